@@ -1,175 +1,379 @@
 package api
 
 import (
-	"database/sql"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/brianvoe/gofakeit/v6"
+	"go-web-service/blob"
+	"go-web-service/money"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// DefaultCurrency is used for new albums that do not specify a currency.
+const DefaultCurrency = "USD"
+
+// Album is a recording. Artist is a copy of the name of the artist with
+// ArtistID, kept for filtering and search. ReviewCount and AverageRating,
+// null without reviews, are kept up to date by the ReviewStore. Tracks and Runtime, the total
+// duration in seconds, are only set when asked for with include=tracks,
+// Genres and Tags with include=genres,tags and Stock with include=stock.
+// DeletedAt is only set on albums in the trash. Version counts the changes to
+// the album and is served as its ETag.
 type Album struct {
-	ID     int64   `json:"id"`
-	Title  string  `json:"title"`
-	Artist string  `json:"artist"`
-	Price  float32 `json:"price"`
+	ID       int64       `json:"id"`
+	Title    string      `json:"title"`
+	Artist   string      `json:"artist"`
+	ArtistID int64       `json:"artist_id"`
+	Price    money.Money `json:"price"`
+	// The release metadata is left out of responses while unknown. Label is
+	// the record label, unrelated to the genre and tag labels.
+	ReleaseDate   Date        `json:"release_date,omitempty"`
+	RecordLabel   string      `json:"label,omitempty"`
+	Format        string      `json:"format,omitempty"`
+	CatalogNumber string      `json:"catalog_number,omitempty"`
+	Barcode       Barcode     `json:"barcode,omitempty"`
+	ReviewCount   int         `json:"review_count"`
+	AverageRating *Rating     `json:"average_rating"`
+	DeletedAt     *time.Time  `json:"deleted_at,omitempty"`
+	Version       int64       `json:"-"`
+	Tracks        []Track     `json:"-"`
+	Runtime       *int        `json:"-"`
+	Genres        []Label     `json:"-"`
+	Tags          []Label     `json:"-"`
+	Stock         *StockLevel `json:"-"`
 }
 
+// MarshalJSON writes the price as a decimal string next to its currency code,
+// followed by the tracks, runtime, genres, tags and stock when they were
+// embedded.
+func (a Album) MarshalJSON() ([]byte, error) {
+	type album Album
+
+	var tracks *[]Track
+	if a.Runtime != nil {
+		embedded := a.Tracks
+		if embedded == nil {
+			embedded = []Track{}
+		}
+		tracks = &embedded
+	}
+
+	var genres, tags *[]Label
+	if a.Genres != nil {
+		genres = &a.Genres
+	}
+	if a.Tags != nil {
+		tags = &a.Tags
+	}
+
+	return json.Marshal(struct {
+		album
+		Currency string      `json:"currency"`
+		Tracks   *[]Track    `json:"tracks,omitempty"`
+		Runtime  *int        `json:"runtime,omitempty"`
+		Genres   *[]Label    `json:"genres,omitempty"`
+		Tags     *[]Label    `json:"tags,omitempty"`
+		Stock    *StockLevel `json:"stock,omitempty"`
+	}{album(a), a.Price.Currency, tracks, a.Runtime, genres, tags, a.Stock})
+}
+
+// Update returns an AlbumUpdate that sets every field of the album.
+func (a Album) Update() AlbumUpdate {
+	return AlbumUpdate{
+		Title:         &a.Title,
+		Artist:        &a.Artist,
+		Price:         &a.Price,
+		ReleaseDate:   &a.ReleaseDate,
+		RecordLabel:   &a.RecordLabel,
+		Format:        &a.Format,
+		CatalogNumber: &a.CatalogNumber,
+		Barcode:       &a.Barcode,
+	}
+}
+
+// Albums holds the handlers and the store of each feature they use.
 type Albums struct {
-	Db *sql.DB
+	Store     AlbumStore
+	Artists   ArtistStore
+	Tracks    TrackStore
+	Labels    LabelStore
+	Covers    CoverStore
+	Inventory InventoryStore
+	Carts     CartStore
+	Orders    OrderStore
+	Customers CustomerStore
+	Wishlists WishlistStore
+	Reviews   ReviewStore
+	Audit     AuditStore
+	// Blobs keeps the cover images.
+	Blobs blob.Store
+	// ShareKey signs wishlist share links, which stop working when it changes.
+	ShareKey []byte
+	// StaffToken is the bearer token staff authenticate with. Nobody can act
+	// as staff when it is empty.
+	StaffToken string
 }
 
-func (a *Albums) GetHandleAlbumRows(rows *sql.Rows) ([]Album, error) {
-	return handleAlbumRows(rows)
+// NewAlbums returns the handlers with every feature kept in store.
+func NewAlbums(store Backend) *Albums {
+	return &Albums{Store: store, Artists: store, Tracks: store, Labels: store, Covers: store, Inventory: store,
+		Carts: store, Orders: store, Customers: store, Wishlists: store, Reviews: store, Audit: store}
 }
 
+// GetAlbums lists albums a page at a time. Query parameters such as
+// price[gte]=10 or artist[in]=a,b filter the albums and sort=-price,title
+// orders them, and genre=jazz&tag=live keeps albums with both labels while
+// tag[in]=live,remastered keeps those with either. facets=artist,price adds
+// counts of the matching albums and include=tracks,genres,tags,stock embeds
+// their tracks, labels and stock.
 func (a *Albums) GetAlbums(w http.ResponseWriter, r *http.Request) {
-	albums, err := a.getAlbumsRows()
+	request, ok := listInput(w, r)
+	if !ok {
+		return
+	}
 
+	albums, err := a.Store.List(r.Context(), request.query())
 	if err != nil {
 		ServeJSONError(w, fmt.Sprintf("GetAlbums %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	ServeJSON(w, albums, http.StatusOK)
+	a.servePage(w, r, request, albums, "GetAlbums")
 }
 
 func (a *Albums) GetAlbumsByArtist(w http.ResponseWriter, r *http.Request) {
 	name := strings.TrimPrefix(r.URL.Path, "/albums/artist/")
-	name = "%" + name + "%"
 
-	stmt, err := a.Db.Prepare(`SELECT * FROM album WHERE artist LIKE ?`)
-	if err != nil {
-		ServeJSONError(w, fmt.Sprintf("GetAlbumsByArtist prepare %v", err), http.StatusInternalServerError)
+	request, ok := listInput(w, r)
+	if !ok {
 		return
 	}
-	defer stmt.Close()
 
-	rows, err := stmt.Query(name)
+	request.Filters = append(request.Filters, Filter{Field: "artist", Operator: OpContains, Values: []any{name}})
+
+	albums, err := a.Store.List(r.Context(), request.query())
 	if err != nil {
 		ServeJSONError(w, fmt.Sprintf("GetAlbumsByArtist %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	albums, err := a.GetHandleAlbumRows(rows)
-	if err != nil {
-		ServeJSONError(w, "failed to get albums by artist", http.StatusInternalServerError)
+	// An empty page past the last cursor is fine, but a search without a match is not
+	if len(albums) == 0 && !request.paged() {
+		ServeJSONError(w, fmt.Sprintf("failed to find an album with provided search: %v", name), http.StatusNotFound)
 		return
 	}
 
-	if len(albums) > 0 {
-		ServeJSON(w, albums, http.StatusOK)
+	a.servePage(w, r, request, albums, "GetAlbumsByArtist")
+}
+
+// servePage serves albums fetched for request in a page envelope, counting
+// the total and facets and embedding what include asked for.
+func (a *Albums) servePage(w http.ResponseWriter, r *http.Request, request listRequest, albums []Album, handler string) {
+	page := request.newPage(albums)
+
+	if err := a.embed(r.Context(), page.Data, request.Include); err != nil {
+		ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
 		return
 	}
 
-	ServeJSONError(w, fmt.Sprintf("failed to find an album with provided search: %v", name), http.StatusNotFound)
-}
+	if request.Total {
+		total, err := a.Store.Count(r.Context(), request.Filters)
+		if err != nil {
+			ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+			return
+		}
 
-func (a *Albums) getAlbumsRows() ([]Album, error) {
-	rows, err := a.Db.Query("SELECT * FROM album")
+		page.Total = &total
+	}
 
-	if err != nil {
-		return nil, fmt.Errorf("handleAlbumRows %v", err)
+	if len(request.Facets) > 0 {
+		facets, err := a.Store.Facets(r.Context(), request.Filters, request.Facets)
+		if err != nil {
+			ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+			return
+		}
+
+		page.Facets = facets
 	}
 
-	return a.GetHandleAlbumRows(rows)
+	ServeJSON(w, page, http.StatusOK)
 }
 
-var handleAlbumRows = func(rows *sql.Rows) ([]Album, error) {
-	// Albums slice to hold db rows
-	var albums []Album
+// includes are the related records include=tracks,genres,tags,stock embeds
+// in albums.
+type includes struct {
+	Tracks bool
+	Genres bool
+	Tags   bool
+	Stock  bool
+}
 
-	defer rows.Close()
+// parseInclude reads an include parameter such as "tracks,tags".
+func parseInclude(include string) (includes, error) {
+	var parsed includes
+	if include == "" {
+		return parsed, nil
+	}
 
-	// Loop rows using Scan to assign to struct fields
-	for rows.Next() {
-		var album Album
-		if err := rows.Scan(&album.ID, &album.Title, &album.Artist, &album.Price); err != nil {
-			return nil, fmt.Errorf("handleAlbumRows %v", err)
+	for _, name := range strings.Split(include, ",") {
+		switch name {
+		case "tracks":
+			parsed.Tracks = true
+		case "genres":
+			parsed.Genres = true
+		case "tags":
+			parsed.Tags = true
+		case "stock":
+			parsed.Stock = true
+		default:
+			return includes{}, fmt.Errorf("unknown include '%v'", name)
 		}
-
-		albums = append(albums, album)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("handleAlbumRows %v", err)
+	return parsed, nil
+}
+
+// embed sets the related records include asks for on each album.
+func (a *Albums) embed(ctx context.Context, albums []Album, include includes) error {
+	if include.Tracks {
+		if err := a.embedTracks(ctx, albums); err != nil {
+			return err
+		}
+	}
+	if include.Genres {
+		if err := a.embedLabels(ctx, LabelGenre, albums); err != nil {
+			return err
+		}
+	}
+	if include.Tags {
+		if err := a.embedLabels(ctx, LabelTag, albums); err != nil {
+			return err
+		}
+	}
+	if include.Stock {
+		if err := a.embedStock(ctx, albums); err != nil {
+			return err
+		}
 	}
 
-	return albums, nil
+	return nil
 }
 
 func (a *Albums) AddAlbum(w http.ResponseWriter, r *http.Request) {
-	parameters := r.URL.Query()
+	input, ok := albumInput(w, r)
+	if !ok {
+		return
+	}
 
-	requiredKeys := []string{"title", "artist", "price"}
-	for _, value := range requiredKeys {
-		if _, ok := parameters[value]; !ok {
-			ServeJSONError(w, fmt.Sprintf("must pass in a '%v'", value), http.StatusBadRequest)
-			return
-		}
+	currency := DefaultCurrency
+	if input.Currency != nil {
+		currency = *input.Currency
 	}
 
-	price, _ := strconv.ParseFloat(parameters.Get("price"), 32)
+	var errs ValidationErrors
+	update := input.update(currency, &errs)
 
-	album := Album{
-		Title:  parameters.Get("title"),
-		Artist: parameters.Get("artist"),
-		Price:  float32(price),
+	if errs = update.Validate(true, errs); len(errs) > 0 {
+		ServeValidationErrors(w, errs)
+		return
 	}
 
-	stmt, err := a.Db.Prepare(`INSERT INTO album (title, artist, price) VALUES (?, ?, ?)`)
-	if err != nil {
-		ServeJSONError(w, fmt.Sprintf("AddAlbum prepare %v", err), http.StatusInternalServerError)
-		return
+	album := Album{Title: *update.Title, Price: *update.Price}
+	if update.ArtistID != nil {
+		album.ArtistID = *update.ArtistID
+	} else {
+		album.Artist = *update.Artist
 	}
+	update.metadata(&album)
 
-	result, err := stmt.Exec(album.Title, album.Artist, album.Price)
-	if err != nil {
-		ServeJSONError(w, fmt.Sprintf("AddAlbum: %v", err), http.StatusInternalServerError)
+	album, err := a.Store.Create(r.Context(), album)
+	if errors.Is(err, ErrArtistNotFound) {
+		serveUnknownArtist(w)
+		return
+	}
+	if errors.Is(err, ErrBarcodeExists) {
+		ServeJSONError(w, err.Error(), http.StatusConflict)
 		return
 	}
-
-	lastId, err := result.LastInsertId()
 	if err != nil {
-		ServeJSONError(w, "failed to create album", http.StatusBadRequest)
-	} else {
-		album.ID = lastId
-		ServeJSON(w, album, http.StatusOK)
+		ServeJSONError(w, fmt.Sprintf("AddAlbum %v", err), http.StatusInternalServerError)
+		return
 	}
+
+	ServeJSON(w, album, http.StatusOK)
 }
 
+// GetAlbumByID serves an album, with its tracks when asked for with include=tracks.
+// Without an include the album is served with its ETag, and If-None-Match is
+// answered with 304 Not Modified while the album is unchanged.
 func (a *Albums) GetAlbumByID(w http.ResponseWriter, r *http.Request) {
-	id := strings.TrimPrefix(r.URL.Path, "/albums/")
-
-	stmt, err := a.Db.Prepare(`SELECT * FROM album WHERE id = ?`)
-	if err != nil {
-		ServeJSONError(w, fmt.Sprintf("GetAlbumsByArtist prepare %v", err), http.StatusInternalServerError)
+	id, ok := albumID(w, r, "/albums/")
+	if !ok {
 		return
 	}
-	defer stmt.Close()
 
-	rows, err := stmt.Query(id)
+	include, err := parseInclude(r.URL.Query().Get("include"))
 	if err != nil {
-		ServeJSONError(w, fmt.Sprintf("GetAlbumsByArtist %v", err), http.StatusInternalServerError)
+		ServeJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	albums, err := a.GetHandleAlbumRows(rows)
+	album, err := a.Store.Get(r.Context(), id)
+	if errors.Is(err, ErrAlbumNotFound) {
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		ServeJSONError(w, "failed to get album by id", http.StatusInternalServerError)
+		ServeJSONError(w, fmt.Sprintf("GetAlbumByID %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	if len(albums) == 0 {
-		ServeJSONError(w, "album not found", http.StatusNotFound)
-	} else {
-		ServeJSON(w, albums, http.StatusOK)
+	// The ETag only covers the album, not what an include embeds in it
+	if include == (includes{}) {
+		etag := albumETag(album)
+		w.Header().Set("ETag", etag)
+		if header := r.Header.Get("If-None-Match"); header != "" && matchETag(header, etag, true) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
 	}
+
+	albums := []Album{album}
+	if err := a.embed(r.Context(), albums, include); err != nil {
+		ServeJSONError(w, fmt.Sprintf("GetAlbumByID %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	ServeJSON(w, albums, http.StatusOK)
 }
 
+// DeleteAlbum moves an album to the trash, from which it can be restored
+// until PurgeTrash deletes it for good.
 func (a *Albums) DeleteAlbum(w http.ResponseWriter, r *http.Request) {
-	_, err := a.Db.Exec("DELETE FROM album WHERE id = ? LIMIT 1", strings.TrimPrefix(r.URL.Path, "/albums/"))
+	id, ok := albumID(w, r, "/albums/")
+	if !ok {
+		return
+	}
+
+	version, ok := a.ifMatch(w, r, id)
+	if !ok {
+		return
+	}
+
+	err := a.Store.Trash(r.Context(), id, version, time.Now().UTC().Truncate(time.Second))
+	if errors.Is(err, ErrAlbumNotFound) {
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrVersionMismatch) {
+		servePreconditionFailed(w)
+		return
+	}
 	if err != nil {
 		ServeJSONError(w, "could not delete album", http.StatusInternalServerError)
 		return
@@ -178,81 +382,257 @@ func (a *Albums) DeleteAlbum(w http.ResponseWriter, r *http.Request) {
 	ServeJSON(w, map[string]any{"message": "album successfully removed"}, http.StatusOK)
 }
 
+// UpdateAlbum applies a partial update. With If-Match it only applies while
+// the album is at that ETag, and answers 412 Precondition Failed otherwise.
 func (a *Albums) UpdateAlbum(w http.ResponseWriter, r *http.Request) {
-	parameters := r.URL.Query()
-	id := strings.TrimPrefix(r.URL.Path, "/albums/")
-
-	var keys []string
-	var values []any
+	id, ok := albumID(w, r, "/albums/")
+	if !ok {
+		return
+	}
 
-	if title, ok := parameters["title"]; ok {
-		keys = append(keys, "title")
-		values = append(values, title[0])
+	input, ok := albumInput(w, r)
+	if !ok {
+		return
 	}
-	if artist, ok := parameters["artist"]; ok {
-		keys = append(keys, "artist")
-		values = append(values, artist[0])
+
+	if input.Title == nil && input.Artist == nil && input.ArtistID == nil && input.Price == nil && input.Currency == nil && input.emptyMetadata() {
+		ServeJSONError(w, "must pass in a 'title', 'artist', 'artist_id', 'price' or release metadata field", http.StatusBadRequest)
+		return
 	}
-	if price, ok := parameters["price"]; ok {
-		keys = append(keys, "price")
-		values = append(values, price[0])
+
+	version, ok := a.ifMatch(w, r, id)
+	if !ok {
+		return
 	}
 
-	dynamicSql := `UPDATE album SET `
-	for i, key := range keys {
-		dynamicSql += key + ` = ?`
-		if i < len(keys)-1 {
-			dynamicSql += `, `
+	// A new price without a currency is in the album's current currency
+	var currency string
+	if input.Currency != nil {
+		currency = *input.Currency
+	} else if input.Price != nil {
+		album, err := a.Store.Get(r.Context(), id)
+		if errors.Is(err, ErrAlbumNotFound) {
+			ServeJSONError(w, "album not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			ServeJSONError(w, fmt.Sprintf("UpdateAlbum %v", err), http.StatusInternalServerError)
+			return
 		}
+
+		currency = album.Price.Currency
 	}
-	dynamicSql += ` WHERE id = ?`
-	values = append(values, id)
 
-	stmt, err := a.Db.Prepare(dynamicSql)
-	if err != nil {
-		ServeJSONError(w, fmt.Sprintf("UpdateAlbum prepare %v", err), http.StatusInternalServerError)
+	var errs ValidationErrors
+	update := input.update(currency, &errs)
+	update.Version = version
+
+	if errs = update.Validate(false, errs); len(errs) > 0 {
+		ServeValidationErrors(w, errs)
 		return
 	}
-	defer stmt.Close()
 
-	_, err = stmt.Exec(values...)
+	err := a.Store.Update(r.Context(), id, update)
+	if errors.Is(err, ErrArtistNotFound) {
+		serveUnknownArtist(w)
+		return
+	}
+	if errors.Is(err, ErrAlbumNotFound) {
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrVersionMismatch) {
+		servePreconditionFailed(w)
+		return
+	}
+	if errors.Is(err, ErrBarcodeExists) {
+		ServeJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
-		ServeJSONError(w, "could not update album", http.StatusBadRequest)
+		ServeJSONError(w, fmt.Sprintf("UpdateAlbum %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	// The update was made against the version If-Match named, so the album
+	// is now at the next one
+	if version != 0 {
+		w.Header().Set("ETag", albumETag(Album{Version: version + 1}))
+	}
+
 	ServeJSON(w, map[string]any{"message": "album successfully updated"}, http.StatusOK)
 }
 
 func (a *Albums) AddRandom(w http.ResponseWriter, r *http.Request) {
-	name := gofakeit.Name()
-	title := gofakeit.Slogan()
-	price := gofakeit.Float32Range(1, 100)
-
 	album := Album{
-		Title:  title,
-		Artist: name,
-		Price:  price,
+		Title:  gofakeit.Slogan(),
+		Artist: gofakeit.Name(),
+		Price:  money.New(int64(gofakeit.IntRange(100, 10000)), DefaultCurrency),
 	}
 
-	stmt, err := a.Db.Prepare(`INSERT INTO album (title, artist, price) VALUES (?, ?, ?)`)
-	if err != nil {
-		ServeJSONError(w, fmt.Sprintf("UpdateAlbum prepare %v", err), http.StatusInternalServerError)
+	if errs := album.Update().Validate(true, nil); len(errs) > 0 {
+		ServeJSONError(w, fmt.Sprintf("failed to create random album: %v", errs), http.StatusInternalServerError)
 		return
 	}
-	defer stmt.Close()
 
-	result, err := stmt.Exec(album.Title, album.Artist, album.Price)
+	album, err := a.Store.Create(r.Context(), album)
 	if err != nil {
 		ServeJSONError(w, "failed to create random album", http.StatusInternalServerError)
 		return
 	}
 
-	lastId, err := result.LastInsertId()
+	ServeJSON(w, album, http.StatusOK)
+}
+
+// serveUnknownArtist reports an artist_id that matches no artist.
+func serveUnknownArtist(w http.ResponseWriter) {
+	var errs ValidationErrors
+	errs.Add("artist_id", "does not match an artist")
+	ServeValidationErrors(w, errs)
+}
+
+// albumRequest holds the album fields sent with a create or update request.
+type albumRequest struct {
+	Title    *string  `json:"title"`
+	Artist   *string  `json:"artist"`
+	ArtistID *int64   `json:"artist_id"`
+	Price    *decimal `json:"price"`
+	Currency *string  `json:"currency"`
+	// An empty release metadata field clears it.
+	ReleaseDate   *string `json:"release_date"`
+	RecordLabel   *string `json:"label"`
+	Format        *string `json:"format"`
+	CatalogNumber *string `json:"catalog_number"`
+	Barcode       *string `json:"barcode"`
+}
+
+// emptyMetadata reports whether the request leaves every release metadata field out.
+func (in albumRequest) emptyMetadata() bool {
+	return in.ReleaseDate == nil && in.RecordLabel == nil && in.Format == nil && in.CatalogNumber == nil && in.Barcode == nil
+}
+
+// update turns the request into an AlbumUpdate, reading the price in
+// currency. Values that cannot be read are added to errs.
+func (in albumRequest) update(currency string, errs *ValidationErrors) AlbumUpdate {
+	update := AlbumUpdate{Title: in.Title, Artist: in.Artist, ArtistID: in.ArtistID, RecordLabel: in.RecordLabel, CatalogNumber: in.CatalogNumber}
+
+	if in.ReleaseDate != nil {
+		date, err := ParseDate(*in.ReleaseDate)
+		if *in.ReleaseDate != "" && err != nil {
+			errs.Add("release_date", "must be a date such as 2006-01-02")
+		} else {
+			update.ReleaseDate = &date
+		}
+	}
+
+	if in.Format != nil {
+		format := strings.ToLower(strings.TrimSpace(*in.Format))
+		update.Format = &format
+	}
+
+	if in.Barcode != nil {
+		var barcode Barcode
+		var err error
+		if *in.Barcode != "" {
+			barcode, err = ParseBarcode(*in.Barcode)
+		}
+		if err != nil {
+			errs.Add("barcode", err.Error())
+		} else {
+			update.Barcode = &barcode
+		}
+	}
+
+	if in.Price == nil {
+		if in.Currency != nil {
+			errs.Add("price", "is required when changing the currency")
+		}
+
+		return update
+	}
+
+	price, err := money.Parse(string(*in.Price), currency)
+	switch {
+	case errors.Is(err, money.ErrCurrency):
+		errs.Add("currency", "must be a supported ISO 4217 currency code")
+	case errors.Is(err, money.ErrPrecision):
+		exponent, _ := money.Exponent(currency)
+		errs.Add("price", fmt.Sprintf("must not have more than %d decimal places", exponent))
+	case errors.Is(err, money.ErrRange):
+		errs.Add("price", "must not be more than "+maxPrice)
+	case err != nil:
+		errs.Add("price", "must be a number")
+	default:
+		update.Price = &price
+	}
+
+	return update
+}
+
+// decimal is a number sent as either a JSON number or a JSON string. It is
+// kept as text so it can be read exactly once its currency is known; any
+// other JSON value is kept too and later reported as a field error.
+type decimal string
+
+func (d *decimal) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		text = string(data)
+	}
+
+	*d = decimal(text)
+
+	return nil
+}
+
+// albumInput reads the album fields sent with a create or update request.
+// JSON bodies are preferred; requests without a Content-Type fall back to the
+// query string that older clients use. It writes an error response and
+// returns false when the input cannot be read.
+func albumInput(w http.ResponseWriter, r *http.Request) (albumRequest, bool) {
+	var input albumRequest
+
+	if isJSON(r) {
+		if err := decodeJSON(w, r, &input); err != nil {
+			ServeJSONError(w, err.Error(), http.StatusBadRequest)
+			return input, false
+		}
+
+		return input, true
+	}
+
+	if r.Header.Get("Content-Type") != "" {
+		ServeJSONError(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return input, false
+	}
+
+	parameters := r.URL.Query()
+
+	if title, ok := parameters["title"]; ok {
+		input.Title = &title[0]
+	}
+	if artist, ok := parameters["artist"]; ok {
+		input.Artist = &artist[0]
+	}
+	if price, ok := parameters["price"]; ok {
+		value := decimal(price[0])
+		input.Price = &value
+	}
+	if currency, ok := parameters["currency"]; ok {
+		input.Currency = &currency[0]
+	}
+
+	return input, true
+}
+
+// albumID parses the album id that follows prefix in the request path. It
+// writes a 400 response and returns false when the id is not a number.
+func albumID(w http.ResponseWriter, r *http.Request, prefix string) (int64, bool) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, prefix), 10, 64)
 	if err != nil {
-		ServeJSON(w, map[string]any{"errors": "failed to create random album"}, http.StatusInternalServerError)
-	} else {
-		album.ID = lastId
-		ServeJSON(w, album, http.StatusOK)
+		ServeJSONError(w, "invalid album id", http.StatusBadRequest)
+		return 0, false
 	}
+
+	return id, true
 }
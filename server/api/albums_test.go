@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"go-web-service/money"
 )
 
 func getMockDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
@@ -32,16 +34,46 @@ func sendMockHTTPRequest(t *testing.T, handler http.HandlerFunc, method, url str
 	return rr
 }
 
+// expectArtistLookup expects the query that finds the artist an album names.
+func expectArtistLookup(mock sqlmock.Sqlmock, key any, id int64, name string) {
+	mock.ExpectQuery(`SELECT id, name, bio FROM artist WHERE name_key = (\?|\$1)`).
+		WithArgs(key).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "bio"}).AddRow(id, name, ""))
+}
+
+// expectAlbumLock expects the query that reads and locks the album with id
+// inside a write to it, for its audit entry.
+func expectAlbumLock(mock sqlmock.Sqlmock, id int64, title, artist, price string) {
+	mock.ExpectQuery(`SELECT id, title, .+ FROM album WHERE id = (\?|\$1)`).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "artist", "artist_id", "currency", "price", "release_date", "label", "format", "catalog_number", "barcode", "review_count", "average_rating", "version"}).
+			AddRow(id, title, artist, 1, "USD", price, nil, "", "", "", nil, 0, 0, 1))
+}
+
+// expectAudit expects the audit entry of an anonymous write to the album
+// with id.
+func expectAudit(mock sqlmock.Sqlmock, id int64, action AuditAction, changes any) {
+	mock.ExpectExec(`INSERT INTO album_audit \(album_id, action, actor, request_id, changes, created_at\) VALUES`).
+		WithArgs(id, string(action), "anonymous", "", changes, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+// The handlers below reach the database through the store, so a failed
+// store call is served as a 500 naming the handler and the store's error,
+// whichever step of the query failed.
 func TestGetAlbums(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	rows := sqlmock.NewRows([]string{"id", "title", "artist", "price"}).
-		AddRow(1, "Album1", "Artist1", 10.99).
-		AddRow(2, "Album2", "Artist2", 12.99)
-	mock.ExpectQuery("SELECT \\* FROM album").WillReturnRows(rows)
+	rows := sqlmock.NewRows([]string{"id", "title", "artist", "artist_id", "currency", "price", "release_date", "label", "format", "catalog_number", "barcode", "review_count", "average_rating", "version"}).
+		AddRow(1, "Album1", "Artist1", 1, "USD", "10.99", nil, "", "", "", nil, 0, 0, 1).
+		AddRow(2, "Album2", "Artist2", 2, "USD", "12.99", nil, "", "", "", nil, 0, 0, 1)
+	mock.ExpectPrepare(`SELECT id, title, artist, artist_id, currency, price, release_date, label, format, catalog_number, barcode, review_count, average_rating, version FROM album WHERE deleted_at IS NULL ORDER BY id LIMIT \?`).
+		ExpectQuery().
+		WithArgs(defaultPageLimit + 1).
+		WillReturnRows(rows)
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	rr := sendMockHTTPRequest(t, albums.GetAlbums, http.MethodGet, "/albums")
 
@@ -49,7 +81,7 @@ func TestGetAlbums(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	expected := `[{"id":1,"title":"Album1","artist":"Artist1","price":10.99},{"id":2,"title":"Album2","artist":"Artist2","price":12.99}]`
+	expected := `{"data":[{"id":1,"title":"Album1","artist":"Artist1","artist_id":1,"price":"10.99","review_count":0,"average_rating":null,"currency":"USD"},{"id":2,"title":"Album2","artist":"Artist2","artist_id":2,"price":"12.99","review_count":0,"average_rating":null,"currency":"USD"}],"next":null,"prev":null}`
 	actual := strings.TrimSpace(rr.Body.String())
 	if actual != expected {
 		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
@@ -64,9 +96,11 @@ func TestGetAlbums_Error(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	mock.ExpectQuery("SELECT \\* FROM album").WillReturnError(fmt.Errorf("query error"))
+	mock.ExpectPrepare(`SELECT id, title, artist, artist_id, currency, price, release_date, label, format, catalog_number, barcode, review_count, average_rating, version FROM album WHERE deleted_at IS NULL ORDER BY id LIMIT \?`).
+		ExpectQuery().
+		WillReturnError(fmt.Errorf("query error"))
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	rr := sendMockHTTPRequest(t, albums.GetAlbums, http.MethodGet, "/albums")
 
@@ -74,7 +108,7 @@ func TestGetAlbums_Error(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
 	}
 
-	expected := `{"errors":"GetAlbums handleAlbumRows query error"}`
+	expected := `{"errors":"GetAlbums query error"}`
 	actual := strings.TrimSpace(rr.Body.String())
 	if actual != expected {
 		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
@@ -89,14 +123,14 @@ func TestGetAlbumsByArtist(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	mock.ExpectPrepare(`SELECT \* FROM album WHERE artist LIKE \?`).
+	mock.ExpectPrepare(`SELECT id, title, artist, artist_id, currency, price, release_date, label, format, catalog_number, barcode, review_count, average_rating, version FROM album WHERE deleted_at IS NULL AND artist LIKE \? ESCAPE '!' ORDER BY id LIMIT \?`).
 		ExpectQuery().
-		WithArgs("%Artist1%").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "artist", "price"}).
-			AddRow(1, "Album1", "Artist1", 10.99).
-			AddRow(2, "Album2", "Artist2", 12.99))
+		WithArgs("%Artist1%", defaultPageLimit+1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "artist", "artist_id", "currency", "price", "release_date", "label", "format", "catalog_number", "barcode", "review_count", "average_rating", "version"}).
+			AddRow(1, "Album1", "Artist1", 1, "USD", "10.99", nil, "", "", "", nil, 0, 0, 1).
+			AddRow(2, "Album2", "Artist2", 2, "USD", "12.99", nil, "", "", "", nil, 0, 0, 1))
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	rr := sendMockHTTPRequest(t, albums.GetAlbumsByArtist, http.MethodGet, "/albums/artist/Artist1")
 
@@ -104,7 +138,7 @@ func TestGetAlbumsByArtist(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	expected := `[{"id":1,"title":"Album1","artist":"Artist1","price":10.99},{"id":2,"title":"Album2","artist":"Artist2","price":12.99}]`
+	expected := `{"data":[{"id":1,"title":"Album1","artist":"Artist1","artist_id":1,"price":"10.99","review_count":0,"average_rating":null,"currency":"USD"},{"id":2,"title":"Album2","artist":"Artist2","artist_id":2,"price":"12.99","review_count":0,"average_rating":null,"currency":"USD"}],"next":null,"prev":null}`
 	actual := strings.TrimSpace(rr.Body.String())
 	if actual != expected {
 		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
@@ -119,14 +153,14 @@ func TestGetAlbumsByArtist_HandleAlbumRowsError(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	mock.ExpectPrepare(`SELECT \* FROM album WHERE artist LIKE \?`).
+	mock.ExpectPrepare(`SELECT id, title, artist, artist_id, currency, price, release_date, label, format, catalog_number, barcode, review_count, average_rating, version FROM album WHERE deleted_at IS NULL AND artist LIKE \? ESCAPE '!' ORDER BY id LIMIT \?`).
 		ExpectQuery().
-		WithArgs("%Artist1%").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "artist", "price"}).
-			AddRow(1, "Album1", "Artist1", 10.99).
-			AddRow(2, "Album2", "Artist2", 12.99))
+		WithArgs("%Artist1%", defaultPageLimit+1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "artist", "artist_id", "currency", "price", "release_date", "label", "format", "catalog_number", "barcode", "review_count", "average_rating", "version"}).
+			AddRow(1, "Album1", "Artist1", 1, "USD", "10.99", nil, "", "", "", nil, 0, 0, 1).
+			AddRow(2, "Album2", "Artist2", 2, "USD", "12.99", nil, "", "", "", nil, 0, 0, 1))
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	// Mock the handleAlbumRows function to return an error
 	originalHandleAlbumRows := handleAlbumRows
@@ -142,7 +176,7 @@ func TestGetAlbumsByArtist_HandleAlbumRowsError(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
 	}
 
-	expected := `{"errors":"failed to get albums by artist"}`
+	expected := `{"errors":"GetAlbumsByArtist mocked error"}`
 	actual := strings.TrimSpace(rr.Body.String())
 	if actual != expected {
 		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
@@ -157,9 +191,9 @@ func TestGetAlbumsByArtist_PrepareError(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	mock.ExpectPrepare(`SELECT \* FROM album WHERE artist LIKE \?`).WillReturnError(fmt.Errorf("prepare error"))
+	mock.ExpectPrepare(`SELECT id, title, artist, artist_id, currency, price, release_date, label, format, catalog_number, barcode, review_count, average_rating, version FROM album WHERE deleted_at IS NULL AND artist LIKE \? ESCAPE '!' ORDER BY id LIMIT \?`).WillReturnError(fmt.Errorf("prepare error"))
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	rr := sendMockHTTPRequest(t, albums.GetAlbumsByArtist, http.MethodGet, "/albums/artist/Artist1")
 
@@ -182,12 +216,12 @@ func TestGetAlbumsByArtist_QueryError(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	mock.ExpectPrepare(`SELECT \* FROM album WHERE artist LIKE \?`).
+	mock.ExpectPrepare(`SELECT id, title, artist, artist_id, currency, price, release_date, label, format, catalog_number, barcode, review_count, average_rating, version FROM album WHERE deleted_at IS NULL AND artist LIKE \? ESCAPE '!' ORDER BY id LIMIT \?`).
 		ExpectQuery().
-		WithArgs("%Artist1%").
+		WithArgs("%Artist1%", defaultPageLimit+1).
 		WillReturnError(fmt.Errorf("query error"))
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	rr := sendMockHTTPRequest(t, albums.GetAlbumsByArtist, http.MethodGet, "/albums/artist/Artist1")
 
@@ -210,12 +244,12 @@ func TestGetAlbumsByArtist_NoAlbumsFound(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	mock.ExpectPrepare(`SELECT \* FROM album WHERE artist LIKE \?`).
+	mock.ExpectPrepare(`SELECT id, title, artist, artist_id, currency, price, release_date, label, format, catalog_number, barcode, review_count, average_rating, version FROM album WHERE deleted_at IS NULL AND artist LIKE \? ESCAPE '!' ORDER BY id LIMIT \?`).
 		ExpectQuery().
-		WithArgs("%NonExistentArtist%").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "artist", "price"}))
+		WithArgs("%NonExistentArtist%", defaultPageLimit+1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "artist", "artist_id", "currency", "price", "release_date", "label", "format", "catalog_number", "barcode", "review_count", "average_rating", "version"}))
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	rr := sendMockHTTPRequest(t, albums.GetAlbumsByArtist, http.MethodGet, "/albums/artist/NonExistentArtist")
 
@@ -223,7 +257,7 @@ func TestGetAlbumsByArtist_NoAlbumsFound(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
 	}
 
-	expected := `{"errors":"failed to find an album with provided search: %NonExistentArtist%"}`
+	expected := `{"errors":"failed to find an album with provided search: NonExistentArtist"}`
 	actual := strings.TrimSpace(rr.Body.String())
 	if actual != expected {
 		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
@@ -238,12 +272,16 @@ func TestAddAlbum(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	mock.ExpectPrepare("INSERT INTO album \\(title, artist, price\\) VALUES \\(\\?, \\?, \\?\\)").
+	mock.ExpectBegin()
+	expectArtistLookup(mock, "artist1", 1, "Artist1")
+	mock.ExpectPrepare("INSERT INTO album \\(title, artist, artist_id, price, currency, release_date, label, format, catalog_number, barcode\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)").
 		ExpectExec().
-		WithArgs("Album1", "Artist1", 10.00).
+		WithArgs("Album1", "Artist1", 1, "10.00", "USD", nil, "", "", "", nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectAudit(mock, 1, AuditCreate, `{"artist":{"before":null,"after":"Artist1"},"artist_id":{"before":null,"after":1},"currency":{"before":null,"after":"USD"},"price":{"before":null,"after":"10.00"},"title":{"before":null,"after":"Album1"}}`)
+	mock.ExpectCommit()
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	rr := sendMockHTTPRequest(t, albums.AddAlbum, http.MethodPut, "/albums?title=Album1&artist=Artist1&price=10")
 
@@ -251,7 +289,7 @@ func TestAddAlbum(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	expected := `{"id":1,"title":"Album1","artist":"Artist1","price":10}`
+	expected := `{"id":1,"title":"Album1","artist":"Artist1","artist_id":1,"price":"10.00","review_count":0,"average_rating":null,"currency":"USD"}`
 	actual := strings.TrimSpace(rr.Body.String())
 	if actual != expected {
 		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
@@ -266,15 +304,15 @@ func TestAddAlbum_MissingParameters(t *testing.T) {
 	db, _ := getMockDB(t)
 	defer db.Close()
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	rr := sendMockHTTPRequest(t, albums.AddAlbum, http.MethodPut, "/albums?title=Album1&artist=Artist1")
 
-	if status := rr.Code; status != http.StatusBadRequest {
-		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
 	}
 
-	expected := `{"errors":"must pass in a 'price'"}`
+	expected := `{"errors":["'price' is required"],"fields":{"price":["is required"]}}`
 	actual := strings.TrimSpace(rr.Body.String())
 	if actual != expected {
 		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
@@ -285,10 +323,13 @@ func TestAddAlbum_PrepareError(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	mock.ExpectPrepare("INSERT INTO album \\(title, artist, price\\) VALUES \\(\\?, \\?, \\?\\)").
+	mock.ExpectBegin()
+	expectArtistLookup(mock, "artist1", 1, "Artist1")
+	mock.ExpectPrepare("INSERT INTO album \\(title, artist, artist_id, price, currency, release_date, label, format, catalog_number, barcode\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)").
 		WillReturnError(fmt.Errorf("prepare error"))
+	mock.ExpectRollback()
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	rr := sendMockHTTPRequest(t, albums.AddAlbum, http.MethodPut, "/albums?title=Album1&artist=Artist1&price=10.99")
 
@@ -311,12 +352,15 @@ func TestAddAlbum_InsertError(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	mock.ExpectPrepare("INSERT INTO album \\(title, artist, price\\) VALUES \\(\\?, \\?, \\?\\)").
+	mock.ExpectBegin()
+	expectArtistLookup(mock, "artist1", 1, "Artist1")
+	mock.ExpectPrepare("INSERT INTO album \\(title, artist, artist_id, price, currency, release_date, label, format, catalog_number, barcode\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)").
 		ExpectExec().
-		WithArgs("Album1", "Artist1", 10.00).
+		WithArgs("Album1", "Artist1", 1, "10.00", "USD", nil, "", "", "", nil).
 		WillReturnError(fmt.Errorf("insert error"))
+	mock.ExpectRollback()
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	rr := sendMockHTTPRequest(t, albums.AddAlbum, http.MethodPut, "/albums?title=Album1&artist=Artist1&price=10")
 
@@ -324,7 +368,7 @@ func TestAddAlbum_InsertError(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
 	}
 
-	expected := `{"errors":"AddAlbum: insert error"}`
+	expected := `{"errors":"AddAlbum insert error"}`
 	actual := strings.TrimSpace(rr.Body.String())
 	if actual != expected {
 		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
@@ -339,20 +383,23 @@ func TestAddAlbum_LastInsertIdError(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	mock.ExpectPrepare("INSERT INTO album \\(title, artist, price\\) VALUES \\(\\?, \\?, \\?\\)").
+	mock.ExpectBegin()
+	expectArtistLookup(mock, "artist1", 1, "Artist1")
+	mock.ExpectPrepare("INSERT INTO album \\(title, artist, artist_id, price, currency, release_date, label, format, catalog_number, barcode\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)").
 		ExpectExec().
-		WithArgs("Album1", "Artist1", 10.00).
+		WithArgs("Album1", "Artist1", 1, "10.00", "USD", nil, "", "", "", nil).
 		WillReturnResult(sqlmock.NewErrorResult(fmt.Errorf("last insert id error")))
+	mock.ExpectRollback()
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	rr := sendMockHTTPRequest(t, albums.AddAlbum, http.MethodPut, "/albums?title=Album1&artist=Artist1&price=10")
 
-	if status := rr.Code; status != http.StatusBadRequest {
-		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	if status := rr.Code; status != http.StatusInternalServerError {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
 	}
 
-	expected := `{"errors":"failed to create album"}`
+	expected := `{"errors":"AddAlbum last insert id error"}`
 	actual := strings.TrimSpace(rr.Body.String())
 	if actual != expected {
 		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
@@ -367,13 +414,13 @@ func TestGetAlbumByID(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	mock.ExpectPrepare(`SELECT \* FROM album WHERE id = \?`).
+	mock.ExpectPrepare(`SELECT id, title, artist, artist_id, currency, price, release_date, label, format, catalog_number, barcode, review_count, average_rating, version FROM album WHERE id = \? AND deleted_at IS NULL`).
 		ExpectQuery().
-		WithArgs("1").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "artist", "price"}).
-			AddRow(1, "Album1", "Artist1", 10.99))
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "artist", "artist_id", "currency", "price", "release_date", "label", "format", "catalog_number", "barcode", "review_count", "average_rating", "version"}).
+			AddRow(1, "Album1", "Artist1", 1, "USD", "10.99", nil, "", "", "", nil, 0, 0, 1))
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	rr := sendMockHTTPRequest(t, albums.GetAlbumByID, http.MethodGet, "/albums/1")
 
@@ -381,7 +428,7 @@ func TestGetAlbumByID(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	expected := `[{"id":1,"title":"Album1","artist":"Artist1","price":10.99}]`
+	expected := `[{"id":1,"title":"Album1","artist":"Artist1","artist_id":1,"price":"10.99","review_count":0,"average_rating":null,"currency":"USD"}]`
 	actual := strings.TrimSpace(rr.Body.String())
 	if actual != expected {
 		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
@@ -396,13 +443,13 @@ func TestGetAlbumByID_HandleAlbumRowsError(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	mock.ExpectPrepare(`SELECT \* FROM album WHERE id = \?`).
+	mock.ExpectPrepare(`SELECT id, title, artist, artist_id, currency, price, release_date, label, format, catalog_number, barcode, review_count, average_rating, version FROM album WHERE id = \? AND deleted_at IS NULL`).
 		ExpectQuery().
-		WithArgs("1").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "artist", "price"}).
-			AddRow(1, "Album1", "Artist1", 10.99))
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "artist", "artist_id", "currency", "price", "release_date", "label", "format", "catalog_number", "barcode", "review_count", "average_rating", "version"}).
+			AddRow(1, "Album1", "Artist1", 1, "USD", "10.99", nil, "", "", "", nil, 0, 0, 1))
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	// Mock the handleAlbumRows function to return an error
 	originalHandleAlbumRows := handleAlbumRows
@@ -418,7 +465,7 @@ func TestGetAlbumByID_HandleAlbumRowsError(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
 	}
 
-	expected := `{"errors":"failed to get album by id"}`
+	expected := `{"errors":"GetAlbumByID mocked error"}`
 	actual := strings.TrimSpace(rr.Body.String())
 	if actual != expected {
 		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
@@ -433,10 +480,10 @@ func TestGetAlbumByID_Errors(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	// Prepare error case
-	mock.ExpectPrepare(`SELECT \* FROM album WHERE id = \?`).WillReturnError(fmt.Errorf("prepare error"))
+	mock.ExpectPrepare(`SELECT id, title, artist, artist_id, currency, price, release_date, label, format, catalog_number, barcode, review_count, average_rating, version FROM album WHERE id = \? AND deleted_at IS NULL`).WillReturnError(fmt.Errorf("prepare error"))
 
 	rr := sendMockHTTPRequest(t, albums.GetAlbumByID, http.MethodGet, "/albums/1")
 
@@ -444,7 +491,7 @@ func TestGetAlbumByID_Errors(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
 	}
 
-	expected := `{"errors":"GetAlbumsByArtist prepare prepare error"}`
+	expected := `{"errors":"GetAlbumByID prepare prepare error"}`
 	actual := strings.TrimSpace(rr.Body.String())
 	if actual != expected {
 		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
@@ -455,9 +502,9 @@ func TestGetAlbumByID_Errors(t *testing.T) {
 	}
 
 	// Query error case
-	mock.ExpectPrepare(`SELECT \* FROM album WHERE id = \?`).
+	mock.ExpectPrepare(`SELECT id, title, artist, artist_id, currency, price, release_date, label, format, catalog_number, barcode, review_count, average_rating, version FROM album WHERE id = \? AND deleted_at IS NULL`).
 		ExpectQuery().
-		WithArgs("1").
+		WithArgs(1).
 		WillReturnError(fmt.Errorf("query error"))
 
 	rr = sendMockHTTPRequest(t, albums.GetAlbumByID, http.MethodGet, "/albums/1")
@@ -466,7 +513,7 @@ func TestGetAlbumByID_Errors(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
 	}
 
-	expected = `{"errors":"GetAlbumsByArtist query error"}`
+	expected = `{"errors":"GetAlbumByID query error"}`
 	actual = strings.TrimSpace(rr.Body.String())
 	if actual != expected {
 		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
@@ -477,10 +524,10 @@ func TestGetAlbumByID_Errors(t *testing.T) {
 	}
 
 	// No albums found case
-	mock.ExpectPrepare(`SELECT \* FROM album WHERE id = \?`).
+	mock.ExpectPrepare(`SELECT id, title, artist, artist_id, currency, price, release_date, label, format, catalog_number, barcode, review_count, average_rating, version FROM album WHERE id = \? AND deleted_at IS NULL`).
 		ExpectQuery().
-		WithArgs("999").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "artist", "price"}))
+		WithArgs(999).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "artist", "artist_id", "currency", "price", "release_date", "label", "format", "catalog_number", "barcode", "review_count", "average_rating", "version"}))
 
 	rr = sendMockHTTPRequest(t, albums.GetAlbumByID, http.MethodGet, "/albums/999")
 
@@ -503,11 +550,18 @@ func TestDeleteAlbum(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	mock.ExpectExec("DELETE FROM album WHERE id = \\? LIMIT 1").
-		WithArgs("1").
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE album SET deleted_at = \\? WHERE id = \\? AND deleted_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAlbumLock(mock, 1, "Album1", "Artist1", "10.99")
+	expectAudit(mock, 1, AuditDelete, sqlmock.AnyArg())
+	mock.ExpectExec("DELETE FROM cart_item WHERE album_id = \\?").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	rr := sendMockHTTPRequest(t, albums.DeleteAlbum, http.MethodDelete, "/albums/1")
 
@@ -530,12 +584,14 @@ func TestDeleteAlbum_Errors(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	// Exec error case
-	mock.ExpectExec("DELETE FROM album WHERE id = \\? LIMIT 1").
-		WithArgs("1").
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE album SET deleted_at = \\? WHERE id = \\? AND deleted_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), 1).
 		WillReturnError(fmt.Errorf("exec error"))
+	mock.ExpectRollback()
 
 	rr := sendMockHTTPRequest(t, albums.DeleteAlbum, http.MethodDelete, "/albums/1")
 
@@ -558,14 +614,19 @@ func TestUpdateAlbum(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	mock.ExpectPrepare("UPDATE album SET title = \\?, artist = \\?, price = \\? WHERE id = \\?").
+	mock.ExpectBegin()
+	expectAlbumLock(mock, 1, "Album1", "Artist1", "10.99")
+	expectArtistLookup(mock, "updatedartist", 1, "UpdatedArtist")
+	mock.ExpectPrepare("UPDATE album SET title = \\?, artist = \\?, artist_id = \\?, price = \\?, currency = \\?, version = version \\+ 1 WHERE id = \\? AND deleted_at IS NULL").
 		ExpectExec().
-		WithArgs("UpdatedTitle", "UpdatedArtist", "20", "1").
+		WithArgs("UpdatedTitle", "UpdatedArtist", 1, "20.00", "USD", 1).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectAudit(mock, 1, AuditUpdate, `{"artist":{"before":"Artist1","after":"UpdatedArtist"},"price":{"before":"10.99","after":"20.00"},"title":{"before":"Album1","after":"UpdatedTitle"}}`)
+	mock.ExpectCommit()
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
-	rr := sendMockHTTPRequest(t, albums.UpdateAlbum, http.MethodPatch, "/albums/1?title=UpdatedTitle&artist=UpdatedArtist&price=20")
+	rr := sendMockHTTPRequest(t, albums.UpdateAlbum, http.MethodPatch, "/albums/1?title=UpdatedTitle&artist=UpdatedArtist&price=20&currency=USD")
 
 	if status := rr.Code; status != http.StatusOK {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
@@ -586,13 +647,17 @@ func TestUpdateAlbum_Errors(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	// Prepare error case
-	mock.ExpectPrepare("UPDATE album SET title = \\?, artist = \\?, price = \\? WHERE id = \\?").
+	mock.ExpectBegin()
+	expectAlbumLock(mock, 1, "Album1", "Artist1", "10.99")
+	expectArtistLookup(mock, "updatedartist", 1, "UpdatedArtist")
+	mock.ExpectPrepare("UPDATE album SET title = \\?, artist = \\?, artist_id = \\?, price = \\?, currency = \\?, version = version \\+ 1 WHERE id = \\? AND deleted_at IS NULL").
 		WillReturnError(fmt.Errorf("prepare error"))
+	mock.ExpectRollback()
 
-	rr := sendMockHTTPRequest(t, albums.UpdateAlbum, http.MethodPatch, "/albums/1?title=UpdatedTitle&artist=UpdatedArtist&price=20")
+	rr := sendMockHTTPRequest(t, albums.UpdateAlbum, http.MethodPatch, "/albums/1?title=UpdatedTitle&artist=UpdatedArtist&price=20&currency=USD")
 
 	if status := rr.Code; status != http.StatusInternalServerError {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
@@ -609,18 +674,22 @@ func TestUpdateAlbum_Errors(t *testing.T) {
 	}
 
 	// Exec error case
-	mock.ExpectPrepare("UPDATE album SET title = \\?, artist = \\?, price = \\? WHERE id = \\?").
+	mock.ExpectBegin()
+	expectAlbumLock(mock, 1, "Album1", "Artist1", "10.99")
+	expectArtistLookup(mock, "updatedartist", 1, "UpdatedArtist")
+	mock.ExpectPrepare("UPDATE album SET title = \\?, artist = \\?, artist_id = \\?, price = \\?, currency = \\?, version = version \\+ 1 WHERE id = \\? AND deleted_at IS NULL").
 		ExpectExec().
-		WithArgs("UpdatedTitle", "UpdatedArtist", "20.99", "1").
+		WithArgs("UpdatedTitle", "UpdatedArtist", 1, "20.99", "USD", 1).
 		WillReturnError(fmt.Errorf("exec error"))
+	mock.ExpectRollback()
 
-	rr = sendMockHTTPRequest(t, albums.UpdateAlbum, http.MethodPatch, "/albums/1?title=UpdatedTitle&artist=UpdatedArtist&price=20.99")
+	rr = sendMockHTTPRequest(t, albums.UpdateAlbum, http.MethodPatch, "/albums/1?title=UpdatedTitle&artist=UpdatedArtist&price=20.99&currency=USD")
 
-	if status := rr.Code; status != http.StatusBadRequest {
-		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	if status := rr.Code; status != http.StatusInternalServerError {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
 	}
 
-	expected = `{"errors":"could not update album"}`
+	expected = `{"errors":"UpdateAlbum exec error"}`
 	actual = strings.TrimSpace(rr.Body.String())
 	if actual != expected {
 		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
@@ -635,12 +704,16 @@ func TestAddRandom(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	mock.ExpectPrepare("INSERT INTO album \\(title, artist, price\\) VALUES \\(\\?, \\?, \\?\\)").
+	mock.ExpectBegin()
+	expectArtistLookup(mock, sqlmock.AnyArg(), 1, "Random Artist")
+	mock.ExpectPrepare("INSERT INTO album \\(title, artist, artist_id, price, currency, release_date, label, format, catalog_number, barcode\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)").
 		ExpectExec().
-		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectAudit(mock, 1, AuditCreate, sqlmock.AnyArg())
+	mock.ExpectCommit()
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	rr := sendMockHTTPRequest(t, albums.AddRandom, http.MethodPost, "/albums/random")
 
@@ -657,13 +730,16 @@ func TestAddRandom_Errors(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	// Exec error case
-	mock.ExpectPrepare("INSERT INTO album \\(title, artist, price\\) VALUES \\(\\?, \\?, \\?\\)").
+	mock.ExpectBegin()
+	expectArtistLookup(mock, sqlmock.AnyArg(), 1, "Random Artist")
+	mock.ExpectPrepare("INSERT INTO album \\(title, artist, artist_id, price, currency, release_date, label, format, catalog_number, barcode\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)").
 		ExpectExec().
-		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnError(fmt.Errorf("exec error"))
+	mock.ExpectRollback()
 
 	rr := sendMockHTTPRequest(t, albums.AddRandom, http.MethodPost, "/albums/random")
 
@@ -686,11 +762,14 @@ func TestAddRandom_PrepareError(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
 	// Prepare error case
-	mock.ExpectPrepare("INSERT INTO album \\(title, artist, price\\) VALUES \\(\\?, \\?, \\?\\)").
+	mock.ExpectBegin()
+	expectArtistLookup(mock, sqlmock.AnyArg(), 1, "Random Artist")
+	mock.ExpectPrepare("INSERT INTO album \\(title, artist, artist_id, price, currency, release_date, label, format, catalog_number, barcode\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)").
 		WillReturnError(fmt.Errorf("prepare error"))
+	mock.ExpectRollback()
 
 	rr := sendMockHTTPRequest(t, albums.AddRandom, http.MethodPost, "/albums/random")
 
@@ -698,7 +777,7 @@ func TestAddRandom_PrepareError(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
 	}
 
-	expected := `{"errors":"UpdateAlbum prepare prepare error"}`
+	expected := `{"errors":"failed to create random album"}`
 	actual := strings.TrimSpace(rr.Body.String())
 	if actual != expected {
 		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
@@ -713,12 +792,15 @@ func TestAddRandom_LastInsertIdError(t *testing.T) {
 	db, mock := getMockDB(t)
 	defer db.Close()
 
-	albums := &Albums{Db: db}
+	albums := &Albums{Store: &SQLStore{Db: db}}
 
-	mock.ExpectPrepare("INSERT INTO album \\(title, artist, price\\) VALUES \\(\\?, \\?, \\?\\)").
+	mock.ExpectBegin()
+	expectArtistLookup(mock, sqlmock.AnyArg(), 1, "Random Artist")
+	mock.ExpectPrepare("INSERT INTO album \\(title, artist, artist_id, price, currency, release_date, label, format, catalog_number, barcode\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)").
 		ExpectExec().
-		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewErrorResult(fmt.Errorf("last insert id error")))
+	mock.ExpectRollback()
 
 	rr := sendMockHTTPRequest(t, albums.AddRandom, http.MethodPost, "/albums/random")
 
@@ -736,3 +818,203 @@ func TestAddRandom_LastInsertIdError(t *testing.T) {
 		t.Errorf("There were unfulfilled expectations: %v", err)
 	}
 }
+
+func TestAddAlbum_JSON(t *testing.T) {
+	albums := NewAlbums(NewMemoryStore())
+
+	rr := sendMockJSONRequest(t, albums.AddAlbum, http.MethodPut, "/albums", `{"title":"Blue Train","artist":"John Coltrane","price":"56.99","currency":"USD"}`)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expected := `{"id":1,"title":"Blue Train","artist":"John Coltrane","artist_id":1,"price":"56.99","review_count":0,"average_rating":null,"currency":"USD"}`
+	actual := strings.TrimSpace(rr.Body.String())
+	if actual != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
+	}
+}
+
+func TestAddAlbum_JSONErrors(t *testing.T) {
+	albums := NewAlbums(NewMemoryStore())
+
+	tests := []struct {
+		body         string
+		expectedCode int
+		expected     string
+	}{
+		{`{"title":"Blue Train","artist":"John Coltrane"}`, http.StatusUnprocessableEntity, `{"errors":["'price' is required"],"fields":{"price":["is required"]}}`},
+		{`{"title":"Blue Train","artist":"John Coltrane","price":{"amount":"56.99"}}`, http.StatusUnprocessableEntity, `{"errors":["'price' must be a number"],"fields":{"price":["must be a number"]}}`},
+		{`{"title":"Blue Train","artist":"John Coltrane","price":"5699","currency":"usd"}`, http.StatusUnprocessableEntity, `{"errors":["'currency' must be a supported ISO 4217 currency code"],"fields":{"currency":["must be a supported ISO 4217 currency code"]}}`},
+		{`{"title":"Blue Train","artist":"John Coltrane","price":56.99,"id":4}`, http.StatusBadRequest, `{"errors":"unknown field \"id\""}`},
+	}
+
+	for _, tt := range tests {
+		rr := sendMockJSONRequest(t, albums.AddAlbum, http.MethodPut, "/albums", tt.body)
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("Handler returned wrong status code for %v: got %v want %v", tt.body, status, tt.expectedCode)
+		}
+
+		actual := strings.TrimSpace(rr.Body.String())
+		if actual != tt.expected {
+			t.Errorf("Handler returned unexpected body for %v: got %v want %v", tt.body, actual, tt.expected)
+		}
+	}
+}
+
+func TestAddAlbum_UnsupportedMediaType(t *testing.T) {
+	albums := NewAlbums(NewMemoryStore())
+
+	req, err := http.NewRequest(http.MethodPut, "/albums?title=Album1&artist=Artist1&price=10", strings.NewReader("title=Album1"))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "text/plain")
+
+	rr := httptest.NewRecorder()
+	albums.AddAlbum(rr, req)
+
+	if status := rr.Code; status != http.StatusUnsupportedMediaType {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusUnsupportedMediaType)
+	}
+}
+
+func TestUpdateAlbum_JSON(t *testing.T) {
+	store := NewMemoryStore(Album{Title: "Jeru", Artist: "Gerry Mulligan", Price: money.MustParse("17.99", "USD")})
+	albums := NewAlbums(store)
+
+	// The query string is ignored once a JSON body is declared
+	rr := sendMockJSONRequest(t, albums.UpdateAlbum, http.MethodPatch, "/albums/1?title=Ignored", `{"title":"Jeru & Friends?"}`)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	album, _ := store.Get(context.Background(), 1)
+	if album.Title != "Jeru & Friends?" || album.Price != money.MustParse("17.99", "USD") {
+		t.Errorf("Expected only the title to be updated, got %v", album)
+	}
+}
+
+func TestAddAlbum_ValidationErrors(t *testing.T) {
+	albums := NewAlbums(NewMemoryStore())
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"/albums?title=Album1&artist=Artist1&price=abc", `{"errors":["'price' must be a number"],"fields":{"price":["must be a number"]}}`},
+		{"/albums?title=%20&price=-1", `{"errors":["'title' must not be blank","'artist' is required","'price' must not be negative"],"fields":{"artist":["is required"],"price":["must not be negative"],"title":["must not be blank"]}}`},
+		{"/albums?title=" + strings.Repeat("a", 129) + "&artist=Artist1&price=1000", `{"errors":["'title' must be at most 128 characters","'price' must not be more than 999.99"],"fields":{"price":["must not be more than 999.99"],"title":["must be at most 128 characters"]}}`},
+		{"/albums?title=Album1&artist=" + strings.Repeat("a", 256) + "&price=9.999", `{"errors":["'price' must not have more than 2 decimal places","'artist' must be at most 255 characters"],"fields":{"artist":["must be at most 255 characters"],"price":["must not have more than 2 decimal places"]}}`},
+	}
+
+	for _, tt := range tests {
+		rr := sendMockHTTPRequest(t, albums.AddAlbum, http.MethodPut, tt.url)
+
+		if status := rr.Code; status != http.StatusUnprocessableEntity {
+			t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+		}
+
+		actual := strings.TrimSpace(rr.Body.String())
+		if actual != tt.expected {
+			t.Errorf("Handler returned unexpected body: got %v want %v", actual, tt.expected)
+		}
+	}
+
+	if albums, _ := albums.Store.List(context.Background(), AlbumQuery{}); len(albums) != 0 {
+		t.Errorf("Expected invalid albums not to be stored, got %v", albums)
+	}
+}
+
+func TestUpdateAlbum_ValidationErrors(t *testing.T) {
+	albums := NewAlbums(NewMemoryStore(Album{Title: "Jeru", Artist: "Gerry Mulligan", Price: money.MustParse("17.99", "USD")}))
+
+	rr := sendMockJSONRequest(t, albums.UpdateAlbum, http.MethodPatch, "/albums/1", `{"artist":"","price":-5}`)
+
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+	}
+
+	expected := `{"errors":["'artist' must not be blank","'price' must not be negative"],"fields":{"artist":["must not be blank"],"price":["must not be negative"]}}`
+	actual := strings.TrimSpace(rr.Body.String())
+	if actual != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
+	}
+
+	rr = sendMockHTTPRequest(t, albums.UpdateAlbum, http.MethodPatch, "/albums/1?price=abc")
+
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+	}
+
+	album, _ := albums.Store.Get(context.Background(), 1)
+	if album.Artist != "Gerry Mulligan" || album.Price != money.MustParse("17.99", "USD") {
+		t.Errorf("Expected album to be unchanged, got %v", album)
+	}
+}
+
+func TestAlbumPrices_Currency(t *testing.T) {
+	store := NewMemoryStore(Album{Title: "Jeru", Artist: "Gerry Mulligan", Price: money.MustParse("17.99", "EUR")})
+	albums := NewAlbums(store)
+
+	// A price on its own stays in the album's currency
+	rr := sendMockJSONRequest(t, albums.UpdateAlbum, http.MethodPatch, "/albums/1", `{"price":"19.50"}`)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	album, _ := store.Get(context.Background(), 1)
+	if album.Price != money.New(1950, "EUR") {
+		t.Errorf("Expected price to stay in EUR, got %v %v", album.Price, album.Price.Currency)
+	}
+
+	rr = sendMockJSONRequest(t, albums.UpdateAlbum, http.MethodPatch, "/albums/1", `{"currency":"JPY"}`)
+	expected := `{"errors":["'price' is required when changing the currency"],"fields":{"price":["is required when changing the currency"]}}`
+	if actual := strings.TrimSpace(rr.Body.String()); actual != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
+	}
+
+	rr = sendMockJSONRequest(t, albums.AddAlbum, http.MethodPut, "/albums", `{"title":"Kind of Blue","artist":"Miles Davis","price":900,"currency":"JPY"}`)
+	expected = `{"id":2,"title":"Kind of Blue","artist":"Miles Davis","artist_id":2,"price":"900","review_count":0,"average_rating":null,"currency":"JPY"}`
+	if actual := strings.TrimSpace(rr.Body.String()); actual != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
+	}
+
+	// Large prices in currencies without minor units must not wrap around
+	rr = sendMockJSONRequest(t, albums.UpdateAlbum, http.MethodPatch, "/albums/2", `{"price":"184467440737095517"}`)
+	expected = `{"errors":["'price' must not be more than 999.99"],"fields":{"price":["must not be more than 999.99"]}}`
+	if actual := strings.TrimSpace(rr.Body.String()); rr.Code != http.StatusUnprocessableEntity || actual != expected {
+		t.Errorf("Handler returned unexpected response: got %v %v want %v %v", rr.Code, actual, http.StatusUnprocessableEntity, expected)
+	}
+
+	rr = sendMockJSONRequest(t, albums.UpdateAlbum, http.MethodPatch, "/albums/9", `{"price":"1.00"}`)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestParseInclude(t *testing.T) {
+	tests := []struct {
+		include  string
+		expected includes
+		err      string
+	}{
+		{"", includes{}, ""},
+		{"tracks", includes{Tracks: true}, ""},
+		{"tags,tracks,tags", includes{Tracks: true, Tags: true}, ""},
+		{"genres", includes{Genres: true}, ""},
+		{"tracks,artist", includes{}, "unknown include 'artist'"},
+	}
+
+	for _, tt := range tests {
+		actual, err := parseInclude(tt.include)
+		if actual != tt.expected {
+			t.Errorf("parseInclude(%q) = %v want %v", tt.include, actual, tt.expected)
+		}
+		if err != nil && err.Error() != tt.err || err == nil && tt.err != "" {
+			t.Errorf("parseInclude(%q) returned error %v want %v", tt.include, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrArtistNotFound is returned by an ArtistStore when no artist matches the given id.
+	ErrArtistNotFound = errors.New("artist not found")
+	// ErrArtistExists is returned when another artist already has the name.
+	ErrArtistExists = errors.New("an artist with this name already exists")
+	// ErrArtistHasAlbums is returned when deleting an artist that still has albums.
+	ErrArtistHasAlbums = errors.New("artist still has albums")
+)
+
+// maxBioLength bounds the artist biography.
+const maxBioLength = 4000
+
+type Artist struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Bio  string `json:"bio"`
+}
+
+// ArtistUpdate holds the fields of a partial artist update. Nil fields are left untouched.
+type ArtistUpdate struct {
+	Name *string
+	Bio  *string
+}
+
+// Empty reports whether the update would not change any field.
+func (u ArtistUpdate) Empty() bool {
+	return u.Name == nil && u.Bio == nil
+}
+
+// Validate checks the fields of an update against the artist table limits.
+// When requireName is set, as it is for new artists, a missing name is an error.
+func (u ArtistUpdate) Validate(requireName bool) ValidationErrors {
+	var errs ValidationErrors
+	validateText(&errs, "name", u.Name, maxArtistLength, requireName)
+
+	if u.Bio != nil && len([]rune(*u.Bio)) > maxBioLength {
+		errs.Add("bio", fmt.Sprintf("must be at most %d characters", maxBioLength))
+	}
+
+	return errs
+}
+
+// ArtistQuery selects a page of artists in name order.
+type ArtistQuery struct {
+	Limit int
+	// After is the last artist of the previous page.
+	After *Artist
+}
+
+// ArtistStore is the persistence layer the artist handlers depend on. Album
+// stores create artists as albums name them, so every Backend keeps both.
+type ArtistStore interface {
+	ListArtists(ctx context.Context, query ArtistQuery) ([]Artist, error)
+	GetArtist(ctx context.Context, id int64) (Artist, error)
+	CreateArtist(ctx context.Context, artist Artist) (Artist, error)
+	// UpdateArtist also renames the artist on its albums.
+	UpdateArtist(ctx context.Context, id int64, update ArtistUpdate) error
+	// DeleteArtist refuses with ErrArtistHasAlbums while albums refer to the artist.
+	DeleteArtist(ctx context.Context, id int64) error
+}
+
+// normalizeName trims an artist name and collapses the spaces inside it.
+func normalizeName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// nameKey is the form artist names are compared in, so that names differing
+// only in case or spacing belong to the same artist.
+func nameKey(name string) string {
+	return strings.ToLower(normalizeName(name))
+}
+
+// ArtistPage is the envelope artist listings are served in. Next is an opaque
+// cursor for the following page and is null on the last one.
+type ArtistPage struct {
+	Data []Artist `json:"data"`
+	Next *string  `json:"next"`
+}
+
+// GetArtists lists artists in name order, a page at a time.
+func (a *Albums) GetArtists(w http.ResponseWriter, r *http.Request) {
+	parameters := r.URL.Query()
+	query := ArtistQuery{Limit: defaultPageLimit}
+
+	var err error
+	if limit := parameters.Get("limit"); limit != "" {
+		if query.Limit, err = parseLimit(limit); err != nil {
+			ServeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if cursor := parameters.Get("cursor"); cursor != "" {
+		if query.After, err = decodeArtistCursor(cursor); err != nil {
+			ServeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Fetch one more artist to tell whether there is a next page
+	query.Limit++
+	artists, err := a.Artists.ListArtists(r.Context(), query)
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("GetArtists %v", err), http.StatusInternalServerError)
+		return
+	}
+	query.Limit--
+
+	page := ArtistPage{Data: artists}
+	if len(artists) > query.Limit {
+		page.Data = artists[:query.Limit]
+		next := encodeArtistCursor(page.Data[query.Limit-1])
+		page.Next = &next
+	}
+	if page.Data == nil {
+		page.Data = []Artist{}
+	}
+
+	ServeJSON(w, page, http.StatusOK)
+}
+
+func (a *Albums) AddArtist(w http.ResponseWriter, r *http.Request) {
+	update, ok := artistInput(w, r)
+	if !ok {
+		return
+	}
+
+	if errs := update.Validate(true); len(errs) > 0 {
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	artist := Artist{Name: *update.Name}
+	if update.Bio != nil {
+		artist.Bio = *update.Bio
+	}
+
+	artist, err := a.Artists.CreateArtist(r.Context(), artist)
+	if errors.Is(err, ErrArtistExists) {
+		ServeJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("AddArtist %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	ServeJSON(w, artist, http.StatusOK)
+}
+
+func (a *Albums) GetArtistByID(w http.ResponseWriter, r *http.Request) {
+	id, ok := artistID(w, r)
+	if !ok {
+		return
+	}
+
+	artist, err := a.Artists.GetArtist(r.Context(), id)
+	if errors.Is(err, ErrArtistNotFound) {
+		ServeJSONError(w, "artist not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("GetArtistByID %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	ServeJSON(w, artist, http.StatusOK)
+}
+
+// UpdateArtist changes an artist's name or bio. A new name is copied onto the
+// artist's albums.
+func (a *Albums) UpdateArtist(w http.ResponseWriter, r *http.Request) {
+	id, ok := artistID(w, r)
+	if !ok {
+		return
+	}
+
+	update, ok := artistInput(w, r)
+	if !ok {
+		return
+	}
+
+	if update.Empty() {
+		ServeJSONError(w, "must pass in a 'name' or 'bio'", http.StatusBadRequest)
+		return
+	}
+
+	if errs := update.Validate(false); len(errs) > 0 {
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	err := a.Artists.UpdateArtist(r.Context(), id, update)
+	switch {
+	case errors.Is(err, ErrArtistNotFound):
+		ServeJSONError(w, "artist not found", http.StatusNotFound)
+	case errors.Is(err, ErrArtistExists):
+		ServeJSONError(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		ServeJSONError(w, fmt.Sprintf("UpdateArtist %v", err), http.StatusInternalServerError)
+	default:
+		ServeJSON(w, map[string]any{"message": "artist successfully updated"}, http.StatusOK)
+	}
+}
+
+func (a *Albums) DeleteArtist(w http.ResponseWriter, r *http.Request) {
+	id, ok := artistID(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.Artists.DeleteArtist(r.Context(), id)
+	switch {
+	case errors.Is(err, ErrArtistNotFound):
+		ServeJSONError(w, "artist not found", http.StatusNotFound)
+	case errors.Is(err, ErrArtistHasAlbums):
+		ServeJSONError(w, "artist still has albums; move or delete them first", http.StatusConflict)
+	case err != nil:
+		ServeJSONError(w, "could not delete artist", http.StatusInternalServerError)
+	default:
+		ServeJSON(w, map[string]any{"message": "artist successfully removed"}, http.StatusOK)
+	}
+}
+
+// GetArtistAlbums lists an artist's albums, taking the same query parameters
+// as GetAlbums.
+func (a *Albums) GetArtistAlbums(w http.ResponseWriter, r *http.Request) {
+	id, ok := artistID(w, r)
+	if !ok {
+		return
+	}
+
+	request, ok := listInput(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := a.Artists.GetArtist(r.Context(), id); errors.Is(err, ErrArtistNotFound) {
+		ServeJSONError(w, "artist not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		ServeJSONError(w, fmt.Sprintf("GetArtistAlbums %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	request.Filters = append(request.Filters, Filter{Field: "artist_id", Operator: OpEq, Values: []any{id}})
+
+	albums, err := a.Store.List(r.Context(), request.query())
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("GetArtistAlbums %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	a.servePage(w, r, request, albums, "GetArtistAlbums")
+}
+
+// artistRequest holds the artist fields sent with a create or update request.
+type artistRequest struct {
+	Name *string `json:"name"`
+	Bio  *string `json:"bio"`
+}
+
+// artistInput reads the JSON body of an artist create or update request. It
+// writes an error response and returns false when the body cannot be read.
+func artistInput(w http.ResponseWriter, r *http.Request) (ArtistUpdate, bool) {
+	if !isJSON(r) {
+		ServeJSONError(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return ArtistUpdate{}, false
+	}
+
+	var input artistRequest
+	if err := decodeJSON(w, r, &input); err != nil {
+		ServeJSONError(w, err.Error(), http.StatusBadRequest)
+		return ArtistUpdate{}, false
+	}
+
+	return ArtistUpdate{Name: input.Name, Bio: input.Bio}, true
+}
+
+// artistID parses the artist id in a /artists/{id} or /artists/{id}/albums
+// path. It writes a 400 response and returns false when the id is not a number.
+func artistID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/artists/"), "/albums")
+
+	id, err := strconv.ParseInt(path, 10, 64)
+	if err != nil {
+		ServeJSONError(w, "invalid artist id", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return id, true
+}
+
+func encodeArtistCursor(artist Artist) string {
+	data, _ := json.Marshal(cursor{After: []string{artist.Name, strconv.FormatInt(artist.ID, 10)}})
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeArtistCursor(encoded string) (*Artist, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || len(c.After) != 2 {
+		return nil, errInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(c.After[1], 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	return &Artist{ID: id, Name: c.After[0]}, nil
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go-web-service/money"
+)
+
+func TestArtists_MemoryStore(t *testing.T) {
+	testArtists(t, NewAlbums(NewMemoryStore(queryAlbums...)))
+}
+
+func TestArtists_SQLite(t *testing.T) {
+	testArtists(t, NewAlbums(querySQLiteStore(t)))
+}
+
+// testArtists runs through the artist endpoints against albums holding queryAlbums.
+func testArtists(t *testing.T, albums *Albums) {
+	t.Helper()
+
+	router := SetupRouter(albums)
+	johnColtrane := encodeArtistCursor(Artist{ID: 1, Name: "John Coltrane"})
+	sarahVaughan := encodeArtistCursor(Artist{ID: 3, Name: "Sarah Vaughan"})
+
+	tests := []struct {
+		method       string
+		url          string
+		body         string
+		expectedCode int
+		expected     string
+	}{
+		// Artists are listed by name
+		{http.MethodGet, "/artists?limit=2", "", http.StatusOK, `{"data":[{"id":2,"name":"Gerry Mulligan","bio":""},{"id":1,"name":"John Coltrane","bio":""}],"next":"` + johnColtrane + `"}`},
+		{http.MethodGet, "/artists?limit=2&cursor=" + johnColtrane, "", http.StatusOK, `{"data":[{"id":4,"name":"Post Malone","bio":""},{"id":3,"name":"Sarah Vaughan","bio":""}],"next":"` + sarahVaughan + `"}`},
+		{http.MethodGet, "/artists?limit=2&cursor=" + sarahVaughan, "", http.StatusOK, `{"data":[{"id":5,"name":"Various","bio":""}],"next":null}`},
+		{http.MethodGet, "/artists?cursor=abc", "", http.StatusBadRequest, `{"errors":"invalid cursor"}`},
+		{http.MethodGet, "/artists/2", "", http.StatusOK, `{"id":2,"name":"Gerry Mulligan","bio":""}`},
+		{http.MethodGet, "/artists/99", "", http.StatusNotFound, `{"errors":"artist not found"}`},
+		{http.MethodGet, "/artists/abc", "", http.StatusBadRequest, `{"errors":"invalid artist id"}`},
+
+		// Names are stored with their spacing tidied, and compared ignoring case
+		{http.MethodPut, "/artists", `{"name":"  Miles   Davis "}`, http.StatusOK, `{"id":6,"name":"Miles Davis","bio":""}`},
+		{http.MethodPut, "/artists", `{"name":"JOHN COLTRANE"}`, http.StatusConflict, `{"errors":"an artist with this name already exists"}`},
+		{http.MethodPut, "/artists", `{"bio":"Unknown"}`, http.StatusUnprocessableEntity, `{"errors":["'name' is required"],"fields":{"name":["is required"]}}`},
+
+		// Albums join the artist their name matches, or the one picked by id
+		{http.MethodPut, "/albums", `{"title":"Lush Life","artist":"john  coltrane ","price":"19.99"}`, http.StatusOK, `{"id":8,"title":"Lush Life","artist":"John Coltrane","artist_id":1,"price":"19.99","review_count":0,"average_rating":null,"currency":"USD"}`},
+		{http.MethodPut, "/albums", `{"title":"Kind of Blue","artist_id":6,"price":"29.99"}`, http.StatusOK, `{"id":9,"title":"Kind of Blue","artist":"Miles Davis","artist_id":6,"price":"29.99","review_count":0,"average_rating":null,"currency":"USD"}`},
+		{http.MethodPut, "/albums", `{"title":"Kind of Blue","artist_id":99,"price":"29.99"}`, http.StatusUnprocessableEntity, `{"errors":["'artist_id' does not match an artist"],"fields":{"artist_id":["does not match an artist"]}}`},
+		{http.MethodPut, "/albums", `{"title":"Kind of Blue","artist":"Miles Davis","artist_id":6,"price":"29.99"}`, http.StatusUnprocessableEntity, `{"errors":["'artist_id' must not be passed with 'artist'"],"fields":{"artist_id":["must not be passed with 'artist'"]}}`},
+		{http.MethodGet, "/artists/1/albums?sort=-price&limit=2", "", http.StatusOK, `"data":[{"id":2,"title":"Giant Steps","artist":"John Coltrane","artist_id":1,"price":"63.99","review_count":0,"average_rating":null,"currency":"USD"},{"id":1,"title":"Blue Train","artist":"John Coltrane","artist_id":1,"price":"56.99","review_count":0,"average_rating":null,"currency":"USD"}]`},
+		{http.MethodGet, "/albums?artist_id=6", "", http.StatusOK, `{"data":[{"id":9,"title":"Kind of Blue","artist":"Miles Davis","artist_id":6,"price":"29.99","review_count":0,"average_rating":null,"currency":"USD"}],"next":null,"prev":null}`},
+		{http.MethodGet, "/artists/99/albums", "", http.StatusNotFound, `{"errors":"artist not found"}`},
+
+		// Renaming an artist renames it on its albums
+		{http.MethodPatch, "/artists/6", `{"name":"Miles Dewey Davis","bio":"Trumpeter"}`, http.StatusOK, `{"message":"artist successfully updated"}`},
+		{http.MethodGet, "/albums/9", "", http.StatusOK, `[{"id":9,"title":"Kind of Blue","artist":"Miles Dewey Davis","artist_id":6,"price":"29.99","review_count":0,"average_rating":null,"currency":"USD"}]`},
+		{http.MethodPatch, "/artists/6", `{"name":"gerry mulligan"}`, http.StatusConflict, `{"errors":"an artist with this name already exists"}`},
+		{http.MethodPatch, "/artists/6", `{"name":"miles dewey davis"}`, http.StatusOK, `{"message":"artist successfully updated"}`},
+		{http.MethodPatch, "/artists/6", `{}`, http.StatusBadRequest, `{"errors":"must pass in a 'name' or 'bio'"}`},
+		{http.MethodPatch, "/artists/99", `{"bio":"Nobody"}`, http.StatusNotFound, `{"errors":"artist not found"}`},
+
+		// Only artists without albums can be deleted
+		{http.MethodDelete, "/artists/6", "", http.StatusConflict, `{"errors":"artist still has albums; move or delete them first"}`},
+		{http.MethodPatch, "/albums/9", `{"artist":"Bill Evans"}`, http.StatusOK, `{"message":"album successfully updated"}`},
+		{http.MethodGet, "/albums/9", "", http.StatusOK, `[{"id":9,"title":"Kind of Blue","artist":"Bill Evans","artist_id":7,"price":"29.99","review_count":0,"average_rating":null,"currency":"USD"}]`},
+		{http.MethodDelete, "/artists/6", "", http.StatusOK, `{"message":"artist successfully removed"}`},
+		{http.MethodDelete, "/artists/6", "", http.StatusNotFound, `{"errors":"artist not found"}`},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if tt.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("%v %v returned wrong status code: got %v want %v", tt.method, tt.url, status, tt.expectedCode)
+		}
+
+		if actual := strings.TrimSpace(rr.Body.String()); !strings.Contains(actual, tt.expected) {
+			t.Errorf("%v %v returned unexpected body: got %v want %v", tt.method, tt.url, actual, tt.expected)
+		}
+	}
+}
+
+func TestIndexedStore_UpdateArtist(t *testing.T) {
+	ctx := context.Background()
+	store, _ := NewIndexedStore(ctx, NewMemoryStore(queryAlbums...))
+
+	name := "Chet Baker"
+	if err := store.UpdateArtist(ctx, 2, ArtistUpdate{Name: &name}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The artist's albums are searched under the new name
+	if results, _ := store.Search(ctx, []string{"mulligan"}, 10); len(results) != 0 {
+		t.Errorf("Expected the old name to be gone, got %v", results)
+	}
+	if results, _ := store.Search(ctx, []string{"baker"}, 10); len(results) != 1 || results[0].Album.Artist != "Chet Baker" {
+		t.Errorf("Expected the new name to match, got %v", results)
+	}
+}
+
+func TestUpdateArtist_Audit_MemoryStore(t *testing.T) {
+	testUpdateArtistAudit(t, NewMemoryStore(queryAlbums...))
+}
+
+func TestUpdateArtist_Audit_SQLite(t *testing.T) {
+	testUpdateArtistAudit(t, querySQLiteStore(t))
+}
+
+// testUpdateArtistAudit checks that renaming an artist logs an update of each
+// of its albums, in the trash or not, against store holding queryAlbums.
+func testUpdateArtistAudit(t *testing.T, store interface {
+	ArtistStore
+	AuditStore
+	Trash(ctx context.Context, id, version int64, now time.Time) error
+}) {
+	t.Helper()
+	ctx := withActor(context.Background(), "staff")
+
+	if err := store.Trash(ctx, 6, 0, time.Now()); err != nil {
+		t.Fatalf("Failed to trash album: %v", err)
+	}
+	for _, name := range []string{"John William Coltrane", "John William Coltrane"} {
+		if err := store.UpdateArtist(ctx, 1, ArtistUpdate{Name: &name}); err != nil {
+			t.Fatalf("Failed to rename artist: %v", err)
+		}
+	}
+
+	entries, err := store.ListAudit(ctx, AuditQuery{Limit: 100})
+	if err != nil {
+		t.Fatalf("Failed to list audit: %v", err)
+	}
+
+	var updated []int64
+	for _, entry := range entries {
+		if entry.Action != AuditUpdate {
+			continue
+		}
+		updated = append(updated, entry.AlbumID)
+
+		changes, _ := json.Marshal(entry.Changes)
+		if entry.Actor != "staff" || string(changes) != `{"artist":{"before":"John Coltrane","after":"John William Coltrane"}}` {
+			t.Errorf("Unexpected audit entry %+v %s", entry, changes)
+		}
+	}
+	slices.Sort(updated)
+	if !slices.Equal(updated, []int64{1, 2, 6}) {
+		t.Errorf("Expected one update of each of the artist's albums, got %v", updated)
+	}
+}
+
+func TestNameKey(t *testing.T) {
+	for _, name := range []string{"John Coltrane", " john  coltrane", "JOHN\tCOLTRANE "} {
+		if actual := nameKey(name); actual != "john coltrane" {
+			t.Errorf("nameKey(%q) = %q want %q", name, actual, "john coltrane")
+		}
+	}
+}
+
+// TestNormalizeArtists checks that artists the artist migration told apart by
+// their spacing are merged, along with their albums.
+func TestNormalizeArtists(t *testing.T) {
+	ctx := context.Background()
+	store := querySQLiteStore(t)
+
+	// As the migration left them: spaces trimmed but not collapsed
+	var ids []int64
+	for _, name := range []string{"Miles  Davis", "miles davis"} {
+		result, err := store.Db.ExecContext(ctx, `INSERT INTO artist (name, name_key, bio) VALUES (?, ?, '')`, name, strings.ToLower(name))
+		if err != nil {
+			t.Fatalf("Failed to insert artist: %v", err)
+		}
+		id, _ := result.LastInsertId()
+		ids = append(ids, id)
+	}
+	first, second := ids[0], ids[1]
+	for _, id := range ids {
+		if _, err := store.Create(ctx, Album{Title: "Kind of Blue", ArtistID: id, Price: money.MustParse("29.99", "USD")}); err != nil {
+			t.Fatalf("Failed to create album: %v", err)
+		}
+	}
+
+	for range 2 {
+		if err := store.NormalizeArtists(ctx); err != nil {
+			t.Fatalf("NormalizeArtists returned %v", err)
+		}
+	}
+
+	if _, err := store.GetArtist(ctx, second); !errors.Is(err, ErrArtistNotFound) {
+		t.Errorf("Expected the duplicate artist to be merged, got %v", err)
+	}
+	artist, err := store.artistByName(ctx, store.Db, "MILES DAVIS", false)
+	if err != nil || artist.ID != first || artist.Name != "Miles Davis" {
+		t.Errorf("Unexpected artist %+v, %v", artist, err)
+	}
+
+	albums, err := store.List(ctx, AlbumQuery{Filters: []Filter{{Field: "artist_id", Operator: OpEq, Values: []any{first}}}})
+	if err != nil || len(albums) != 2 {
+		t.Fatalf("Expected both albums under the merged artist, got %v, %v", albums, err)
+	}
+	for _, album := range albums {
+		if album.Artist != "Miles Davis" || album.Version != 2 {
+			t.Errorf("Unexpected album after the merge %+v", album)
+		}
+	}
+
+	// The merge and the rename are logged once for each album, by the system
+	entries, err := store.ListAudit(ctx, AuditQuery{Limit: 100})
+	if err != nil {
+		t.Fatalf("Failed to list audit: %v", err)
+	}
+	var updates []AuditEntry
+	for _, entry := range entries {
+		if entry.Action == AuditUpdate {
+			updates = append(updates, entry)
+		}
+	}
+	if len(updates) != 2 {
+		t.Fatalf("Expected an update entry for each album, got %+v", updates)
+	}
+	for _, entry := range updates {
+		if entry.Actor != systemActor || entry.Changes["artist"].After == nil || string(entry.Changes["artist"].After) != `"Miles Davis"` {
+			t.Errorf("Unexpected audit entry %+v", entry)
+		}
+	}
+}
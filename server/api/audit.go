@@ -0,0 +1,299 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requestIDHeader carries the id a request is logged under. Clients may send
+// their own, and every response echoes the one that was used.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength caps the length of request ids sent by clients.
+const maxRequestIDLength = 128
+
+// systemActor is the actor of writes made outside any request, such as
+// purging the trash.
+const systemActor = "system"
+
+// AuditAction is the kind of write an audit entry records.
+type AuditAction string
+
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditRestore AuditAction = "restore"
+	AuditPurge   AuditAction = "purge"
+)
+
+// auditedFields are the album fields audit entries record changes to, named
+// as in the album's JSON.
+var auditedFields = []string{"title", "artist", "artist_id", "price", "currency", "release_date",
+	"label", "format", "catalog_number", "barcode"}
+
+// AuditChange is a field's JSON value before and after a write. A value is
+// null when the album did not exist or the field was not set.
+type AuditChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// AuditEntry records one write to an album: who made it, in which request,
+// and the fields it changed.
+type AuditEntry struct {
+	ID        int64                  `json:"id"`
+	AlbumID   int64                  `json:"album_id"`
+	Action    AuditAction            `json:"action"`
+	Actor     string                 `json:"actor"`
+	RequestID string                 `json:"request_id"`
+	CreatedAt time.Time              `json:"created_at"`
+	Changes   map[string]AuditChange `json:"changes"`
+}
+
+// AuditQuery selects a page of the audit log, newest first.
+type AuditQuery struct {
+	// AlbumID keeps the entries of one album when set.
+	AlbumID int64
+	// Since and Until keep the entries made at or after Since and before
+	// Until, when set.
+	Since time.Time
+	Until time.Time
+	Limit int
+	// Before is the id of the last entry of the previous page.
+	Before int64
+}
+
+// AuditStore is the persistence layer the audit handlers depend on. Entries
+// are written by the album writes themselves, in the same transaction, and
+// are never changed afterwards.
+type AuditStore interface {
+	ListAudit(ctx context.Context, query AuditQuery) ([]AuditEntry, error)
+}
+
+// AuditPage is the envelope the audit log is served in. Next is an opaque
+// cursor for the following page and is null on the last one.
+type AuditPage struct {
+	Data []AuditEntry `json:"data"`
+	Next *string      `json:"next"`
+}
+
+type requestIDKey struct{}
+
+type actorKey struct{}
+
+// RequestID is middleware that gives each request an id, taken from its
+// X-Request-ID header when that holds a usable one, for the audit log.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			var err error
+			if id, err = newRequestID(); err != nil {
+				ServeJSONError(w, fmt.Sprintf("RequestID %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// newRequestID returns a random request id of 32 hex digits.
+func newRequestID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// validRequestID reports whether a client's request id can be logged as is:
+// letters, digits and -_.: only, and not too long.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// withActor returns a context whose album writes are logged as made by actor,
+// for writes made outside a request.
+func withActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// auditActor names who the writes made with ctx are logged as made by: the
+// actor set by withActor, else staff or the authenticated customer, else
+// anonymous.
+func auditActor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok {
+		return actor
+	}
+	if isStaff(ctx) {
+		return "staff"
+	}
+	if customer, ok := CurrentCustomer(ctx); ok {
+		return "customer:" + strconv.FormatInt(customer.ID, 10)
+	}
+
+	return "anonymous"
+}
+
+// newAuditEntry returns the entry for a write made with ctx to the album with
+// id, which changed it from before to after. Either is nil when the album did
+// not exist on that side of the write.
+func newAuditEntry(ctx context.Context, id int64, action AuditAction, before, after *Album, now time.Time) (AuditEntry, error) {
+	entry := AuditEntry{AlbumID: id, Action: action, Actor: auditActor(ctx), CreatedAt: now.UTC(), Changes: map[string]AuditChange{}}
+	entry.RequestID, _ = ctx.Value(requestIDKey{}).(string)
+
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+
+	for _, field := range auditedFields {
+		if !bytes.Equal(beforeFields[field], afterFields[field]) {
+			entry.Changes[field] = AuditChange{Before: beforeFields[field], After: afterFields[field]}
+		}
+	}
+
+	return entry, nil
+}
+
+// auditFields returns the album's JSON fields by name, or none for nil.
+func auditFields(album *Album) (map[string]json.RawMessage, error) {
+	if album == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(album)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+
+	return fields, err
+}
+
+// GetAudit lists the audit log of every album, newest first, a page at a
+// time. since and until keep the entries made in that time range. The log
+// names who made each change, so only staff can read it.
+func (a *Albums) GetAudit(w http.ResponseWriter, r *http.Request) {
+	if !requireStaff(w, r) {
+		return
+	}
+
+	query, ok := auditInput(w, r)
+	if !ok {
+		return
+	}
+
+	a.serveAudit(w, r, query, "GetAudit")
+}
+
+// GetAlbumHistory lists the audit log of one album, newest first, a page at
+// a time, and takes since and until like GetAudit. The history outlives the
+// album, so it is served for deleted albums too. Only staff can read it.
+func (a *Albums) GetAlbumHistory(w http.ResponseWriter, r *http.Request) {
+	if !requireStaff(w, r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/albums/"), "/history"), 10, 64)
+	if err != nil {
+		ServeJSONError(w, "invalid album id", http.StatusBadRequest)
+		return
+	}
+
+	query, ok := auditInput(w, r)
+	if !ok {
+		return
+	}
+	query.AlbumID = id
+
+	a.serveAudit(w, r, query, "GetAlbumHistory")
+}
+
+// auditInput reads the limit, cursor, since and until query parameters. It
+// writes a 400 response and returns false when they are invalid.
+func auditInput(w http.ResponseWriter, r *http.Request) (AuditQuery, bool) {
+	parameters := r.URL.Query()
+	query := AuditQuery{Limit: defaultPageLimit}
+
+	var err error
+	if limit := parameters.Get("limit"); limit != "" {
+		if query.Limit, err = parseLimit(limit); err != nil {
+			ServeJSONError(w, err.Error(), http.StatusBadRequest)
+			return AuditQuery{}, false
+		}
+	}
+
+	if cursor := parameters.Get("cursor"); cursor != "" {
+		if query.Before, err = decodeIDCursor(cursor); err != nil {
+			ServeJSONError(w, err.Error(), http.StatusBadRequest)
+			return AuditQuery{}, false
+		}
+	}
+
+	for name, bound := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if value := parameters.Get(name); value != "" {
+			if *bound, err = time.Parse(time.RFC3339, value); err != nil {
+				ServeJSONError(w, name+" must be a time such as 2006-01-02T15:04:05Z", http.StatusBadRequest)
+				return AuditQuery{}, false
+			}
+		}
+	}
+	if !query.Since.IsZero() && !query.Until.IsZero() && !query.Since.Before(query.Until) {
+		ServeJSONError(w, "since must be before until", http.StatusBadRequest)
+		return AuditQuery{}, false
+	}
+
+	return query, true
+}
+
+func (a *Albums) serveAudit(w http.ResponseWriter, r *http.Request, query AuditQuery, handler string) {
+	// Fetch one more entry to tell whether there is a next page
+	query.Limit++
+	entries, err := a.Audit.ListAudit(r.Context(), query)
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+		return
+	}
+	query.Limit--
+
+	page := AuditPage{Data: entries}
+	if len(entries) > query.Limit {
+		page.Data = entries[:query.Limit]
+		next := encodeIDCursor(page.Data[query.Limit-1].ID)
+		page.Next = &next
+	}
+	if page.Data == nil {
+		page.Data = []AuditEntry{}
+	}
+
+	ServeJSON(w, page, http.StatusOK)
+}
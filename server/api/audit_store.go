@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// record appends the audit entry of a write made with ctx to the album with
+// id. Callers must hold s.mu, and record before changing anything so that a
+// failure leaves the store as it was.
+func (s *MemoryStore) record(ctx context.Context, id int64, action AuditAction, before, after *Album, now time.Time) error {
+	entry, err := newAuditEntry(ctx, id, action, before, after, now)
+	if err != nil {
+		return err
+	}
+
+	entry.ID = int64(len(s.audit)) + 1
+	s.audit = append(s.audit, entry)
+
+	return nil
+}
+
+func (s *MemoryStore) ListAudit(ctx context.Context, query AuditQuery) ([]AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []AuditEntry
+	for i := len(s.audit) - 1; i >= 0 && len(entries) < query.Limit; i-- {
+		entry := s.audit[i]
+		if query.AlbumID != 0 && entry.AlbumID != query.AlbumID ||
+			!query.Since.IsZero() && entry.CreatedAt.Before(query.Since) ||
+			!query.Until.IsZero() && !entry.CreatedAt.Before(query.Until) ||
+			query.Before != 0 && entry.ID >= query.Before {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// audit writes the audit entry of a write made with ctx to the album with id
+// inside the write's transaction.
+func (s *SQLStore) audit(ctx context.Context, tx *sql.Tx, id int64, action AuditAction, before, after *Album, now time.Time) error {
+	entry, err := newAuditEntry(ctx, id, action, before, after, now)
+	if err != nil {
+		return err
+	}
+
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO album_audit (album_id, action, actor, request_id, changes, created_at) VALUES (?, ?, ?, ?, ?, ?)`),
+		entry.AlbumID, entry.Action, entry.Actor, entry.RequestID, string(changes), entry.CreatedAt)
+
+	return err
+}
+
+// lockAlbum reads the album with id inside tx, for the audit entry of a write
+// to it, and locks its row where the driver can. live leaves albums in the
+// trash out.
+func (s *SQLStore) lockAlbum(ctx context.Context, tx *sql.Tx, id int64, live bool) (Album, error) {
+	query := `SELECT ` + albumColumns + ` FROM album WHERE id = ?`
+	if live {
+		query += ` AND deleted_at IS NULL`
+	}
+	if s.Driver != "sqlite" {
+		query += ` FOR UPDATE`
+	}
+
+	var album Album
+	err := tx.QueryRowContext(ctx, s.rebind(query), id).Scan(albumDest(&album)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Album{}, ErrAlbumNotFound
+	}
+
+	return album, err
+}
+
+func (s *SQLStore) ListAudit(ctx context.Context, query AuditQuery) ([]AuditEntry, error) {
+	var conditions []string
+	var args []any
+	if query.AlbumID != 0 {
+		conditions = append(conditions, "album_id = ?")
+		args = append(args, query.AlbumID)
+	}
+	if !query.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, query.Since.UTC())
+	}
+	if !query.Until.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, query.Until.UTC())
+	}
+	if query.Before != 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, query.Before)
+	}
+
+	statement := `SELECT id, album_id, action, actor, request_id, changes, created_at FROM album_audit`
+	if len(conditions) > 0 {
+		statement += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	statement += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, query.Limit)
+
+	rows, err := s.Db.QueryContext(ctx, s.rebind(statement), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var changes string
+		if err := rows.Scan(&entry.ID, &entry.AlbumID, &entry.Action, &entry.Actor, &entry.RequestID, &changes,
+			timeScanner{&entry.CreatedAt}); err != nil {
+			return nil, fmt.Errorf("list audit %v", err)
+		}
+
+		if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			return nil, fmt.Errorf("list audit %v", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
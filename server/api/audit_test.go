@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go-web-service/money"
+)
+
+func TestAudit_MemoryStore(t *testing.T) {
+	testAudit(t, NewAlbums(NewMemoryStore(queryAlbums...)))
+}
+
+func TestAudit_SQLite(t *testing.T) {
+	testAudit(t, NewAlbums(querySQLiteStore(t)))
+}
+
+// testAudit runs an album through its life and reads its audit log back,
+// against albums holding queryAlbums.
+func testAudit(t *testing.T, albums *Albums) {
+	t.Helper()
+
+	albums.StaffToken = staffToken
+	router := SetupRouter(albums)
+	token := registerCustomer(t, router, "ella@example.com")
+	since := time.Now().UTC().Add(-time.Second).Format(time.RFC3339)
+	generatedID := regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+	rr := wishlistRequest(router, http.MethodPut, "/albums", `{"title":"Kind of Blue","artist":"Miles Davis","price":"29.99"}`,
+		http.Header{"Authorization": {"Bearer " + token}, "X-Request-Id": {"create-1"}})
+	var album struct{ ID int64 }
+	if err := json.Unmarshal(rr.Body.Bytes(), &album); err != nil || album.ID == 0 {
+		t.Fatalf("Failed to create album: %v %v", rr.Body, err)
+	}
+	if id := rr.Header().Get("X-Request-ID"); id != "create-1" {
+		t.Errorf("Expected the client's request id to be echoed, got %q", id)
+	}
+	url := "/albums/" + strconv.FormatInt(album.ID, 10)
+
+	writes := []struct {
+		method       string
+		url          string
+		header       http.Header
+		body         string
+		expectedCode int
+	}{
+		{http.MethodPatch, url, http.Header{"Authorization": {"Bearer " + token}, "X-Request-Id": {"price-1"}}, `{"price":"19.99"}`, http.StatusOK},
+		// Writes that fail are not logged
+		{http.MethodPatch, url, http.Header{"If-Match": {`"1"`}}, `{"price":"9.99"}`, http.StatusPreconditionFailed},
+		{http.MethodDelete, url, nil, "", http.StatusOK},
+		{http.MethodPost, url + "/restore", http.Header{"Authorization": {"Bearer " + staffToken}, "X-Request-Id": {"not a valid id"}}, "", http.StatusOK},
+		{http.MethodDelete, url, nil, "", http.StatusOK},
+	}
+
+	var requestIDs []string
+	for _, tt := range writes {
+		rr := wishlistRequest(router, tt.method, tt.url, tt.body, tt.header)
+		if rr.Code != tt.expectedCode {
+			t.Fatalf("%v %v returned wrong status code: got %v want %v: %v", tt.method, tt.url, rr.Code, tt.expectedCode, rr.Body)
+		}
+		requestIDs = append(requestIDs, rr.Header().Get("X-Request-ID"))
+	}
+	for _, id := range requestIDs[2:] {
+		if !generatedID.MatchString(id) {
+			t.Errorf("Expected a generated request id, got %q", id)
+		}
+	}
+
+	if _, err := albums.PurgeTrash(context.Background(), 0, time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("Failed to purge the trash: %v", err)
+	}
+
+	// The history outlives the album, newest first, a page at a time
+	var history []AuditEntry
+	for next := url + "/history?limit=4"; next != ""; {
+		rr := authRequest(router, http.MethodGet, next, "", staffToken)
+		var page AuditPage
+		if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+			t.Fatalf("GET %v returned an unexpected page %v: %v", next, rr.Body, err)
+		}
+
+		history = append(history, page.Data...)
+		next = ""
+		if page.Next != nil {
+			next = url + "/history?limit=4&cursor=" + *page.Next
+		}
+	}
+
+	expected := []struct {
+		action    AuditAction
+		actor     string
+		requestID string
+		changes   string
+	}{
+		{AuditPurge, systemActor, "", `"title":{"before":"Kind of Blue","after":null}`},
+		{AuditDelete, "anonymous", requestIDs[4], `"price":{"before":"19.99","after":null}`},
+		{AuditRestore, "staff", requestIDs[3], `"artist":{"before":null,"after":"Miles Davis"}`},
+		{AuditDelete, "anonymous", requestIDs[2], `"currency":{"before":"USD","after":null}`},
+		{AuditUpdate, "customer:1", "price-1", `{"price":{"before":"29.99","after":"19.99"}}`},
+		{AuditCreate, "customer:1", "create-1", `"title":{"before":null,"after":"Kind of Blue"}`},
+	}
+	if len(history) != len(expected) {
+		t.Fatalf("Unexpected history: got %+v want %v entries", history, len(expected))
+	}
+	for i, entry := range history {
+		changes, _ := json.Marshal(entry.Changes)
+		want := expected[i]
+		if entry.AlbumID != album.ID || entry.Action != want.action || entry.Actor != want.actor || entry.RequestID != want.requestID ||
+			!strings.Contains(string(changes), want.changes) {
+			t.Errorf("Unexpected history entry %v: got %+v %s want %+v", i, entry, changes, want)
+		}
+		if i > 0 && entry.CreatedAt.After(history[i-1].CreatedAt) {
+			t.Errorf("Expected history entry %v to be older than the one before it", i)
+		}
+	}
+
+	until := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+	tests := []struct {
+		url          string
+		expectedCode int
+		expected     string
+	}{
+		{fmt.Sprintf("/audit?since=%v&until=%v&limit=1", since, until), http.StatusOK, fmt.Sprintf(`{"data":[{"id":%v,"album_id":%v,"action":"purge","actor":"system",`, history[0].ID, album.ID)},
+		{"/audit?since=" + until, http.StatusOK, `{"data":[],"next":null}`},
+		{"/audit?since=yesterday", http.StatusBadRequest, `{"errors":"since must be a time such as 2006-01-02T15:04:05Z"}`},
+		{"/audit?since=" + until + "&until=" + since, http.StatusBadRequest, `{"errors":"since must be before until"}`},
+		{"/audit?cursor=x", http.StatusBadRequest, `{"errors":"invalid cursor"}`},
+		{"/audit?limit=0", http.StatusBadRequest, `{"errors":"limit must be a number between 1 and 100"}`},
+		{url + "/history?since=" + until, http.StatusOK, `{"data":[],"next":null}`},
+		{"/albums/999/history", http.StatusOK, `{"data":[],"next":null}`},
+		{"/albums/x/history", http.StatusBadRequest, `{"errors":"invalid album id"}`},
+	}
+
+	for _, tt := range tests {
+		rr := authRequest(router, http.MethodGet, tt.url, "", staffToken)
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("GET %v returned wrong status code: got %v want %v", tt.url, status, tt.expectedCode)
+		}
+
+		if actual := strings.TrimSpace(rr.Body.String()); !strings.Contains(actual, tt.expected) {
+			t.Errorf("GET %v returned unexpected body: got %v want %v", tt.url, actual, tt.expected)
+		}
+	}
+
+	// Entries made before the range are left out
+	rr = authRequest(router, http.MethodGet, "/audit?until="+since+"&limit=100", "", staffToken)
+	var page AuditPage
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatalf("Unexpected audit page %v: %v", rr.Body, err)
+	}
+	if slices.ContainsFunc(page.Data, func(entry AuditEntry) bool { return entry.AlbumID == album.ID }) {
+		t.Errorf("Expected no entries for album %v before %v, got %v", album.ID, since, rr.Body)
+	}
+
+	// Only staff read the log
+	for _, url := range []string{"/audit", url + "/history"} {
+		if rr := shopRequest(router, http.MethodGet, url, ""); rr.Code != http.StatusUnauthorized {
+			t.Errorf("GET %v returned wrong status code for an anonymous request: got %v want %v", url, rr.Code, http.StatusUnauthorized)
+		}
+		if rr := authRequest(router, http.MethodGet, url, "", token); rr.Code != http.StatusForbidden ||
+			strings.TrimSpace(rr.Body.String()) != `{"errors":"only staff can do this"}` {
+			t.Errorf("GET %v returned an unexpected response for a customer: %v %v", url, rr.Code, rr.Body)
+		}
+	}
+}
+
+// TestAudit_Rollback checks that an album write is rolled back when its
+// audit entry cannot be written.
+func TestAudit_Rollback(t *testing.T) {
+	db, mock := getMockDB(t)
+	defer db.Close()
+
+	store := &SQLStore{Db: db, Driver: "postgres"}
+	price := money.MustParse("12.99", "USD")
+
+	mock.ExpectBegin()
+	expectAlbumLock(mock, 7, "Album1", "Artist1", "10.99")
+	mock.ExpectPrepare(`UPDATE album SET price = \$1, currency = \$2, version = version \+ 1 WHERE id = \$3 AND deleted_at IS NULL`).
+		ExpectExec().
+		WithArgs("12.99", "USD", 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO album_audit`).
+		WillReturnError(fmt.Errorf("insert error"))
+	mock.ExpectRollback()
+
+	if err := store.Update(context.Background(), 7, AlbumUpdate{Price: &price}); err == nil || err.Error() != "insert error" {
+		t.Errorf("Expected the audit error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %v", err)
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id       string
+		expected bool
+	}{
+		{"3f2c9a1e-1b7d-4c8e-9f6a-2d5b8e0c4a71", true},
+		{"web:checkout.42_a", true},
+		{"", false},
+		{"has space", false},
+		{"new\nline", false},
+		{strings.Repeat("a", maxRequestIDLength), true},
+		{strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+
+	for _, tt := range tests {
+		if actual := validRequestID(tt.id); actual != tt.expected {
+			t.Errorf("validRequestID(%q) = %v, want %v", tt.id, actual, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrSessionNotFound is returned by a CustomerStore when no unexpired session
+// has the given token hash.
+var ErrSessionNotFound = errors.New("session not found")
+
+// sessionTTL is how long a session token can be used after logging in.
+const sessionTTL = 30 * 24 * time.Hour
+
+// Session lets the holder of a token act as a customer until ExpiresAt. Only
+// the SHA-256 of the token is stored.
+type Session struct {
+	TokenHash  string
+	CustomerID int64
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+}
+
+// principal is the customer a request was authenticated as, and the session
+// it was authenticated with, or staff authenticated with the staff token.
+type principal struct {
+	customer  Customer
+	tokenHash string
+	staff     bool
+}
+
+type principalKey struct{}
+
+// CurrentCustomer returns the customer the request context was authenticated
+// as by Authenticate. Staff are not customers.
+func CurrentCustomer(ctx context.Context) (Customer, bool) {
+	p, ok := ctx.Value(principalKey{}).(principal)
+
+	return p.customer, ok && !p.staff
+}
+
+// isStaff reports whether the request context was authenticated with the
+// staff token.
+func isStaff(ctx context.Context) bool {
+	p, ok := ctx.Value(principalKey{}).(principal)
+
+	return ok && p.staff
+}
+
+// Authenticate is middleware that authenticates requests carrying an
+// "Authorization: Bearer <token>" header as the token's customer, or as staff
+// for the staff token. Requests without one pass through anonymously, and
+// those with an unknown or expired token are refused.
+func (a *Albums) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if a.StaffToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.StaffToken)) == 1 {
+			ctx := context.WithValue(r.Context(), principalKey{}, principal{staff: true})
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		tokenHash := hashToken(token)
+		customer, err := a.Customers.SessionCustomer(r.Context(), tokenHash, time.Now())
+		if errors.Is(err, ErrSessionNotFound) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			ServeJSONError(w, "invalid or expired session", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			ServeJSONError(w, fmt.Sprintf("Authenticate %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalKey{}, principal{customer: customer, tokenHash: tokenHash})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireCustomer returns the principal of a request authenticated as a
+// customer. It writes a 401 response and returns false for anonymous ones,
+// and a 403 response for staff.
+func requireCustomer(w http.ResponseWriter, r *http.Request) (principal, bool) {
+	p, ok := r.Context().Value(principalKey{}).(principal)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		ServeJSONError(w, "authentication required", http.StatusUnauthorized)
+		return principal{}, false
+	}
+	if p.staff {
+		ServeJSONError(w, "staff have no customer account", http.StatusForbidden)
+		return principal{}, false
+	}
+
+	return p, true
+}
+
+// requireLogin writes a 401 response and returns false for anonymous
+// requests, and lets those of customers and staff through.
+func requireLogin(w http.ResponseWriter, r *http.Request) bool {
+	if _, ok := r.Context().Value(principalKey{}).(principal); !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		ServeJSONError(w, "authentication required", http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
+
+// requireStaff writes a 401 response for anonymous requests and a 403 one
+// for customers, and returns false unless the request is made by staff.
+func requireStaff(w http.ResponseWriter, r *http.Request) bool {
+	if !requireLogin(w, r) {
+		return false
+	}
+	if !isStaff(r.Context()) {
+		ServeJSONError(w, "only staff can do this", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// bearerToken returns the token of the request's Authorization header, if it
+// uses the Bearer scheme.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+
+	return strings.TrimSpace(token), true
+}
+
+// newSessionToken returns a random token of 256 bits.
+func newSessionToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// hashToken returns the SHA-256 of token in hex, the form sessions are stored
+// under. Tokens are random, so a fast hash is enough.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,305 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+)
+
+func (s *MemoryStore) CreateCart(ctx context.Context, cart Cart) (Cart, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cart.Items = nil
+	s.carts[cart.ID] = cart
+
+	return cart, nil
+}
+
+func (s *MemoryStore) GetCart(ctx context.Context, id string) (Cart, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cart(id)
+}
+
+func (s *MemoryStore) SetCartItem(ctx context.Context, cartID string, albumID int64, quantity int, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cart, ok := s.carts[cartID]
+	if !ok {
+		return ErrCartNotFound
+	}
+	album, ok := s.albums[albumID]
+	if !ok {
+		return ErrAlbumNotFound
+	}
+
+	items := slices.DeleteFunc(slices.Clone(cart.Items), func(item CartItem) bool { return item.AlbumID == albumID })
+	for _, item := range items {
+		if s.albums[item.AlbumID].Price.Currency != album.Price.Currency {
+			return ErrCurrencyMismatch
+		}
+	}
+
+	cart.Items = append(items, CartItem{AlbumID: albumID, Quantity: quantity})
+	slices.SortFunc(cart.Items, func(a, b CartItem) int { return cmp.Compare(a.AlbumID, b.AlbumID) })
+	cart.UpdatedAt = now
+	s.carts[cartID] = cart
+
+	return nil
+}
+
+func (s *MemoryStore) RemoveCartItem(ctx context.Context, cartID string, albumID int64, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cart, ok := s.carts[cartID]
+	if !ok {
+		return ErrCartNotFound
+	}
+
+	items := slices.DeleteFunc(slices.Clone(cart.Items), func(item CartItem) bool { return item.AlbumID == albumID })
+	if len(items) == len(cart.Items) {
+		return ErrCartItemNotFound
+	}
+
+	cart.Items, cart.UpdatedAt = items, now
+	s.carts[cartID] = cart
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteCart(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.carts[id]; !ok {
+		return ErrCartNotFound
+	}
+
+	delete(s.carts, id)
+
+	return nil
+}
+
+// cart returns the cart with id, its items filled in from their albums.
+// Callers must hold s.mu.
+func (s *MemoryStore) cart(id string) (Cart, error) {
+	cart, ok := s.carts[id]
+	if !ok {
+		return Cart{}, ErrCartNotFound
+	}
+
+	items := make([]CartItem, len(cart.Items))
+	for i, item := range cart.Items {
+		album := s.albums[item.AlbumID]
+		items[i] = CartItem{AlbumID: album.ID, Title: album.Title, Artist: album.Artist, Quantity: item.Quantity, Price: album.Price}
+	}
+	cart.Items = items
+
+	return cart, nil
+}
+
+// unlinkSales takes a deleted album out of every cart and clears it from the
+// items of past orders and wishlists, which keep their copy of its details.
+// Callers must hold s.mu.
+func (s *MemoryStore) unlinkSales(albumID int64) {
+	for id, cart := range s.carts {
+		cart.Items = slices.DeleteFunc(slices.Clone(cart.Items), func(item CartItem) bool { return item.AlbumID == albumID })
+		s.carts[id] = cart
+	}
+	for _, order := range s.orders {
+		for i, item := range order.Items {
+			if item.AlbumID != nil && *item.AlbumID == albumID {
+				order.Items[i].AlbumID = nil
+			}
+		}
+	}
+	for _, wishlist := range s.wishlists {
+		for i, item := range wishlist.Items {
+			if item.AlbumID != nil && *item.AlbumID == albumID {
+				wishlist.Items[i].AlbumID = nil
+			}
+		}
+	}
+}
+
+func (s *SQLStore) CreateCart(ctx context.Context, cart Cart) (Cart, error) {
+	_, err := s.Db.ExecContext(ctx, s.rebind(`INSERT INTO cart (id, customer_id, created_at, updated_at) VALUES (?, ?, ?, ?)`),
+		cart.ID, cart.CustomerID, cart.CreatedAt.UTC(), cart.UpdatedAt.UTC())
+	if err != nil {
+		return Cart{}, err
+	}
+
+	cart.Items = nil
+
+	return cart, nil
+}
+
+func (s *SQLStore) GetCart(ctx context.Context, id string) (Cart, error) {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return Cart{}, err
+	}
+	defer tx.Rollback()
+
+	cart, err := s.cart(ctx, tx, id, false)
+	if err != nil {
+		return Cart{}, err
+	}
+
+	return cart, tx.Commit()
+}
+
+// SetCartItem replaces the item rather than upserting it, since each database
+// spells upserts differently.
+func (s *SQLStore) SetCartItem(ctx context.Context, cartID string, albumID int64, quantity int, now time.Time) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.touchCart(ctx, tx, cartID, now); err != nil {
+		return err
+	}
+
+	var currency string
+	err = tx.QueryRowContext(ctx, s.rebind(`SELECT currency FROM album WHERE id = ? AND deleted_at IS NULL`), albumID).Scan(&currency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAlbumNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var others int
+	err = tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM cart_item i JOIN album a ON a.id = i.album_id WHERE i.cart_id = ? AND i.album_id <> ? AND a.currency <> ?`),
+		cartID, albumID, currency).Scan(&others)
+	if err != nil {
+		return err
+	}
+	if others > 0 {
+		return ErrCurrencyMismatch
+	}
+
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM cart_item WHERE cart_id = ? AND album_id = ?`), cartID, albumID); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO cart_item (cart_id, album_id, quantity) VALUES (?, ?, ?)`), cartID, albumID, quantity)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) RemoveCartItem(ctx context.Context, cartID string, albumID int64, now time.Time) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.touchCart(ctx, tx, cartID, now); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM cart_item WHERE cart_id = ? AND album_id = ?`), cartID, albumID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCartItemNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) DeleteCart(ctx context.Context, id string) error {
+	result, err := s.Db.ExecContext(ctx, s.rebind(`DELETE FROM cart WHERE id = ?`), id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCartNotFound
+	}
+
+	return nil
+}
+
+// cart reads the cart with id and its items at their albums' current prices,
+// locking the cart row until tx ends when lock is set.
+func (s *SQLStore) cart(ctx context.Context, tx *sql.Tx, id string, lock bool) (Cart, error) {
+	query := `SELECT customer_id, created_at, updated_at FROM cart WHERE id = ?`
+	if lock && s.Driver != "sqlite" {
+		query += ` FOR UPDATE`
+	}
+
+	cart := Cart{ID: id}
+	var customerID sql.NullInt64
+	err := tx.QueryRowContext(ctx, s.rebind(query), id).Scan(&customerID, timeScanner{&cart.CreatedAt}, timeScanner{&cart.UpdatedAt})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Cart{}, ErrCartNotFound
+	}
+	if err != nil {
+		return Cart{}, err
+	}
+	if customerID.Valid {
+		cart.CustomerID = &customerID.Int64
+	}
+
+	rows, err := tx.QueryContext(ctx, s.rebind(`SELECT a.id, a.title, a.artist, a.currency, a.price, i.quantity FROM cart_item i`+
+		` JOIN album a ON a.id = i.album_id WHERE i.cart_id = ? ORDER BY a.id`), id)
+	if err != nil {
+		return Cart{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item CartItem
+		if err := rows.Scan(&item.AlbumID, &item.Title, &item.Artist, &item.Price.Currency, &item.Price, &item.Quantity); err != nil {
+			return Cart{}, err
+		}
+		cart.Items = append(cart.Items, item)
+	}
+
+	return cart, rows.Err()
+}
+
+// touchCart locks the cart row until tx ends and marks the cart as changed
+// at now, or returns ErrCartNotFound.
+func (s *SQLStore) touchCart(ctx context.Context, tx *sql.Tx, id string, now time.Time) error {
+	query := `SELECT id FROM cart WHERE id = ?`
+	if s.Driver != "sqlite" {
+		query += ` FOR UPDATE`
+	}
+
+	err := tx.QueryRowContext(ctx, s.rebind(query), id).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrCartNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`UPDATE cart SET updated_at = ? WHERE id = ?`), now.UTC(), id)
+
+	return err
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-web-service/money"
+)
+
+var (
+	// ErrCartNotFound is returned by a CartStore when no cart has the given id.
+	ErrCartNotFound = errors.New("cart not found")
+	// ErrCartItemNotFound is returned when the cart does not hold the album.
+	ErrCartItemNotFound = errors.New("album is not in the cart")
+	// ErrCurrencyMismatch is returned when a cart would hold albums priced in
+	// more than one currency, which cannot be added up into one order.
+	ErrCurrencyMismatch = errors.New("cart items must all be priced in the same currency")
+)
+
+// maxCartQuantity caps the copies of one album in a cart.
+const maxCartQuantity = 99
+
+// Cart collects albums before checkout. Its id is an unguessable token, so
+// holding it is what lets a caller see and change the cart; CustomerID is set
+// for carts created by a logged in customer. Items are priced at their album's
+// current price, and Total is null while the items mix currencies.
+type Cart struct {
+	ID         string       `json:"id"`
+	CustomerID *int64       `json:"customer_id"`
+	Items      []CartItem   `json:"items"`
+	Currency   string       `json:"currency"`
+	Total      *money.Money `json:"total"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// CartItem is Quantity copies of an album in a cart.
+type CartItem struct {
+	AlbumID  int64       `json:"album_id"`
+	Title    string      `json:"title"`
+	Artist   string      `json:"artist"`
+	Quantity int         `json:"quantity"`
+	Price    money.Money `json:"price"`
+	Subtotal money.Money `json:"subtotal"`
+}
+
+// price sets the subtotal of each item and the cart's currency and total.
+// An empty cart is priced at zero in DefaultCurrency.
+func (c *Cart) price() {
+	if c.Items == nil {
+		c.Items = []CartItem{}
+	}
+
+	c.Currency, c.Total = DefaultCurrency, nil
+	if len(c.Items) > 0 {
+		c.Currency = c.Items[0].Price.Currency
+	}
+
+	total, mixed := money.New(0, c.Currency), false
+	for i, item := range c.Items {
+		c.Items[i].Subtotal = money.New(item.Price.Amount*int64(item.Quantity), item.Price.Currency)
+		total.Amount += c.Items[i].Subtotal.Amount
+		mixed = mixed || item.Price.Currency != c.Currency
+	}
+
+	if mixed {
+		c.Currency = ""
+		return
+	}
+	c.Total = &total
+}
+
+// CartStore is the persistence layer the cart handlers depend on. Carts are
+// changed at now, which callers pass in.
+type CartStore interface {
+	CreateCart(ctx context.Context, cart Cart) (Cart, error)
+	// GetCart returns the cart with its items in album id order, each at its
+	// album's current price. Items whose album was deleted are gone.
+	GetCart(ctx context.Context, id string) (Cart, error)
+	// SetCartItem puts quantity copies of the album in the cart, replacing
+	// any there already. It returns ErrCurrencyMismatch when the album is
+	// priced in another currency than the rest of the cart.
+	SetCartItem(ctx context.Context, cartID string, albumID int64, quantity int, now time.Time) error
+	RemoveCartItem(ctx context.Context, cartID string, albumID int64, now time.Time) error
+	DeleteCart(ctx context.Context, id string) error
+}
+
+// AddCart creates an empty cart, which belongs to the authenticated customer
+// or is anonymous. The cart's id is needed for every later request about it.
+func (a *Albums) AddCart(w http.ResponseWriter, r *http.Request) {
+	var customerID *int64
+	if customer, ok := CurrentCustomer(r.Context()); ok {
+		customerID = &customer.ID
+	}
+
+	id, err := newCartID()
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("AddCart %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	cart, err := a.Carts.CreateCart(r.Context(), Cart{ID: id, CustomerID: customerID, CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("AddCart %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	cart.price()
+	ServeJSON(w, cart, http.StatusOK)
+}
+
+// GetCart serves a cart with its items at their albums' current prices.
+func (a *Albums) GetCart(w http.ResponseWriter, r *http.Request) {
+	id, _, ok := cartPath(w, r)
+	if !ok {
+		return
+	}
+
+	a.serveCart(w, r, id, "GetCart")
+}
+
+// SetCartItem puts copies of an album in a cart, as in
+// {"album_id":3,"quantity":2}, and serves the cart. The quantity replaces any
+// already in the cart and defaults to 1.
+func (a *Albums) SetCartItem(w http.ResponseWriter, r *http.Request) {
+	id, _, ok := cartPath(w, r)
+	if !ok {
+		return
+	}
+
+	if !isJSON(r) {
+		ServeJSONError(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var input struct {
+		AlbumID  *int64 `json:"album_id"`
+		Quantity *int   `json:"quantity"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		ServeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var errs ValidationErrors
+	if input.AlbumID == nil {
+		errs.Add("album_id", "is required")
+	}
+	quantity := 1
+	if input.Quantity != nil {
+		if *input.Quantity < 1 || *input.Quantity > maxCartQuantity {
+			errs.Add("quantity", fmt.Sprintf("must be between 1 and %d", maxCartQuantity))
+		}
+		quantity = *input.Quantity
+	}
+	if len(errs) > 0 {
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	err := a.Carts.SetCartItem(r.Context(), id, *input.AlbumID, quantity, time.Now().UTC().Truncate(time.Second))
+	switch {
+	case errors.Is(err, ErrCartNotFound):
+		ServeJSONError(w, "cart not found", http.StatusNotFound)
+	case errors.Is(err, ErrAlbumNotFound):
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+	case errors.Is(err, ErrCurrencyMismatch):
+		ServeJSONError(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		ServeJSONError(w, fmt.Sprintf("SetCartItem %v", err), http.StatusInternalServerError)
+	default:
+		a.serveCart(w, r, id, "SetCartItem")
+	}
+}
+
+// DeleteCartItem takes an album out of a cart and serves the cart.
+func (a *Albums) DeleteCartItem(w http.ResponseWriter, r *http.Request) {
+	id, albumID, ok := cartPath(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.Carts.RemoveCartItem(r.Context(), id, albumID, time.Now().UTC().Truncate(time.Second))
+	switch {
+	case errors.Is(err, ErrCartNotFound):
+		ServeJSONError(w, "cart not found", http.StatusNotFound)
+	case errors.Is(err, ErrCartItemNotFound):
+		ServeJSONError(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		ServeJSONError(w, fmt.Sprintf("DeleteCartItem %v", err), http.StatusInternalServerError)
+	default:
+		a.serveCart(w, r, id, "DeleteCartItem")
+	}
+}
+
+func (a *Albums) DeleteCart(w http.ResponseWriter, r *http.Request) {
+	id, _, ok := cartPath(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.Carts.DeleteCart(r.Context(), id)
+	switch {
+	case errors.Is(err, ErrCartNotFound):
+		ServeJSONError(w, "cart not found", http.StatusNotFound)
+	case err != nil:
+		ServeJSONError(w, "could not delete cart", http.StatusInternalServerError)
+	default:
+		ServeJSON(w, map[string]any{"message": "cart successfully removed"}, http.StatusOK)
+	}
+}
+
+func (a *Albums) serveCart(w http.ResponseWriter, r *http.Request, id string, handler string) {
+	cart, err := a.Carts.GetCart(r.Context(), id)
+	if errors.Is(err, ErrCartNotFound) {
+		ServeJSONError(w, "cart not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+		return
+	}
+
+	cart.price()
+	ServeJSON(w, cart, http.StatusOK)
+}
+
+// newCartID returns a random cart id of 32 hex digits.
+func newCartID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// validCartID reports whether id has the form newCartID gives ids.
+func validCartID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+
+	return err == nil && strings.ToLower(id) == id
+}
+
+// cartPath parses the cart id, and the album id if there is one, of a
+// /carts/{id}, /carts/{id}/items or /carts/{id}/items/{album} path. It writes
+// a 400 response and returns false when either is malformed.
+func cartPath(w http.ResponseWriter, r *http.Request) (string, int64, bool) {
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/carts/"), "/")
+
+	if !validCartID(segments[0]) {
+		ServeJSONError(w, "invalid cart id", http.StatusBadRequest)
+		return "", 0, false
+	}
+
+	var albumID int64
+	if len(segments) > 2 {
+		var err error
+		if albumID, err = strconv.ParseInt(segments[2], 10, 64); err != nil || len(segments) > 3 {
+			ServeJSONError(w, "invalid album id", http.StatusBadRequest)
+			return "", 0, false
+		}
+	}
+
+	return segments[0], albumID, true
+}
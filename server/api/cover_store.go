@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *MemoryStore) Cover(ctx context.Context, albumID int64) (Cover, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cover, ok := s.covers[albumID]
+	if !ok {
+		return Cover{}, ErrCoverNotFound
+	}
+
+	return cover, nil
+}
+
+func (s *MemoryStore) SetCover(ctx context.Context, cover Cover) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.albums[cover.AlbumID]; !ok {
+		return ErrAlbumNotFound
+	}
+
+	s.covers[cover.AlbumID] = cover
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteCover(ctx context.Context, albumID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.covers[albumID]; !ok {
+		return ErrCoverNotFound
+	}
+
+	delete(s.covers, albumID)
+
+	return nil
+}
+
+func (s *SQLStore) Cover(ctx context.Context, albumID int64) (Cover, error) {
+	cover := Cover{AlbumID: albumID}
+
+	err := s.Db.QueryRowContext(ctx, s.rebind(`SELECT content_type, size, width, height, checksum, updated_at FROM album_cover WHERE album_id = ?`), albumID).
+		Scan(&cover.ContentType, &cover.Size, &cover.Width, &cover.Height, &cover.Checksum, timeScanner{&cover.UpdatedAt})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Cover{}, ErrCoverNotFound
+	}
+
+	return cover, err
+}
+
+// SetCover replaces the cover row rather than upserting it, since each
+// database spells upserts differently.
+func (s *SQLStore) SetCover(ctx context.Context, cover Cover) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var albums int
+	if err := tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM album WHERE id = ? AND deleted_at IS NULL`), cover.AlbumID).Scan(&albums); err != nil {
+		return err
+	}
+	if albums == 0 {
+		return ErrAlbumNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM album_cover WHERE album_id = ?`), cover.AlbumID); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO album_cover (album_id, content_type, size, width, height, checksum, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`),
+		cover.AlbumID, cover.ContentType, cover.Size, cover.Width, cover.Height, cover.Checksum, cover.UpdatedAt.UTC())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) DeleteCover(ctx context.Context, albumID int64) error {
+	result, err := s.Db.ExecContext(ctx, s.rebind(`DELETE FROM album_cover WHERE album_id = ?`), albumID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrCoverNotFound
+	}
+
+	return nil
+}
+
+// timeScanner scans a TIMESTAMP column into a UTC time.Time. Drivers return
+// the column as a time.Time, or as text when, like MySQL without parseTime,
+// they leave parsing to the caller.
+type timeScanner struct {
+	t *time.Time
+}
+
+// timestampLayouts are the text forms drivers return timestamps in.
+var timestampLayouts = []string{"2006-01-02 15:04:05.999999999-07:00", time.RFC3339Nano, "2006-01-02 15:04:05.999999999"}
+
+func (s timeScanner) Scan(src any) error {
+	switch v := src.(type) {
+	case time.Time:
+		*s.t = v.UTC()
+		return nil
+	case []byte:
+		return s.Scan(string(v))
+	case string:
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				*s.t = t.UTC()
+				return nil
+			}
+		}
+		return fmt.Errorf("scan timestamp %q: unknown format", v)
+	default:
+		return fmt.Errorf("scan timestamp: unsupported type %T", src)
+	}
+}
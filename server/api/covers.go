@@ -0,0 +1,383 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-web-service/blob"
+)
+
+// ErrCoverNotFound is returned by a CoverStore when the album has no cover.
+var ErrCoverNotFound = errors.New("cover not found")
+
+const (
+	// maxCoverBytes caps the size of an uploaded cover image.
+	maxCoverBytes = 10 << 20
+	// maxCoverDimension caps the width and height of a cover, which bounds
+	// the memory a thumbnail needs however well the image compresses.
+	maxCoverDimension = 6000
+	// coverCacheControl lets clients reuse a cover for an hour before
+	// revalidating it by its ETag.
+	coverCacheControl = "public, max-age=3600"
+)
+
+// coverTypes are the image types a cover can be, by their sniffed content type.
+var coverTypes = []string{"image/jpeg", "image/png"}
+
+// thumbnailSizes are the sizes thumbnails can be asked for in, as the
+// longest side in pixels. Keeping the list short bounds the thumbnails
+// kept per cover.
+var thumbnailSizes = []int{64, 128, 256, 512}
+
+// Cover describes an album's cover image. The image itself is kept in a
+// blob.Store under a key made from its Checksum, a hex SHA-256.
+type Cover struct {
+	AlbumID     int64     `json:"album_id"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	Checksum    string    `json:"checksum"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// key returns the blob key of the cover image, or of its thumbnail when
+// size is not zero.
+func (c Cover) key(size int) string {
+	name := "original"
+	if size != 0 {
+		name = strconv.Itoa(size)
+	}
+
+	return fmt.Sprintf("covers/%d/%v/%v", c.AlbumID, c.Checksum, name)
+}
+
+// etag returns the entity tag of the cover image or its thumbnail.
+func (c Cover) etag(size int) string {
+	if size == 0 {
+		return `"` + c.Checksum + `"`
+	}
+
+	return fmt.Sprintf(`"%v-%d"`, c.Checksum, size)
+}
+
+// CoverStore is the persistence layer the cover handlers depend on. It
+// keeps what is known about covers; the images are kept in a blob.Store.
+type CoverStore interface {
+	Cover(ctx context.Context, albumID int64) (Cover, error)
+	// SetCover replaces the album's cover, returning ErrAlbumNotFound when
+	// there is no such album.
+	SetCover(ctx context.Context, cover Cover) error
+	DeleteCover(ctx context.Context, albumID int64) error
+}
+
+// UploadCover sets an album's cover from the "cover" field of a
+// multipart/form-data request. The image must be a JPEG or PNG, which is
+// sniffed from its content rather than trusted from the request.
+func (a *Albums) UploadCover(w http.ResponseWriter, r *http.Request) {
+	albumID, ok := coverPath(w, r)
+	if !ok {
+		return
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "multipart/form-data" {
+		ServeJSONError(w, "Content-Type must be multipart/form-data", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	data, err := readCover(w, r)
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		ServeJSONError(w, fmt.Sprintf("cover must not be larger than %d bytes", maxCoverBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		ServeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cover, errs := newCover(albumID, data)
+	if len(errs) > 0 {
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	if _, err := a.Store.Get(r.Context(), albumID); errors.Is(err, ErrAlbumNotFound) {
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		ServeJSONError(w, fmt.Sprintf("UploadCover %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	previous, err := a.Covers.Cover(r.Context(), albumID)
+	if err != nil && !errors.Is(err, ErrCoverNotFound) {
+		ServeJSONError(w, fmt.Sprintf("UploadCover %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// The image is stored before the cover points at it, so a failure leaves
+	// at worst an unused blob rather than a cover without an image.
+	if err := a.Blobs.Put(r.Context(), cover.key(0), bytes.NewReader(data), cover.ContentType); err != nil {
+		ServeJSONError(w, fmt.Sprintf("UploadCover %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	err = a.Covers.SetCover(r.Context(), cover)
+	if errors.Is(err, ErrAlbumNotFound) {
+		a.removeCoverBlobs(r.Context(), cover)
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("UploadCover %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if previous.Checksum != "" && previous.Checksum != cover.Checksum {
+		a.removeCoverBlobs(r.Context(), previous)
+	}
+
+	ServeJSON(w, cover, http.StatusOK)
+}
+
+// GetCover serves an album's cover image, or with size=256 a thumbnail no
+// larger than 256 pixels on either side. Thumbnails are made the first
+// time they are asked for and kept alongside the image. Responses carry an
+// ETag and Last-Modified for caching and honor Range requests.
+func (a *Albums) GetCover(w http.ResponseWriter, r *http.Request) {
+	albumID, ok := coverPath(w, r)
+	if !ok {
+		return
+	}
+
+	var size int
+	if s := r.URL.Query().Get("size"); s != "" {
+		size, _ = strconv.Atoi(s)
+		if !slices.Contains(thumbnailSizes, size) {
+			ServeJSONError(w, "size must be one of "+joinInts(thumbnailSizes), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Covers are kept in the trash with their album, until it is purged
+	if _, err := a.Store.Get(r.Context(), albumID); errors.Is(err, ErrAlbumNotFound) {
+		ServeJSONError(w, "cover not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		ServeJSONError(w, fmt.Sprintf("GetCover %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	cover, err := a.Covers.Cover(r.Context(), albumID)
+	if errors.Is(err, ErrCoverNotFound) {
+		ServeJSONError(w, "cover not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("GetCover %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := a.coverImage(r.Context(), cover, size)
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("GetCover %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", cover.ContentType)
+	w.Header().Set("ETag", cover.etag(size))
+	w.Header().Set("Cache-Control", coverCacheControl)
+	http.ServeContent(w, r, "", cover.UpdatedAt, bytes.NewReader(data))
+}
+
+func (a *Albums) DeleteCover(w http.ResponseWriter, r *http.Request) {
+	albumID, ok := coverPath(w, r)
+	if !ok {
+		return
+	}
+
+	cover, err := a.Covers.Cover(r.Context(), albumID)
+	if err == nil {
+		err = a.Covers.DeleteCover(r.Context(), albumID)
+	}
+	if errors.Is(err, ErrCoverNotFound) {
+		ServeJSONError(w, "cover not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		ServeJSONError(w, "could not delete cover", http.StatusInternalServerError)
+		return
+	}
+
+	a.removeCoverBlobs(r.Context(), cover)
+
+	ServeJSON(w, map[string]any{"message": "cover successfully removed"}, http.StatusOK)
+}
+
+// coverImage reads the cover image, or its thumbnail of size, making the
+// thumbnail when it is not kept yet.
+func (a *Albums) coverImage(ctx context.Context, cover Cover, size int) ([]byte, error) {
+	data, err := a.readBlob(ctx, cover.key(size))
+	if size == 0 || !errors.Is(err, blob.ErrNotFound) {
+		return data, err
+	}
+
+	original, err := a.readBlob(ctx, cover.key(0))
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return nil, err
+	}
+
+	var encoded bytes.Buffer
+	if err := encodeCover(&encoded, thumbnail(img, size), cover.ContentType); err != nil {
+		return nil, err
+	}
+
+	// Failing to keep the thumbnail only means making it again next time.
+	_ = a.Blobs.Put(ctx, cover.key(size), bytes.NewReader(encoded.Bytes()), cover.ContentType)
+
+	return encoded.Bytes(), nil
+}
+
+func (a *Albums) readBlob(ctx context.Context, key string) ([]byte, error) {
+	body, err := a.Blobs.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
+
+// removeCoverBlobs deletes the cover image and its thumbnails. Failures are
+// ignored: the cover no longer points at them, so they are only wasted space.
+func (a *Albums) removeCoverBlobs(ctx context.Context, cover Cover) {
+	_ = a.Blobs.Delete(ctx, cover.key(0))
+	for _, size := range thumbnailSizes {
+		_ = a.Blobs.Delete(ctx, cover.key(size))
+	}
+}
+
+// readCover reads the "cover" file of a multipart request, or returns nil
+// when the request has no such field.
+func readCover(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	// Leave room for the multipart headers and boundaries around the image.
+	r.Body = http.MaxBytesReader(w, r.Body, maxCoverBytes+64<<10)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if part.FormName() == "cover" {
+			data, err := io.ReadAll(io.LimitReader(part, maxCoverBytes+1))
+			if err == nil && len(data) > maxCoverBytes {
+				err = &http.MaxBytesError{Limit: maxCoverBytes}
+			}
+			return data, err
+		}
+	}
+}
+
+// newCover describes the cover image in data, checking that it is an image
+// the server can make thumbnails of.
+func newCover(albumID int64, data []byte) (Cover, ValidationErrors) {
+	var errs ValidationErrors
+	if data == nil {
+		errs.Add("cover", "is required")
+		return Cover{}, errs
+	}
+
+	contentType := http.DetectContentType(data)
+	if !slices.Contains(coverTypes, contentType) {
+		errs.Add("cover", "must be a JPEG or PNG image")
+		return Cover{}, errs
+	}
+
+	// The dimensions are checked before the whole image is decoded, which
+	// catches truncated files that would otherwise fail as thumbnails.
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err == nil && (config.Width > maxCoverDimension || config.Height > maxCoverDimension) {
+		errs.Add("cover", fmt.Sprintf("must be at most %d pixels wide and high", maxCoverDimension))
+		return Cover{}, errs
+	}
+	if err == nil {
+		_, _, err = image.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		errs.Add("cover", "is not a readable image")
+		return Cover{}, errs
+	}
+
+	sum := sha256.Sum256(data)
+
+	return Cover{
+		AlbumID:     albumID,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Width:       config.Width,
+		Height:      config.Height,
+		Checksum:    hex.EncodeToString(sum[:]),
+		UpdatedAt:   time.Now().UTC().Truncate(time.Second),
+	}, nil
+}
+
+// encodeCover writes img in the format of contentType.
+func encodeCover(w io.Writer, img image.Image, contentType string) error {
+	if contentType == "image/png" {
+		return png.Encode(w, img)
+	}
+
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+}
+
+func joinInts(values []int) string {
+	s := make([]string, len(values))
+	for i, value := range values {
+		s[i] = strconv.Itoa(value)
+	}
+
+	return strings.Join(s, ", ")
+}
+
+// coverPath parses the album id of a /albums/{id}/cover path. It writes a
+// 400 response and returns false when the id is not a number.
+func coverPath(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	album, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/albums/"), "/cover")
+
+	albumID, err := strconv.ParseInt(album, 10, 64)
+	if err != nil {
+		ServeJSONError(w, "invalid album id", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return albumID, true
+}
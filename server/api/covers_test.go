@@ -0,0 +1,335 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-web-service/blob"
+)
+
+func TestCovers_MemoryStore(t *testing.T) {
+	testCovers(t, NewMemoryStore(queryAlbums...))
+}
+
+func TestCovers_SQLite(t *testing.T) {
+	testCovers(t, querySQLiteStore(t))
+}
+
+// testCovers runs through uploading, serving and removing covers against
+// a store holding queryAlbums.
+func testCovers(t *testing.T, store Backend) {
+	t.Helper()
+
+	albums := NewAlbums(store)
+	albums.Blobs = blob.Dir{Path: t.TempDir()}
+	router := SetupRouter(albums)
+	pngCover := encodeTestImage(t, "image/png", 300, 150)
+	jpegCover := encodeTestImage(t, "image/jpeg", 100, 200)
+
+	rr := uploadCover(router, "/albums/3/cover", "cover", pngCover)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Upload returned wrong status code: got %v want %v: %v", rr.Code, http.StatusOK, rr.Body)
+	}
+	var cover Cover
+	if err := json.Unmarshal(rr.Body.Bytes(), &cover); err != nil {
+		t.Fatalf("Failed to decode cover: %v", err)
+	}
+	if cover.AlbumID != 3 || cover.ContentType != "image/png" || cover.Size != int64(len(pngCover)) || cover.Width != 300 || cover.Height != 150 || len(cover.Checksum) != 64 {
+		t.Errorf("Unexpected cover %+v", cover)
+	}
+
+	// The image is served with caching headers
+	rr = coverRequest(router, http.MethodGet, "/albums/3/cover", nil, nil)
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), pngCover) {
+		t.Errorf("Expected the uploaded image, got %v with %v bytes", rr.Code, rr.Body.Len())
+	}
+	expectedHeaders := map[string]string{
+		"Content-Type":  "image/png",
+		"ETag":          `"` + cover.Checksum + `"`,
+		"Cache-Control": "public, max-age=3600",
+		"Last-Modified": cover.UpdatedAt.Format(http.TimeFormat),
+		"Accept-Ranges": "bytes",
+	}
+	for name, expected := range expectedHeaders {
+		if actual := rr.Header().Get(name); actual != expected {
+			t.Errorf("Unexpected %v header: got %v want %v", name, actual, expected)
+		}
+	}
+
+	rr = coverRequest(router, http.MethodGet, "/albums/3/cover", nil, map[string]string{"If-None-Match": `"` + cover.Checksum + `"`})
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("Expected a matching ETag to return %v, got %v", http.StatusNotModified, rr.Code)
+	}
+
+	rr = coverRequest(router, http.MethodGet, "/albums/3/cover", nil, map[string]string{"Range": "bytes=0-7"})
+	if rr.Code != http.StatusPartialContent || !bytes.Equal(rr.Body.Bytes(), pngCover[:8]) {
+		t.Errorf("Expected the first 8 bytes, got %v with %q", rr.Code, rr.Body.Bytes())
+	}
+	if actual, expected := rr.Header().Get("Content-Range"), "bytes 0-7/"+strconv.Itoa(len(pngCover)); actual != expected {
+		t.Errorf("Unexpected Content-Range header: got %v want %v", actual, expected)
+	}
+
+	// Thumbnails keep the aspect ratio and format, and are kept once made
+	rr = coverRequest(router, http.MethodGet, "/albums/3/cover?size=64", nil, nil)
+	expectThumbnail(t, rr, "image/png", 64, 32)
+	if actual, expected := rr.Header().Get("ETag"), `"`+cover.Checksum+`-64"`; actual != expected {
+		t.Errorf("Unexpected thumbnail ETag: got %v want %v", actual, expected)
+	}
+	expectBlob(t, albums.Blobs, cover.key(64), true)
+
+	for _, url := range []string{"/albums/3/cover?size=100", "/albums/3/cover?size=big"} {
+		rr = coverRequest(router, http.MethodGet, url, nil, nil)
+		if expected := `{"errors":"size must be one of 64, 128, 256, 512"}`; rr.Code != http.StatusBadRequest || strings.TrimSpace(rr.Body.String()) != expected {
+			t.Errorf("GET %v returned %v %v, want 400 %v", url, rr.Code, rr.Body, expected)
+		}
+	}
+
+	// Replacing a cover removes the old image and its thumbnails
+	rr = uploadCover(router, "/albums/3/cover", "cover", jpegCover)
+	var replaced Cover
+	if err := json.Unmarshal(rr.Body.Bytes(), &replaced); err != nil || replaced.ContentType != "image/jpeg" {
+		t.Fatalf("Expected a JPEG cover, got %v %v", rr.Code, rr.Body)
+	}
+	expectBlob(t, albums.Blobs, cover.key(0), false)
+	expectBlob(t, albums.Blobs, cover.key(64), false)
+
+	expectThumbnail(t, coverRequest(router, http.MethodGet, "/albums/3/cover?size=64", nil, nil), "image/jpeg", 32, 64)
+	expectThumbnail(t, coverRequest(router, http.MethodGet, "/albums/3/cover?size=512", nil, nil), "image/jpeg", 100, 200)
+
+	tests := []struct {
+		rr           *httptest.ResponseRecorder
+		expectedCode int
+		expected     string
+	}{
+		{coverRequest(router, http.MethodPut, "/albums/3/cover", bytes.NewReader(pngCover), map[string]string{"Content-Type": "image/png"}), http.StatusUnsupportedMediaType, `{"errors":"Content-Type must be multipart/form-data"}`},
+		{uploadCover(router, "/albums/3/cover", "image", pngCover), http.StatusUnprocessableEntity, `{"errors":["'cover' is required"],"fields":{"cover":["is required"]}}`},
+		{uploadCover(router, "/albums/3/cover", "cover", []byte("GIF89a not really")), http.StatusUnprocessableEntity, `{"errors":["'cover' must be a JPEG or PNG image"],"fields":{"cover":["must be a JPEG or PNG image"]}}`},
+		{uploadCover(router, "/albums/3/cover", "cover", pngCover[:40]), http.StatusUnprocessableEntity, `{"errors":["'cover' is not a readable image"],"fields":{"cover":["is not a readable image"]}}`},
+		{uploadCover(router, "/albums/3/cover", "cover", make([]byte, maxCoverBytes+1)), http.StatusRequestEntityTooLarge, `{"errors":"cover must not be larger than 10485760 bytes"}`},
+		{uploadCover(router, "/albums/99/cover", "cover", pngCover), http.StatusNotFound, `{"errors":"album not found"}`},
+		{uploadCover(router, "/albums/abc/cover", "cover", pngCover), http.StatusBadRequest, `{"errors":"invalid album id"}`},
+		{coverRequest(router, http.MethodGet, "/albums/4/cover", nil, nil), http.StatusNotFound, `{"errors":"cover not found"}`},
+
+		{coverRequest(router, http.MethodDelete, "/albums/3/cover", nil, nil), http.StatusOK, `{"message":"cover successfully removed"}`},
+		{coverRequest(router, http.MethodDelete, "/albums/3/cover", nil, nil), http.StatusNotFound, `{"errors":"cover not found"}`},
+		{coverRequest(router, http.MethodGet, "/albums/3/cover", nil, nil), http.StatusNotFound, `{"errors":"cover not found"}`},
+	}
+
+	for i, tt := range tests {
+		if tt.rr.Code != tt.expectedCode {
+			t.Errorf("Request %v returned wrong status code: got %v want %v", i, tt.rr.Code, tt.expectedCode)
+		}
+		if actual := strings.TrimSpace(tt.rr.Body.String()); actual != tt.expected {
+			t.Errorf("Request %v returned unexpected body: got %v want %v", i, actual, tt.expected)
+		}
+	}
+	expectBlob(t, albums.Blobs, replaced.key(0), false)
+	expectBlob(t, albums.Blobs, replaced.key(64), false)
+
+	// Albums keep their cover image in the trash, and lose it when purged
+	rr = uploadCover(router, "/albums/4/cover", "cover", pngCover)
+	if err := json.Unmarshal(rr.Body.Bytes(), &cover); err != nil {
+		t.Fatalf("Failed to decode cover: %v", err)
+	}
+	expectBlob(t, albums.Blobs, cover.key(0), true)
+	if rr := coverRequest(router, http.MethodDelete, "/albums/4", nil, nil); rr.Code != http.StatusOK {
+		t.Errorf("Expected the album to be deleted, got %v", rr.Code)
+	}
+	expectBlob(t, albums.Blobs, cover.key(0), true)
+	if rr := coverRequest(router, http.MethodGet, "/albums/4/cover", nil, nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected the cover of an album in the trash to be hidden, got %v", rr.Code)
+	}
+	if _, err := albums.PurgeTrash(context.Background(), 0, time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("Failed to purge the trash: %v", err)
+	}
+	expectBlob(t, albums.Blobs, cover.key(0), false)
+	if _, err := albums.Covers.Cover(context.Background(), 4); !errors.Is(err, ErrCoverNotFound) {
+		t.Errorf("Expected ErrCoverNotFound for the deleted album, got %v", err)
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	// Each half of the image averages to one thumbnail pixel
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 2; y++ {
+			c := color.RGBA{A: 255}
+			if x >= 2 {
+				c = color.RGBA{R: 200, G: 100, B: 50 * uint8(y), A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	thumb := thumbnail(img, 2)
+	if bounds := thumb.Bounds(); bounds.Dx() != 2 || bounds.Dy() != 1 {
+		t.Fatalf("Expected a 2x1 thumbnail, got %v", bounds)
+	}
+	if actual, expected := thumb.At(0, 0), (color.RGBA{A: 255}); actual != expected {
+		t.Errorf("Unexpected left pixel: got %v want %v", actual, expected)
+	}
+	if actual, expected := thumb.At(1, 0), (color.RGBA{R: 200, G: 100, B: 25, A: 255}); actual != expected {
+		t.Errorf("Unexpected right pixel: got %v want %v", actual, expected)
+	}
+
+	if small := image.NewRGBA(image.Rect(0, 0, 10, 20)); thumbnail(small, 64) != image.Image(small) {
+		t.Error("Expected an image that fits to be returned as is")
+	}
+}
+
+func encodeTestImage(t *testing.T, contentType string, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	var encoded bytes.Buffer
+	if err := encodeCover(&encoded, img, contentType); err != nil {
+		t.Fatalf("Failed to encode image: %v", err)
+	}
+
+	return encoded.Bytes()
+}
+
+func uploadCover(router http.Handler, url, field string, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile(field, "cover")
+	_, _ = part.Write(data)
+	_ = writer.Close()
+
+	req := httptest.NewRequest(http.MethodPut, url, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func coverRequest(router http.Handler, method, url string, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, body)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func expectThumbnail(t *testing.T, rr *httptest.ResponseRecorder, contentType string, width, height int) {
+	t.Helper()
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != contentType {
+		t.Fatalf("Expected a %v thumbnail, got %v %v", contentType, rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	decode := png.Decode
+	if contentType == "image/jpeg" {
+		decode = jpeg.Decode
+	}
+	img, err := decode(rr.Body)
+	if err != nil {
+		t.Fatalf("Failed to decode thumbnail: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != width || bounds.Dy() != height {
+		t.Errorf("Expected a %vx%v thumbnail, got %v", width, height, bounds)
+	}
+}
+
+// TestCoverStore_SQLite stores, replaces and deletes cover metadata straight
+// through the SQLite store. The images themselves go to the blob store.
+func TestCoverStore_SQLite(t *testing.T) {
+	ctx := context.Background()
+	store := querySQLiteStore(t)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	if _, err := store.Cover(ctx, 3); !errors.Is(err, ErrCoverNotFound) {
+		t.Errorf("Expected %v before an upload, got %v", ErrCoverNotFound, err)
+	}
+	if err := store.SetCover(ctx, Cover{AlbumID: 99, ContentType: "image/png", UpdatedAt: now}); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("Expected %v for a missing album, got %v", ErrAlbumNotFound, err)
+	}
+
+	for _, cover := range []Cover{
+		{AlbumID: 3, ContentType: "image/png", Size: 1024, Width: 300, Height: 150, Checksum: "first", UpdatedAt: now},
+		// A new upload replaces the cover
+		{AlbumID: 3, ContentType: "image/jpeg", Size: 2048, Width: 100, Height: 200, Checksum: "second", UpdatedAt: now.Add(time.Minute)},
+	} {
+		if err := store.SetCover(ctx, cover); err != nil {
+			t.Fatalf("Failed to set cover: %v", err)
+		}
+		if found, err := store.Cover(ctx, 3); err != nil || found != cover {
+			t.Errorf("Unexpected cover: got %+v, %v want %+v", found, err, cover)
+		}
+	}
+
+	// Albums in the trash keep their cover, but cannot get a new one
+	if err := store.Trash(ctx, 3, 0, now); err != nil {
+		t.Fatalf("Failed to trash album: %v", err)
+	}
+	if err := store.SetCover(ctx, Cover{AlbumID: 3, ContentType: "image/png", UpdatedAt: now}); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("Expected %v for an album in the trash, got %v", ErrAlbumNotFound, err)
+	}
+	if err := store.Restore(ctx, 3); err != nil {
+		t.Fatalf("Failed to restore album: %v", err)
+	}
+	if found, err := store.Cover(ctx, 3); err != nil || found.Checksum != "second" {
+		t.Errorf("Expected the restored album to keep its cover, got %+v, %v", found, err)
+	}
+
+	if err := store.DeleteCover(ctx, 3); err != nil {
+		t.Fatalf("Failed to delete cover: %v", err)
+	}
+	if err := store.DeleteCover(ctx, 3); !errors.Is(err, ErrCoverNotFound) {
+		t.Errorf("Expected %v deleting the cover twice, got %v", ErrCoverNotFound, err)
+	}
+
+	// Covers go with their album
+	if err := store.SetCover(ctx, Cover{AlbumID: 2, ContentType: "image/png", UpdatedAt: now}); err != nil {
+		t.Fatalf("Failed to set cover: %v", err)
+	}
+	if err := store.Delete(ctx, 2); err != nil {
+		t.Fatalf("Failed to delete album: %v", err)
+	}
+	if _, err := store.Cover(ctx, 2); !errors.Is(err, ErrCoverNotFound) {
+		t.Errorf("Expected the cover to be deleted with its album, got %v", err)
+	}
+}
+
+func expectBlob(t *testing.T, blobs blob.Store, key string, exists bool) {
+	t.Helper()
+
+	body, err := blobs.Get(context.Background(), key)
+	if err == nil {
+		_, _ = io.Copy(io.Discard, body)
+		body.Close()
+	}
+
+	if exists && err != nil {
+		t.Errorf("Expected blob %v to exist, got %v", key, err)
+	}
+	if !exists && !errors.Is(err, blob.ErrNotFound) {
+		t.Errorf("Expected blob %v to be removed, got %v", key, err)
+	}
+}
@@ -0,0 +1,314 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (s *MemoryStore) CreateCustomer(ctx context.Context, customer Customer) (Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.customers {
+		if existing.Email == customer.Email {
+			return Customer{}, ErrEmailExists
+		}
+	}
+
+	s.nextCustomerID++
+	customer.ID = s.nextCustomerID
+	s.customers[customer.ID] = customer
+
+	return customer, nil
+}
+
+func (s *MemoryStore) CustomerByEmail(ctx context.Context, email string) (Customer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, customer := range s.customers {
+		if customer.Email == email {
+			return customer, nil
+		}
+	}
+
+	return Customer{}, ErrCustomerNotFound
+}
+
+func (s *MemoryStore) SetPassword(ctx context.Context, id int64, hash []byte, keepTokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	customer, ok := s.customers[id]
+	if !ok {
+		return ErrCustomerNotFound
+	}
+
+	customer.PasswordHash = hash
+	s.customers[id] = customer
+	for tokenHash, session := range s.sessions {
+		if session.CustomerID == id && tokenHash != keepTokenHash {
+			delete(s.sessions, tokenHash)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteCustomer(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.customers[id]; !ok {
+		return ErrCustomerNotFound
+	}
+
+	delete(s.customers, id)
+	for tokenHash, session := range s.sessions {
+		if session.CustomerID == id {
+			delete(s.sessions, tokenHash)
+		}
+	}
+	for cartID, cart := range s.carts {
+		if cart.CustomerID != nil && *cart.CustomerID == id {
+			delete(s.carts, cartID)
+		}
+	}
+	for wishlistID, wishlist := range s.wishlists {
+		if wishlist.CustomerID != nil && *wishlist.CustomerID == id {
+			delete(s.wishlists, wishlistID)
+		}
+	}
+	for orderID, order := range s.orders {
+		if order.CustomerID != nil && *order.CustomerID == id {
+			order.CustomerID = nil
+			s.orders[orderID] = order
+		}
+	}
+	for reviewID, review := range s.reviews {
+		if review.CustomerID != nil && *review.CustomerID == id {
+			review.CustomerID = nil
+			s.reviews[reviewID] = review
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) CreateSession(ctx context.Context, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.customers[session.CustomerID]; !ok {
+		return ErrCustomerNotFound
+	}
+
+	for tokenHash, expired := range s.sessions {
+		if expired.CustomerID == session.CustomerID && !expired.ExpiresAt.After(session.CreatedAt) {
+			delete(s.sessions, tokenHash)
+		}
+	}
+	s.sessions[session.TokenHash] = session
+
+	return nil
+}
+
+func (s *MemoryStore) SessionCustomer(ctx context.Context, tokenHash string, now time.Time) (Customer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[tokenHash]
+	if !ok || !session.ExpiresAt.After(now) {
+		return Customer{}, ErrSessionNotFound
+	}
+
+	customer, ok := s.customers[session.CustomerID]
+	if !ok {
+		return Customer{}, ErrSessionNotFound
+	}
+
+	return customer, nil
+}
+
+func (s *MemoryStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[tokenHash]; !ok {
+		return ErrSessionNotFound
+	}
+
+	delete(s.sessions, tokenHash)
+
+	return nil
+}
+
+// customerColumns are the customer columns scanCustomer reads.
+const customerColumns = "id, email, name, password_hash, created_at"
+
+// scanCustomer reads the customerColumns of a *sql.Row or *sql.Rows.
+func scanCustomer(row interface{ Scan(...any) error }) (Customer, error) {
+	var customer Customer
+	var hash string
+	err := row.Scan(&customer.ID, &customer.Email, &customer.Name, &hash, timeScanner{&customer.CreatedAt})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Customer{}, ErrCustomerNotFound
+	}
+	if err != nil {
+		return Customer{}, err
+	}
+
+	customer.PasswordHash = []byte(hash)
+
+	return customer, nil
+}
+
+func (s *SQLStore) CreateCustomer(ctx context.Context, customer Customer) (Customer, error) {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return Customer{}, err
+	}
+	defer tx.Rollback()
+
+	var existing int
+	if err := tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM customer WHERE email = ?`), customer.Email).Scan(&existing); err != nil {
+		return Customer{}, err
+	}
+	if existing > 0 {
+		return Customer{}, ErrEmailExists
+	}
+
+	query := `INSERT INTO customer (email, name, password_hash, created_at) VALUES (?, ?, ?, ?)`
+	args := []any{customer.Email, customer.Name, string(customer.PasswordHash), customer.CreatedAt.UTC()}
+	if s.postgres() {
+		err = tx.QueryRowContext(ctx, s.rebind(query+` RETURNING id`), args...).Scan(&customer.ID)
+	} else {
+		var result sql.Result
+		if result, err = tx.ExecContext(ctx, query, args...); err == nil {
+			customer.ID, err = result.LastInsertId()
+		}
+	}
+	if err != nil {
+		return Customer{}, err
+	}
+
+	return customer, tx.Commit()
+}
+
+func (s *SQLStore) CustomerByEmail(ctx context.Context, email string) (Customer, error) {
+	return scanCustomer(s.Db.QueryRowContext(ctx, s.rebind(`SELECT `+customerColumns+` FROM customer WHERE email = ?`), email))
+}
+
+func (s *SQLStore) SetPassword(ctx context.Context, id int64, hash []byte, keepTokenHash string) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var customers int
+	if err := tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM customer WHERE id = ?`), id).Scan(&customers); err != nil {
+		return err
+	}
+	if customers == 0 {
+		return ErrCustomerNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, s.rebind(`UPDATE customer SET password_hash = ? WHERE id = ?`), string(hash), id); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM customer_session WHERE customer_id = ? AND token_hash <> ?`), id, keepTokenHash)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteCustomer relies on foreign keys to delete the customer's sessions and
+// wishlist.
+// Carts and orders only note the customer's id, so they are seen to here.
+func (s *SQLStore) DeleteCustomer(ctx context.Context, id int64) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM customer WHERE id = ?`), id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCustomerNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM cart WHERE customer_id = ?`), id); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, s.rebind(`UPDATE orders SET customer_id = NULL WHERE customer_id = ?`), id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) CreateSession(ctx context.Context, session Session) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM customer_session WHERE customer_id = ? AND expires_at <= ?`),
+		session.CustomerID, session.CreatedAt.UTC())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO customer_session (token_hash, customer_id, created_at, expires_at) VALUES (?, ?, ?, ?)`),
+		session.TokenHash, session.CustomerID, session.CreatedAt.UTC(), session.ExpiresAt.UTC())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) SessionCustomer(ctx context.Context, tokenHash string, now time.Time) (Customer, error) {
+	query := `SELECT c.id, c.email, c.name, c.password_hash, c.created_at FROM customer_session s` +
+		` JOIN customer c ON c.id = s.customer_id WHERE s.token_hash = ? AND s.expires_at > ?`
+
+	customer, err := scanCustomer(s.Db.QueryRowContext(ctx, s.rebind(query), tokenHash, now.UTC()))
+	if errors.Is(err, ErrCustomerNotFound) {
+		return Customer{}, ErrSessionNotFound
+	}
+
+	return customer, err
+}
+
+func (s *SQLStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	result, err := s.Db.ExecContext(ctx, s.rebind(`DELETE FROM customer_session WHERE token_hash = ?`), tokenHash)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,342 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrCustomerNotFound is returned by a CustomerStore when no customer
+	// matches the given id or email.
+	ErrCustomerNotFound = errors.New("customer not found")
+	// ErrEmailExists is returned when another customer already has the email.
+	ErrEmailExists = errors.New("an account with this email already exists")
+)
+
+const (
+	maxEmailLength        = 254
+	maxCustomerNameLength = 128
+	minPasswordBytes      = 8
+	// maxPasswordBytes is the most bcrypt looks at. Longer passwords are
+	// refused rather than silently truncated.
+	maxPasswordBytes = 72
+)
+
+// passwordCost is the bcrypt cost passwords are hashed with.
+var passwordCost = bcrypt.DefaultCost
+
+// dummyHash is compared against when logging in with an unknown email, so
+// that the response takes as long as for a wrong password.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not anyone's password"), passwordCost)
+	return hash
+})
+
+type Customer struct {
+	ID           int64     `json:"id"`
+	Email        string    `json:"email"`
+	Name         string    `json:"name"`
+	PasswordHash []byte    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// CustomerStore is the persistence layer the account handlers depend on.
+type CustomerStore interface {
+	// CreateCustomer returns ErrEmailExists when another customer has the email.
+	CreateCustomer(ctx context.Context, customer Customer) (Customer, error)
+	// CustomerByEmail looks a customer up by their normalized email.
+	CustomerByEmail(ctx context.Context, email string) (Customer, error)
+	// SetPassword replaces the customer's password hash and ends every one of
+	// their sessions except the one with keepTokenHash.
+	SetPassword(ctx context.Context, id int64, hash []byte, keepTokenHash string) error
+	// DeleteCustomer also ends the customer's sessions and deletes their carts
+	// and wishlist. Their orders are kept, no longer linked to them.
+	DeleteCustomer(ctx context.Context, id int64) error
+
+	// CreateSession also forgets the customer's expired sessions.
+	CreateSession(ctx context.Context, session Session) error
+	// SessionCustomer returns the customer of the session with tokenHash, or
+	// ErrSessionNotFound when there is none or it expired before now.
+	SessionCustomer(ctx context.Context, tokenHash string, now time.Time) (Customer, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
+}
+
+// SessionResponse is what Register and Login serve. Token goes in the
+// Authorization header of later requests, as "Bearer <token>".
+type SessionResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Customer  Customer  `json:"customer"`
+}
+
+// Register creates a customer account from {"email","password","name"} and
+// logs it in.
+func (a *Albums) Register(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    *string `json:"email"`
+		Password *string `json:"password"`
+		Name     *string `json:"name"`
+	}
+	if !readJSON(w, r, &input) {
+		return
+	}
+
+	var errs ValidationErrors
+	email := validateEmail(&errs, input.Email)
+	validatePassword(&errs, "password", input.Password)
+	validateText(&errs, "name", input.Name, maxCustomerNameLength, false)
+	if len(errs) > 0 {
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(*input.Password), passwordCost)
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("Register %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	customer := Customer{Email: email, PasswordHash: hash, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	if input.Name != nil {
+		customer.Name = strings.TrimSpace(*input.Name)
+	}
+
+	customer, err = a.Customers.CreateCustomer(r.Context(), customer)
+	if errors.Is(err, ErrEmailExists) {
+		ServeJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("Register %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	a.startSession(w, r, customer, "Register")
+}
+
+// Login starts a session for the customer with {"email","password"}.
+func (a *Albums) Login(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    *string `json:"email"`
+		Password *string `json:"password"`
+	}
+	if !readJSON(w, r, &input) {
+		return
+	}
+
+	var errs ValidationErrors
+	if input.Email == nil {
+		errs.Add("email", "is required")
+	}
+	if input.Password == nil {
+		errs.Add("password", "is required")
+	}
+	if len(errs) > 0 {
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	customer, err := a.Customers.CustomerByEmail(r.Context(), normalizeEmail(*input.Email))
+	if err != nil && !errors.Is(err, ErrCustomerNotFound) {
+		ServeJSONError(w, fmt.Sprintf("Login %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	hash := customer.PasswordHash
+	if err != nil {
+		hash = dummyHash()
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(*input.Password)) != nil || err != nil {
+		ServeJSONError(w, "invalid email or password", http.StatusUnauthorized)
+		return
+	}
+
+	a.startSession(w, r, customer, "Login")
+}
+
+// Logout ends the session the request was authenticated with.
+func (a *Albums) Logout(w http.ResponseWriter, r *http.Request) {
+	p, ok := requireCustomer(w, r)
+	if !ok {
+		return
+	}
+
+	if err := a.Customers.DeleteSession(r.Context(), p.tokenHash); err != nil && !errors.Is(err, ErrSessionNotFound) {
+		ServeJSONError(w, "could not log out", http.StatusInternalServerError)
+		return
+	}
+
+	ServeJSON(w, map[string]any{"message": "successfully logged out"}, http.StatusOK)
+}
+
+// GetMe serves the authenticated customer's account.
+func (a *Albums) GetMe(w http.ResponseWriter, r *http.Request) {
+	p, ok := requireCustomer(w, r)
+	if !ok {
+		return
+	}
+
+	ServeJSON(w, p.customer, http.StatusOK)
+}
+
+// ChangePassword replaces the authenticated customer's password given
+// {"current_password","new_password"}, and logs out their other sessions.
+func (a *Albums) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	p, ok := requireCustomer(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		CurrentPassword *string `json:"current_password"`
+		NewPassword     *string `json:"new_password"`
+	}
+	if !readJSON(w, r, &input) {
+		return
+	}
+
+	var errs ValidationErrors
+	if input.CurrentPassword == nil {
+		errs.Add("current_password", "is required")
+	}
+	validatePassword(&errs, "new_password", input.NewPassword)
+	if len(errs) > 0 {
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword(p.customer.PasswordHash, []byte(*input.CurrentPassword)) != nil {
+		ServeJSONError(w, "current password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(*input.NewPassword), passwordCost)
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("ChangePassword %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	err = a.Customers.SetPassword(r.Context(), p.customer.ID, hash, p.tokenHash)
+	switch {
+	case errors.Is(err, ErrCustomerNotFound):
+		ServeJSONError(w, "customer not found", http.StatusNotFound)
+	case err != nil:
+		ServeJSONError(w, fmt.Sprintf("ChangePassword %v", err), http.StatusInternalServerError)
+	default:
+		ServeJSON(w, map[string]any{"message": "password successfully changed"}, http.StatusOK)
+	}
+}
+
+// DeleteMe deletes the authenticated customer's account once confirmed with
+// {"password"}.
+func (a *Albums) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	p, ok := requireCustomer(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Password *string `json:"password"`
+	}
+	if !readJSON(w, r, &input) {
+		return
+	}
+
+	if input.Password == nil {
+		var errs ValidationErrors
+		errs.Add("password", "is required")
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword(p.customer.PasswordHash, []byte(*input.Password)) != nil {
+		ServeJSONError(w, "password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	err := a.Customers.DeleteCustomer(r.Context(), p.customer.ID)
+	switch {
+	case errors.Is(err, ErrCustomerNotFound):
+		ServeJSONError(w, "customer not found", http.StatusNotFound)
+	case err != nil:
+		ServeJSONError(w, "could not delete account", http.StatusInternalServerError)
+	default:
+		ServeJSON(w, map[string]any{"message": "account successfully deleted"}, http.StatusOK)
+	}
+}
+
+// startSession creates a session for customer and serves its token.
+func (a *Albums) startSession(w http.ResponseWriter, r *http.Request, customer Customer, handler string) {
+	token, err := newSessionToken()
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	session := Session{TokenHash: hashToken(token), CustomerID: customer.ID, CreatedAt: now, ExpiresAt: now.Add(sessionTTL)}
+	if err := a.Customers.CreateSession(r.Context(), session); err != nil {
+		ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+		return
+	}
+
+	ServeJSON(w, SessionResponse{Token: token, ExpiresAt: session.ExpiresAt, Customer: customer}, http.StatusOK)
+}
+
+// readJSON decodes a JSON request body into dst. It writes an error response
+// and returns false when the body cannot be read.
+func readJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	if !isJSON(r) {
+		ServeJSONError(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return false
+	}
+
+	if err := decodeJSON(w, r, dst); err != nil {
+		ServeJSONError(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// normalizeEmail trims and lowercases an email, the form emails are stored
+// and compared in.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validateEmail checks an email address and returns it normalized.
+func validateEmail(errs *ValidationErrors, email *string) string {
+	if email == nil {
+		errs.Add("email", "is required")
+		return ""
+	}
+
+	normalized := normalizeEmail(*email)
+	address, err := mail.ParseAddress(normalized)
+	switch {
+	case err != nil || address.Address != normalized:
+		errs.Add("email", "must be an email address such as name@example.com")
+	case len(normalized) > maxEmailLength:
+		errs.Add("email", fmt.Sprintf("must be at most %d characters", maxEmailLength))
+	}
+
+	return normalized
+}
+
+func validatePassword(errs *ValidationErrors, field string, password *string) {
+	switch {
+	case password == nil:
+		errs.Add(field, "is required")
+	case len(*password) < minPasswordBytes || len(*password) > maxPasswordBytes:
+		errs.Add(field, fmt.Sprintf("must be between %d and %d bytes long", minPasswordBytes, maxPasswordBytes))
+	}
+}
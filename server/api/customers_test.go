@@ -0,0 +1,290 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	// Hashing at the default cost would make the account tests slow.
+	passwordCost = bcrypt.MinCost
+}
+
+func TestCustomers_MemoryStore(t *testing.T) {
+	testCustomers(t, NewAlbums(NewMemoryStore(queryAlbums...)))
+}
+
+func TestCustomers_SQLite(t *testing.T) {
+	testCustomers(t, NewAlbums(querySQLiteStore(t)))
+}
+
+// testCustomers runs through registering, logging in, changing the password
+// and deleting the account of a customer.
+func testCustomers(t *testing.T, albums *Albums) {
+	t.Helper()
+
+	albums.StaffToken = staffToken
+	router := SetupRouter(albums)
+	tokens := map[string]string{"{first}": registerCustomer(t, router, "ella@example.com"), "{staff}": staffToken}
+
+	// A second session, from logging in with differently written credentials
+	rr := shopRequest(router, http.MethodPut, "/auth/login", `{"email":" Ella@Example.com ","password":"a-love-supreme"}`)
+	var session struct {
+		Token    string
+		Customer struct{ ID int64 }
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &session); err != nil || session.Token == "" || session.Customer.ID != 1 {
+		t.Fatalf("Unexpected login %v: %v", rr.Body, err)
+	}
+	tokens["{second}"] = session.Token
+
+	// An order placed by the customer, which outlives their account
+	rr = authRequest(router, http.MethodPut, "/carts", "", tokens["{first}"])
+	var cart struct{ ID string }
+	if err := json.Unmarshal(rr.Body.Bytes(), &cart); err != nil {
+		t.Fatalf("Failed to decode cart: %v", err)
+	}
+	authRequest(router, http.MethodPatch, "/albums/3/stock", `{"format":"cd","delta":1}`, staffToken)
+	shopRequest(router, http.MethodPut, "/carts/"+cart.ID+"/items", `{"album_id":3}`)
+	if rr := authRequest(router, http.MethodPut, "/orders", `{"cart_id":"`+cart.ID+`"}`, tokens["{first}"]); rr.Code != http.StatusOK {
+		t.Fatalf("Checkout returned wrong status code: got %v want %v: %v", rr.Code, http.StatusOK, rr.Body)
+	}
+
+	tests := []struct {
+		method       string
+		url          string
+		token        string
+		body         string
+		expectedCode int
+		expected     string
+	}{
+		{http.MethodPut, "/auth/register", "", `{"email":"ELLA@example.com","password":"something-else"}`, http.StatusConflict, `{"errors":"an account with this email already exists"}`},
+		{http.MethodPut, "/auth/register", "", `{"email":"ella","password":"short","name":""}`, http.StatusUnprocessableEntity, `"fields":{"email":["must be an email address such as name@example.com"],"name":["must not be blank"],"password":["must be between 8 and 72 bytes long"]}}`},
+		{http.MethodPut, "/auth/register", "", `{}`, http.StatusUnprocessableEntity, `"fields":{"email":["is required"],"password":["is required"]}`},
+		{http.MethodPut, "/auth/register", "", `{"email":"x@example.com","password":"` + strings.Repeat("x", 73) + `"}`, http.StatusUnprocessableEntity, `"password":["must be between 8 and 72 bytes long"]`},
+		{http.MethodPut, "/auth/login", "", `{"email":"ella@example.com","password":"wrong password"}`, http.StatusUnauthorized, `{"errors":"invalid email or password"}`},
+		{http.MethodPut, "/auth/login", "", `{"email":"nobody@example.com","password":"a-love-supreme"}`, http.StatusUnauthorized, `{"errors":"invalid email or password"}`},
+		{http.MethodPut, "/auth/login", "", `{"email":"ella@example.com"}`, http.StatusUnprocessableEntity, `"fields":{"password":["is required"]}`},
+		{http.MethodGet, "/me", "{first}", "", http.StatusOK, `{"id":1,"email":"ella@example.com","name":"Ella","created_at":`},
+		{http.MethodGet, "/me", "", "", http.StatusUnauthorized, `{"errors":"authentication required"}`},
+		{http.MethodGet, "/me", "not-a-token", "", http.StatusUnauthorized, `{"errors":"invalid or expired session"}`},
+		{http.MethodGet, "/me", "{staff}", "", http.StatusForbidden, `{"errors":"staff have no customer account"}`},
+		{http.MethodGet, "/orders?customer_id=1", "{first}", "", http.StatusOK, `{"data":[{"id":1,"customer_id":1,`},
+		{http.MethodPatch, "/me/password", "{first}", `{"current_password":"wrong password","new_password":"blue-in-green"}`, http.StatusForbidden, `{"errors":"current password is incorrect"}`},
+		{http.MethodPatch, "/me/password", "{first}", `{"current_password":"a-love-supreme","new_password":"short"}`, http.StatusUnprocessableEntity, `"fields":{"new_password":["must be between 8 and 72 bytes long"]}`},
+		{http.MethodPatch, "/me/password", "", `{"current_password":"a-love-supreme","new_password":"blue-in-green"}`, http.StatusUnauthorized, `{"errors":"authentication required"}`},
+		{http.MethodPatch, "/me/password", "{first}", `{"current_password":"a-love-supreme","new_password":"blue-in-green"}`, http.StatusOK, `{"message":"password successfully changed"}`},
+		{http.MethodGet, "/me", "{second}", "", http.StatusUnauthorized, `{"errors":"invalid or expired session"}`},
+		{http.MethodGet, "/me", "{first}", "", http.StatusOK, `{"id":1,`},
+		{http.MethodPut, "/auth/login", "", `{"email":"ella@example.com","password":"a-love-supreme"}`, http.StatusUnauthorized, `{"errors":"invalid email or password"}`},
+		{http.MethodPut, "/auth/login", "", `{"email":"ella@example.com","password":"blue-in-green"}`, http.StatusOK, `"customer":{"id":1,"email":"ella@example.com","name":"Ella",`},
+		{http.MethodDelete, "/me", "{first}", `{"password":"a-love-supreme"}`, http.StatusForbidden, `{"errors":"password is incorrect"}`},
+		{http.MethodDelete, "/me", "{first}", `{}`, http.StatusUnprocessableEntity, `"fields":{"password":["is required"]}`},
+		{http.MethodDelete, "/me", "{first}", `{"password":"blue-in-green"}`, http.StatusOK, `{"message":"account successfully deleted"}`},
+		{http.MethodGet, "/me", "{first}", "", http.StatusUnauthorized, `{"errors":"invalid or expired session"}`},
+		{http.MethodGet, "/orders/1", "{staff}", "", http.StatusOK, `{"id":1,"customer_id":null,`},
+		{http.MethodPut, "/auth/login", "", `{"email":"ella@example.com","password":"blue-in-green"}`, http.StatusUnauthorized, `{"errors":"invalid email or password"}`},
+		{http.MethodPut, "/auth/register", "", `{"email":"ella@example.com","password":"a-love-supreme"}`, http.StatusOK, `"customer":{"id":2,"email":"ella@example.com","name":"",`},
+	}
+
+	for _, tt := range tests {
+		token := tt.token
+		if id, ok := tokens[token]; ok {
+			token = id
+		}
+
+		rr := authRequest(router, tt.method, tt.url, tt.body, token)
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("%v %v returned wrong status code: got %v want %v", tt.method, tt.url, status, tt.expectedCode)
+		}
+
+		if actual := strings.TrimSpace(rr.Body.String()); !strings.Contains(actual, tt.expected) {
+			t.Errorf("%v %v returned unexpected body: got %v want %v", tt.method, tt.url, actual, tt.expected)
+		}
+	}
+}
+
+func TestLogout(t *testing.T) {
+	router := SetupRouter(NewAlbums(NewMemoryStore()))
+	token := registerCustomer(t, router, "ella@example.com")
+
+	if rr := authRequest(router, http.MethodDelete, "/auth/logout", "", token); rr.Code != http.StatusOK {
+		t.Errorf("Logout returned wrong status code: got %v want %v: %v", rr.Code, http.StatusOK, rr.Body)
+	}
+	if rr := authRequest(router, http.MethodGet, "/me", "", token); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the logged out token to be refused, got %v", rr.Code)
+	}
+	if rr := shopRequest(router, http.MethodDelete, "/auth/logout", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an anonymous logout to be refused, got %v", rr.Code)
+	}
+}
+
+func TestSessionExpiry_MemoryStore(t *testing.T) {
+	testSessionExpiry(t, NewMemoryStore())
+}
+
+func TestSessionExpiry_SQLite(t *testing.T) {
+	testSessionExpiry(t, querySQLiteStore(t))
+}
+
+// testSessionExpiry checks that a session stops authenticating once it
+// expires, and is forgotten when its customer next logs in.
+func testSessionExpiry(t *testing.T, store Backend) {
+	t.Helper()
+
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	customer, err := store.CreateCustomer(ctx, Customer{Email: "ella@example.com", PasswordHash: []byte("hash"), CreatedAt: now})
+	if err != nil {
+		t.Fatalf("Failed to create customer: %v", err)
+	}
+	if err := store.CreateSession(ctx, Session{TokenHash: hashToken("old"), CustomerID: customer.ID, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	if found, err := store.SessionCustomer(ctx, hashToken("old"), now.Add(59*time.Minute)); err != nil || found.ID != customer.ID {
+		t.Errorf("Expected the session to be valid before it expires, got %+v, %v", found, err)
+	}
+	if _, err := store.SessionCustomer(ctx, hashToken("old"), now.Add(time.Hour)); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected an expired session to be %v, got %v", ErrSessionNotFound, err)
+	}
+
+	later := now.Add(2 * time.Hour)
+	if err := store.CreateSession(ctx, Session{TokenHash: hashToken("new"), CustomerID: customer.ID, CreatedAt: later, ExpiresAt: later.Add(time.Hour)}); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := store.DeleteSession(ctx, hashToken("old")); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected the expired session to be forgotten, got %v", err)
+	}
+	if _, err := store.SessionCustomer(ctx, hashToken("new"), later); err != nil {
+		t.Errorf("Expected the new session to be valid, got %v", err)
+	}
+}
+
+func TestCustomerStore_MemoryStore(t *testing.T) {
+	testCustomerStore(t, NewMemoryStore(queryAlbums...))
+}
+
+func TestCustomerStore_SQLite(t *testing.T) {
+	testCustomerStore(t, querySQLiteStore(t))
+}
+
+// testCustomerStore registers a customer, changes their password and deletes
+// their account, which takes their sessions, cart and wishlist with it and
+// leaves their review unsigned, against store holding queryAlbums.
+func testCustomerStore(t *testing.T, store Backend) {
+	t.Helper()
+
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	customer, err := store.CreateCustomer(ctx, Customer{Email: "ella@example.com", Name: "Ella", PasswordHash: []byte("old"), CreatedAt: now})
+	if err != nil {
+		t.Fatalf("Failed to create customer: %v", err)
+	}
+	if _, err := store.CreateCustomer(ctx, Customer{Email: "ella@example.com", PasswordHash: []byte("x"), CreatedAt: now}); !errors.Is(err, ErrEmailExists) {
+		t.Errorf("Expected %v registering the email twice, got %v", ErrEmailExists, err)
+	}
+	if found, err := store.CustomerByEmail(ctx, "ella@example.com"); err != nil || found.ID != customer.ID || found.Name != "Ella" {
+		t.Errorf("Unexpected customer by email %+v, %v", found, err)
+	}
+	if _, err := store.CustomerByEmail(ctx, "nobody@example.com"); !errors.Is(err, ErrCustomerNotFound) {
+		t.Errorf("Expected %v, got %v", ErrCustomerNotFound, err)
+	}
+
+	for _, token := range []string{"kept", "ended"} {
+		if err := store.CreateSession(ctx, Session{TokenHash: hashToken(token), CustomerID: customer.ID, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+	if found, err := store.SessionCustomer(ctx, hashToken("ended"), now); err != nil || found.ID != customer.ID {
+		t.Errorf("Expected the session to find its customer, got %+v, %v", found, err)
+	}
+
+	// Changing the password ends every other session
+	if err := store.SetPassword(ctx, customer.ID, []byte("new"), hashToken("kept")); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if _, err := store.SessionCustomer(ctx, hashToken("ended"), now); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected the other session to end, got %v", err)
+	}
+	if found, err := store.SessionCustomer(ctx, hashToken("kept"), now); err != nil || string(found.PasswordHash) != "new" {
+		t.Errorf("Expected the kept session to find the new password, got %+v, %v", found, err)
+	}
+	if err := store.SetPassword(ctx, 99, []byte("new"), ""); !errors.Is(err, ErrCustomerNotFound) {
+		t.Errorf("Expected %v, got %v", ErrCustomerNotFound, err)
+	}
+
+	cart, err := store.CreateCart(ctx, Cart{ID: strings.Repeat("ab", 16), CustomerID: &customer.ID, CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		t.Fatalf("Failed to create cart: %v", err)
+	}
+	wishlist, err := store.CreateWishlist(ctx, Wishlist{CustomerID: &customer.ID, CreatedAt: now})
+	if err != nil {
+		t.Fatalf("Failed to create wishlist: %v", err)
+	}
+	if err := store.AddWishlistItem(ctx, wishlist.ID, 3, now); err != nil {
+		t.Fatalf("Failed to add to wishlist: %v", err)
+	}
+	review, err := store.CreateReview(ctx, Review{AlbumID: 3, CustomerID: &customer.ID, Rating: 4, CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		t.Fatalf("Failed to create review: %v", err)
+	}
+
+	if err := store.DeleteCustomer(ctx, customer.ID); err != nil {
+		t.Fatalf("Failed to delete customer: %v", err)
+	}
+	if err := store.DeleteCustomer(ctx, customer.ID); !errors.Is(err, ErrCustomerNotFound) {
+		t.Errorf("Expected %v deleting the customer twice, got %v", ErrCustomerNotFound, err)
+	}
+	if _, err := store.CustomerByEmail(ctx, "ella@example.com"); !errors.Is(err, ErrCustomerNotFound) {
+		t.Errorf("Expected the customer to be gone, got %v", err)
+	}
+	if _, err := store.SessionCustomer(ctx, hashToken("kept"), now); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected the sessions to be gone, got %v", err)
+	}
+	if _, err := store.GetCart(ctx, cart.ID); !errors.Is(err, ErrCartNotFound) {
+		t.Errorf("Expected the cart to be gone, got %v", err)
+	}
+	if _, err := store.GetWishlist(ctx, wishlist.ID); !errors.Is(err, ErrWishlistNotFound) {
+		t.Errorf("Expected the wishlist to be gone, got %v", err)
+	}
+	if found, err := store.GetReview(ctx, 3, review.ID); err != nil || found.CustomerID != nil || found.Rating != 4 {
+		t.Errorf("Expected the review to be kept unsigned, got %+v, %v", found, err)
+	}
+	if album, err := store.Get(ctx, 3); err != nil || album.ReviewCount != 1 {
+		t.Errorf("Expected the album to keep its review, got %+v, %v", album, err)
+	}
+
+	// The email is free again
+	if _, err := store.CreateCustomer(ctx, Customer{Email: "ella@example.com", PasswordHash: []byte("x"), CreatedAt: now}); err != nil {
+		t.Errorf("Expected the email to be free after the account is deleted, got %v", err)
+	}
+}
+
+// registerCustomer registers a customer with email and returns their session
+// token.
+func registerCustomer(t *testing.T, router http.Handler, email string) string {
+	t.Helper()
+
+	rr := shopRequest(router, http.MethodPut, "/auth/register", `{"email":"`+email+`","password":"a-love-supreme","name":" Ella "}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Register returned wrong status code: got %v want %v: %v", rr.Code, http.StatusOK, rr.Body)
+	}
+
+	var session struct{ Token string }
+	if err := json.Unmarshal(rr.Body.Bytes(), &session); err != nil || session.Token == "" {
+		t.Fatalf("Unexpected session %v: %v", rr.Body, err)
+	}
+
+	return session.Token
+}
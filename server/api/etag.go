@@ -0,0 +1,67 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrVersionMismatch is returned by an AlbumStore when a write is made
+// against a version of the album that is no longer current.
+var ErrVersionMismatch = errors.New("album has been changed since it was read")
+
+// albumETag returns the ETag of the album, a strong validator that changes
+// with its version.
+func albumETag(album Album) string {
+	return `"` + strconv.FormatInt(album.Version, 10) + `"`
+}
+
+// matchETag reports whether an If-Match or If-None-Match header lists etag,
+// or is *. Weak validators only match when weak comparison is allowed, as it
+// is for If-None-Match.
+func matchETag(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifMatch enforces the request's If-Match header against the album with id.
+// It returns the version the write must be made against, or zero without
+// the header, and has served an error when it returns false.
+func (a *Albums) ifMatch(w http.ResponseWriter, r *http.Request, id int64) (int64, bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0, true
+	}
+
+	album, err := a.Store.Get(r.Context(), id)
+	if errors.Is(err, ErrAlbumNotFound) {
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+		return 0, false
+	}
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("ifMatch %v", err), http.StatusInternalServerError)
+		return 0, false
+	}
+
+	if !matchETag(header, albumETag(album), false) {
+		servePreconditionFailed(w)
+		return 0, false
+	}
+
+	return album.Version, true
+}
+
+func servePreconditionFailed(w http.ResponseWriter) {
+	ServeJSONError(w, ErrVersionMismatch.Error(), http.StatusPreconditionFailed)
+}
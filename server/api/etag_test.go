@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestETags_MemoryStore(t *testing.T) {
+	testETags(t, NewMemoryStore(queryAlbums...))
+}
+
+func TestETags_SQLite(t *testing.T) {
+	testETags(t, querySQLiteStore(t))
+}
+
+// testETags runs through conditional reads and writes of albums, against a
+// store holding queryAlbums.
+func testETags(t *testing.T, store Backend) {
+	t.Helper()
+
+	router := SetupRouter(NewAlbums(store))
+	token := registerCustomer(t, router, "ella@example.com")
+
+	tests := []struct {
+		method       string
+		url          string
+		header       http.Header
+		body         string
+		expectedCode int
+		expectedETag string
+		expected     string
+	}{
+		{http.MethodGet, "/albums/1", nil, "", http.StatusOK, `"1"`, `[{"id":1,"title":"Blue Train",`},
+		{http.MethodGet, "/albums/1", http.Header{"If-None-Match": {`"1"`}}, "", http.StatusNotModified, `"1"`, ``},
+		{http.MethodGet, "/albums/1", http.Header{"If-None-Match": {`"0", W/"1"`}}, "", http.StatusNotModified, `"1"`, ``},
+		{http.MethodGet, "/albums/1", http.Header{"If-None-Match": {`*`}}, "", http.StatusNotModified, `"1"`, ``},
+		{http.MethodGet, "/albums/1", http.Header{"If-None-Match": {`"2"`}}, "", http.StatusOK, `"1"`, `[{"id":1,`},
+		{http.MethodGet, "/albums/1?include=tracks", http.Header{"If-None-Match": {`"1"`}}, "", http.StatusOK, ``, `"tracks":[]`},
+
+		{http.MethodPatch, "/albums/1", http.Header{"If-Match": {`"1"`}}, `{"title":"Blue Train (Mono)"}`, http.StatusOK, `"2"`, `{"message":"album successfully updated"}`},
+		{http.MethodPatch, "/albums/1", http.Header{"If-Match": {`"1"`}}, `{"title":"Blue Train"}`, http.StatusPreconditionFailed, ``, `{"errors":"album has been changed since it was read"}`},
+		{http.MethodPatch, "/albums/1", http.Header{"If-Match": {`W/"2"`}}, `{"title":"Blue Train"}`, http.StatusPreconditionFailed, ``, `{"errors":"album has been changed since it was read"}`},
+		{http.MethodPatch, "/albums/1", http.Header{"If-Match": {`"1", "2"`}}, `{"price":"49.99"}`, http.StatusOK, `"3"`, `{"message":"album successfully updated"}`},
+		{http.MethodPatch, "/albums/1", http.Header{"If-Match": {`*`}}, `{"format":"vinyl"}`, http.StatusOK, `"4"`, `{"message":"album successfully updated"}`},
+		{http.MethodPatch, "/albums/1", nil, `{"label":"Blue Note"}`, http.StatusOK, ``, `{"message":"album successfully updated"}`},
+		{http.MethodPatch, "/albums/99", http.Header{"If-Match": {`"1"`}}, `{"title":"Missing"}`, http.StatusNotFound, ``, `{"errors":"album not found"}`},
+		{http.MethodPatch, "/albums/99", nil, `{"title":"Missing"}`, http.StatusNotFound, ``, `{"errors":"album not found"}`},
+		{http.MethodGet, "/albums/1", nil, "", http.StatusOK, `"5"`, `"title":"Blue Train (Mono)","artist":"John Coltrane","artist_id":1,"price":"49.99","label":"Blue Note","format":"vinyl",`},
+
+		// Reviews change the album's rating, and so its version
+		{http.MethodPut, "/albums/2/reviews", http.Header{"Authorization": {"Bearer " + token}}, `{"rating":5}`, http.StatusOK, ``, `{"id":1,"album_id":2,`},
+		{http.MethodGet, "/albums/2", http.Header{"If-None-Match": {`"1"`}}, "", http.StatusOK, `"2"`, `"review_count":1,"average_rating":5.00,`},
+		{http.MethodDelete, "/albums/2", http.Header{"If-Match": {`"1"`}}, "", http.StatusPreconditionFailed, ``, `{"errors":"album has been changed since it was read"}`},
+		{http.MethodGet, "/albums/2", nil, "", http.StatusOK, `"2"`, `[{"id":2,`},
+		{http.MethodDelete, "/albums/2", http.Header{"If-Match": {`"2"`}}, "", http.StatusOK, ``, `{"message":"album successfully removed"}`},
+		{http.MethodDelete, "/albums/2", http.Header{"If-Match": {`"2"`}}, "", http.StatusNotFound, ``, `{"errors":"album not found"}`},
+	}
+
+	for _, tt := range tests {
+		rr := wishlistRequest(router, tt.method, tt.url, tt.body, tt.header)
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("%v %v returned wrong status code: got %v want %v", tt.method, tt.url, status, tt.expectedCode)
+		}
+
+		if etag := rr.Header().Get("ETag"); etag != tt.expectedETag {
+			t.Errorf("%v %v returned wrong ETag: got %v want %v", tt.method, tt.url, etag, tt.expectedETag)
+		}
+
+		if actual := strings.TrimSpace(rr.Body.String()); !strings.Contains(actual, tt.expected) || tt.expected == "" && actual != "" {
+			t.Errorf("%v %v returned unexpected body: got %v want %v", tt.method, tt.url, actual, tt.expected)
+		}
+	}
+
+	// Renaming the artist changes their albums
+	name := "John William Coltrane"
+	if err := store.UpdateArtist(context.Background(), 1, ArtistUpdate{Name: &name}); err != nil {
+		t.Fatalf("Failed to rename artist: %v", err)
+	}
+	if rr := shopRequest(router, http.MethodGet, "/albums/1", ""); rr.Header().Get("ETag") != `"6"` {
+		t.Errorf("Expected renaming the artist to change the album's ETag, got %v", rr.Header().Get("ETag"))
+	}
+
+	// The store checks the version as it writes, so a change made since the
+	// handler read the album is not overwritten
+	title := "Sarah Vaughan (Deluxe)"
+	if err := store.Update(context.Background(), 4, AlbumUpdate{Title: &title, Version: 2}); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("Expected ErrVersionMismatch updating a stale version, got %v", err)
+	}
+	if err := store.Update(context.Background(), 99, AlbumUpdate{Title: &title, Version: 1}); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("Expected ErrAlbumNotFound updating a missing album, got %v", err)
+	}
+	if err := store.Trash(context.Background(), 4, 2, time.Now()); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("Expected ErrVersionMismatch trashing a stale version, got %v", err)
+	}
+	if album, err := store.Get(context.Background(), 4); err != nil || album.Title != "Sarah Vaughan" || album.Version != 1 {
+		t.Errorf("Expected the album to be left alone, got %+v, %v", album, err)
+	}
+}
+
+func TestMatchETag(t *testing.T) {
+	tests := []struct {
+		header   string
+		weak     bool
+		expected bool
+	}{
+		{`"3"`, false, true},
+		{`"1", "3"`, false, true},
+		{`"1","3"`, false, true},
+		{`*`, false, true},
+		{`"4"`, false, false},
+		{`W/"3"`, false, false},
+		{`W/"3"`, true, true},
+		{`3`, true, false},
+	}
+
+	for _, tt := range tests {
+		if actual := matchETag(tt.header, `"3"`, tt.weak); actual != tt.expected {
+			t.Errorf("matchETag(%q, weak %v) = %v, want %v", tt.header, tt.weak, actual, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-web-service/money"
+)
+
+// maxFacetValues bounds the buckets of a value facet, keeping the largest.
+const maxFacetValues = 20
+
+// FacetBucket counts the albums sharing a facet value. Range buckets also
+// carry their bounds, in the form the price[gte] and price[lt] filters take,
+// so a client can refine by them; the last bucket has no Max.
+type FacetBucket struct {
+	Value string  `json:"value"`
+	Min   *string `json:"min,omitempty"`
+	Max   *string `json:"max,omitempty"`
+	Count int64   `json:"count"`
+}
+
+// albumFacet describes how albums are grouped for a facet.
+type albumFacet struct {
+	field string
+	// bounds splits a range facet into buckets; value facets leave it empty.
+	bounds []money.Money
+}
+
+// albumFacets lists the facets a listing can ask for with facets=artist,price.
+var albumFacets = map[string]albumFacet{
+	"artist": {field: "artist"},
+	"price": {field: "price", bounds: []money.Money{
+		money.New(1000, DefaultCurrency),
+		money.New(2500, DefaultCurrency),
+		money.New(5000, DefaultCurrency),
+		money.New(10000, DefaultCurrency),
+	}},
+}
+
+// parseFacets reads a facets parameter such as "artist,price".
+func parseFacets(facets string) ([]string, error) {
+	if facets == "" {
+		return nil, nil
+	}
+
+	var names []string
+	for _, name := range strings.Split(facets, ",") {
+		if _, ok := albumFacets[name]; !ok {
+			return nil, fmt.Errorf("unknown facet '%v'", name)
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// bucket returns the index of the range bucket value falls in.
+func (f albumFacet) bucket(value money.Money) int {
+	for i, bound := range f.bounds {
+		if value.Amount < bound.Amount {
+			return i
+		}
+	}
+
+	return len(f.bounds)
+}
+
+// rangeBucket describes range bucket i, with count albums.
+func (f albumFacet) rangeBucket(i int, count int64) FacetBucket {
+	bucket := FacetBucket{Count: count}
+
+	var min, max string
+	if i > 0 {
+		min = f.bounds[i-1].String()
+		bucket.Min = &min
+	}
+	if i < len(f.bounds) {
+		max = f.bounds[i].String()
+		bucket.Max = &max
+	}
+
+	bucket.Value = min + "-" + max
+	if i == 0 {
+		bucket.Value = "0.00-" + max
+	}
+
+	return bucket
+}
+
+// sortValueBuckets orders value buckets by descending count, then by value,
+// and keeps the first maxFacetValues.
+func sortValueBuckets(buckets []FacetBucket) []FacetBucket {
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Count != buckets[j].Count {
+			return buckets[i].Count > buckets[j].Count
+		}
+		return buckets[i].Value < buckets[j].Value
+	})
+
+	if len(buckets) > maxFacetValues {
+		buckets = buckets[:maxFacetValues]
+	}
+
+	return buckets
+}
+
+// Facets counts the albums matching filters in memory.
+func (s *MemoryStore) Facets(ctx context.Context, filters []Filter, names []string) (map[string][]FacetBucket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := AlbumQuery{Filters: s.resolveLabels(filters)}
+	albums := s.sorted(query.match)
+
+	facets := map[string][]FacetBucket{}
+	for _, name := range names {
+		facet := albumFacets[name]
+		field := albumFields[facet.field]
+
+		if facet.bounds != nil {
+			counts := make([]int64, len(facet.bounds)+1)
+			for _, album := range albums {
+				counts[facet.bucket(field.value(album).(money.Money))]++
+			}
+
+			buckets := []FacetBucket{}
+			for i, count := range counts {
+				if count > 0 {
+					buckets = append(buckets, facet.rangeBucket(i, count))
+				}
+			}
+
+			facets[name] = buckets
+			continue
+		}
+
+		counts := map[string]int64{}
+		for _, album := range albums {
+			counts[field.value(album).(string)]++
+		}
+
+		buckets := []FacetBucket{}
+		for value, count := range counts {
+			buckets = append(buckets, FacetBucket{Value: value, Count: count})
+		}
+
+		facets[name] = sortValueBuckets(buckets)
+	}
+
+	return facets, nil
+}
+
+// Facets runs one GROUP BY query per facet over the albums matching filters.
+func (s *SQLStore) Facets(ctx context.Context, filters []Filter, names []string) (map[string][]FacetBucket, error) {
+	conditions, args := s.where(filters)
+	where := ""
+	if len(conditions) > 0 {
+		where = ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	facets := map[string][]FacetBucket{}
+	for _, name := range names {
+		facet := albumFacets[name]
+
+		var buckets []FacetBucket
+		var err error
+		if facet.bounds != nil {
+			buckets, err = s.rangeFacet(ctx, facet, where, args)
+		} else {
+			buckets, err = s.valueFacet(ctx, facet, where, args)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("facet %v %v", name, err)
+		}
+
+		facets[name] = buckets
+	}
+
+	return facets, nil
+}
+
+func (s *SQLStore) valueFacet(ctx context.Context, facet albumFacet, where string, args []any) ([]FacetBucket, error) {
+	column := albumFields[facet.field].column
+
+	rows, err := s.Db.QueryContext(ctx, s.rebind(`SELECT `+column+`, COUNT(*) FROM album`+where+
+		` GROUP BY `+column+` ORDER BY COUNT(*) DESC, `+column+` LIMIT `+strconv.Itoa(maxFacetValues)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []FacetBucket{}
+	for rows.Next() {
+		var bucket FacetBucket
+		if err := rows.Scan(&bucket.Value, &bucket.Count); err != nil {
+			return nil, err
+		}
+
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, rows.Err()
+}
+
+func (s *SQLStore) rangeFacet(ctx context.Context, facet albumFacet, where string, args []any) ([]FacetBucket, error) {
+	column := albumFields[facet.field].column
+
+	// The bounds are constants rather than user input, so they are inlined
+	var cases []string
+	for i, bound := range facet.bounds {
+		cases = append(cases, fmt.Sprintf("WHEN %v < %v THEN %d", column, bound, i))
+	}
+	bucket := fmt.Sprintf("CASE %v ELSE %d END", strings.Join(cases, " "), len(facet.bounds))
+
+	rows, err := s.Db.QueryContext(ctx, s.rebind(`SELECT `+bucket+` AS bucket, COUNT(*) FROM album`+where+
+		` GROUP BY bucket ORDER BY bucket`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []FacetBucket{}
+	for rows.Next() {
+		var i int
+		var count int64
+		if err := rows.Scan(&i, &count); err != nil {
+			return nil, err
+		}
+
+		buckets = append(buckets, facet.rangeBucket(i, count))
+	}
+
+	return buckets, rows.Err()
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go-web-service/money"
+)
+
+func TestFacets_MemoryStore(t *testing.T) {
+	testFacets(t, NewAlbums(NewMemoryStore(queryAlbums...)))
+}
+
+func TestFacets_SQLite(t *testing.T) {
+	testFacets(t, NewAlbums(querySQLiteStore(t)))
+}
+
+func testFacets(t *testing.T, albums *Albums) {
+	t.Helper()
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"/albums?limit=1&facets=artist", `"facets":{"artist":[{"value":"John Coltrane","count":3},{"value":"Gerry Mulligan","count":1},{"value":"Post Malone","count":1},{"value":"Sarah Vaughan","count":1},{"value":"Various","count":1}]}`},
+		{"/albums?limit=1&facets=price", `"facets":{"price":[{"value":"10.00-25.00","min":"10.00","max":"25.00","count":4},{"value":"25.00-50.00","min":"25.00","max":"50.00","count":1},{"value":"50.00-100.00","min":"50.00","max":"100.00","count":2}]}`},
+		// Facets count every album matching the filters, not just the page
+		{"/albums?limit=1&artist=John+Coltrane&facets=artist,price", `"facets":{"artist":[{"value":"John Coltrane","count":3}],"price":[{"value":"10.00-25.00","min":"10.00","max":"25.00","count":1},{"value":"50.00-100.00","min":"50.00","max":"100.00","count":2}]}`},
+		{"/albums?price[gte]=1000&facets=artist,price", `"facets":{"artist":[],"price":[]}`},
+	}
+
+	for _, tt := range tests {
+		rr := sendMockHTTPRequest(t, albums.GetAlbums, http.MethodGet, tt.url)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("%v returned wrong status code: got %v want %v", tt.url, status, http.StatusOK)
+		}
+
+		if actual := rr.Body.String(); !strings.Contains(actual, tt.expected) {
+			t.Errorf("%v returned unexpected body: got %v want it to contain %v", tt.url, actual, tt.expected)
+		}
+	}
+
+	rr := sendMockHTTPRequest(t, albums.GetAlbums, http.MethodGet, "/albums")
+	if actual := rr.Body.String(); strings.Contains(actual, "facets") {
+		t.Errorf("Expected no facets unless asked for, got %v", actual)
+	}
+}
+
+func TestFacets_InvalidInput(t *testing.T) {
+	albums := NewAlbums(NewMemoryStore(queryAlbums...))
+
+	rr := sendMockHTTPRequest(t, albums.GetAlbums, http.MethodGet, "/albums?facets=artist,title")
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	expected := `{"errors":"unknown facet 'title'"}`
+	if actual := strings.TrimSpace(rr.Body.String()); actual != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
+	}
+}
+
+func TestSQLStore_Facets(t *testing.T) {
+	db, mock := getMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT artist, COUNT\(\*\) FROM album WHERE deleted_at IS NULL AND price >= \$1 GROUP BY artist ORDER BY COUNT\(\*\) DESC, artist LIMIT 20`).
+		WithArgs("20.00").
+		WillReturnRows(sqlmock.NewRows([]string{"artist", "count"}).AddRow("John Coltrane", 2))
+	mock.ExpectQuery(`SELECT CASE WHEN price < 10.00 THEN 0 WHEN price < 25.00 THEN 1 WHEN price < 50.00 THEN 2 WHEN price < 100.00 THEN 3 ELSE 4 END AS bucket, COUNT\(\*\) FROM album WHERE deleted_at IS NULL AND price >= \$1 GROUP BY bucket ORDER BY bucket`).
+		WithArgs("20.00").
+		WillReturnRows(sqlmock.NewRows([]string{"bucket", "count"}).AddRow(2, 1).AddRow(4, 1))
+
+	store := &SQLStore{Db: db, Driver: "postgres"}
+	filters := []Filter{{Field: "price", Operator: OpGte, Values: []any{money.MustParse("20.00", DefaultCurrency)}}}
+
+	facets, err := store.Facets(context.Background(), filters, []string{"artist", "price"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if actual := facets["artist"]; len(actual) != 1 || actual[0].Value != "John Coltrane" || actual[0].Count != 2 {
+		t.Errorf("Unexpected artist facet: %v", actual)
+	}
+	if actual := facets["price"]; len(actual) != 2 || actual[0].Value != "25.00-50.00" || actual[1].Value != "100.00-" || actual[1].Max != nil {
+		t.Errorf("Unexpected price facet: %v", actual)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,296 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// minSimilarity is the trigram similarity a word needs to fuzzily match a
+// term, the same default as PostgreSQL's pg_trgm.
+const minSimilarity = 0.3
+
+// FuzzySearcher is implemented by stores that can match album titles and
+// artists despite typos.
+type FuzzySearcher interface {
+	// FuzzySearch returns the albums with words similar to any of terms,
+	// closest first. Results list the words that matched.
+	FuzzySearch(ctx context.Context, terms []string, limit int) ([]SearchResult, error)
+	// Suggest completes prefix into album titles and artists.
+	Suggest(ctx context.Context, prefix string, limit int) ([]Suggestion, error)
+}
+
+// Suggestion is a title or artist that completes a prefix, with the number of
+// albums it belongs to.
+type Suggestion struct {
+	Text   string `json:"text"`
+	Field  string `json:"field"`
+	Albums int    `json:"albums"`
+}
+
+// Suggest serves GET /albums/suggest?prefix=, completing a prefix into album
+// titles and artists. Prefixes that complete nothing are matched fuzzily, so
+// a typo still gets suggestions.
+func (a *Albums) Suggest(w http.ResponseWriter, r *http.Request) {
+	suggester, ok := a.Store.(FuzzySearcher)
+	if !ok {
+		ServeJSONError(w, "suggestions are not supported by this store", http.StatusNotImplemented)
+		return
+	}
+
+	parameters := r.URL.Query()
+
+	prefix := parameters.Get("prefix")
+	if len(words(prefix)) == 0 {
+		ServeJSONError(w, "prefix must contain at least one letter or digit", http.StatusBadRequest)
+		return
+	}
+
+	limit := 10
+	if value := parameters.Get("limit"); value != "" {
+		var err error
+		if limit, err = parseLimit(value); err != nil {
+			ServeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	suggestions, err := suggester.Suggest(r.Context(), prefix, limit)
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("Suggest %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if suggestions == nil {
+		suggestions = []Suggestion{}
+	}
+
+	ServeJSON(w, map[string]any{"data": suggestions}, http.StatusOK)
+}
+
+// FuzzySearch scores each album by how close its words are to the terms:
+// the sum, over the terms, of the trigram similarity of the album's closest
+// word. An exact match scores 1.
+func (s *IndexedStore) FuzzySearch(ctx context.Context, terms []string, limit int) ([]SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type match struct {
+		score   float64
+		matched []string
+	}
+	matches := map[int64]*match{}
+
+	for _, term := range terms {
+		best := map[int64]float64{}
+		closest := map[int64]string{}
+
+		for word, similarity := range s.similarWords(term) {
+			for id := range s.postings[word] {
+				if similarity > best[id] || similarity == best[id] && word < closest[id] {
+					best[id] = similarity
+					closest[id] = word
+				}
+			}
+		}
+
+		for id, similarity := range best {
+			if matches[id] == nil {
+				matches[id] = &match{}
+			}
+
+			matches[id].score += similarity
+			matches[id].matched = append(matches[id].matched, closest[id])
+		}
+	}
+
+	results := make([]SearchResult, 0, len(matches))
+	for id, m := range matches {
+		results = append(results, SearchResult{Album: s.albums[id], Score: m.score, matched: m.matched})
+	}
+
+	sortResults(results)
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// Suggest completes the last word of prefix, keeping the titles and artists
+// that also contain its earlier words. Values starting with the prefix come
+// first, then those belonging to the most albums.
+func (s *IndexedStore) Suggest(ctx context.Context, prefix string, limit int) ([]Suggestion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	prefixWords := words(prefix)
+	last := prefixWords[len(prefixWords)-1]
+	earlier := prefixWords[:len(prefixWords)-1]
+
+	// Words completing the last word, or failing that words close to it
+	var candidates []string
+	start, _ := slices.BinarySearch(s.vocabulary, last)
+	for _, word := range s.vocabulary[start:] {
+		if !strings.HasPrefix(word, last) {
+			break
+		}
+		candidates = append(candidates, word)
+	}
+	if len(candidates) == 0 {
+		for word := range s.similarWords(last) {
+			candidates = append(candidates, word)
+		}
+	}
+
+	type key struct{ field, text string }
+	found := map[key]*Suggestion{}
+	counted := map[key]map[int64]bool{}
+
+	for _, word := range candidates {
+		for id, p := range s.postings[word] {
+			album := s.albums[id]
+
+			for _, field := range []struct {
+				name  string
+				text  string
+				count int
+			}{{"title", album.Title, p.title}, {"artist", album.Artist, p.artist}} {
+				if field.count == 0 || !containsWords(field.text, earlier) {
+					continue
+				}
+
+				k := key{field.name, strings.ToLower(field.text)}
+				if found[k] == nil {
+					found[k] = &Suggestion{Text: field.text, Field: field.name}
+					counted[k] = map[int64]bool{}
+				}
+				if !counted[k][id] {
+					counted[k][id] = true
+					found[k].Albums++
+				}
+			}
+		}
+	}
+
+	normalized := strings.Join(prefixWords, " ")
+	startsWith := func(s *Suggestion) bool {
+		return strings.HasPrefix(strings.Join(words(s.Text), " "), normalized)
+	}
+
+	suggestions := make([]*Suggestion, 0, len(found))
+	for _, suggestion := range found {
+		suggestions = append(suggestions, suggestion)
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if startsWith(a) != startsWith(b) {
+			return startsWith(a)
+		}
+		if a.Albums != b.Albums {
+			return a.Albums > b.Albums
+		}
+		if a.Text != b.Text {
+			return a.Text < b.Text
+		}
+		return a.Field < b.Field
+	})
+
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+
+	result := make([]Suggestion, len(suggestions))
+	for i, suggestion := range suggestions {
+		result[i] = *suggestion
+	}
+
+	return result, nil
+}
+
+// containsWords reports whether text contains every one of want as a whole word.
+func containsWords(text string, want []string) bool {
+	have := words(text)
+	for _, word := range want {
+		if !slices.Contains(have, word) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// similarWords returns the indexed words whose trigram similarity to term is
+// at least minSimilarity. Callers must hold s.mu.
+func (s *IndexedStore) similarWords(term string) map[string]float64 {
+	termTrigrams := trigrams(term)
+
+	shared := map[string]int{}
+	for _, trigram := range termTrigrams {
+		for word := range s.trigrams[trigram] {
+			shared[word]++
+		}
+	}
+
+	similar := map[string]float64{}
+	for word, n := range shared {
+		similarity := float64(n) / float64(len(termTrigrams)+len(trigrams(word))-n)
+		if similarity >= minSimilarity {
+			similar[word] = similarity
+		}
+	}
+
+	return similar
+}
+
+// trigrams returns the distinct three letter sequences of word, padded the
+// way pg_trgm does so that short words and word starts weigh more.
+func trigrams(word string) []string {
+	runes := []rune("  " + word + " ")
+
+	var result []string
+	seen := map[string]bool{}
+	for i := 0; i+3 <= len(runes); i++ {
+		trigram := string(runes[i : i+3])
+		if !seen[trigram] {
+			seen[trigram] = true
+			result = append(result, trigram)
+		}
+	}
+
+	return result
+}
+
+// addWord adds a newly indexed word to the vocabulary and trigram index.
+// Callers must hold s.mu.
+func (s *IndexedStore) addWord(word string) {
+	if i, found := slices.BinarySearch(s.vocabulary, word); !found {
+		s.vocabulary = slices.Insert(s.vocabulary, i, word)
+	}
+
+	for _, trigram := range trigrams(word) {
+		if s.trigrams[trigram] == nil {
+			s.trigrams[trigram] = map[string]bool{}
+		}
+		s.trigrams[trigram][word] = true
+	}
+}
+
+// removeWord removes a word no album contains any more. Callers must hold s.mu.
+func (s *IndexedStore) removeWord(word string) {
+	if i, found := slices.BinarySearch(s.vocabulary, word); found {
+		s.vocabulary = slices.Delete(s.vocabulary, i, i+1)
+	}
+
+	for _, trigram := range trigrams(word) {
+		delete(s.trigrams[trigram], word)
+		if len(s.trigrams[trigram]) == 0 {
+			delete(s.trigrams, trigram)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-web-service/money"
+)
+
+func TestTrigrams(t *testing.T) {
+	expected := []string{"  j", " je", "jer", "eru", "ru "}
+	if actual := trigrams("jeru"); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected trigrams: got %v want %v", actual, expected)
+	}
+}
+
+func TestIndexedStore_FuzzySearch(t *testing.T) {
+	ctx := context.Background()
+	store, _ := NewIndexedStore(ctx, NewMemoryStore(queryAlbums...))
+
+	search := func(query string) string {
+		results, err := store.FuzzySearch(ctx, tokenize(query), 10)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		var titles []string
+		for _, result := range results {
+			titles = append(titles, result.Album.Title)
+		}
+		return strings.Join(titles, ",")
+	}
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"coltane", "Blue Train,Giant Steps,Ballads"},
+		{"mulligen", "Jeru"},
+		{"gerry mulligan", "Jeru"},
+		{"giant stpes", "Giant Steps"},
+		{"xylophone", ""},
+	}
+
+	for _, tt := range tests {
+		if actual := search(tt.query); actual != tt.expected {
+			t.Errorf("FuzzySearch(%q) = %v want %v", tt.query, actual, tt.expected)
+		}
+	}
+
+	// The index follows writes made through the store
+	artist := "John Coltrane"
+	if err := store.Update(ctx, 3, AlbumUpdate{Artist: &artist}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if actual := search("mulligen"); actual != "" {
+		t.Errorf("Expected the old artist to be gone, got %v", actual)
+	}
+	if actual := search("coltane"); actual != "Blue Train,Giant Steps,Jeru,Ballads" {
+		t.Errorf("Expected the new artist to match, got %v", actual)
+	}
+}
+
+func TestIndexedStore_Suggest(t *testing.T) {
+	ctx := context.Background()
+	store, _ := NewIndexedStore(ctx, NewMemoryStore(append(queryAlbums,
+		Album{Title: "Coltrane Jazz", Artist: "John Coltrane", Price: money.New(1999, "USD")},
+	)...))
+
+	suggest := func(prefix string) []Suggestion {
+		suggestions, err := store.Suggest(ctx, prefix, 10)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return suggestions
+	}
+
+	expected := []Suggestion{
+		{Text: "Coltrane Jazz", Field: "title", Albums: 1},
+		{Text: "John Coltrane", Field: "artist", Albums: 4},
+	}
+	if actual := suggest("Col"); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected suggestions: got %v want %v", actual, expected)
+	}
+
+	expected = []Suggestion{{Text: "John Coltrane", Field: "artist", Albums: 4}}
+	if actual := suggest("john colt"); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected suggestions: got %v want %v", actual, expected)
+	}
+
+	// A misspelled prefix falls back to words close to it
+	expected = []Suggestion{{Text: "Gerry Mulligan", Field: "artist", Albums: 1}}
+	if actual := suggest("muligan"); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected suggestions: got %v want %v", actual, expected)
+	}
+
+	if err := store.Delete(ctx, 3); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if actual := suggest("mull"); len(actual) != 0 {
+		t.Errorf("Expected no suggestions for a deleted album, got %v", actual)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	store, _ := NewIndexedStore(context.Background(), NewMemoryStore(queryAlbums...))
+	albums := NewAlbums(store)
+
+	tests := []struct {
+		albums       *Albums
+		url          string
+		expectedCode int
+		expected     string
+	}{
+		{albums, "/albums/suggest?prefix=sar", http.StatusOK, `{"data":[{"text":"Sarah Vaughan","field":"artist","albums":1},{"text":"Sarah Vaughan","field":"title","albums":1}]}`},
+		{albums, "/albums/suggest?prefix=jo&limit=1", http.StatusOK, `{"data":[{"text":"John Coltrane","field":"artist","albums":3}]}`},
+		{albums, "/albums/suggest?prefix=zzz", http.StatusOK, `{"data":[]}`},
+		{albums, "/albums/suggest?prefix=-", http.StatusBadRequest, `{"errors":"prefix must contain at least one letter or digit"}`},
+		{albums, "/albums/suggest?prefix=jo&limit=500", http.StatusBadRequest, `{"errors":"limit must be a number between 1 and 100"}`},
+		{NewAlbums(NewMemoryStore()), "/albums/suggest?prefix=jo", http.StatusNotImplemented, `{"errors":"suggestions are not supported by this store"}`},
+	}
+
+	for _, tt := range tests {
+		rr := sendMockHTTPRequest(t, tt.albums.Suggest, http.MethodGet, tt.url)
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("%v returned wrong status code: got %v want %v", tt.url, status, tt.expectedCode)
+		}
+
+		if actual := strings.TrimSpace(rr.Body.String()); actual != tt.expected {
+			t.Errorf("%v returned unexpected body: got %v want %v", tt.url, actual, tt.expected)
+		}
+	}
+}
+
+func TestSearch_Fuzzy(t *testing.T) {
+	store, _ := NewIndexedStore(context.Background(), NewMemoryStore(queryAlbums...))
+	albums := NewAlbums(store)
+
+	rr := sendMockHTTPRequest(t, albums.Search, http.MethodGet, "/search?q=mulligen&fuzzy=true")
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expected := `"highlights":{"artist":"Gerry \u003cmark\u003eMulligan\u003c/mark\u003e","title":"Jeru"}`
+	if actual := rr.Body.String(); !strings.Contains(actual, expected) {
+		t.Errorf("Handler returned unexpected body: got %v want it to contain %v", actual, expected)
+	}
+
+	rr = sendMockHTTPRequest(t, albums.Search, http.MethodGet, "/search?q=blue&fuzzy=maybe")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,410 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrOutOfStock is returned by an InventoryStore when a reservation or
+	// decrement needs more copies than are available.
+	ErrOutOfStock = errors.New("not enough stock available")
+	// ErrReservationNotFound is returned when the album has no unexpired
+	// reservation with the given id.
+	ErrReservationNotFound = errors.New("reservation not found")
+	// ErrReservationLimit is returned when a reservation would have its
+	// customer hold more than maxCustomerReserved copies.
+	ErrReservationLimit = fmt.Errorf("customers can hold at most %d copies at a time", maxCustomerReserved)
+)
+
+const (
+	// lowStockThreshold is the number of available copies at or below which
+	// stock is reported as low.
+	lowStockThreshold = 3
+	// maxStockAdjustment caps how far one request can move a stock level.
+	maxStockAdjustment = 10000
+	// maxReservationQuantity caps the copies one reservation can hold, and
+	// maxCustomerReserved those all of a customer's unexpired ones can.
+	maxReservationQuantity = 100
+	maxCustomerReserved    = 100
+	defaultReservationTTL  = 15 * time.Minute
+	maxReservationTTL      = 24 * time.Hour
+)
+
+// stockFormats are the album formats physical copies are counted in.
+var stockFormats = []string{"vinyl", "cd", "cassette"}
+
+// Availability summarizes how many copies can be sold.
+type Availability string
+
+const (
+	InStock    Availability = "in_stock"
+	LowStock   Availability = "low_stock"
+	OutOfStock Availability = "out_of_stock"
+)
+
+func availability(available int) Availability {
+	switch {
+	case available <= 0:
+		return OutOfStock
+	case available <= lowStockThreshold:
+		return LowStock
+	default:
+		return InStock
+	}
+}
+
+// Stock is the number of copies of an album in one format. Available is
+// OnHand less the copies held by unexpired reservations.
+type Stock struct {
+	Format    string       `json:"format"`
+	OnHand    int          `json:"on_hand"`
+	Reserved  int          `json:"reserved"`
+	Available int          `json:"available"`
+	Status    Availability `json:"status"`
+}
+
+func newStock(format string, onHand, reserved int) Stock {
+	available := max(onHand-reserved, 0)
+
+	return Stock{Format: format, OnHand: onHand, Reserved: reserved, Available: available, Status: availability(available)}
+}
+
+// StockLevel is the stock of an album across its formats.
+type StockLevel struct {
+	Available int          `json:"available"`
+	Status    Availability `json:"status"`
+	Formats   []Stock      `json:"formats"`
+}
+
+func newStockLevel(stock []Stock) StockLevel {
+	if stock == nil {
+		stock = []Stock{}
+	}
+
+	var available int
+	for _, format := range stock {
+		available += format.Available
+	}
+
+	return StockLevel{Available: available, Status: availability(available), Formats: stock}
+}
+
+// Reservation holds Quantity copies of an album in Format back from sale
+// until ExpiresAt for the customer with CustomerID. CartID is set for
+// reservations made for a cart, whose copies are sold when the cart is
+// checked out.
+type Reservation struct {
+	ID         int64     `json:"id"`
+	AlbumID    int64     `json:"album_id"`
+	Format     string    `json:"format"`
+	Quantity   int       `json:"quantity"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	CustomerID int64     `json:"customer_id"`
+	CartID     *string   `json:"cart_id"`
+}
+
+// stockCount is the copies of an album in one format on hand, held by
+// unexpired reservations, and held of those for whoever takes copies.
+type stockCount struct {
+	onHand, reserved, held int
+}
+
+// takeCopies returns how many of need copies to take in each of the formats
+// counted: those held for the taker first, then those available, in format
+// order. It returns false when there are not enough.
+func takeCopies(need int, counts []stockCount) ([]int, bool) {
+	taken := make([]int, len(counts))
+	for i, count := range counts {
+		taken[i] = min(need, count.held)
+		need -= taken[i]
+	}
+	for i, count := range counts {
+		take := max(min(need, count.onHand-count.reserved), 0)
+		taken[i] += take
+		need -= take
+	}
+
+	return taken, need == 0
+}
+
+// InventoryStore is the persistence layer the stock and reservation handlers
+// depend on. Reservations expire at their ExpiresAt as of now, which callers
+// pass in. Changes to the stock of one album and format are serialized, so
+// concurrent requests can never hand out more copies than are on hand.
+type InventoryStore interface {
+	// Stock returns the stock of each album by album id, in format order.
+	// Albums without stock are left out.
+	Stock(ctx context.Context, albumIDs []int64, now time.Time) (map[int64][]Stock, error)
+	// AdjustStock adds delta, which may be negative, to the copies on hand
+	// and returns the new stock. It returns ErrOutOfStock rather than take
+	// the copies on hand below those reserved.
+	AdjustStock(ctx context.Context, albumID int64, format string, delta int, now time.Time) (Stock, error)
+	// Reserve returns ErrOutOfStock when fewer than the reservation's
+	// Quantity copies are available, ErrReservationLimit when its customer
+	// would hold too many, ErrCustomerNotFound when there is no such
+	// customer, and ErrCartNotFound when its CartID is set to a cart that
+	// does not exist or belongs to another customer. The reservations of one
+	// customer are serialized, so that concurrent ones cannot pass the limit.
+	Reserve(ctx context.Context, reservation Reservation, now time.Time) (Reservation, error)
+	// Release returns ErrReservationNotFound when the album has no unexpired
+	// reservation with the id made by the customer with customerID.
+	Release(ctx context.Context, albumID, reservationID, customerID int64, now time.Time) error
+}
+
+// GetStock serves an album's stock in each format, with its availability.
+func (a *Albums) GetStock(w http.ResponseWriter, r *http.Request) {
+	albumID, _, ok := inventoryPath(w, r)
+	if !ok {
+		return
+	}
+
+	a.serveStock(w, r, albumID, "GetStock")
+}
+
+// AdjustStock adds copies of an album to its stock, or takes them away, as
+// in {"format":"vinyl","delta":-2}, and serves the album's stock. Copies
+// held by reservations cannot be taken away. Only staff can change stock.
+func (a *Albums) AdjustStock(w http.ResponseWriter, r *http.Request) {
+	if !requireStaff(w, r) {
+		return
+	}
+
+	albumID, _, ok := inventoryPath(w, r)
+	if !ok {
+		return
+	}
+
+	if !isJSON(r) {
+		ServeJSONError(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var input struct {
+		Format *string `json:"format"`
+		Delta  *int    `json:"delta"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		ServeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var errs ValidationErrors
+	format := validateStockFormat(&errs, input.Format)
+	switch {
+	case input.Delta == nil:
+		errs.Add("delta", "is required")
+	case *input.Delta == 0 || *input.Delta < -maxStockAdjustment || *input.Delta > maxStockAdjustment:
+		errs.Add("delta", fmt.Sprintf("must be a non-zero number between %d and %d", -maxStockAdjustment, maxStockAdjustment))
+	}
+	if len(errs) > 0 {
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	_, err := a.Inventory.AdjustStock(r.Context(), albumID, format, *input.Delta, time.Now())
+	switch {
+	case errors.Is(err, ErrAlbumNotFound):
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrOutOfStock):
+		ServeJSONError(w, ErrOutOfStock.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		ServeJSONError(w, fmt.Sprintf("AdjustStock %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	a.serveStock(w, r, albumID, "AdjustStock")
+}
+
+// AddReservation holds copies of an album back from sale, as in
+// {"format":"vinyl","quantity":1,"ttl":900}, for ttl seconds or 15 minutes
+// by default. A cart_id holds them for that cart's checkout. Reservations
+// are made by customers, who can hold up to 100 copies at a time.
+func (a *Albums) AddReservation(w http.ResponseWriter, r *http.Request) {
+	p, ok := requireCustomer(w, r)
+	if !ok {
+		return
+	}
+
+	albumID, _, ok := inventoryPath(w, r)
+	if !ok {
+		return
+	}
+
+	if !isJSON(r) {
+		ServeJSONError(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var input struct {
+		Format   *string `json:"format"`
+		Quantity *int    `json:"quantity"`
+		TTL      *int    `json:"ttl"`
+		CartID   *string `json:"cart_id"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		ServeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var errs ValidationErrors
+	reservation := Reservation{AlbumID: albumID, Format: validateStockFormat(&errs, input.Format), Quantity: 1, CustomerID: p.customer.ID}
+	if input.Quantity != nil {
+		if *input.Quantity < 1 || *input.Quantity > maxReservationQuantity {
+			errs.Add("quantity", fmt.Sprintf("must be between 1 and %d", maxReservationQuantity))
+		}
+		reservation.Quantity = *input.Quantity
+	}
+	ttl := defaultReservationTTL
+	if input.TTL != nil {
+		if *input.TTL < 1 || *input.TTL > int(maxReservationTTL.Seconds()) {
+			errs.Add("ttl", fmt.Sprintf("must be a number of seconds between 1 and %d", int(maxReservationTTL.Seconds())))
+		}
+		ttl = time.Duration(*input.TTL) * time.Second
+	}
+	if input.CartID != nil {
+		if !validCartID(*input.CartID) {
+			errs.Add("cart_id", "is not a cart id")
+		}
+		reservation.CartID = input.CartID
+	}
+	if len(errs) > 0 {
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	reservation.ExpiresAt = now.Add(ttl)
+
+	reservation, err := a.Inventory.Reserve(r.Context(), reservation, now)
+	switch {
+	case errors.Is(err, ErrAlbumNotFound):
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrCartNotFound):
+		ServeJSONError(w, "cart not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrOutOfStock), errors.Is(err, ErrReservationLimit):
+		ServeJSONError(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		ServeJSONError(w, fmt.Sprintf("AddReservation %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	ServeJSON(w, reservation, http.StatusOK)
+}
+
+// DeleteReservation releases a reservation's copies before it expires.
+// Customers can only release their own reservations.
+func (a *Albums) DeleteReservation(w http.ResponseWriter, r *http.Request) {
+	p, ok := requireCustomer(w, r)
+	if !ok {
+		return
+	}
+
+	albumID, reservationID, ok := inventoryPath(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.Inventory.Release(r.Context(), albumID, reservationID, p.customer.ID, time.Now())
+	if errors.Is(err, ErrReservationNotFound) {
+		ServeJSONError(w, "reservation not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		ServeJSONError(w, "could not release reservation", http.StatusInternalServerError)
+		return
+	}
+
+	ServeJSON(w, map[string]any{"message": "reservation successfully released"}, http.StatusOK)
+}
+
+// serveStock serves the stock of the album with albumID, or a 404 when there
+// is no such album.
+func (a *Albums) serveStock(w http.ResponseWriter, r *http.Request, albumID int64, handler string) {
+	if _, err := a.Store.Get(r.Context(), albumID); errors.Is(err, ErrAlbumNotFound) {
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+		return
+	}
+
+	stock, err := a.Inventory.Stock(r.Context(), []int64{albumID}, time.Now())
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+		return
+	}
+
+	ServeJSON(w, newStockLevel(stock[albumID]), http.StatusOK)
+}
+
+// embedStock sets the stock level of each album.
+func (a *Albums) embedStock(ctx context.Context, albums []Album) error {
+	ids := make([]int64, len(albums))
+	for i, album := range albums {
+		ids[i] = album.ID
+	}
+
+	stock, err := a.Inventory.Stock(ctx, ids, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for i := range albums {
+		level := newStockLevel(stock[albums[i].ID])
+		albums[i].Stock = &level
+	}
+
+	return nil
+}
+
+// validateStockFormat checks the format of a stock request and returns it
+// lowercased.
+func validateStockFormat(errs *ValidationErrors, format *string) string {
+	if format == nil {
+		errs.Add("format", "is required")
+		return ""
+	}
+
+	normalized := strings.ToLower(strings.TrimSpace(*format))
+	if !slices.Contains(stockFormats, normalized) {
+		errs.Add("format", "must be one of "+strings.Join(stockFormats, ", "))
+	}
+
+	return normalized
+}
+
+// inventoryPath parses the album id, and the reservation id if there is one,
+// of a /albums/{id}/stock, /albums/{id}/reservations or
+// /albums/{id}/reservations/{reservation} path. It writes a 400 response and
+// returns false when either is not a number.
+func inventoryPath(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/albums/"), "/")
+
+	albumID, err := strconv.ParseInt(segments[0], 10, 64)
+	if err != nil {
+		ServeJSONError(w, "invalid album id", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	var reservationID int64
+	if len(segments) > 2 {
+		if reservationID, err = strconv.ParseInt(segments[2], 10, 64); err != nil || len(segments) > 3 {
+			ServeJSONError(w, "invalid reservation id", http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+
+	return albumID, reservationID, true
+}
@@ -0,0 +1,549 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// stockKey identifies the stock of an album in one format in a MemoryStore.
+type stockKey struct {
+	albumID int64
+	format  string
+}
+
+func (s *MemoryStore) Stock(ctx context.Context, albumIDs []int64, now time.Time) (map[int64][]Stock, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stock := map[int64][]Stock{}
+	for _, id := range albumIDs {
+		for key, onHand := range s.stock {
+			if key.albumID == id {
+				stock[id] = append(stock[id], newStock(key.format, onHand, s.reserved(key, now)))
+			}
+		}
+		slices.SortFunc(stock[id], func(a, b Stock) int { return cmp.Compare(a.Format, b.Format) })
+	}
+
+	return stock, nil
+}
+
+func (s *MemoryStore) AdjustStock(ctx context.Context, albumID int64, format string, delta int, now time.Time) (Stock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.albums[albumID]; !ok {
+		return Stock{}, ErrAlbumNotFound
+	}
+
+	key := stockKey{albumID, format}
+	reserved := s.reserved(key, now)
+	onHand := s.stock[key] + delta
+	if onHand < reserved {
+		return Stock{}, ErrOutOfStock
+	}
+
+	s.stock[key] = onHand
+
+	return newStock(format, onHand, reserved), nil
+}
+
+func (s *MemoryStore) Reserve(ctx context.Context, reservation Reservation, now time.Time) (Reservation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.albums[reservation.AlbumID]; !ok {
+		return Reservation{}, ErrAlbumNotFound
+	}
+	if _, ok := s.customers[reservation.CustomerID]; !ok {
+		return Reservation{}, ErrCustomerNotFound
+	}
+	if reservation.CartID != nil {
+		cart, ok := s.carts[*reservation.CartID]
+		if !ok || cart.CustomerID != nil && *cart.CustomerID != reservation.CustomerID {
+			return Reservation{}, ErrCartNotFound
+		}
+	}
+
+	var held int
+	for _, other := range s.reservations {
+		if other.CustomerID == reservation.CustomerID && other.ExpiresAt.After(now) {
+			held += other.Quantity
+		}
+	}
+	if held+reservation.Quantity > maxCustomerReserved {
+		return Reservation{}, ErrReservationLimit
+	}
+
+	key := stockKey{reservation.AlbumID, reservation.Format}
+	if s.stock[key]-s.reserved(key, now) < reservation.Quantity {
+		return Reservation{}, ErrOutOfStock
+	}
+
+	// Expired reservations no longer count, so this is a good time to forget them.
+	for id, expired := range s.reservations {
+		if !expired.ExpiresAt.After(now) {
+			delete(s.reservations, id)
+		}
+	}
+
+	s.nextReservationID++
+	reservation.ID = s.nextReservationID
+	s.reservations[reservation.ID] = reservation
+
+	return reservation, nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, albumID, reservationID, customerID int64, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reservation, ok := s.reservations[reservationID]
+	if !ok || reservation.AlbumID != albumID || reservation.CustomerID != customerID || !reservation.ExpiresAt.After(now) {
+		return ErrReservationNotFound
+	}
+
+	delete(s.reservations, reservationID)
+
+	return nil
+}
+
+// reserved counts the copies held by unexpired reservations. Callers must
+// hold s.mu.
+func (s *MemoryStore) reserved(key stockKey, now time.Time) int {
+	var reserved int
+	for _, reservation := range s.reservations {
+		if reservation.AlbumID == key.albumID && reservation.Format == key.format && reservation.ExpiresAt.After(now) {
+			reserved += reservation.Quantity
+		}
+	}
+
+	return reserved
+}
+
+// takeStock takes the copies of each item in the cart off the stock, using
+// up the cart's reservations, and returns the copies taken. It returns
+// ErrOutOfStock and changes nothing when there are not enough. Callers must
+// hold s.mu.
+func (s *MemoryStore) takeStock(cart Cart, now time.Time) (map[stockKey]int, error) {
+	held := map[stockKey]int{}
+	for _, reservation := range s.reservations {
+		if reservation.CartID != nil && *reservation.CartID == cart.ID && reservation.ExpiresAt.After(now) {
+			held[stockKey{reservation.AlbumID, reservation.Format}] += reservation.Quantity
+		}
+	}
+
+	taken := map[stockKey]int{}
+	for _, item := range cart.Items {
+		counts := make([]stockCount, len(stockFormats))
+		for i, format := range stockFormats {
+			key := stockKey{item.AlbumID, format}
+			counts[i] = stockCount{s.stock[key], s.reserved(key, now), held[key]}
+		}
+
+		take, ok := takeCopies(item.Quantity, counts)
+		if !ok {
+			return nil, ErrOutOfStock
+		}
+		for i, format := range stockFormats {
+			if take[i] > 0 {
+				taken[stockKey{item.AlbumID, format}] = take[i]
+			}
+		}
+	}
+
+	for key, take := range taken {
+		s.stock[key] -= take
+	}
+	for id, reservation := range s.reservations {
+		if reservation.CartID != nil && *reservation.CartID == cart.ID {
+			delete(s.reservations, id)
+		}
+	}
+
+	return taken, nil
+}
+
+// restock puts the copies the order with id took off the stock back. The
+// copies of albums deleted since are gone with their stock. Callers must
+// hold s.mu.
+func (s *MemoryStore) restock(id int64) {
+	for key, quantity := range s.orderStock[id] {
+		s.stock[key] += quantity
+	}
+}
+
+// removeInventory forgets the stock and reservations of an album. Callers
+// must hold s.mu.
+func (s *MemoryStore) removeInventory(albumID int64) {
+	for key := range s.stock {
+		if key.albumID == albumID {
+			delete(s.stock, key)
+		}
+	}
+	for id, reservation := range s.reservations {
+		if reservation.AlbumID == albumID {
+			delete(s.reservations, id)
+		}
+	}
+	for _, taken := range s.orderStock {
+		for key := range taken {
+			if key.albumID == albumID {
+				delete(taken, key)
+			}
+		}
+	}
+}
+
+func (s *SQLStore) Stock(ctx context.Context, albumIDs []int64, now time.Time) (map[int64][]Stock, error) {
+	stock := map[int64][]Stock{}
+	if len(albumIDs) == 0 {
+		return stock, nil
+	}
+
+	args := []any{now.UTC()}
+	for _, id := range albumIDs {
+		args = append(args, id)
+	}
+
+	query := `SELECT s.album_id, s.format, s.on_hand, COALESCE(SUM(r.quantity), 0) FROM stock s` +
+		` LEFT JOIN reservation r ON r.album_id = s.album_id AND r.format = s.format AND r.expires_at > ?` +
+		` WHERE s.album_id IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(albumIDs)), ", ") + `)` +
+		` GROUP BY s.album_id, s.format, s.on_hand ORDER BY s.album_id, s.format`
+
+	rows, err := s.Db.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var albumID int64
+		var format string
+		var onHand, reserved int
+		if err := rows.Scan(&albumID, &format, &onHand, &reserved); err != nil {
+			return nil, err
+		}
+
+		stock[albumID] = append(stock[albumID], newStock(format, onHand, reserved))
+	}
+
+	return stock, rows.Err()
+}
+
+func (s *SQLStore) AdjustStock(ctx context.Context, albumID int64, format string, delta int, now time.Time) (Stock, error) {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return Stock{}, err
+	}
+	defer tx.Rollback()
+
+	if err := s.albumExists(ctx, tx, albumID); err != nil {
+		return Stock{}, err
+	}
+
+	if delta > 0 {
+		// Create the stock row first, so that there is always a row to lock
+		// and two first deliveries cannot both insert one.
+		if err := s.ensureStock(ctx, tx, albumID, format); err != nil {
+			return Stock{}, err
+		}
+	}
+
+	onHand, reserved, err := s.lockStock(ctx, tx, albumID, format, now)
+	if err != nil {
+		return Stock{}, err
+	}
+	if onHand+delta < reserved {
+		return Stock{}, ErrOutOfStock
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`UPDATE stock SET on_hand = on_hand + ? WHERE album_id = ? AND format = ?`), delta, albumID, format)
+	if err != nil {
+		return Stock{}, err
+	}
+
+	return newStock(format, onHand+delta, reserved), tx.Commit()
+}
+
+func (s *SQLStore) Reserve(ctx context.Context, reservation Reservation, now time.Time) (Reservation, error) {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return Reservation{}, err
+	}
+	defer tx.Rollback()
+
+	// A checkout locks its cart before the stock, so the customer and the
+	// cart are locked first here. The customer's lock serializes their
+	// reservations, and the cart's keeps it from being checked out while the
+	// reservation is made for it.
+	held, err := s.customerReserved(ctx, tx, reservation.CustomerID, now)
+	if err != nil {
+		return Reservation{}, err
+	}
+	if held+reservation.Quantity > maxCustomerReserved {
+		return Reservation{}, ErrReservationLimit
+	}
+	if reservation.CartID != nil {
+		if err := s.lockCart(ctx, tx, *reservation.CartID, reservation.CustomerID); err != nil {
+			return Reservation{}, err
+		}
+	}
+
+	// Lock the stock row before reading anything else about the album, so
+	// that the copies are counted as they are once the lock is held.
+	onHand, reserved, err := s.lockStock(ctx, tx, reservation.AlbumID, reservation.Format, now)
+	if err != nil {
+		return Reservation{}, err
+	}
+	if err := s.albumExists(ctx, tx, reservation.AlbumID); err != nil {
+		return Reservation{}, err
+	}
+	if onHand-reserved < reservation.Quantity {
+		return Reservation{}, ErrOutOfStock
+	}
+
+	// Expired reservations no longer count, so this is a good time to forget them.
+	_, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM reservation WHERE album_id = ? AND format = ? AND expires_at <= ?`),
+		reservation.AlbumID, reservation.Format, now.UTC())
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	query := `INSERT INTO reservation (album_id, format, quantity, expires_at, customer_id, cart_id) VALUES (?, ?, ?, ?, ?, ?)`
+	args := []any{reservation.AlbumID, reservation.Format, reservation.Quantity, reservation.ExpiresAt.UTC(), reservation.CustomerID, reservation.CartID}
+	if s.postgres() {
+		err = tx.QueryRowContext(ctx, s.rebind(query+` RETURNING id`), args...).Scan(&reservation.ID)
+	} else {
+		var result sql.Result
+		if result, err = tx.ExecContext(ctx, query, args...); err == nil {
+			reservation.ID, err = result.LastInsertId()
+		}
+	}
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	return reservation, tx.Commit()
+}
+
+func (s *SQLStore) Release(ctx context.Context, albumID, reservationID, customerID int64, now time.Time) error {
+	result, err := s.Db.ExecContext(ctx, s.rebind(`DELETE FROM reservation WHERE id = ? AND album_id = ? AND customer_id = ? AND expires_at > ?`),
+		reservationID, albumID, customerID, now.UTC())
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrReservationNotFound
+	}
+
+	return nil
+}
+
+// albumExists returns ErrAlbumNotFound when there is no album with id. It is
+// a locking read where the driver has them, so that it does not fix the
+// snapshot MySQL reads from for the rest of tx, and so that the album cannot
+// be deleted before tx ends.
+func (s *SQLStore) albumExists(ctx context.Context, tx *sql.Tx, id int64) error {
+	query := `SELECT id FROM album WHERE id = ? AND deleted_at IS NULL`
+	if s.Driver != "sqlite" {
+		query += ` FOR SHARE`
+	}
+
+	err := tx.QueryRowContext(ctx, s.rebind(query), id).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAlbumNotFound
+	}
+
+	return err
+}
+
+// customerReserved returns the copies held by the unexpired reservations of
+// the customer with id, locking the customer's row until tx ends where the
+// driver has row locks, or returns ErrCustomerNotFound. The reservations are
+// summed with a locking read on MySQL, as in lockStock.
+func (s *SQLStore) customerReserved(ctx context.Context, tx *sql.Tx, id int64, now time.Time) (int, error) {
+	query := `SELECT id FROM customer WHERE id = ?`
+	if s.Driver != "sqlite" {
+		query += ` FOR UPDATE`
+	}
+
+	err := tx.QueryRowContext(ctx, s.rebind(query), id).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrCustomerNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	query = `SELECT COALESCE(SUM(quantity), 0) FROM reservation WHERE customer_id = ? AND expires_at > ?`
+	if s.Driver != "sqlite" && !s.postgres() {
+		query += ` FOR SHARE`
+	}
+
+	var reserved int
+	err = tx.QueryRowContext(ctx, s.rebind(query), id, now.UTC()).Scan(&reserved)
+
+	return reserved, err
+}
+
+// lockCart returns ErrCartNotFound when there is no cart with id or it
+// belongs to another customer than the one with customerID, and otherwise
+// keeps the cart from being checked out or deleted before tx ends where the
+// driver has row locks.
+func (s *SQLStore) lockCart(ctx context.Context, tx *sql.Tx, id string, customerID int64) error {
+	query := `SELECT customer_id FROM cart WHERE id = ?`
+	if s.Driver != "sqlite" {
+		query += ` FOR SHARE`
+	}
+
+	var owner sql.NullInt64
+	err := tx.QueryRowContext(ctx, s.rebind(query), id).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && owner.Valid && owner.Int64 != customerID {
+		return ErrCartNotFound
+	}
+
+	return err
+}
+
+// takeStock takes the copies of each item in the cart off the stock inside
+// tx, using up the cart's reservations, and returns the copies taken, or
+// ErrOutOfStock. The stock rows are locked in album and format order, so
+// that concurrent checkouts cannot deadlock.
+func (s *SQLStore) takeStock(ctx context.Context, tx *sql.Tx, cart Cart, now time.Time) (map[stockKey]int, error) {
+	taken := map[stockKey]int{}
+	for _, item := range cart.Items {
+		counts := make([]stockCount, len(stockFormats))
+		for i, format := range stockFormats {
+			onHand, reserved, err := s.lockStock(ctx, tx, item.AlbumID, format, now)
+			if err != nil {
+				return nil, err
+			}
+			counts[i] = stockCount{onHand: onHand, reserved: reserved}
+
+			err = tx.QueryRowContext(ctx, s.rebind(`SELECT COALESCE(SUM(quantity), 0) FROM reservation WHERE cart_id = ? AND album_id = ? AND format = ? AND expires_at > ?`),
+				cart.ID, item.AlbumID, format, now.UTC()).Scan(&counts[i].held)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		take, ok := takeCopies(item.Quantity, counts)
+		if !ok {
+			return nil, ErrOutOfStock
+		}
+		for i, format := range stockFormats {
+			if take[i] == 0 {
+				continue
+			}
+			_, err := tx.ExecContext(ctx, s.rebind(`UPDATE stock SET on_hand = on_hand - ? WHERE album_id = ? AND format = ?`), take[i], item.AlbumID, format)
+			if err != nil {
+				return nil, err
+			}
+			taken[stockKey{item.AlbumID, format}] = take[i]
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM reservation WHERE cart_id = ?`), cart.ID); err != nil {
+		return nil, err
+	}
+
+	return taken, nil
+}
+
+// restock puts the copies the order with id took off the stock back inside
+// tx, in album and format order like takeStock locks them. The copies of
+// albums deleted since are gone with their stock.
+func (s *SQLStore) restock(ctx context.Context, tx *sql.Tx, id int64) error {
+	rows, err := tx.QueryContext(ctx, s.rebind(`SELECT album_id, format, quantity FROM order_stock WHERE order_id = ? ORDER BY album_id, format`), id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type restocked struct {
+		key      stockKey
+		quantity int
+	}
+	var items []restocked
+	for rows.Next() {
+		var item restocked
+		if err := rows.Scan(&item.key.albumID, &item.key.format, &item.quantity); err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, item := range items {
+		_, err := tx.ExecContext(ctx, s.rebind(`UPDATE stock SET on_hand = on_hand + ? WHERE album_id = ? AND format = ?`), item.quantity, item.key.albumID, item.key.format)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureStock creates an empty stock row for the album and format unless
+// there is one already.
+func (s *SQLStore) ensureStock(ctx context.Context, tx *sql.Tx, albumID int64, format string) error {
+	query := `INSERT INTO stock (album_id, format, on_hand) VALUES (?, ?, 0) ON CONFLICT DO NOTHING`
+	if s.Driver == "mysql" {
+		query = `INSERT IGNORE INTO stock (album_id, format, on_hand) VALUES (?, ?, 0)`
+	}
+
+	_, err := tx.ExecContext(ctx, s.rebind(query), albumID, format)
+
+	return err
+}
+
+// lockStock returns the copies of the album in format on hand and held by
+// unexpired reservations, locking the stock row until tx ends so that other
+// changes to it wait. SQLite has no row locks, but lets one writer in at a
+// time, which serializes the changes just the same. A missing row counts as
+// no copies.
+//
+// The reservations are summed with a locking read on MySQL, as its plain
+// reads come from the snapshot taken at the first of them and may miss
+// reservations committed while the stock row was waiting for its lock.
+// PostgreSQL takes a new snapshot for each statement, and refuses FOR SHARE
+// with aggregates.
+func (s *SQLStore) lockStock(ctx context.Context, tx *sql.Tx, albumID int64, format string, now time.Time) (int, int, error) {
+	query := `SELECT on_hand FROM stock WHERE album_id = ? AND format = ?`
+	if s.Driver != "sqlite" {
+		query += ` FOR UPDATE`
+	}
+
+	var onHand int
+	err := tx.QueryRowContext(ctx, s.rebind(query), albumID, format).Scan(&onHand)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	query = `SELECT COALESCE(SUM(quantity), 0) FROM reservation WHERE album_id = ? AND format = ? AND expires_at > ?`
+	if s.Driver != "sqlite" && !s.postgres() {
+		query += ` FOR SHARE`
+	}
+
+	var reserved int
+	err = tx.QueryRowContext(ctx, s.rebind(query), albumID, format, now.UTC()).Scan(&reserved)
+
+	return onHand, reserved, err
+}
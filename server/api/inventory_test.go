@@ -0,0 +1,396 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestInventory_MemoryStore(t *testing.T) {
+	testInventory(t, NewAlbums(NewMemoryStore(queryAlbums...)))
+}
+
+func TestInventory_SQLite(t *testing.T) {
+	testInventory(t, NewAlbums(querySQLiteStore(t)))
+}
+
+// testInventory runs through stocking and reserving copies against albums
+// holding queryAlbums.
+func testInventory(t *testing.T, albums *Albums) {
+	t.Helper()
+
+	albums.StaffToken = staffToken
+	router := SetupRouter(albums)
+	tokens := map[string]string{"{customer}": registerCustomer(t, router, "ella@example.com"),
+		"{other}": registerCustomer(t, router, "other@example.com"), "{staff}": staffToken}
+
+	tests := []struct {
+		method       string
+		url          string
+		as           string
+		body         string
+		expectedCode int
+		expected     string
+	}{
+		{http.MethodGet, "/albums/3/stock", "", "", http.StatusOK, `{"available":0,"status":"out_of_stock","formats":[]}`},
+		{http.MethodPatch, "/albums/3/stock", "{staff}", `{"format":"Vinyl","delta":5}`, http.StatusOK, `{"available":5,"status":"in_stock","formats":[{"format":"vinyl","on_hand":5,"reserved":0,"available":5,"status":"in_stock"}]}`},
+		{http.MethodPatch, "/albums/3/stock", "{staff}", `{"format":"cd","delta":2}`, http.StatusOK, `{"available":7,"status":"in_stock","formats":[{"format":"cd","on_hand":2,"reserved":0,"available":2,"status":"low_stock"},{"format":"vinyl","on_hand":5,"reserved":0,"available":5,"status":"in_stock"}]}`},
+
+		// Only staff change stock, and only customers reserve copies
+		{http.MethodPatch, "/albums/3/stock", "", `{"format":"vinyl","delta":-5}`, http.StatusUnauthorized, `{"errors":"authentication required"}`},
+		{http.MethodPatch, "/albums/3/stock", "{customer}", `{"format":"vinyl","delta":-5}`, http.StatusForbidden, `{"errors":"only staff can do this"}`},
+		{http.MethodPut, "/albums/3/reservations", "", `{"format":"vinyl"}`, http.StatusUnauthorized, `{"errors":"authentication required"}`},
+		{http.MethodPut, "/albums/3/reservations", "{staff}", `{"format":"vinyl"}`, http.StatusForbidden, `{"errors":"staff have no customer account"}`},
+		{http.MethodDelete, "/albums/3/reservations/1", "", "", http.StatusUnauthorized, `{"errors":"authentication required"}`},
+
+		// Reserved copies are not available
+		{http.MethodPut, "/albums/3/reservations", "{customer}", `{"format":"vinyl","quantity":3}`, http.StatusOK, `{"id":1,"album_id":3,"format":"vinyl","quantity":3,"expires_at":`},
+		{http.MethodGet, "/albums/3/stock", "", "", http.StatusOK, `{"format":"vinyl","on_hand":5,"reserved":3,"available":2,"status":"low_stock"}`},
+		{http.MethodPut, "/albums/3/reservations", "{customer}", `{"format":"vinyl","quantity":3}`, http.StatusConflict, `{"errors":"not enough stock available"}`},
+		{http.MethodPatch, "/albums/3/stock", "{staff}", `{"format":"vinyl","delta":-3}`, http.StatusConflict, `{"errors":"not enough stock available"}`},
+		{http.MethodPatch, "/albums/3/stock", "{staff}", `{"format":"vinyl","delta":-2}`, http.StatusOK, `{"format":"vinyl","on_hand":3,"reserved":3,"available":0,"status":"out_of_stock"}`},
+		{http.MethodPut, "/albums/3/reservations", "{customer}", `{"format":"cassette"}`, http.StatusConflict, `{"errors":"not enough stock available"}`},
+		{http.MethodPatch, "/albums/3/stock", "{staff}", `{"format":"cassette","delta":-1}`, http.StatusConflict, `{"errors":"not enough stock available"}`},
+
+		// Stock can be embedded in album reads
+		{http.MethodGet, "/albums/3?include=stock", "", "", http.StatusOK, `"stock":{"available":2,"status":"low_stock","formats":[`},
+		{http.MethodGet, "/albums?include=stock&sort=id&limit=1", "", "", http.StatusOK, `"stock":{"available":0,"status":"out_of_stock","formats":[]}`},
+		{http.MethodGet, "/albums/3", "", "", http.StatusOK, `"currency":"USD"}]`},
+
+		// Released copies are available again
+		{http.MethodDelete, "/albums/4/reservations/1", "{customer}", "", http.StatusNotFound, `{"errors":"reservation not found"}`},
+		{http.MethodDelete, "/albums/3/reservations/1", "{other}", "", http.StatusNotFound, `{"errors":"reservation not found"}`},
+		{http.MethodDelete, "/albums/3/reservations/1", "{customer}", "", http.StatusOK, `{"message":"reservation successfully released"}`},
+		{http.MethodDelete, "/albums/3/reservations/1", "{customer}", "", http.StatusNotFound, `{"errors":"reservation not found"}`},
+		{http.MethodGet, "/albums/3/stock", "", "", http.StatusOK, `{"format":"vinyl","on_hand":3,"reserved":0,"available":3,"status":"low_stock"}`},
+
+		// Each customer can only hold so many copies
+		{http.MethodPatch, "/albums/4/stock", "{staff}", `{"format":"cd","delta":200}`, http.StatusOK, `"on_hand":200`},
+		{http.MethodPut, "/albums/4/reservations", "{other}", `{"format":"cd","quantity":100}`, http.StatusOK, `"quantity":100,`},
+		{http.MethodPut, "/albums/4/reservations", "{other}", `{"format":"cd"}`, http.StatusConflict, `{"errors":"customers can hold at most 100 copies at a time"}`},
+		{http.MethodPut, "/albums/4/reservations", "{customer}", `{"format":"cd"}`, http.StatusOK, `"quantity":1,`},
+
+		{http.MethodGet, "/albums/99/stock", "", "", http.StatusNotFound, `{"errors":"album not found"}`},
+		{http.MethodPatch, "/albums/99/stock", "{staff}", `{"format":"cd","delta":1}`, http.StatusNotFound, `{"errors":"album not found"}`},
+		{http.MethodPut, "/albums/99/reservations", "{customer}", `{"format":"cd"}`, http.StatusNotFound, `{"errors":"album not found"}`},
+		{http.MethodGet, "/albums/x/stock", "", "", http.StatusBadRequest, `{"errors":"invalid album id"}`},
+		{http.MethodDelete, "/albums/3/reservations/x", "{customer}", "", http.StatusBadRequest, `{"errors":"invalid reservation id"}`},
+
+		{http.MethodPatch, "/albums/3/stock", "{staff}", `{"format":"digital","delta":0}`, http.StatusUnprocessableEntity, `"fields":{"delta":["must be a non-zero number between -10000 and 10000"],"format":["must be one of vinyl, cd, cassette"]}`},
+		{http.MethodPatch, "/albums/3/stock", "{staff}", `{}`, http.StatusUnprocessableEntity, `"fields":{"delta":["is required"],"format":["is required"]}`},
+		{http.MethodPut, "/albums/3/reservations", "{customer}", `{"format":"cd","quantity":0,"ttl":86401}`, http.StatusUnprocessableEntity, `"fields":{"quantity":["must be between 1 and 100"],"ttl":["must be a number of seconds between 1 and 86400"]}`},
+		{http.MethodPut, "/albums/3/reservations", "{customer}", `{"format":"cd","cart_id":"x"}`, http.StatusUnprocessableEntity, `"fields":{"cart_id":["is not a cart id"]}`},
+		{http.MethodPut, "/albums/3/reservations", "{customer}", `{"format":"cd","count":1}`, http.StatusBadRequest, `unknown field`},
+	}
+
+	for _, tt := range tests {
+		rr := authRequest(router, tt.method, tt.url, tt.body, tokens[tt.as])
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("%v %v returned wrong status code: got %v want %v", tt.method, tt.url, status, tt.expectedCode)
+		}
+
+		if actual := strings.TrimSpace(rr.Body.String()); !strings.Contains(actual, tt.expected) {
+			t.Errorf("%v %v returned unexpected body: got %v want %v", tt.method, tt.url, actual, tt.expected)
+		}
+	}
+}
+
+func TestReservationExpiry_MemoryStore(t *testing.T) {
+	testReservationExpiry(t, NewMemoryStore(queryAlbums...))
+}
+
+func TestReservationExpiry_SQLite(t *testing.T) {
+	testReservationExpiry(t, querySQLiteStore(t))
+}
+
+// testReservationExpiry checks that a reservation stops holding copies once
+// it expires.
+func testReservationExpiry(t *testing.T, store Backend) {
+	t.Helper()
+
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	customerID := reservingCustomer(t, store)
+	if _, err := store.AdjustStock(ctx, 3, "cd", 2, now); err != nil {
+		t.Fatalf("Failed to stock album: %v", err)
+	}
+	reservation, err := store.Reserve(ctx, Reservation{AlbumID: 3, Format: "cd", Quantity: 2, ExpiresAt: now.Add(time.Minute), CustomerID: customerID}, now)
+	if err != nil {
+		t.Fatalf("Failed to reserve: %v", err)
+	}
+
+	if _, err := store.Reserve(ctx, Reservation{AlbumID: 3, Format: "cd", Quantity: 1, ExpiresAt: now.Add(2 * time.Minute), CustomerID: customerID}, now.Add(59*time.Second)); !errors.Is(err, ErrOutOfStock) {
+		t.Errorf("Expected %v before the reservation expires, got %v", ErrOutOfStock, err)
+	}
+
+	later := now.Add(time.Minute)
+	stock, err := store.Stock(ctx, []int64{3}, later)
+	if err != nil {
+		t.Fatalf("Failed to get stock: %v", err)
+	}
+	if expected := []Stock{newStock("cd", 2, 0)}; len(stock[3]) != 1 || stock[3][0] != expected[0] {
+		t.Errorf("Unexpected stock after expiry: got %+v want %+v", stock[3], expected)
+	}
+
+	if err := store.Release(ctx, 3, reservation.ID, customerID, later); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("Expected an expired reservation to be %v, got %v", ErrReservationNotFound, err)
+	}
+	if _, err := store.Reserve(ctx, Reservation{AlbumID: 3, Format: "cd", Quantity: 2, ExpiresAt: later.Add(time.Minute), CustomerID: customerID}, later); err != nil {
+		t.Errorf("Expected the expired copies to be reservable, got %v", err)
+	}
+}
+
+func TestReserveConcurrency_MemoryStore(t *testing.T) {
+	testReserveConcurrency(t, NewMemoryStore(queryAlbums...))
+}
+
+func TestReserveConcurrency_SQLite(t *testing.T) {
+	testReserveConcurrency(t, querySQLiteStore(t))
+}
+
+// testReserveConcurrency races reservations for more copies than are on
+// hand, and checks that exactly the copies on hand were reserved.
+func testReserveConcurrency(t *testing.T, store Backend) {
+	t.Helper()
+
+	const onHand, attempts = 10, 30
+
+	ctx := context.Background()
+	now := time.Now()
+	customerID := reservingCustomer(t, store)
+	if _, err := store.AdjustStock(ctx, 3, "cd", onHand, now); err != nil {
+		t.Fatalf("Failed to stock album: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan error, attempts)
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.Reserve(ctx, Reservation{AlbumID: 3, Format: "cd", Quantity: 1, ExpiresAt: now.Add(time.Hour), CustomerID: customerID}, now)
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	var succeeded int
+	for err := range results {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrOutOfStock):
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if succeeded != onHand {
+		t.Errorf("Expected %v copies to be reserved, got %v", onHand, succeeded)
+	}
+
+	stock, err := store.Stock(ctx, []int64{3}, now)
+	if err != nil {
+		t.Fatalf("Failed to get stock: %v", err)
+	}
+	if expected := newStock("cd", onHand, onHand); len(stock[3]) != 1 || stock[3][0] != expected {
+		t.Errorf("Unexpected stock after the race: got %+v want %+v", stock[3], expected)
+	}
+}
+
+func TestReservationLimitConcurrency_MemoryStore(t *testing.T) {
+	testReservationLimitConcurrency(t, NewMemoryStore(queryAlbums...))
+}
+
+func TestReservationLimitConcurrency_SQLite(t *testing.T) {
+	testReservationLimitConcurrency(t, querySQLiteStore(t))
+}
+
+// testReservationLimitConcurrency races one customer's reservations of two
+// albums for more copies than they can hold, and checks that they hold no
+// more than maxCustomerReserved.
+func testReservationLimitConcurrency(t *testing.T, store Backend) {
+	t.Helper()
+
+	const quantity, attempts = 10, 30
+
+	ctx := context.Background()
+	now := time.Now()
+	customerID := reservingCustomer(t, store)
+	for _, id := range []int64{3, 4} {
+		if _, err := store.AdjustStock(ctx, id, "cd", quantity*attempts, now); err != nil {
+			t.Fatalf("Failed to stock album: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan error, attempts)
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.Reserve(ctx, Reservation{AlbumID: int64(3 + i%2), Format: "cd", Quantity: quantity, ExpiresAt: now.Add(time.Hour), CustomerID: customerID}, now)
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	var succeeded int
+	for err := range results {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrReservationLimit):
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if succeeded != maxCustomerReserved/quantity {
+		t.Errorf("Expected %v reservations to be made, got %v", maxCustomerReserved/quantity, succeeded)
+	}
+}
+
+// TestReserve_MySQLLocks checks that a MySQL reservation locks its customer,
+// then the stock row before its other reads of the album, and counts the
+// reservations with locking reads, so that none come from a snapshot taken
+// before the locks.
+func TestReserve_MySQLLocks(t *testing.T) {
+	db, mock := getMockDB(t)
+	defer db.Close()
+
+	store := &SQLStore{Db: db, Driver: "mysql"}
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT id FROM customer WHERE id = \? FOR UPDATE$`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`^SELECT COALESCE\(SUM\(quantity\), 0\) FROM reservation WHERE customer_id = \? AND expires_at > \? FOR SHARE$`).
+		WithArgs(1, now.UTC()).
+		WillReturnRows(sqlmock.NewRows([]string{"reserved"}).AddRow(0))
+	mock.ExpectQuery(`^SELECT on_hand FROM stock WHERE album_id = \? AND format = \? FOR UPDATE$`).
+		WithArgs(3, "cd").
+		WillReturnRows(sqlmock.NewRows([]string{"on_hand"}).AddRow(5))
+	mock.ExpectQuery(`^SELECT COALESCE\(SUM\(quantity\), 0\) FROM reservation WHERE .+ FOR SHARE$`).
+		WithArgs(3, "cd", now.UTC()).
+		WillReturnRows(sqlmock.NewRows([]string{"reserved"}).AddRow(5))
+	mock.ExpectQuery(`^SELECT id FROM album WHERE id = \? AND deleted_at IS NULL FOR SHARE$`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectRollback()
+
+	if _, err := store.Reserve(context.Background(), Reservation{AlbumID: 3, Format: "cd", Quantity: 1, ExpiresAt: now.Add(time.Hour), CustomerID: 1}, now); !errors.Is(err, ErrOutOfStock) {
+		t.Errorf("Expected %v, got %v", ErrOutOfStock, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %v", err)
+	}
+}
+
+func TestInventoryConcurrency_MemoryStore(t *testing.T) {
+	testInventoryConcurrency(t, NewMemoryStore(queryAlbums...))
+}
+
+func TestInventoryConcurrency_SQLite(t *testing.T) {
+	testInventoryConcurrency(t, querySQLiteStore(t))
+}
+
+// testInventoryConcurrency races reservations and decrements for more copies
+// than are on hand, and checks that exactly the copies on hand were handed out.
+func testInventoryConcurrency(t *testing.T, store Backend) {
+	t.Helper()
+
+	const onHand, attempts = 10, 40
+
+	ctx := context.Background()
+	now := time.Now()
+	customerID := reservingCustomer(t, store)
+	if _, err := store.AdjustStock(ctx, 3, "vinyl", onHand, now); err != nil {
+		t.Fatalf("Failed to stock album: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan error, attempts)
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				_, err = store.Reserve(ctx, Reservation{AlbumID: 3, Format: "vinyl", Quantity: 1, ExpiresAt: now.Add(time.Hour), CustomerID: customerID}, now)
+			} else {
+				_, err = store.AdjustStock(ctx, 3, "vinyl", -1, now)
+			}
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	var succeeded int
+	for err := range results {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrOutOfStock):
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if succeeded != onHand {
+		t.Errorf("Expected %v copies to be handed out, got %v", onHand, succeeded)
+	}
+
+	stock, err := store.Stock(ctx, []int64{3}, now)
+	if err != nil {
+		t.Fatalf("Failed to get stock: %v", err)
+	}
+	if len(stock[3]) != 1 || stock[3][0].OnHand < 0 || stock[3][0].Available != 0 || stock[3][0].OnHand != stock[3][0].Reserved {
+		t.Errorf("Unexpected stock after the race: %+v", stock[3])
+	}
+}
+
+// reservingCustomer creates a customer for store tests to make reservations
+// as, and returns their id.
+func reservingCustomer(t *testing.T, store Backend) int64 {
+	t.Helper()
+
+	customer, err := store.CreateCustomer(context.Background(), Customer{Email: "ella@example.com", PasswordHash: []byte("x"), CreatedAt: time.Now().UTC()})
+	if err != nil {
+		t.Fatalf("Failed to create customer: %v", err)
+	}
+
+	return customer.ID
+}
+
+func TestTakeCopies(t *testing.T) {
+	tests := []struct {
+		need     int
+		counts   []stockCount
+		expected []int
+		ok       bool
+	}{
+		// Held copies come first, whatever their format
+		{1, []stockCount{{onHand: 2}, {onHand: 1, reserved: 1, held: 1}}, []int{0, 1}, true},
+		{3, []stockCount{{onHand: 2}, {onHand: 1, reserved: 1, held: 1}}, []int{2, 1}, true},
+		// Copies held for others are not taken
+		{2, []stockCount{{onHand: 2, reserved: 1}, {onHand: 3, reserved: 2, held: 1}}, []int{1, 1}, true},
+		{4, []stockCount{{onHand: 2, reserved: 1}, {onHand: 3, reserved: 2, held: 1}}, []int{1, 2}, false},
+		{1, []stockCount{{onHand: 1, reserved: 2}, {}}, []int{0, 0}, false},
+	}
+
+	for _, tt := range tests {
+		actual, ok := takeCopies(tt.need, tt.counts)
+		if !slices.Equal(actual, tt.expected) || ok != tt.ok {
+			t.Errorf("takeCopies(%v, %+v) = %v, %v, want %v, %v", tt.need, tt.counts, actual, ok, tt.expected, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,436 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// labelSet holds the labels of one kind in a MemoryStore.
+type labelSet struct {
+	labels map[int64]Label
+	nextID int64
+	// albums holds the ids of the albums each label is on.
+	albums map[int64]map[int64]bool
+}
+
+func newLabelSets() map[LabelKind]*labelSet {
+	sets := map[LabelKind]*labelSet{}
+	for kind := range labelKinds {
+		sets[kind] = &labelSet{labels: map[int64]Label{}, albums: map[int64]map[int64]bool{}}
+	}
+
+	return sets
+}
+
+// byName returns the label named name.
+func (l *labelSet) byName(name string) (Label, bool) {
+	key := nameKey(name)
+	for _, label := range l.labels {
+		if nameKey(label.Name) == key {
+			return label, true
+		}
+	}
+
+	return Label{}, false
+}
+
+func (l *labelSet) create(name string) Label {
+	l.nextID++
+	label := Label{ID: l.nextID, Name: normalizeName(name)}
+	l.labels[label.ID] = label
+	l.albums[label.ID] = map[int64]bool{}
+
+	return label
+}
+
+func compareLabels(a, b Label) int {
+	return cmp.Or(cmp.Compare(nameKey(a.Name), nameKey(b.Name)), cmp.Compare(a.ID, b.ID))
+}
+
+func (s *MemoryStore) Labels(ctx context.Context, kind LabelKind, byCount bool, limit int) ([]LabelCount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	set := s.labels[kind]
+
+	var labels []LabelCount
+	for id, label := range set.labels {
+		count := LabelCount{Label: label}
+		for albumID := range set.albums[id] {
+			// Albums in the trash keep their labels but are not counted
+			if _, ok := s.albums[albumID]; ok {
+				count.Albums++
+			}
+		}
+		labels = append(labels, count)
+	}
+
+	slices.SortFunc(labels, func(a, b LabelCount) int {
+		if byCount && a.Albums != b.Albums {
+			return cmp.Compare(b.Albums, a.Albums)
+		}
+		return compareLabels(a.Label, b.Label)
+	})
+
+	if len(labels) > limit {
+		labels = labels[:limit]
+	}
+
+	return labels, nil
+}
+
+func (s *MemoryStore) CreateLabel(ctx context.Context, kind LabelKind, name string) (Label, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set := s.labels[kind]
+	if _, ok := set.byName(name); ok {
+		return Label{}, ErrLabelExists
+	}
+
+	return set.create(name), nil
+}
+
+func (s *MemoryStore) DeleteLabel(ctx context.Context, kind LabelKind, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set := s.labels[kind]
+	if _, ok := set.labels[id]; !ok {
+		return ErrLabelNotFound
+	}
+
+	delete(set.labels, id)
+	delete(set.albums, id)
+
+	return nil
+}
+
+func (s *MemoryStore) AlbumLabels(ctx context.Context, kind LabelKind, albumIDs []int64) (map[int64][]Label, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	set := s.labels[kind]
+
+	labels := map[int64][]Label{}
+	for _, albumID := range albumIDs {
+		for id, albums := range set.albums {
+			if albums[albumID] {
+				labels[albumID] = append(labels[albumID], set.labels[id])
+			}
+		}
+
+		slices.SortFunc(labels[albumID], compareLabels)
+	}
+
+	return labels, nil
+}
+
+func (s *MemoryStore) AssignLabel(ctx context.Context, kind LabelKind, albumID int64, label Label) (Label, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.albums[albumID]; !ok {
+		return Label{}, ErrAlbumNotFound
+	}
+
+	set := s.labels[kind]
+
+	var ok bool
+	if name := label.Name; label.ID != 0 {
+		label, ok = set.labels[label.ID]
+	} else if label, ok = set.byName(name); !ok && labelKinds[kind].free {
+		label, ok = set.create(name), true
+	}
+	if !ok {
+		return Label{}, ErrLabelNotFound
+	}
+
+	set.albums[label.ID][albumID] = true
+
+	return label, nil
+}
+
+func (s *MemoryStore) UnassignLabel(ctx context.Context, kind LabelKind, albumID, labelID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	albums := s.labels[kind].albums[labelID]
+	if !albums[albumID] {
+		return ErrLabelNotFound
+	}
+
+	delete(albums, albumID)
+
+	return nil
+}
+
+// resolveLabels rewrites the genre and tag filters into filters on the ids of
+// the albums they match, which the in-memory query can evaluate. Callers
+// must hold mu.
+func (s *MemoryStore) resolveLabels(filters []Filter) []Filter {
+	var resolved []Filter
+	for _, filter := range filters {
+		kind := albumFields[filter.Field].label
+		if kind == "" {
+			resolved = append(resolved, filter)
+			continue
+		}
+
+		set := s.labels[kind]
+		labelled := map[int64]bool{}
+		for id, label := range set.labels {
+			if slices.Contains(filter.Values, any(nameKey(label.Name))) {
+				for albumID := range set.albums[id] {
+					labelled[albumID] = true
+				}
+			}
+		}
+
+		ids := Filter{Field: "id", Operator: OpIn}
+		for albumID := range s.albums {
+			if labelled[albumID] != (filter.Operator == OpNeq) {
+				ids.Values = append(ids.Values, albumID)
+			}
+		}
+
+		resolved = append(resolved, ids)
+	}
+
+	return resolved
+}
+
+// unassignAlbum removes an album from every label. Callers must hold mu.
+func (s *MemoryStore) unassignAlbum(albumID int64) {
+	for _, set := range s.labels {
+		for _, albums := range set.albums {
+			delete(albums, albumID)
+		}
+	}
+}
+
+func (s *SQLStore) Labels(ctx context.Context, kind LabelKind, byCount bool, limit int) ([]LabelCount, error) {
+	described := labelKinds[kind]
+
+	order := `l.name_key, l.id`
+	if byCount {
+		order = `COUNT(a.id) DESC, ` + order
+	}
+
+	// Albums in the trash keep their labels but are not counted
+	rows, err := s.Db.QueryContext(ctx, s.rebind(`SELECT l.id, l.name, COUNT(a.id) FROM `+described.table+` l`+
+		` LEFT JOIN `+described.join+` j ON j.`+described.column+` = l.id`+
+		` LEFT JOIN album a ON a.id = j.album_id AND a.deleted_at IS NULL`+
+		` GROUP BY l.id, l.name, l.name_key ORDER BY `+order+` LIMIT ?`), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var labels []LabelCount
+	for rows.Next() {
+		var label LabelCount
+		if err := rows.Scan(&label.ID, &label.Name, &label.Albums); err != nil {
+			return nil, fmt.Errorf("labels %v", err)
+		}
+
+		labels = append(labels, label)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("labels %v", err)
+	}
+
+	return labels, nil
+}
+
+func (s *SQLStore) CreateLabel(ctx context.Context, kind LabelKind, name string) (Label, error) {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return Label{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := s.labelByName(ctx, tx, kind, name); err == nil {
+		return Label{}, ErrLabelExists
+	} else if !errors.Is(err, ErrLabelNotFound) {
+		return Label{}, err
+	}
+
+	label, err := s.insertLabel(ctx, tx, kind, name)
+	if err != nil {
+		return Label{}, err
+	}
+
+	return label, tx.Commit()
+}
+
+func (s *SQLStore) DeleteLabel(ctx context.Context, kind LabelKind, id int64) error {
+	// The join table rows go with the label, through ON DELETE CASCADE
+	result, err := s.Db.ExecContext(ctx, s.rebind(`DELETE FROM `+labelKinds[kind].table+` WHERE id = ?`), id)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrLabelNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLStore) AlbumLabels(ctx context.Context, kind LabelKind, albumIDs []int64) (map[int64][]Label, error) {
+	labels := map[int64][]Label{}
+	if len(albumIDs) == 0 {
+		return labels, nil
+	}
+
+	described := labelKinds[kind]
+
+	args := make([]any, len(albumIDs))
+	for i, id := range albumIDs {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(albumIDs)), ", ")
+
+	rows, err := s.Db.QueryContext(ctx, s.rebind(`SELECT j.album_id, l.id, l.name FROM `+described.join+` j`+
+		` JOIN `+described.table+` l ON l.id = j.`+described.column+
+		` WHERE j.album_id IN (`+placeholders+`) ORDER BY j.album_id, l.name_key, l.id`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var albumID int64
+		var label Label
+		if err := rows.Scan(&albumID, &label.ID, &label.Name); err != nil {
+			return nil, fmt.Errorf("album labels %v", err)
+		}
+
+		labels[albumID] = append(labels[albumID], label)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("album labels %v", err)
+	}
+
+	return labels, nil
+}
+
+func (s *SQLStore) AssignLabel(ctx context.Context, kind LabelKind, albumID int64, label Label) (Label, error) {
+	described := labelKinds[kind]
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return Label{}, err
+	}
+	defer tx.Rollback()
+
+	var albums int
+	if err := tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM album WHERE id = ? AND deleted_at IS NULL`), albumID).Scan(&albums); err != nil {
+		return Label{}, err
+	}
+	if albums == 0 {
+		return Label{}, ErrAlbumNotFound
+	}
+
+	if label.ID != 0 {
+		err = tx.QueryRowContext(ctx, s.rebind(`SELECT id, name FROM `+described.table+` WHERE id = ?`), label.ID).Scan(&label.ID, &label.Name)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrLabelNotFound
+		}
+	} else {
+		name := label.Name
+		label, err = s.labelByName(ctx, tx, kind, name)
+		if errors.Is(err, ErrLabelNotFound) && described.free {
+			label, err = s.insertLabel(ctx, tx, kind, name)
+		}
+	}
+	if err != nil {
+		return Label{}, err
+	}
+
+	var assigned int
+	err = tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM `+described.join+` WHERE album_id = ? AND `+described.column+` = ?`),
+		albumID, label.ID).Scan(&assigned)
+	if err != nil {
+		return Label{}, err
+	}
+
+	if assigned == 0 {
+		_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO `+described.join+` (album_id, `+described.column+`) VALUES (?, ?)`), albumID, label.ID)
+		if err != nil {
+			return Label{}, err
+		}
+	}
+
+	return label, tx.Commit()
+}
+
+func (s *SQLStore) UnassignLabel(ctx context.Context, kind LabelKind, albumID, labelID int64) error {
+	described := labelKinds[kind]
+
+	result, err := s.Db.ExecContext(ctx, s.rebind(`DELETE FROM `+described.join+` WHERE album_id = ? AND `+described.column+` = ?`),
+		albumID, labelID)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrLabelNotFound
+	}
+
+	return nil
+}
+
+// labelByName looks up the label of kind whose name has the same nameKey.
+func (s *SQLStore) labelByName(ctx context.Context, tx *sql.Tx, kind LabelKind, name string) (Label, error) {
+	var label Label
+	err := tx.QueryRowContext(ctx, s.rebind(`SELECT id, name FROM `+labelKinds[kind].table+` WHERE name_key = ?`),
+		nameKey(name)).Scan(&label.ID, &label.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Label{}, ErrLabelNotFound
+	}
+
+	return label, err
+}
+
+func (s *SQLStore) insertLabel(ctx context.Context, tx *sql.Tx, kind LabelKind, name string) (Label, error) {
+	label := Label{Name: normalizeName(name)}
+
+	query := `INSERT INTO ` + labelKinds[kind].table + ` (name, name_key) VALUES (?, ?)`
+	args := []any{label.Name, nameKey(label.Name)}
+
+	if s.postgres() {
+		if err := tx.QueryRowContext(ctx, s.rebind(query+` RETURNING id`), args...).Scan(&label.ID); err != nil {
+			return Label{}, err
+		}
+
+		return label, nil
+	}
+
+	result, err := tx.ExecContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return Label{}, err
+	}
+
+	if label.ID, err = result.LastInsertId(); err != nil {
+		return Label{}, err
+	}
+
+	return label, nil
+}
@@ -0,0 +1,373 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrLabelNotFound is returned by a LabelStore when no label of the kind
+	// matches, or the label is not on the album.
+	ErrLabelNotFound = errors.New("label not found")
+	// ErrLabelExists is returned when another label of the kind already has the name.
+	ErrLabelExists = errors.New("label already exists")
+)
+
+// LabelKind names a way of categorizing albums beyond their artist.
+type LabelKind string
+
+const (
+	// LabelGenre labels come from a curated list and must be created before
+	// albums are assigned to them.
+	LabelGenre LabelKind = "genre"
+	// LabelTag labels are free-form and created the first time an album is tagged.
+	LabelTag LabelKind = "tag"
+)
+
+// labelKind describes the tables behind a kind of label. Only these names
+// ever reach SQL.
+type labelKind struct {
+	// plural is the path segment of the kind, as in /albums/1/genres.
+	plural string
+	table  string
+	// join relates albums to labels through its album_id and column.
+	join      string
+	column    string
+	maxLength int
+	// free kinds create unknown labels when albums are assigned to them.
+	free bool
+}
+
+var labelKinds = map[LabelKind]labelKind{
+	LabelGenre: {plural: "genres", table: "genre", join: "album_genre", column: "genre_id", maxLength: 100},
+	LabelTag:   {plural: "tags", table: "tag", join: "album_tag", column: "tag_id", maxLength: 50, free: true},
+}
+
+// Label is a genre or tag. Names compare like artist names, by nameKey.
+type Label struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// LabelCount is a label with the number of albums assigned to it.
+type LabelCount struct {
+	Label
+	Albums int64 `json:"albums"`
+}
+
+// LabelStore is the persistence layer the genre and tag handlers depend on.
+type LabelStore interface {
+	// Labels lists labels of kind in name order, or most used first when
+	// byCount is set.
+	Labels(ctx context.Context, kind LabelKind, byCount bool, limit int) ([]LabelCount, error)
+	// CreateLabel returns ErrLabelExists when the name is taken.
+	CreateLabel(ctx context.Context, kind LabelKind, name string) (Label, error)
+	// DeleteLabel also unassigns the label from its albums.
+	DeleteLabel(ctx context.Context, kind LabelKind, id int64) error
+	// AlbumLabels returns the labels of kind on each album by album id, in
+	// name order. Albums without labels are left out.
+	AlbumLabels(ctx context.Context, kind LabelKind, albumIDs []int64) (map[int64][]Label, error)
+	// AssignLabel puts the label with label.ID, or else named label.Name, on
+	// an album. Assigning a label twice is not an error.
+	AssignLabel(ctx context.Context, kind LabelKind, albumID int64, label Label) (Label, error)
+	// UnassignLabel returns ErrLabelNotFound when the label is not on the album.
+	UnassignLabel(ctx context.Context, kind LabelKind, albumID, labelID int64) error
+}
+
+// GetLabels lists the genres or tags with their album counts. sort=albums
+// puts the most used first, for tag clouds; the default is by name.
+func (a *Albums) GetLabels(w http.ResponseWriter, r *http.Request) {
+	kind, _, _, ok := labelPath(w, r)
+	if !ok {
+		return
+	}
+
+	parameters := r.URL.Query()
+
+	var byCount bool
+	switch parameters.Get("sort") {
+	case "", "name":
+	case "albums":
+		byCount = true
+	default:
+		ServeJSONError(w, "sort must be 'name' or 'albums'", http.StatusBadRequest)
+		return
+	}
+
+	limit := maxPageLimit
+	if parameters.Has("limit") {
+		var err error
+		if limit, err = parseLimit(parameters.Get("limit")); err != nil {
+			ServeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	labels, err := a.Labels.Labels(r.Context(), kind, byCount, limit)
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("GetLabels %v", err), http.StatusInternalServerError)
+		return
+	}
+	if labels == nil {
+		labels = []LabelCount{}
+	}
+
+	ServeJSON(w, map[string]any{"data": labels}, http.StatusOK)
+}
+
+func (a *Albums) AddLabel(w http.ResponseWriter, r *http.Request) {
+	kind, _, _, ok := labelPath(w, r)
+	if !ok {
+		return
+	}
+
+	input, ok := labelInput(w, r)
+	if !ok {
+		return
+	}
+
+	var errs ValidationErrors
+	validateText(&errs, "name", input.Name, labelKinds[kind].maxLength, true)
+	if input.ID != nil {
+		errs.Add("id", "must not be passed when creating a "+string(kind))
+	}
+	if len(errs) > 0 {
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	label, err := a.Labels.CreateLabel(r.Context(), kind, *input.Name)
+	if errors.Is(err, ErrLabelExists) {
+		ServeJSONError(w, fmt.Sprintf("a %v with this name already exists", kind), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("AddLabel %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	ServeJSON(w, label, http.StatusOK)
+}
+
+func (a *Albums) DeleteLabel(w http.ResponseWriter, r *http.Request) {
+	kind, _, id, ok := labelPath(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.Labels.DeleteLabel(r.Context(), kind, id)
+	if errors.Is(err, ErrLabelNotFound) {
+		ServeJSONError(w, fmt.Sprintf("%v not found", kind), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("could not delete %v", kind), http.StatusInternalServerError)
+		return
+	}
+
+	ServeJSON(w, map[string]any{"message": fmt.Sprintf("%v successfully removed", kind)}, http.StatusOK)
+}
+
+// GetAlbumLabels lists the genres or tags of an album.
+func (a *Albums) GetAlbumLabels(w http.ResponseWriter, r *http.Request) {
+	kind, albumID, _, ok := labelPath(w, r)
+	if !ok {
+		return
+	}
+
+	a.serveAlbumLabels(w, r, kind, albumID, "GetAlbumLabels")
+}
+
+// AssignLabel puts a genre or tag on an album, chosen by {"id":1} or by
+// {"name":"Jazz"}, and serves the album's labels of that kind. Tags are
+// created as they are named; genres must already exist.
+func (a *Albums) AssignLabel(w http.ResponseWriter, r *http.Request) {
+	kind, albumID, _, ok := labelPath(w, r)
+	if !ok {
+		return
+	}
+
+	input, ok := labelInput(w, r)
+	if !ok {
+		return
+	}
+
+	var errs ValidationErrors
+	switch {
+	case input.ID != nil && input.Name != nil:
+		errs.Add("id", "must not be passed with 'name'")
+	case input.ID == nil:
+		validateText(&errs, "name", input.Name, labelKinds[kind].maxLength, true)
+	}
+	if len(errs) > 0 {
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	var label Label
+	if input.ID != nil {
+		label.ID = *input.ID
+	} else {
+		label.Name = *input.Name
+	}
+
+	_, err := a.Labels.AssignLabel(r.Context(), kind, albumID, label)
+	switch {
+	case errors.Is(err, ErrAlbumNotFound):
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrLabelNotFound):
+		field := "name"
+		if input.ID != nil {
+			field = "id"
+		}
+		errs.Add(field, "does not match a "+string(kind))
+		ServeValidationErrors(w, errs)
+		return
+	case err != nil:
+		ServeJSONError(w, fmt.Sprintf("AssignLabel %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	a.serveAlbumLabels(w, r, kind, albumID, "AssignLabel")
+}
+
+func (a *Albums) UnassignLabel(w http.ResponseWriter, r *http.Request) {
+	kind, albumID, labelID, ok := labelPath(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.Labels.UnassignLabel(r.Context(), kind, albumID, labelID)
+	if errors.Is(err, ErrLabelNotFound) {
+		ServeJSONError(w, fmt.Sprintf("%v not found on this album", kind), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("could not unassign %v", kind), http.StatusInternalServerError)
+		return
+	}
+
+	ServeJSON(w, map[string]any{"message": fmt.Sprintf("%v successfully unassigned", kind)}, http.StatusOK)
+}
+
+// serveAlbumLabels serves the labels of kind on the album with albumID, or a
+// 404 when there is no such album.
+func (a *Albums) serveAlbumLabels(w http.ResponseWriter, r *http.Request, kind LabelKind, albumID int64, handler string) {
+	if _, err := a.Store.Get(r.Context(), albumID); errors.Is(err, ErrAlbumNotFound) {
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+		return
+	}
+
+	labels, err := a.Labels.AlbumLabels(r.Context(), kind, []int64{albumID})
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+		return
+	}
+
+	list := labels[albumID]
+	if list == nil {
+		list = []Label{}
+	}
+
+	ServeJSON(w, map[string]any{"data": list}, http.StatusOK)
+}
+
+// embedLabels sets the genres or tags of each album.
+func (a *Albums) embedLabels(ctx context.Context, kind LabelKind, albums []Album) error {
+	ids := make([]int64, len(albums))
+	for i, album := range albums {
+		ids[i] = album.ID
+	}
+
+	labels, err := a.Labels.AlbumLabels(ctx, kind, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range albums {
+		embedded := labels[albums[i].ID]
+		if embedded == nil {
+			embedded = []Label{}
+		}
+
+		if kind == LabelGenre {
+			albums[i].Genres = embedded
+		} else {
+			albums[i].Tags = embedded
+		}
+	}
+
+	return nil
+}
+
+// labelRequest holds the label fields sent when creating or assigning a label.
+type labelRequest struct {
+	ID   *int64  `json:"id"`
+	Name *string `json:"name"`
+}
+
+// labelInput reads the JSON body of a label request. It writes an error
+// response and returns false when the body cannot be read.
+func labelInput(w http.ResponseWriter, r *http.Request) (labelRequest, bool) {
+	var input labelRequest
+
+	if !isJSON(r) {
+		ServeJSONError(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return input, false
+	}
+
+	if err := decodeJSON(w, r, &input); err != nil {
+		ServeJSONError(w, err.Error(), http.StatusBadRequest)
+		return input, false
+	}
+
+	return input, true
+}
+
+// labelPath parses the kind and ids of a /genres, /genres/{id},
+// /albums/{id}/genres or /albums/{id}/genres/{genre} path, or the same with
+// tags. It writes a 400 response and returns false when an id is not a number.
+func labelPath(w http.ResponseWriter, r *http.Request) (LabelKind, int64, int64, bool) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	var albumID int64
+	if segments[0] == "albums" && len(segments) > 2 {
+		var err error
+		if albumID, err = strconv.ParseInt(segments[1], 10, 64); err != nil {
+			ServeJSONError(w, "invalid album id", http.StatusBadRequest)
+			return "", 0, 0, false
+		}
+
+		segments = segments[2:]
+	}
+
+	var kind LabelKind
+	for k, described := range labelKinds {
+		if described.plural == segments[0] {
+			kind = k
+		}
+	}
+	if kind == "" {
+		ServeJSONError(w, "unknown label kind", http.StatusNotFound)
+		return "", 0, 0, false
+	}
+
+	var labelID int64
+	if len(segments) > 1 {
+		var err error
+		if labelID, err = strconv.ParseInt(segments[1], 10, 64); err != nil || len(segments) > 2 {
+			ServeJSONError(w, fmt.Sprintf("invalid %v id", kind), http.StatusBadRequest)
+			return "", 0, 0, false
+		}
+	}
+
+	return kind, albumID, labelID, true
+}
@@ -0,0 +1,299 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLabels_MemoryStore(t *testing.T) {
+	testLabels(t, NewAlbums(NewMemoryStore(queryAlbums...)))
+}
+
+func TestLabels_SQLite(t *testing.T) {
+	testLabels(t, NewAlbums(querySQLiteStore(t)))
+}
+
+// testLabels runs through the genre and tag endpoints and filters against
+// albums holding queryAlbums.
+func testLabels(t *testing.T, albums *Albums) {
+	t.Helper()
+
+	router := SetupRouter(albums)
+
+	tests := []struct {
+		method       string
+		url          string
+		body         string
+		expectedCode int
+		expected     string
+	}{
+		{http.MethodGet, "/genres", "", http.StatusOK, `{"data":[]}`},
+
+		// Genres are created before albums are assigned to them
+		{http.MethodPut, "/genres", `{"name":" Cool  Jazz "}`, http.StatusOK, `{"id":1,"name":"Cool Jazz"}`},
+		{http.MethodPut, "/genres", `{"name":"Hard Bop"}`, http.StatusOK, `{"id":2,"name":"Hard Bop"}`},
+		{http.MethodPut, "/genres", `{"name":"cool jazz"}`, http.StatusConflict, `{"errors":"a genre with this name already exists"}`},
+		{http.MethodPut, "/genres", `{}`, http.StatusUnprocessableEntity, `{"errors":["'name' is required"],"fields":{"name":["is required"]}}`},
+		{http.MethodPut, "/albums/1/genres", `{"name":"hard bop"}`, http.StatusOK, `{"data":[{"id":2,"name":"Hard Bop"}]}`},
+		{http.MethodPut, "/albums/1/genres", `{"id":2}`, http.StatusOK, `{"data":[{"id":2,"name":"Hard Bop"}]}`},
+		{http.MethodPut, "/albums/2/genres", `{"id":2}`, http.StatusOK, `{"data":[{"id":2,"name":"Hard Bop"}]}`},
+		{http.MethodPut, "/albums/3/genres", `{"id":1}`, http.StatusOK, `{"data":[{"id":1,"name":"Cool Jazz"}]}`},
+		{http.MethodPut, "/albums/3/genres", `{"name":"Free Jazz"}`, http.StatusUnprocessableEntity, `{"errors":["'name' does not match a genre"],"fields":{"name":["does not match a genre"]}}`},
+		{http.MethodPut, "/albums/3/genres", `{"id":99}`, http.StatusUnprocessableEntity, `{"errors":["'id' does not match a genre"],"fields":{"id":["does not match a genre"]}}`},
+		{http.MethodPut, "/albums/3/genres", `{"id":1,"name":"Cool Jazz"}`, http.StatusUnprocessableEntity, `{"errors":["'id' must not be passed with 'name'"]`},
+		{http.MethodPut, "/albums/99/genres", `{"id":1}`, http.StatusNotFound, `{"errors":"album not found"}`},
+		{http.MethodGet, "/albums/abc/genres", "", http.StatusBadRequest, `{"errors":"invalid album id"}`},
+
+		// Tags are created the first time they are named
+		{http.MethodPut, "/albums/1/tags", `{"name":"Saxophone"}`, http.StatusOK, `{"data":[{"id":1,"name":"Saxophone"}]}`},
+		{http.MethodPut, "/albums/2/tags", `{"name":"saxophone"}`, http.StatusOK, `{"data":[{"id":1,"name":"Saxophone"}]}`},
+		{http.MethodPut, "/albums/3/tags", `{"name":"SAXOPHONE"}`, http.StatusOK, `{"data":[{"id":1,"name":"Saxophone"}]}`},
+		{http.MethodPut, "/albums/3/tags", `{"name":"Live"}`, http.StatusOK, `{"data":[{"id":2,"name":"Live"},{"id":1,"name":"Saxophone"}]}`},
+		{http.MethodPut, "/albums/4/tags", `{"name":"live"}`, http.StatusOK, `{"data":[{"id":2,"name":"Live"}]}`},
+		{http.MethodGet, "/albums/5/tags", "", http.StatusOK, `{"data":[]}`},
+
+		// Tag counts, most used first for a tag cloud
+		{http.MethodGet, "/tags?sort=albums", "", http.StatusOK, `{"data":[{"id":1,"name":"Saxophone","albums":3},{"id":2,"name":"Live","albums":2}]}`},
+		{http.MethodGet, "/tags?sort=albums&limit=1", "", http.StatusOK, `{"data":[{"id":1,"name":"Saxophone","albums":3}]}`},
+		{http.MethodGet, "/tags", "", http.StatusOK, `{"data":[{"id":2,"name":"Live","albums":2},{"id":1,"name":"Saxophone","albums":3}]}`},
+		{http.MethodGet, "/genres", "", http.StatusOK, `{"data":[{"id":1,"name":"Cool Jazz","albums":1},{"id":2,"name":"Hard Bop","albums":2}]}`},
+		{http.MethodGet, "/tags?sort=price", "", http.StatusBadRequest, `{"errors":"sort must be 'name' or 'albums'"}`},
+
+		// Albums embed their labels when asked to
+		{http.MethodGet, "/albums/3?include=genres,tags", "", http.StatusOK, `[{"id":3,"title":"Jeru","artist":"Gerry Mulligan","artist_id":2,"price":"17.99","review_count":0,"average_rating":null,"currency":"USD","genres":[{"id":1,"name":"Cool Jazz"}],"tags":[{"id":2,"name":"Live"},{"id":1,"name":"Saxophone"}]}]`},
+		{http.MethodGet, "/albums?artist=Post+Malone&include=tags", "", http.StatusOK, `"currency":"USD","tags":[]}]`},
+
+		// Unassigning and deleting labels
+		{http.MethodDelete, "/albums/3/tags/1", "", http.StatusOK, `{"message":"tag successfully unassigned"}`},
+		{http.MethodDelete, "/albums/3/tags/1", "", http.StatusNotFound, `{"errors":"tag not found on this album"}`},
+		{http.MethodDelete, "/genres/2", "", http.StatusOK, `{"message":"genre successfully removed"}`},
+		{http.MethodDelete, "/genres/2", "", http.StatusNotFound, `{"errors":"genre not found"}`},
+		{http.MethodDelete, "/genres/abc", "", http.StatusBadRequest, `{"errors":"invalid genre id"}`},
+		{http.MethodGet, "/albums/1/genres", "", http.StatusOK, `{"data":[]}`},
+
+		// Deleting an album unassigns its labels
+		{http.MethodDelete, "/albums/4", "", http.StatusOK, `{"message":"album successfully removed"}`},
+		{http.MethodGet, "/tags?sort=albums", "", http.StatusOK, `{"data":[{"id":1,"name":"Saxophone","albums":2},{"id":2,"name":"Live","albums":1}]}`},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if tt.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("%v %v returned wrong status code: got %v want %v", tt.method, tt.url, status, tt.expectedCode)
+		}
+
+		if actual := strings.TrimSpace(rr.Body.String()); !strings.Contains(actual, tt.expected) {
+			t.Errorf("%v %v returned unexpected body: got %v want %v", tt.method, tt.url, actual, tt.expected)
+		}
+	}
+}
+
+func TestLabelFilters_MemoryStore(t *testing.T) {
+	testLabelFilters(t, NewAlbums(NewMemoryStore(queryAlbums...)))
+}
+
+func TestLabelFilters_SQLite(t *testing.T) {
+	testLabelFilters(t, NewAlbums(querySQLiteStore(t)))
+}
+
+func testLabelFilters(t *testing.T, albums *Albums) {
+	t.Helper()
+
+	router := SetupRouter(albums)
+	for _, assign := range []struct{ url, body string }{
+		{"/genres", `{"name":"Cool Jazz"}`},
+		{"/genres", `{"name":"Hard Bop"}`},
+		{"/albums/1/genres", `{"name":"Hard Bop"}`},
+		{"/albums/2/genres", `{"name":"Hard Bop"}`},
+		{"/albums/3/genres", `{"name":"Cool Jazz"}`},
+		{"/albums/1/tags", `{"name":"Saxophone"}`},
+		{"/albums/2/tags", `{"name":"Saxophone"}`},
+		{"/albums/3/tags", `{"name":"Saxophone"}`},
+		{"/albums/3/tags", `{"name":"Live"}`},
+		{"/albums/4/tags", `{"name":"Live"}`},
+	} {
+		req, _ := http.NewRequest(http.MethodPut, assign.url, strings.NewReader(assign.body))
+		req.Header.Set("Content-Type", "application/json")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("PUT %v returned %v: %v", assign.url, rr.Code, rr.Body.String())
+		}
+	}
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"/albums?tag=saxophone", "1,2,3"},
+		// Repeated filters must all match; in matches any of its values
+		{"/albums?tag=saxophone&tag=live", "3"},
+		{"/albums?tag[in]=live,saxophone", "1,2,3,4"},
+		{"/albums?genre=Hard+Bop", "1,2"},
+		{"/albums?genre=hard+bop&tag=live", ""},
+		{"/albums?tag[neq]=saxophone", "4,5,6,7"},
+		{"/albums?genre[in]=cool+jazz,hard+bop&tag[neq]=live&sort=-price", "2,1"},
+		{"/albums?tag=unknown", ""},
+	}
+
+	for _, tt := range tests {
+		if actual := listAlbumIDs(t, albums, tt.url); actual != tt.expected {
+			t.Errorf("%v returned unexpected albums: got %v want %v", tt.url, actual, tt.expected)
+		}
+	}
+
+	if listing := listAlbums(t, albums, "/albums?tag[in]=live,saxophone&total=true&limit=1"); listing.Total == nil || *listing.Total != 4 {
+		t.Errorf("Unexpected total: got %v want 4", listing.Total)
+	}
+
+	rr := sendMockHTTPRequest(t, albums.GetAlbums, http.MethodGet, "/albums?tag=saxophone&facets=artist")
+	expected := `"facets":{"artist":[{"value":"John Coltrane","count":2},{"value":"Gerry Mulligan","count":1}]}`
+	if actual := rr.Body.String(); !strings.Contains(actual, expected) {
+		t.Errorf("Unexpected facets: got %v want %v", actual, expected)
+	}
+}
+
+func TestLabelFilters_Errors(t *testing.T) {
+	albums := NewAlbums(NewMemoryStore())
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"/albums?tag[lt]=live", `{"errors":"'tag' does not support lt"}`},
+		{"/albums?genre[contains]=jazz", `{"errors":"'genre' does not support contains"}`},
+		{"/albums?sort=tag", `{"errors":"cannot sort by 'tag'"}`},
+		{"/albums?include=labels", `{"errors":"unknown include 'labels'"}`},
+	}
+
+	for _, tt := range tests {
+		rr := sendMockHTTPRequest(t, albums.GetAlbums, http.MethodGet, tt.url)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("%v returned wrong status code: got %v want %v", tt.url, status, http.StatusBadRequest)
+		}
+
+		if actual := strings.TrimSpace(rr.Body.String()); actual != tt.expected {
+			t.Errorf("%v returned unexpected body: got %v want %v", tt.url, actual, tt.expected)
+		}
+	}
+}
+
+func TestSQLStore_LabelFilters(t *testing.T) {
+	store := &SQLStore{Driver: "postgres"}
+
+	conditions, args := store.where([]Filter{
+		{Field: "genre", Operator: OpEq, Values: []any{"jazz"}},
+		{Field: "tag", Operator: OpIn, Values: []any{"live", "mono"}},
+		{Field: "tag", Operator: OpNeq, Values: []any{"bootleg"}},
+	})
+
+	expected := []string{
+		"deleted_at IS NULL",
+		"EXISTS (SELECT 1 FROM album_genre j JOIN genre l ON l.id = j.genre_id WHERE j.album_id = album.id AND l.name_key IN (?))",
+		"EXISTS (SELECT 1 FROM album_tag j JOIN tag l ON l.id = j.tag_id WHERE j.album_id = album.id AND l.name_key IN (?, ?))",
+		"NOT EXISTS (SELECT 1 FROM album_tag j JOIN tag l ON l.id = j.tag_id WHERE j.album_id = album.id AND l.name_key IN (?))",
+	}
+	if !reflect.DeepEqual(conditions, expected) {
+		t.Errorf("Unexpected conditions: got %v want %v", conditions, expected)
+	}
+
+	if expectedArgs := []any{"jazz", "live", "mono", "bootleg"}; !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("Unexpected arguments: got %v want %v", args, expectedArgs)
+	}
+}
+
+// TestLabelStore_SQLite assigns genres and tags straight through the SQLite
+// store, and checks the albums its label filters match and the albums it
+// counts for each label.
+func TestLabelStore_SQLite(t *testing.T) {
+	ctx := context.Background()
+	store := querySQLiteStore(t)
+
+	for _, name := range []string{"Cool Jazz", "Hard Bop"} {
+		if _, err := store.CreateLabel(ctx, LabelGenre, name); err != nil {
+			t.Fatalf("Failed to create genre: %v", err)
+		}
+	}
+	for _, assign := range []struct {
+		kind    LabelKind
+		albumID int64
+		name    string
+	}{
+		{LabelGenre, 1, "Hard Bop"},
+		{LabelGenre, 2, "hard  bop"},
+		{LabelGenre, 3, "Cool Jazz"},
+		{LabelTag, 1, "Saxophone"},
+		{LabelTag, 2, "Saxophone"},
+		{LabelTag, 3, "SAXOPHONE"},
+		{LabelTag, 3, "Live"},
+		{LabelTag, 4, "Live"},
+		{LabelTag, 6, "Live"},
+		{LabelTag, 6, "Live"},
+	} {
+		if _, err := store.AssignLabel(ctx, assign.kind, assign.albumID, Label{Name: assign.name}); err != nil {
+			t.Fatalf("Failed to assign %v %q to album %v: %v", assign.kind, assign.name, assign.albumID, err)
+		}
+	}
+
+	// Albums in the trash are neither matched nor counted
+	if err := store.Trash(ctx, 4, 0, time.Now()); err != nil {
+		t.Fatalf("Failed to trash album: %v", err)
+	}
+
+	tests := []struct {
+		filters  []Filter
+		expected []int64
+	}{
+		{[]Filter{{Field: "tag", Operator: OpEq, Values: []any{"saxophone"}}}, []int64{1, 2, 3}},
+		// Every filter must match, while in matches any of its values
+		{[]Filter{{Field: "tag", Operator: OpEq, Values: []any{"saxophone"}}, {Field: "tag", Operator: OpEq, Values: []any{"live"}}}, []int64{3}},
+		{[]Filter{{Field: "tag", Operator: OpIn, Values: []any{"live", "saxophone"}}}, []int64{1, 2, 3, 6}},
+		{[]Filter{{Field: "genre", Operator: OpEq, Values: []any{"hard bop"}}, {Field: "tag", Operator: OpEq, Values: []any{"live"}}}, nil},
+		{[]Filter{{Field: "genre", Operator: OpIn, Values: []any{"cool jazz", "hard bop"}}, {Field: "tag", Operator: OpNeq, Values: []any{"live"}}}, []int64{1, 2}},
+		{[]Filter{{Field: "tag", Operator: OpNeq, Values: []any{"saxophone"}}}, []int64{5, 6, 7}},
+	}
+
+	for _, tt := range tests {
+		albums, err := store.List(ctx, AlbumQuery{Filters: tt.filters, Page: Page{Limit: 10}})
+		if err != nil {
+			t.Fatalf("Failed to list albums matching %+v: %v", tt.filters, err)
+		}
+		var ids []int64
+		for _, album := range albums {
+			ids = append(ids, album.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.expected) {
+			t.Errorf("Albums matching %+v: got %v want %v", tt.filters, ids, tt.expected)
+		}
+
+		if count, err := store.Count(ctx, tt.filters); err != nil || count != int64(len(tt.expected)) {
+			t.Errorf("Count of albums matching %+v: got %v, %v want %v", tt.filters, count, err, len(tt.expected))
+		}
+	}
+
+	labels, err := store.Labels(ctx, LabelTag, true, 10)
+	if err != nil {
+		t.Fatalf("Failed to list tags: %v", err)
+	}
+	expected := []LabelCount{{Label{ID: 1, Name: "Saxophone"}, 3}, {Label{ID: 2, Name: "Live"}, 2}}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("Unexpected tag counts: got %v want %v", labels, expected)
+	}
+}
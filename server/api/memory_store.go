@@ -0,0 +1,546 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Backend that keeps albums in process memory. It is
+// safe for concurrent use and is mainly intended for tests and local development.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	albums map[int64]Album
+	nextID int64
+	// trash holds the albums moved out of albums by Trash
+	trash map[int64]Album
+
+	artists      map[int64]Artist
+	nextArtistID int64
+
+	tracks      map[int64]Track
+	nextTrackID int64
+
+	labels map[LabelKind]*labelSet
+
+	covers map[int64]Cover
+
+	stock             map[stockKey]int
+	reservations      map[int64]Reservation
+	nextReservationID int64
+
+	carts       map[string]Cart
+	orders      map[int64]Order
+	nextOrderID int64
+	// orderStock holds the copies each order took off the stock, by order id
+	orderStock map[int64]map[stockKey]int
+
+	customers      map[int64]Customer
+	nextCustomerID int64
+	sessions       map[string]Session
+
+	wishlists          map[int64]Wishlist
+	nextWishlistID     int64
+	nextWishlistItemID int64
+
+	reviews      map[int64]Review
+	nextReviewID int64
+
+	// audit holds the audit log in id order, ids counting from 1
+	audit []AuditEntry
+}
+
+// NewMemoryStore returns a MemoryStore seeded with the given albums. Seed
+// albums without an id are assigned one, and their artists are created the
+// way Create would.
+func NewMemoryStore(albums ...Album) *MemoryStore {
+	s := &MemoryStore{albums: map[int64]Album{}, trash: map[int64]Album{}, artists: map[int64]Artist{}, tracks: map[int64]Track{}, labels: newLabelSets(),
+		covers: map[int64]Cover{}, stock: map[stockKey]int{}, reservations: map[int64]Reservation{},
+		carts: map[string]Cart{}, orders: map[int64]Order{}, orderStock: map[int64]map[stockKey]int{}, customers: map[int64]Customer{}, sessions: map[string]Session{},
+		wishlists: map[int64]Wishlist{}, reviews: map[int64]Review{}}
+
+	for _, album := range albums {
+		if album.ID == 0 {
+			s.nextID++
+			album.ID = s.nextID
+		} else if album.ID > s.nextID {
+			s.nextID = album.ID
+		}
+
+		artist, _ := s.albumArtist(0, album.Artist)
+		album.ArtistID, album.Artist, album.Version = artist.ID, artist.Name, 1
+
+		s.albums[album.ID] = album
+	}
+
+	return s
+}
+
+func (s *MemoryStore) List(ctx context.Context, query AlbumQuery) ([]Album, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query.Filters = s.resolveLabels(query.Filters)
+
+	return query.apply(s.sorted(func(Album) bool { return true })), nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id int64) (Album, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	album, ok := s.albums[id]
+	if !ok {
+		return Album{}, ErrAlbumNotFound
+	}
+
+	return album, nil
+}
+
+func (s *MemoryStore) Create(ctx context.Context, album Album) (Album, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.barcodeTaken(album.Barcode, 0) {
+		return Album{}, ErrBarcodeExists
+	}
+
+	artist, err := s.albumArtist(album.ArtistID, album.Artist)
+	if err != nil {
+		return Album{}, err
+	}
+	album.ArtistID, album.Artist, album.Version = artist.ID, artist.Name, 1
+
+	album.ID = s.nextID + 1
+	if err := s.record(ctx, album.ID, AuditCreate, nil, &album, time.Now()); err != nil {
+		return Album{}, err
+	}
+	s.nextID++
+	s.albums[album.ID] = album
+
+	return album, nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, id int64, update AlbumUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, ok := s.albums[id]
+	if !ok {
+		return ErrAlbumNotFound
+	}
+	if update.Version != 0 && before.Version != update.Version {
+		return ErrVersionMismatch
+	}
+
+	if update.Barcode != nil && s.barcodeTaken(*update.Barcode, id) {
+		return ErrBarcodeExists
+	}
+
+	album := before
+	if update.Artist != nil || update.ArtistID != nil {
+		var id int64
+		var name string
+		if update.ArtistID != nil {
+			id = *update.ArtistID
+		} else {
+			name = *update.Artist
+		}
+
+		artist, err := s.albumArtist(id, name)
+		if err != nil {
+			return err
+		}
+		album.ArtistID, album.Artist = artist.ID, artist.Name
+	}
+	update.apply(&album)
+	album.Version++
+
+	if err := s.record(ctx, id, AuditUpdate, &before, &album, time.Now()); err != nil {
+		return err
+	}
+	s.albums[id] = album
+
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	album, live := s.albums[id]
+	if !live {
+		var trashed bool
+		if album, trashed = s.trash[id]; !trashed {
+			return ErrAlbumNotFound
+		}
+	}
+
+	return s.deleteAlbum(ctx, album)
+}
+
+func (s *MemoryStore) Purge(ctx context.Context, id int64, cutoff time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	album, trashed := s.trash[id]
+	if !trashed || album.DeletedAt.After(cutoff) {
+		return ErrAlbumNotFound
+	}
+
+	return s.deleteAlbum(ctx, album)
+}
+
+// deleteAlbum deletes the album and everything that belongs to it, and logs
+// the purge. Callers must hold s.mu.
+func (s *MemoryStore) deleteAlbum(ctx context.Context, album Album) error {
+	id := album.ID
+	if err := s.record(ctx, id, AuditPurge, &album, nil, time.Now()); err != nil {
+		return err
+	}
+
+	delete(s.albums, id)
+	delete(s.trash, id)
+	for trackID, track := range s.tracks {
+		if track.AlbumID == id {
+			delete(s.tracks, trackID)
+		}
+	}
+	s.unassignAlbum(id)
+	delete(s.covers, id)
+	s.removeInventory(id)
+	s.unlinkSales(id)
+	for reviewID, review := range s.reviews {
+		if review.AlbumID == id {
+			delete(s.reviews, reviewID)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Count(ctx context.Context, filters []Filter) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := AlbumQuery{Filters: s.resolveLabels(filters)}
+
+	return int64(len(s.sorted(query.match))), nil
+}
+
+// barcodeTaken reports whether an album other than the one with id, in the
+// trash or not, has the barcode. Callers must hold s.mu.
+func (s *MemoryStore) barcodeTaken(barcode Barcode, id int64) bool {
+	if barcode == "" {
+		return false
+	}
+
+	for _, albums := range []map[int64]Album{s.albums, s.trash} {
+		for _, album := range albums {
+			if album.Barcode == barcode && album.ID != id {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// sorted returns the albums accepted by keep, ordered by id. Callers must hold s.mu.
+func (s *MemoryStore) sorted(keep func(Album) bool) []Album {
+	var albums []Album
+	for _, album := range s.albums {
+		if keep(album) {
+			albums = append(albums, album)
+		}
+	}
+
+	sort.Slice(albums, func(i, j int) bool { return albums[i].ID < albums[j].ID })
+
+	return albums
+}
+
+func (s *MemoryStore) ListArtists(ctx context.Context, query ArtistQuery) ([]Artist, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	compare := func(a, b Artist) int {
+		return cmp.Or(cmp.Compare(nameKey(a.Name), nameKey(b.Name)), cmp.Compare(a.ID, b.ID))
+	}
+
+	var artists []Artist
+	for _, artist := range s.artists {
+		if query.After == nil || compare(artist, *query.After) > 0 {
+			artists = append(artists, artist)
+		}
+	}
+
+	slices.SortFunc(artists, compare)
+
+	if query.Limit > 0 && len(artists) > query.Limit {
+		artists = artists[:query.Limit]
+	}
+
+	return artists, nil
+}
+
+func (s *MemoryStore) GetArtist(ctx context.Context, id int64) (Artist, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	artist, ok := s.artists[id]
+	if !ok {
+		return Artist{}, ErrArtistNotFound
+	}
+
+	return artist, nil
+}
+
+func (s *MemoryStore) CreateArtist(ctx context.Context, artist Artist) (Artist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createArtist(artist)
+}
+
+func (s *MemoryStore) UpdateArtist(ctx context.Context, id int64, update ArtistUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	artist, ok := s.artists[id]
+	if !ok {
+		return ErrArtistNotFound
+	}
+
+	if update.Name != nil {
+		name := normalizeName(*update.Name)
+		if existing, ok := s.artistByName(name); ok && existing.ID != id {
+			return ErrArtistExists
+		}
+
+		artist.Name = name
+		if err := s.renameAlbums(ctx, id, name, time.Now()); err != nil {
+			return err
+		}
+	}
+	if update.Bio != nil {
+		artist.Bio = *update.Bio
+	}
+
+	s.artists[id] = artist
+
+	return nil
+}
+
+// renameAlbums gives the albums of the artist with id its new name, and logs
+// the update of each album it changes. Callers must hold s.mu.
+func (s *MemoryStore) renameAlbums(ctx context.Context, id int64, name string, now time.Time) error {
+	var renamed []Album
+	for _, albums := range []map[int64]Album{s.albums, s.trash} {
+		for _, album := range albums {
+			if album.ArtistID == id && album.Artist != name {
+				renamed = append(renamed, album)
+			}
+		}
+	}
+	slices.SortFunc(renamed, func(a, b Album) int { return cmp.Compare(a.ID, b.ID) })
+
+	for i, before := range renamed {
+		renamed[i].Artist = name
+		renamed[i].Version++
+		if err := s.record(ctx, before.ID, AuditUpdate, &before, &renamed[i], now); err != nil {
+			return err
+		}
+	}
+
+	for _, album := range renamed {
+		if _, ok := s.albums[album.ID]; ok {
+			s.albums[album.ID] = album
+		} else {
+			s.trash[album.ID] = album
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteArtist(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.artists[id]; !ok {
+		return ErrArtistNotFound
+	}
+
+	for _, albums := range []map[int64]Album{s.albums, s.trash} {
+		for _, album := range albums {
+			if album.ArtistID == id {
+				return ErrArtistHasAlbums
+			}
+		}
+	}
+
+	delete(s.artists, id)
+
+	return nil
+}
+
+// createArtist stores a new artist. Callers must hold s.mu.
+func (s *MemoryStore) createArtist(artist Artist) (Artist, error) {
+	artist.Name = normalizeName(artist.Name)
+	if _, ok := s.artistByName(artist.Name); ok {
+		return Artist{}, ErrArtistExists
+	}
+
+	s.nextArtistID++
+	artist.ID = s.nextArtistID
+	s.artists[artist.ID] = artist
+
+	return artist, nil
+}
+
+// artistByName finds the artist whose name matches name ignoring case and
+// spacing. Callers must hold s.mu.
+func (s *MemoryStore) artistByName(name string) (Artist, bool) {
+	key := nameKey(name)
+	for _, artist := range s.artists {
+		if nameKey(artist.Name) == key {
+			return artist, true
+		}
+	}
+
+	return Artist{}, false
+}
+
+// albumArtist returns the artist with id, or when id is zero the artist
+// called name, creating it if needed. Callers must hold s.mu.
+func (s *MemoryStore) albumArtist(id int64, name string) (Artist, error) {
+	if id != 0 {
+		artist, ok := s.artists[id]
+		if !ok {
+			return Artist{}, ErrArtistNotFound
+		}
+		return artist, nil
+	}
+
+	if artist, ok := s.artistByName(name); ok {
+		return artist, nil
+	}
+
+	return s.createArtist(Artist{Name: name})
+}
+
+func (s *MemoryStore) Tracks(ctx context.Context, albumIDs []int64) (map[int64][]Track, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tracks := map[int64][]Track{}
+	for _, id := range albumIDs {
+		if albumTracks := s.albumTracks(id); len(albumTracks) > 0 {
+			tracks[id] = albumTracks
+		}
+	}
+
+	return tracks, nil
+}
+
+func (s *MemoryStore) AddTrack(ctx context.Context, track Track) (Track, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.albums[track.AlbumID]; !ok {
+		return Track{}, ErrAlbumNotFound
+	}
+
+	var count int
+	for _, other := range s.albumTracks(track.AlbumID) {
+		if other.Disc == track.Disc {
+			count++
+		}
+	}
+
+	if track.Position < 1 || track.Position > count {
+		track.Position = count + 1
+	} else {
+		s.shiftTracks(track.AlbumID, track.Disc, track.Position, 1)
+	}
+
+	s.nextTrackID++
+	track.ID = s.nextTrackID
+	s.tracks[track.ID] = track
+
+	return track, nil
+}
+
+func (s *MemoryStore) ReorderTracks(ctx context.Context, albumID int64, trackIDs []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.albums[albumID]; !ok {
+		return ErrAlbumNotFound
+	}
+
+	discs := map[int64]int{}
+	for _, track := range s.albumTracks(albumID) {
+		discs[track.ID] = track.Disc
+	}
+
+	positions, err := trackPositions(discs, trackIDs)
+	if err != nil {
+		return err
+	}
+
+	for id, position := range positions {
+		track := s.tracks[id]
+		track.Position = position
+		s.tracks[id] = track
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteTrack(ctx context.Context, albumID, trackID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	track, ok := s.tracks[trackID]
+	if !ok || track.AlbumID != albumID {
+		return ErrTrackNotFound
+	}
+
+	delete(s.tracks, trackID)
+	s.shiftTracks(albumID, track.Disc, track.Position+1, -1)
+
+	return nil
+}
+
+// albumTracks returns the album's tracks in disc and position order. Callers
+// must hold mu.
+func (s *MemoryStore) albumTracks(albumID int64) []Track {
+	var tracks []Track
+	for _, track := range s.tracks {
+		if track.AlbumID == albumID {
+			tracks = append(tracks, track)
+		}
+	}
+
+	slices.SortFunc(tracks, func(a, b Track) int {
+		return cmp.Or(cmp.Compare(a.Disc, b.Disc), cmp.Compare(a.Position, b.Position))
+	})
+
+	return tracks
+}
+
+// shiftTracks moves the tracks on a disc from position onwards by delta.
+// Callers must hold mu.
+func (s *MemoryStore) shiftTracks(albumID int64, disc, position, delta int) {
+	for id, track := range s.tracks {
+		if track.AlbumID == albumID && track.Disc == disc && track.Position >= position {
+			track.Position += delta
+			s.tracks[id] = track
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go-web-service/money"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(
+		Album{Title: "Blue Train", Artist: "John Coltrane", Price: money.MustParse("56.99", "USD")},
+		Album{Title: "Jeru", Artist: "Gerry Mulligan", Price: money.MustParse("17.99", "USD")},
+	)
+
+	created, err := store.Create(ctx, Album{Title: "Giant Steps", Artist: "John Coltrane", Price: money.MustParse("63.99", "USD")})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if created.ID != 3 {
+		t.Errorf("Expected created album to get id 3, got %v", created.ID)
+	}
+
+	albums, err := store.List(ctx, AlbumQuery{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(albums) != 3 || albums[0].ID != 1 || albums[2].ID != 3 {
+		t.Errorf("Expected albums ordered by id, got %v", albums)
+	}
+
+	albums, err = store.List(ctx, AlbumQuery{Filters: []Filter{{Field: "artist", Operator: OpContains, Values: []any{"coltrane"}}}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(albums) != 2 {
+		t.Errorf("Expected 2 albums by Coltrane, got %v", albums)
+	}
+
+	title := "Lonely Woman"
+	if err := store.Update(ctx, 2, AlbumUpdate{Title: &title}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	album, err := store.Get(ctx, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if album.Title != title || album.Artist != "Gerry Mulligan" {
+		t.Errorf("Expected only the title to change, got %v", album)
+	}
+
+	if err := store.Delete(ctx, 2); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := store.Get(ctx, 2); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("Expected ErrAlbumNotFound, got %v", err)
+	}
+	if err := store.Delete(ctx, 2); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("Expected ErrAlbumNotFound, got %v", err)
+	}
+}
+
+func TestAlbumsWithMemoryStore(t *testing.T) {
+	albums := NewAlbums(NewMemoryStore(Album{Title: "Jeru", Artist: "Gerry Mulligan", Price: money.MustParse("17.99", "USD")}))
+
+	tests := []struct {
+		handler      http.HandlerFunc
+		method       string
+		url          string
+		expectedCode int
+		expected     string
+	}{
+		{albums.GetAlbumByID, http.MethodGet, "/albums/1", http.StatusOK, `[{"id":1,"title":"Jeru","artist":"Gerry Mulligan","artist_id":1,"price":"17.99","review_count":0,"average_rating":null,"currency":"USD"}]`},
+		{albums.GetAlbumByID, http.MethodGet, "/albums/abc", http.StatusBadRequest, `{"errors":"invalid album id"}`},
+		{albums.UpdateAlbum, http.MethodPatch, "/albums/1", http.StatusBadRequest, `{"errors":"must pass in a 'title', 'artist', 'artist_id', 'price' or release metadata field"}`},
+		{albums.UpdateAlbum, http.MethodPatch, "/albums/1?price=20", http.StatusOK, `{"message":"album successfully updated"}`},
+		{albums.GetAlbums, http.MethodGet, "/albums", http.StatusOK, `{"data":[{"id":1,"title":"Jeru","artist":"Gerry Mulligan","artist_id":1,"price":"20.00","review_count":0,"average_rating":null,"currency":"USD"}],"next":null,"prev":null}`},
+		{albums.DeleteAlbum, http.MethodDelete, "/albums/1", http.StatusOK, `{"message":"album successfully removed"}`},
+		{albums.DeleteAlbum, http.MethodDelete, "/albums/1", http.StatusNotFound, `{"errors":"album not found"}`},
+	}
+
+	for _, tt := range tests {
+		rr := sendMockHTTPRequest(t, tt.handler, tt.method, tt.url)
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("%v %v returned wrong status code: got %v want %v", tt.method, tt.url, status, tt.expectedCode)
+		}
+
+		actual := strings.TrimSpace(rr.Body.String())
+		if actual != tt.expected {
+			t.Errorf("%v %v returned unexpected body: got %v want %v", tt.method, tt.url, actual, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrBarcodeExists is returned when another album already has the barcode.
+var ErrBarcodeExists = errors.New("another album already has this barcode")
+
+// Limits of the album metadata columns.
+const (
+	maxRecordLabelLength   = 255
+	maxCatalogNumberLength = 64
+)
+
+// albumFormats are the physical formats an album can be released in.
+var albumFormats = []string{"vinyl", "cd", "cassette", "digital"}
+
+// dateLayout is the form release dates are read and written in.
+const dateLayout = "2006-01-02"
+
+// Date is a calendar date such as 2006-01-02. The empty Date is stored as NULL.
+type Date string
+
+// ParseDate reads a date in YYYY-MM-DD form.
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return "", err
+	}
+
+	return Date(t.Format(dateLayout)), nil
+}
+
+func (d Date) Value() (driver.Value, error) {
+	if d == "" {
+		return nil, nil
+	}
+
+	return string(d), nil
+}
+
+// Scan reads a DATE column. Drivers return dates as time.Time or as text,
+// which SQLite may store with a time after the date.
+func (d *Date) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*d = ""
+	case time.Time:
+		*d = Date(v.Format(dateLayout))
+	case []byte:
+		return d.Scan(string(v))
+	case string:
+		if len(v) < len(dateLayout) {
+			return fmt.Errorf("scan date %q: too short", v)
+		}
+		*d = Date(v[:len(dateLayout)])
+	default:
+		return fmt.Errorf("scan date: unsupported type %T", src)
+	}
+
+	return nil
+}
+
+var (
+	errBarcodeLength     = errors.New("must be a 12 digit UPC or 13 digit EAN")
+	errBarcodeCheckDigit = errors.New("has an invalid check digit")
+)
+
+// Barcode is a 13 digit EAN. UPC-A codes are kept as the EAN with a leading
+// zero they are equivalent to, so one product cannot be entered twice. The
+// empty Barcode is stored as NULL.
+type Barcode string
+
+// ParseBarcode reads a UPC-A or EAN-13 barcode, ignoring spaces and hyphens,
+// and checks its check digit.
+func ParseBarcode(s string) (Barcode, error) {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(s)
+	if len(digits) == 12 {
+		digits = "0" + digits
+	}
+
+	if len(digits) != 13 || strings.Trim(digits, "0123456789") != "" {
+		return "", errBarcodeLength
+	}
+
+	// Digits are weighted 1 and 3 alternately from the left, so that the
+	// weighted sum including the check digit is a multiple of 10.
+	var sum int
+	for i, digit := range digits {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(digit-'0') * weight
+	}
+	if sum%10 != 0 {
+		return "", errBarcodeCheckDigit
+	}
+
+	return Barcode(digits), nil
+}
+
+func (b Barcode) Value() (driver.Value, error) {
+	if b == "" {
+		return nil, nil
+	}
+
+	return string(b), nil
+}
+
+func (b *Barcode) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*b = ""
+	case []byte:
+		*b = Barcode(v)
+	case string:
+		*b = Barcode(v)
+	default:
+		return fmt.Errorf("scan barcode: unsupported type %T", src)
+	}
+
+	return nil
+}
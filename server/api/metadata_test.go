@@ -0,0 +1,143 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBarcode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Barcode
+		err      error
+	}{
+		{"4006381333931", "4006381333931", nil},
+		{"400-6381 333931", "4006381333931", nil},
+		// UPC-A codes are kept as the equivalent EAN-13
+		{"036000291452", "0036000291452", nil},
+		{"0036000291452", "0036000291452", nil},
+		{"4006381333932", "", errBarcodeCheckDigit},
+		{"036000291453", "", errBarcodeCheckDigit},
+		{"40063813339", "", errBarcodeLength},
+		{"400638133393a", "", errBarcodeLength},
+		{"", "", errBarcodeLength},
+	}
+
+	for _, tt := range tests {
+		actual, err := ParseBarcode(tt.input)
+		if err != tt.err {
+			t.Errorf("ParseBarcode(%q) returned error %v, want %v", tt.input, err, tt.err)
+		}
+		if actual != tt.expected {
+			t.Errorf("ParseBarcode(%q) = %q, want %q", tt.input, actual, tt.expected)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	if date, err := ParseDate("1957-09-15"); err != nil || date != "1957-09-15" {
+		t.Errorf("ParseDate returned %q, %v", date, err)
+	}
+
+	for _, input := range []string{"1957-9-15", "1957-02-30", "15/09/1957", ""} {
+		if _, err := ParseDate(input); err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+}
+
+func TestDateScan(t *testing.T) {
+	tests := []struct {
+		src      any
+		expected Date
+	}{
+		{nil, ""},
+		{time.Date(1957, time.September, 15, 0, 0, 0, 0, time.UTC), "1957-09-15"},
+		{[]byte("1957-09-15"), "1957-09-15"},
+		{"1957-09-15T00:00:00Z", "1957-09-15"},
+	}
+
+	for _, tt := range tests {
+		date := Date("2000-01-01")
+		if err := date.Scan(tt.src); err != nil {
+			t.Errorf("Scan(%v) returned error %v", tt.src, err)
+		}
+		if date != tt.expected {
+			t.Errorf("Scan(%v) = %q, want %q", tt.src, date, tt.expected)
+		}
+	}
+
+	var date Date
+	if err := date.Scan("1957"); err == nil {
+		t.Error("Expected an error for a short date")
+	}
+}
+
+func TestAlbumMetadata_MemoryStore(t *testing.T) {
+	testAlbumMetadata(t, NewAlbums(NewMemoryStore(queryAlbums...)))
+}
+
+func TestAlbumMetadata_SQLite(t *testing.T) {
+	testAlbumMetadata(t, NewAlbums(querySQLiteStore(t)))
+}
+
+// testAlbumMetadata runs through setting release metadata against albums
+// holding queryAlbums.
+func testAlbumMetadata(t *testing.T, albums *Albums) {
+	t.Helper()
+
+	router := SetupRouter(albums)
+
+	tests := []struct {
+		method       string
+		url          string
+		body         string
+		expectedCode int
+		expected     string
+	}{
+		{http.MethodPut, "/albums", `{"title":"Blue Train","artist_id":1,"price":"56.99","release_date":"1958-01-01","label":"Blue Note","format":" Vinyl ","catalog_number":"BLP 1577","barcode":"036000291452"}`, http.StatusOK, `{"id":8,"title":"Blue Train","artist":"John Coltrane","artist_id":1,"price":"56.99","release_date":"1958-01-01","label":"Blue Note","format":"vinyl","catalog_number":"BLP 1577","barcode":"0036000291452","review_count":0,"average_rating":null,"currency":"USD"}`},
+		{http.MethodGet, "/albums/8", "", http.StatusOK, `[{"id":8,"title":"Blue Train","artist":"John Coltrane","artist_id":1,"price":"56.99","release_date":"1958-01-01","label":"Blue Note","format":"vinyl","catalog_number":"BLP 1577","barcode":"0036000291452","review_count":0,"average_rating":null,"currency":"USD"}]`},
+
+		// A UPC and its EAN are the same barcode
+		{http.MethodPut, "/albums", `{"title":"Again","artist_id":1,"price":"9.99","barcode":"0036000291452"}`, http.StatusConflict, `{"errors":"another album already has this barcode"}`},
+		{http.MethodPatch, "/albums/3", `{"barcode":"036000291452"}`, http.StatusConflict, `{"errors":"another album already has this barcode"}`},
+		{http.MethodPatch, "/albums/8", `{"barcode":"036000291452"}`, http.StatusOK, `{"message":"album successfully updated"}`},
+
+		{http.MethodPut, "/albums", `{"title":"Bad","artist_id":1,"price":"9.99","release_date":"1958-13-01","format":"8-track","barcode":"036000291453","catalog_number":"` + strings.Repeat("a", 65) + `"}`, http.StatusUnprocessableEntity, `"fields":{"barcode":["has an invalid check digit"],"catalog_number":["must be at most 64 characters"],"format":["must be one of vinyl, cd, cassette, digital"],"release_date":["must be a date such as 2006-01-02"]}`},
+		{http.MethodPatch, "/albums/8", `{"barcode":"12345"}`, http.StatusUnprocessableEntity, `"fields":{"barcode":["must be a 12 digit UPC or 13 digit EAN"]}`},
+
+		// Metadata can be set and cleared on its own
+		{http.MethodPatch, "/albums/3", `{"format":"cd","barcode":"4006381333931"}`, http.StatusOK, `{"message":"album successfully updated"}`},
+		{http.MethodGet, "/albums/3", "", http.StatusOK, `[{"id":3,"title":"Jeru","artist":"Gerry Mulligan","artist_id":2,"price":"17.99","format":"cd","barcode":"4006381333931","review_count":0,"average_rating":null,"currency":"USD"}]`},
+		{http.MethodPatch, "/albums/8", `{"release_date":"","label":"","format":"","catalog_number":"","barcode":""}`, http.StatusOK, `{"message":"album successfully updated"}`},
+		{http.MethodGet, "/albums/8", "", http.StatusOK, `[{"id":8,"title":"Blue Train","artist":"John Coltrane","artist_id":1,"price":"56.99","review_count":0,"average_rating":null,"currency":"USD"}]`},
+		{http.MethodPatch, "/albums/3", `{"barcode":"036000291452"}`, http.StatusOK, `{"message":"album successfully updated"}`},
+
+		// Label and format filter like other text fields
+		{http.MethodGet, "/albums?format=cd&sort=id", "", http.StatusOK, `{"data":[{"id":3,`},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if tt.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("%v %v returned wrong status code: got %v want %v", tt.method, tt.url, status, tt.expectedCode)
+		}
+
+		if actual := strings.TrimSpace(rr.Body.String()); !strings.Contains(actual, tt.expected) {
+			t.Errorf("%v %v returned unexpected body: got %v want %v", tt.method, tt.url, actual, tt.expected)
+		}
+	}
+}
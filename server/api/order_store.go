@@ -0,0 +1,328 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+func (s *MemoryStore) Checkout(ctx context.Context, cartID string, customerID int64, now time.Time) (Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cart, err := s.cart(cartID)
+	if err != nil {
+		return Order{}, err
+	}
+	if cart.CustomerID != nil && *cart.CustomerID != customerID {
+		return Order{}, ErrCartNotFound
+	}
+	cart.CustomerID = &customerID
+
+	order, err := newOrder(cart, now)
+	if err != nil {
+		return Order{}, err
+	}
+	taken, err := s.takeStock(cart, now)
+	if err != nil {
+		return Order{}, err
+	}
+
+	s.nextOrderID++
+	order.ID = s.nextOrderID
+	s.orders[order.ID] = order
+	s.orderStock[order.ID] = taken
+	delete(s.carts, cartID)
+
+	return copyOrder(order), nil
+}
+
+func (s *MemoryStore) ListOrders(ctx context.Context, query OrderQuery) ([]Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var orders []Order
+	for _, order := range s.orders {
+		if query.CustomerID != nil && (order.CustomerID == nil || *order.CustomerID != *query.CustomerID) ||
+			query.Status != "" && order.Status != query.Status ||
+			query.Before != 0 && order.ID >= query.Before {
+			continue
+		}
+		order.Items = nil
+		orders = append(orders, order)
+	}
+
+	slices.SortFunc(orders, func(a, b Order) int { return cmp.Compare(b.ID, a.ID) })
+	if len(orders) > query.Limit {
+		orders = orders[:query.Limit]
+	}
+
+	return orders, nil
+}
+
+func (s *MemoryStore) GetOrder(ctx context.Context, id int64) (Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	order, ok := s.orders[id]
+	if !ok {
+		return Order{}, ErrOrderNotFound
+	}
+
+	return copyOrder(order), nil
+}
+
+func (s *MemoryStore) SetOrderStatus(ctx context.Context, id int64, status OrderStatus, now time.Time) (Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, ok := s.orders[id]
+	if !ok {
+		return Order{}, ErrOrderNotFound
+	}
+	if err := checkTransition(order.Status, status); err != nil {
+		return Order{}, err
+	}
+
+	if restocks(order.Status, status) {
+		s.restock(id)
+	}
+
+	order.Status, order.UpdatedAt = status, now
+	s.orders[id] = order
+
+	return copyOrder(order), nil
+}
+
+// copyOrder returns order with items of its own, so that callers cannot
+// change the stored ones.
+func copyOrder(order Order) Order {
+	items := make([]OrderItem, len(order.Items))
+	for i, item := range order.Items {
+		if item.AlbumID != nil {
+			albumID := *item.AlbumID
+			item.AlbumID = &albumID
+		}
+		items[i] = item
+	}
+	order.Items = items
+
+	return order
+}
+
+// orderColumns are the order columns scanOrder reads.
+// The currency comes before the total because money.Money needs it to scan.
+const orderColumns = "id, customer_id, status, currency, total, created_at, updated_at"
+
+// scanOrder reads the orderColumns of a *sql.Row or *sql.Rows.
+func scanOrder(row interface{ Scan(...any) error }) (Order, error) {
+	var order Order
+	var customerID sql.NullInt64
+	err := row.Scan(&order.ID, &customerID, &order.Status, &order.Total.Currency, &order.Total, timeScanner{&order.CreatedAt}, timeScanner{&order.UpdatedAt})
+	if err != nil {
+		return Order{}, err
+	}
+
+	order.Currency = order.Total.Currency
+	if customerID.Valid {
+		order.CustomerID = &customerID.Int64
+	}
+
+	return order, nil
+}
+
+func (s *SQLStore) Checkout(ctx context.Context, cartID string, customerID int64, now time.Time) (Order, error) {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return Order{}, err
+	}
+	defer tx.Rollback()
+
+	// Locking the cart keeps a second checkout of it waiting until this one
+	// has deleted it.
+	cart, err := s.cart(ctx, tx, cartID, true)
+	if err != nil {
+		return Order{}, err
+	}
+	if cart.CustomerID != nil && *cart.CustomerID != customerID {
+		return Order{}, ErrCartNotFound
+	}
+	cart.CustomerID = &customerID
+
+	order, err := newOrder(cart, now)
+	if err != nil {
+		return Order{}, err
+	}
+	taken, err := s.takeStock(ctx, tx, cart, now)
+	if err != nil {
+		return Order{}, err
+	}
+
+	query := `INSERT INTO orders (customer_id, status, currency, total, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`
+	args := []any{order.CustomerID, order.Status, order.Currency, order.Total, order.CreatedAt.UTC(), order.UpdatedAt.UTC()}
+	if s.postgres() {
+		err = tx.QueryRowContext(ctx, s.rebind(query+` RETURNING id`), args...).Scan(&order.ID)
+	} else {
+		var result sql.Result
+		if result, err = tx.ExecContext(ctx, query, args...); err == nil {
+			order.ID, err = result.LastInsertId()
+		}
+	}
+	if err != nil {
+		return Order{}, err
+	}
+
+	query = `INSERT INTO order_item (order_id, album_id, title, artist, quantity, price) VALUES ` +
+		strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?), ", len(order.Items)), ", ")
+	args = nil
+	for _, item := range order.Items {
+		args = append(args, order.ID, item.AlbumID, item.Title, item.Artist, item.Quantity, item.Price)
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(query), args...); err != nil {
+		return Order{}, err
+	}
+
+	for key, quantity := range taken {
+		_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO order_stock (order_id, album_id, format, quantity) VALUES (?, ?, ?, ?)`),
+			order.ID, key.albumID, key.format, quantity)
+		if err != nil {
+			return Order{}, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM cart WHERE id = ?`), cartID); err != nil {
+		return Order{}, err
+	}
+
+	return order, tx.Commit()
+}
+
+func (s *SQLStore) ListOrders(ctx context.Context, query OrderQuery) ([]Order, error) {
+	var conditions []string
+	var args []any
+	if query.CustomerID != nil {
+		conditions = append(conditions, "customer_id = ?")
+		args = append(args, *query.CustomerID)
+	}
+	if query.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, query.Status)
+	}
+	if query.Before != 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, query.Before)
+	}
+
+	statement := `SELECT ` + orderColumns + ` FROM orders`
+	if len(conditions) > 0 {
+		statement += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	statement += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, query.Limit)
+
+	rows, err := s.Db.QueryContext(ctx, s.rebind(statement), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+func (s *SQLStore) GetOrder(ctx context.Context, id int64) (Order, error) {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return Order{}, err
+	}
+	defer tx.Rollback()
+
+	order, err := s.order(ctx, tx, id, false)
+	if err != nil {
+		return Order{}, err
+	}
+
+	rows, err := tx.QueryContext(ctx, s.rebind(`SELECT album_id, title, artist, quantity, price FROM order_item WHERE order_id = ? ORDER BY id`), id)
+	if err != nil {
+		return Order{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := OrderItem{}
+		item.Price.Currency = order.Currency
+		var albumID sql.NullInt64
+		if err := rows.Scan(&albumID, &item.Title, &item.Artist, &item.Quantity, &item.Price); err != nil {
+			return Order{}, err
+		}
+		if albumID.Valid {
+			item.AlbumID = &albumID.Int64
+		}
+		order.Items = append(order.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return Order{}, err
+	}
+	order.subtotal()
+
+	return order, tx.Commit()
+}
+
+func (s *SQLStore) SetOrderStatus(ctx context.Context, id int64, status OrderStatus, now time.Time) (Order, error) {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return Order{}, err
+	}
+	defer tx.Rollback()
+
+	order, err := s.order(ctx, tx, id, true)
+	if err != nil {
+		return Order{}, err
+	}
+	if err := checkTransition(order.Status, status); err != nil {
+		return Order{}, err
+	}
+	if restocks(order.Status, status) {
+		if err := s.restock(ctx, tx, id); err != nil {
+			return Order{}, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`UPDATE orders SET status = ?, updated_at = ? WHERE id = ?`), status, now.UTC(), id)
+	if err != nil {
+		return Order{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Order{}, err
+	}
+
+	return s.GetOrder(ctx, id)
+}
+
+// order reads the order with id without its items, locking its row until tx
+// ends when lock is set.
+func (s *SQLStore) order(ctx context.Context, tx *sql.Tx, id int64, lock bool) (Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE id = ?`
+	if lock && s.Driver != "sqlite" {
+		query += ` FOR UPDATE`
+	}
+
+	order, err := scanOrder(tx.QueryRowContext(ctx, s.rebind(query), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Order{}, ErrOrderNotFound
+	}
+
+	return order, err
+}
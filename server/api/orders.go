@@ -0,0 +1,421 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-web-service/money"
+)
+
+var (
+	// ErrOrderNotFound is returned by an OrderStore when no order matches the given id.
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrCartEmpty is returned when checking out a cart without items.
+	ErrCartEmpty = errors.New("cart is empty")
+	// ErrOrderStatus is returned when an order cannot move to the requested
+	// status from the one it is in.
+	ErrOrderStatus = errors.New("invalid order status change")
+)
+
+// OrderStatus is where an order is in its lifecycle.
+type OrderStatus string
+
+const (
+	OrderPending   OrderStatus = "pending"
+	OrderPaid      OrderStatus = "paid"
+	OrderShipped   OrderStatus = "shipped"
+	OrderCancelled OrderStatus = "cancelled"
+)
+
+// orderTransitions lists the statuses each status can move to. Shipped and
+// cancelled orders are final.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderPending: {OrderPaid, OrderCancelled},
+	OrderPaid:    {OrderShipped, OrderCancelled},
+}
+
+// orderStatuses are the statuses in lifecycle order.
+var orderStatuses = []OrderStatus{OrderPending, OrderPaid, OrderShipped, OrderCancelled}
+
+// checkTransition returns ErrOrderStatus, wrapped with both statuses, unless
+// an order can move from one to the other.
+func checkTransition(from, to OrderStatus) error {
+	if !slices.Contains(orderTransitions[from], to) {
+		return fmt.Errorf("%w from %v to %v", ErrOrderStatus, from, to)
+	}
+
+	return nil
+}
+
+// restocks reports whether an order moving from one status to the other
+// gives its copies back to the stock: they have not left the shop until the
+// order is shipped.
+func restocks(from, to OrderStatus) bool {
+	return to == OrderCancelled && (from == OrderPending || from == OrderPaid)
+}
+
+// Order is a checked out cart. Its items keep the title, artist and price
+// their album had at checkout, and AlbumID is null once the album is deleted.
+// Items are left out of order listings.
+type Order struct {
+	ID         int64       `json:"id"`
+	CustomerID *int64      `json:"customer_id"`
+	Status     OrderStatus `json:"status"`
+	Currency   string      `json:"currency"`
+	Total      money.Money `json:"total"`
+	Items      []OrderItem `json:"items,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+type OrderItem struct {
+	AlbumID  *int64      `json:"album_id"`
+	Title    string      `json:"title"`
+	Artist   string      `json:"artist"`
+	Quantity int         `json:"quantity"`
+	Price    money.Money `json:"price"`
+	Subtotal money.Money `json:"subtotal"`
+}
+
+// newOrder returns a pending order for the items in cart at their current
+// prices.
+func newOrder(cart Cart, now time.Time) (Order, error) {
+	if len(cart.Items) == 0 {
+		return Order{}, ErrCartEmpty
+	}
+
+	cart.price()
+	if cart.Total == nil {
+		return Order{}, ErrCurrencyMismatch
+	}
+
+	order := Order{CustomerID: cart.CustomerID, Status: OrderPending, Currency: cart.Currency, Total: *cart.Total, CreatedAt: now, UpdatedAt: now}
+	for _, item := range cart.Items {
+		order.Items = append(order.Items, OrderItem{AlbumID: &item.AlbumID, Title: item.Title, Artist: item.Artist,
+			Quantity: item.Quantity, Price: item.Price, Subtotal: item.Subtotal})
+	}
+
+	return order, nil
+}
+
+// subtotal sets the subtotal of each of the order's items.
+func (o *Order) subtotal() {
+	for i, item := range o.Items {
+		o.Items[i].Subtotal = money.New(item.Price.Amount*int64(item.Quantity), item.Price.Currency)
+	}
+}
+
+// OrderQuery selects a page of orders, newest first.
+type OrderQuery struct {
+	CustomerID *int64
+	Status     OrderStatus
+	Limit      int
+	// Before is the id of the last order of the previous page.
+	Before int64
+}
+
+// OrderStore is the persistence layer the order handlers depend on.
+type OrderStore interface {
+	// Checkout turns the cart into a pending order of the customer with
+	// customerID at its albums' current prices, takes the copies ordered off
+	// the stock and deletes the cart, all in one transaction. Copies come
+	// from the cart's reservations first, which are used up, then from those
+	// available in any format. It returns ErrCartEmpty or
+	// ErrCurrencyMismatch when the cart cannot be ordered, and ErrOutOfStock
+	// when not enough copies are available. The carts of other customers are
+	// not found.
+	Checkout(ctx context.Context, cartID string, customerID int64, now time.Time) (Order, error)
+	// ListOrders returns orders without their items.
+	ListOrders(ctx context.Context, query OrderQuery) ([]Order, error)
+	GetOrder(ctx context.Context, id int64) (Order, error)
+	// SetOrderStatus returns ErrOrderStatus when the order cannot move to
+	// status. Cancelling an order that has not shipped puts its copies back
+	// on the stock in the same transaction.
+	SetOrderStatus(ctx context.Context, id int64, status OrderStatus, now time.Time) (Order, error)
+}
+
+// OrderPage is the envelope order listings are served in. Next is an opaque
+// cursor for the following page and is null on the last one.
+type OrderPage struct {
+	Data []Order `json:"data"`
+	Next *string `json:"next"`
+}
+
+// GetOrders lists orders newest first, a page at a time, optionally only
+// those of one customer_id or in one status. Customers list their own orders
+// and only staff those of others.
+func (a *Albums) GetOrders(w http.ResponseWriter, r *http.Request) {
+	if !requireLogin(w, r) {
+		return
+	}
+
+	parameters := r.URL.Query()
+	query := OrderQuery{Limit: defaultPageLimit}
+
+	var err error
+	if limit := parameters.Get("limit"); limit != "" {
+		if query.Limit, err = parseLimit(limit); err != nil {
+			ServeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if cursor := parameters.Get("cursor"); cursor != "" {
+		if query.Before, err = decodeIDCursor(cursor); err != nil {
+			ServeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if customer := parameters.Get("customer_id"); customer != "" {
+		id, err := strconv.ParseInt(customer, 10, 64)
+		if err != nil {
+			ServeJSONError(w, "invalid customer_id", http.StatusBadRequest)
+			return
+		}
+		query.CustomerID = &id
+	}
+
+	if customer, ok := CurrentCustomer(r.Context()); ok {
+		if query.CustomerID != nil && *query.CustomerID != customer.ID {
+			ServeJSONError(w, "only staff can list the orders of other customers", http.StatusForbidden)
+			return
+		}
+		query.CustomerID = &customer.ID
+	}
+
+	if status := parameters.Get("status"); status != "" {
+		query.Status = OrderStatus(status)
+		if !slices.Contains(orderStatuses, query.Status) {
+			ServeJSONError(w, "status must be one of "+joinStatuses(orderStatuses), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Fetch one more order to tell whether there is a next page
+	query.Limit++
+	orders, err := a.Orders.ListOrders(r.Context(), query)
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("GetOrders %v", err), http.StatusInternalServerError)
+		return
+	}
+	query.Limit--
+
+	page := OrderPage{Data: orders}
+	if len(orders) > query.Limit {
+		page.Data = orders[:query.Limit]
+		next := encodeIDCursor(page.Data[query.Limit-1].ID)
+		page.Next = &next
+	}
+	if page.Data == nil {
+		page.Data = []Order{}
+	}
+
+	ServeJSON(w, page, http.StatusOK)
+}
+
+// AddOrder checks out the cart in {"cart_id":"..."}, turning it into a
+// pending order with the current price of each album. Checkout needs a
+// customer login, so that the order can be read and cancelled afterwards;
+// an anonymous cart becomes the customer's order.
+func (a *Albums) AddOrder(w http.ResponseWriter, r *http.Request) {
+	p, ok := requireCustomer(w, r)
+	if !ok {
+		return
+	}
+
+	if !isJSON(r) {
+		ServeJSONError(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var input struct {
+		CartID *string `json:"cart_id"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		ServeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var errs ValidationErrors
+	switch {
+	case input.CartID == nil:
+		errs.Add("cart_id", "is required")
+	case !validCartID(*input.CartID):
+		errs.Add("cart_id", "is not a cart id")
+	}
+	if len(errs) > 0 {
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	order, err := a.Orders.Checkout(r.Context(), *input.CartID, p.customer.ID, time.Now().UTC().Truncate(time.Second))
+	switch {
+	case errors.Is(err, ErrCartNotFound):
+		ServeJSONError(w, "cart not found", http.StatusNotFound)
+	case errors.Is(err, ErrCartEmpty), errors.Is(err, ErrCurrencyMismatch), errors.Is(err, ErrOutOfStock):
+		ServeJSONError(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		ServeJSONError(w, fmt.Sprintf("AddOrder %v", err), http.StatusInternalServerError)
+	default:
+		ServeJSON(w, order, http.StatusOK)
+	}
+}
+
+// GetOrderByID serves an order to staff or to the customer who placed it.
+func (a *Albums) GetOrderByID(w http.ResponseWriter, r *http.Request) {
+	if !requireLogin(w, r) {
+		return
+	}
+
+	id, ok := orderID(w, r)
+	if !ok {
+		return
+	}
+
+	if order, ok := a.visibleOrder(w, r, id, "GetOrderByID"); ok {
+		ServeJSON(w, order, http.StatusOK)
+	}
+}
+
+// visibleOrder returns the order with id when the request may see it: staff
+// see every order and customers their own. The orders of others are not
+// found, so that their ids are not revealed. It writes an error response and
+// returns false when the order cannot be served.
+func (a *Albums) visibleOrder(w http.ResponseWriter, r *http.Request, id int64, handler string) (Order, bool) {
+	order, err := a.Orders.GetOrder(r.Context(), id)
+	if err != nil && !errors.Is(err, ErrOrderNotFound) {
+		ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+		return Order{}, false
+	}
+
+	if !isStaff(r.Context()) {
+		customer, _ := CurrentCustomer(r.Context())
+		if order.CustomerID == nil || *order.CustomerID != customer.ID {
+			err = ErrOrderNotFound
+		}
+	}
+	if errors.Is(err, ErrOrderNotFound) {
+		ServeJSONError(w, "order not found", http.StatusNotFound)
+		return Order{}, false
+	}
+
+	return order, true
+}
+
+// UpdateOrder moves an order along its lifecycle, as in {"status":"paid"}.
+// Pending orders can be paid or cancelled, and paid ones shipped or cancelled.
+// Staff make every change, and customers can only cancel their own orders.
+func (a *Albums) UpdateOrder(w http.ResponseWriter, r *http.Request) {
+	if !requireLogin(w, r) {
+		return
+	}
+
+	id, ok := orderID(w, r)
+	if !ok {
+		return
+	}
+
+	if !isJSON(r) {
+		ServeJSONError(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var input struct {
+		Status *OrderStatus `json:"status"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		ServeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var errs ValidationErrors
+	switch {
+	case input.Status == nil:
+		errs.Add("status", "is required")
+	case !slices.Contains(orderStatuses, *input.Status):
+		errs.Add("status", "must be one of "+joinStatuses(orderStatuses))
+	}
+	if len(errs) > 0 {
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	if !isStaff(r.Context()) {
+		if _, ok := a.visibleOrder(w, r, id, "UpdateOrder"); !ok {
+			return
+		}
+		if *input.Status != OrderCancelled {
+			ServeJSONError(w, fmt.Sprintf("only staff can change an order to %v", *input.Status), http.StatusForbidden)
+			return
+		}
+	}
+
+	order, err := a.Orders.SetOrderStatus(r.Context(), id, *input.Status, time.Now().UTC().Truncate(time.Second))
+	switch {
+	case errors.Is(err, ErrOrderNotFound):
+		ServeJSONError(w, "order not found", http.StatusNotFound)
+	case errors.Is(err, ErrOrderStatus):
+		ServeJSONError(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		ServeJSONError(w, fmt.Sprintf("UpdateOrder %v", err), http.StatusInternalServerError)
+	default:
+		ServeJSON(w, order, http.StatusOK)
+	}
+}
+
+func joinStatuses(statuses []OrderStatus) string {
+	names := make([]string, len(statuses))
+	for i, status := range statuses {
+		names[i] = string(status)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// orderID parses the order id in a /orders/{id} path. It writes a 400
+// response and returns false when the id is not a number.
+func orderID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/orders/"), 10, 64)
+	if err != nil {
+		ServeJSONError(w, "invalid order id", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return id, true
+}
+
+// encodeIDCursor returns the cursor of a page that continues below id, for
+// listings ordered by descending id.
+func encodeIDCursor(id int64) string {
+	data, _ := json.Marshal(cursor{Before: []string{strconv.FormatInt(id, 10)}})
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeIDCursor(encoded string) (int64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || len(c.Before) != 1 {
+		return 0, errInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(c.Before[0], 10, 64)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+
+	return id, nil
+}
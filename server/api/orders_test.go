@@ -0,0 +1,288 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// staffToken authenticates order tests as staff.
+var staffToken = strings.Repeat("s", 32)
+
+func TestCheckout_MemoryStore(t *testing.T) {
+	testCheckout(t, NewAlbums(NewMemoryStore(queryAlbums...)))
+}
+
+func TestCheckout_SQLite(t *testing.T) {
+	testCheckout(t, NewAlbums(querySQLiteStore(t)))
+}
+
+// testCheckout runs through filling carts, checking them out and moving the
+// orders along against albums holding queryAlbums.
+func testCheckout(t *testing.T, albums *Albums) {
+	t.Helper()
+
+	albums.StaffToken = staffToken
+	router := SetupRouter(albums)
+	token := registerCustomer(t, router, "shopper@example.com")
+	tokens := map[string]string{"{shopper}": token, "{buyer}": registerCustomer(t, router, "buyer@example.com"), "{staff}": staffToken}
+	carts := map[string]string{}
+	for name, token := range map[string]string{"cart": token, "mine": token, "other": "", "spare": ""} {
+		rr := authRequest(router, http.MethodPut, "/carts", "", token)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("AddCart returned wrong status code: got %v want %v: %v", rr.Code, http.StatusOK, rr.Body)
+		}
+		var cart struct {
+			ID    string
+			Items []CartItem
+			Total string
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &cart); err != nil {
+			t.Fatalf("Failed to decode cart: %v", err)
+		}
+		if !validCartID(cart.ID) || cart.Total != "0.00" || cart.Items == nil || len(cart.Items) != 0 {
+			t.Errorf("Unexpected new cart %+v", cart)
+		}
+		carts["{"+name+"}"] = cart.ID
+	}
+
+	tests := []struct {
+		method       string
+		url          string
+		as           string
+		body         string
+		expectedCode int
+		expected     string
+	}{
+		{http.MethodPatch, "/albums/1/stock", "{staff}", `{"format":"vinyl","delta":1}`, http.StatusOK, `"on_hand":1`},
+		{http.MethodPatch, "/albums/2/stock", "{staff}", `{"format":"vinyl","delta":1}`, http.StatusOK, `"on_hand":1`},
+		{http.MethodPatch, "/albums/3/stock", "{staff}", `{"format":"cd","delta":1}`, http.StatusOK, `"on_hand":1`},
+		{http.MethodPatch, "/albums/3/stock", "{staff}", `{"format":"vinyl","delta":1}`, http.StatusOK, `"on_hand":1`},
+		{http.MethodPatch, "/albums/7/stock", "{staff}", `{"format":"cd","delta":2}`, http.StatusOK, `"on_hand":2`},
+		{http.MethodGet, "/carts/{cart}", "", "", http.StatusOK, `"customer_id":1,"items":[],"currency":"USD","total":"0.00"`},
+		{http.MethodGet, "/carts/{other}", "", "", http.StatusOK, `"customer_id":null,`},
+		{http.MethodPut, "/carts/{cart}/items", "", `{"album_id":3,"quantity":2}`, http.StatusOK, `"items":[{"album_id":3,"title":"Jeru","artist":"Gerry Mulligan","quantity":2,"price":"17.99","subtotal":"35.98"}],"currency":"USD","total":"35.98"`},
+		{http.MethodPut, "/carts/{cart}/items", "", `{"album_id":1}`, http.StatusOK, `"items":[{"album_id":1,"title":"Blue Train","artist":"John Coltrane","quantity":1,"price":"56.99","subtotal":"56.99"},{"album_id":3,`},
+		{http.MethodPut, "/carts/{cart}/items", "", `{"album_id":3,"quantity":1}`, http.StatusOK, `"total":"74.98"`},
+		{http.MethodPut, "/carts/{cart}/items", "", `{"album_id":5}`, http.StatusOK, `"total":"99.97"`},
+		{http.MethodDelete, "/carts/{cart}/items/5", "", "", http.StatusOK, `"total":"74.98"`},
+		{http.MethodDelete, "/carts/{cart}/items/5", "", "", http.StatusNotFound, `{"errors":"album is not in the cart"}`},
+
+		// Carts hold a single currency
+		{http.MethodPatch, "/albums/7", "", `{"price":"20.00","currency":"EUR"}`, http.StatusOK, `{"message":"album successfully updated"}`},
+		{http.MethodPut, "/carts/{cart}/items", "", `{"album_id":7}`, http.StatusConflict, `{"errors":"cart items must all be priced in the same currency"}`},
+
+		{http.MethodPut, "/carts/{cart}/items", "", `{"album_id":99}`, http.StatusNotFound, `{"errors":"album not found"}`},
+		{http.MethodPut, "/carts/00000000000000000000000000000000/items", "", `{"album_id":1}`, http.StatusNotFound, `{"errors":"cart not found"}`},
+		{http.MethodGet, "/carts/not-a-cart", "", "", http.StatusBadRequest, `{"errors":"invalid cart id"}`},
+		{http.MethodDelete, "/carts/{cart}/items/x", "", "", http.StatusBadRequest, `{"errors":"invalid album id"}`},
+		{http.MethodPut, "/carts/{cart}/items", "", `{"quantity":100}`, http.StatusUnprocessableEntity, `"fields":{"album_id":["is required"],"quantity":["must be between 1 and 99"]}`},
+
+		{http.MethodDelete, "/carts/{spare}", "", "", http.StatusOK, `{"message":"cart successfully removed"}`},
+		{http.MethodDelete, "/carts/{spare}", "", "", http.StatusNotFound, `{"errors":"cart not found"}`},
+
+		// Carts follow price changes until checkout
+		{http.MethodPatch, "/albums/3", "", `{"price":"19.99"}`, http.StatusOK, `{"message":"album successfully updated"}`},
+		{http.MethodGet, "/carts/{cart}", "", "", http.StatusOK, `"total":"76.98"`},
+
+		// Copies can be reserved for a cart
+		{http.MethodPut, "/albums/3/reservations", "{shopper}", `{"format":"cd","cart_id":"{cart}"}`, http.StatusOK, `"format":"cd","quantity":1,`},
+		{http.MethodPut, "/albums/3/reservations", "{shopper}", `{"format":"vinyl","cart_id":"{spare}"}`, http.StatusNotFound, `{"errors":"cart not found"}`},
+		{http.MethodPut, "/albums/3/reservations", "{buyer}", `{"format":"vinyl","cart_id":"{cart}"}`, http.StatusNotFound, `{"errors":"cart not found"}`},
+		{http.MethodGet, "/albums/3/stock", "", "", http.StatusOK, `{"format":"cd","on_hand":1,"reserved":1,"available":0,"status":"out_of_stock"}`},
+
+		// Checkout takes the copies off the stock, or fails when there are
+		// not enough and leaves the cart and stock as they were
+		{http.MethodPut, "/orders", "{shopper}", `{"cart_id":"{other}"}`, http.StatusConflict, `{"errors":"cart is empty"}`},
+		{http.MethodPut, "/carts/{cart}/items", "", `{"album_id":1,"quantity":2}`, http.StatusOK, `"total":"133.97"`},
+		{http.MethodPut, "/orders", "{shopper}", `{"cart_id":"{cart}"}`, http.StatusConflict, `{"errors":"not enough stock available"}`},
+		{http.MethodGet, "/albums/3/stock", "", "", http.StatusOK, `{"format":"cd","on_hand":1,"reserved":1,"available":0,"status":"out_of_stock"}`},
+		{http.MethodPut, "/carts/{cart}/items", "", `{"album_id":1,"quantity":1}`, http.StatusOK, `"total":"76.98"`},
+		// Checkout needs a customer, and the cart to be theirs or anonymous
+		{http.MethodPut, "/orders", "", `{"cart_id":"{cart}"}`, http.StatusUnauthorized, `{"errors":"authentication required"}`},
+		{http.MethodPut, "/orders", "{staff}", `{"cart_id":"{cart}"}`, http.StatusForbidden, `{"errors":"staff have no customer account"}`},
+		{http.MethodPut, "/orders", "{buyer}", `{"cart_id":"{cart}"}`, http.StatusNotFound, `{"errors":"cart not found"}`},
+		{http.MethodPut, "/orders", "{shopper}", `{"cart_id":"{cart}"}`, http.StatusOK, `{"id":1,"customer_id":1,"status":"pending","currency":"USD","total":"76.98","items":[{"album_id":1,"title":"Blue Train","artist":"John Coltrane","quantity":1,"price":"56.99","subtotal":"56.99"},{"album_id":3,"title":"Jeru","artist":"Gerry Mulligan","quantity":1,"price":"19.99","subtotal":"19.99"}],"created_at":`},
+		{http.MethodGet, "/carts/{cart}", "", "", http.StatusNotFound, `{"errors":"cart not found"}`},
+		// The reserved CD was sold rather than the available vinyl
+		{http.MethodGet, "/albums/3/stock", "", "", http.StatusOK, `"formats":[{"format":"cd","on_hand":0,"reserved":0,"available":0,"status":"out_of_stock"},{"format":"vinyl","on_hand":1,"reserved":0,"available":1,"status":"low_stock"}]`},
+		{http.MethodGet, "/albums/1/stock", "", "", http.StatusOK, `{"format":"vinyl","on_hand":0,"reserved":0,"available":0,"status":"out_of_stock"}`},
+		{http.MethodPut, "/orders", "{shopper}", `{"cart_id":"{cart}"}`, http.StatusNotFound, `{"errors":"cart not found"}`},
+		{http.MethodPut, "/orders", "{shopper}", `{}`, http.StatusUnprocessableEntity, `"fields":{"cart_id":["is required"]}`},
+
+		// Orders keep the prices and details of checkout, and their albums
+		// while those are in the trash
+		{http.MethodPatch, "/albums/3", "", `{"price":"9.99"}`, http.StatusOK, `{"message":"album successfully updated"}`},
+		{http.MethodDelete, "/albums/1", "", "", http.StatusOK, `{"message":"album successfully removed"}`},
+		{http.MethodGet, "/orders/1", "{shopper}", "", http.StatusOK, `"total":"76.98","items":[{"album_id":1,"title":"Blue Train","artist":"John Coltrane","quantity":1,"price":"56.99","subtotal":"56.99"},{"album_id":3,"title":"Jeru","artist":"Gerry Mulligan","quantity":1,"price":"19.99","subtotal":"19.99"}]`},
+
+		// Orders move through pending, paid and shipped, or are cancelled.
+		// Customers can only cancel their own orders.
+		{http.MethodPatch, "/orders/1", "", `{"status":"paid"}`, http.StatusUnauthorized, `{"errors":"authentication required"}`},
+		{http.MethodPatch, "/orders/1", "{shopper}", `{"status":"paid"}`, http.StatusForbidden, `{"errors":"only staff can change an order to paid"}`},
+		{http.MethodPatch, "/orders/1", "{staff}", `{"status":"shipped"}`, http.StatusConflict, `{"errors":"invalid order status change from pending to shipped"}`},
+		{http.MethodPatch, "/orders/1", "{staff}", `{"status":"paid"}`, http.StatusOK, `"status":"paid"`},
+		{http.MethodPatch, "/orders/1", "{staff}", `{"status":"shipped"}`, http.StatusOK, `"status":"shipped"`},
+		{http.MethodPatch, "/orders/1", "{staff}", `{"status":"cancelled"}`, http.StatusConflict, `{"errors":"invalid order status change from shipped to cancelled"}`},
+		{http.MethodPatch, "/orders/1", "{staff}", `{"status":"lost"}`, http.StatusUnprocessableEntity, `"fields":{"status":["must be one of pending, paid, shipped, cancelled"]}`},
+		{http.MethodPatch, "/orders/99", "{staff}", `{"status":"paid"}`, http.StatusNotFound, `{"errors":"order not found"}`},
+
+		{http.MethodPut, "/carts/{other}/items", "", `{"album_id":7,"quantity":2}`, http.StatusOK, `"currency":"EUR","total":"40.00"`},
+		// An anonymous cart becomes the order of the customer checking it out
+		{http.MethodPut, "/orders", "{buyer}", `{"cart_id":"{other}"}`, http.StatusOK, `{"id":2,"customer_id":2,"status":"pending","currency":"EUR","total":"40.00"`},
+		{http.MethodGet, "/orders/2", "{shopper}", "", http.StatusNotFound, `{"errors":"order not found"}`},
+		{http.MethodPatch, "/orders/2", "{shopper}", `{"status":"cancelled"}`, http.StatusNotFound, `{"errors":"order not found"}`},
+		{http.MethodPatch, "/orders/2", "{staff}", `{"status":"paid"}`, http.StatusOK, `"status":"paid"`},
+		{http.MethodGet, "/albums/7/stock", "", "", http.StatusOK, `{"format":"cd","on_hand":0,`},
+		{http.MethodPatch, "/orders/2", "{staff}", `{"status":"cancelled"}`, http.StatusOK, `"status":"cancelled"`},
+		{http.MethodGet, "/albums/7/stock", "", "", http.StatusOK, `{"format":"cd","on_hand":2,`},
+		{http.MethodPut, "/carts/{mine}/items", "", `{"album_id":2}`, http.StatusOK, `"total":"63.99"`},
+		{http.MethodPut, "/orders", "{shopper}", `{"cart_id":"{mine}"}`, http.StatusOK, `{"id":3,"customer_id":1,"status":"pending"`},
+		{http.MethodGet, "/albums/2/stock", "", "", http.StatusOK, `{"format":"vinyl","on_hand":0,`},
+		// Cancelled orders put their copies back on the stock
+		{http.MethodPatch, "/orders/3", "{shopper}", `{"status":"cancelled"}`, http.StatusOK, `"status":"cancelled"`},
+		{http.MethodGet, "/albums/2/stock", "", "", http.StatusOK, `{"format":"vinyl","on_hand":1,"reserved":0,"available":1,`},
+		{http.MethodPatch, "/orders/1", "{shopper}", `{"status":"cancelled"}`, http.StatusConflict, `{"errors":"invalid order status change from shipped to cancelled"}`},
+
+		// Listings leave out the items
+		{http.MethodGet, "/orders", "{staff}", "", http.StatusOK, `{"data":[{"id":3,"customer_id":1,"status":"cancelled","currency":"USD","total":"63.99","created_at":`},
+		{http.MethodGet, "/orders?customer_id=1&status=shipped", "{staff}", "", http.StatusOK, `{"data":[{"id":1,"customer_id":1,"status":"shipped","currency":"USD","total":"76.98","created_at":`},
+		// Customers list their own orders
+		{http.MethodGet, "/orders", "", "", http.StatusUnauthorized, `{"errors":"authentication required"}`},
+		{http.MethodGet, "/orders?status=shipped", "{shopper}", "", http.StatusOK, `{"data":[{"id":1,"customer_id":1,"status":"shipped"`},
+		{http.MethodGet, "/orders?status=pending", "{shopper}", "", http.StatusOK, `{"data":[],"next":null}`},
+		{http.MethodGet, "/orders?customer_id=2", "{shopper}", "", http.StatusForbidden, `{"errors":"only staff can list the orders of other customers"}`},
+		{http.MethodGet, "/orders/1", "", "", http.StatusUnauthorized, `{"errors":"authentication required"}`},
+		{http.MethodGet, "/orders?status=shipped", "{staff}", "", http.StatusOK, `"next":null}`},
+		{http.MethodGet, "/orders?status=paid", "{staff}", "", http.StatusOK, `{"data":[],"next":null}`},
+		{http.MethodGet, "/orders?status=lost", "{staff}", "", http.StatusBadRequest, `{"errors":"status must be one of pending, paid, shipped, cancelled"}`},
+		{http.MethodGet, "/orders?customer_id=x", "{staff}", "", http.StatusBadRequest, `{"errors":"invalid customer_id"}`},
+		{http.MethodGet, "/orders?cursor=x", "{staff}", "", http.StatusBadRequest, `{"errors":"invalid cursor"}`},
+		{http.MethodGet, "/orders/99", "{staff}", "", http.StatusNotFound, `{"errors":"order not found"}`},
+		{http.MethodGet, "/orders/x", "{staff}", "", http.StatusBadRequest, `{"errors":"invalid order id"}`},
+	}
+
+	for _, tt := range tests {
+		url, body := tt.url, tt.body
+		for name, id := range carts {
+			url, body = strings.ReplaceAll(url, name, id), strings.ReplaceAll(body, name, id)
+		}
+
+		rr := authRequest(router, tt.method, url, body, tokens[tt.as])
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("%v %v returned wrong status code: got %v want %v", tt.method, tt.url, status, tt.expectedCode)
+		}
+
+		if actual := strings.TrimSpace(rr.Body.String()); !strings.Contains(actual, tt.expected) {
+			t.Errorf("%v %v returned unexpected body: got %v want %v", tt.method, tt.url, actual, tt.expected)
+		}
+	}
+
+	// Orders are listed newest first, a page at a time
+	var page struct {
+		Data []struct{ ID int64 }
+		Next *string
+	}
+	rr := authRequest(router, http.MethodGet, "/orders?limit=2", "", staffToken)
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil || len(page.Data) != 2 || page.Data[1].ID != 2 || page.Next == nil {
+		t.Fatalf("Unexpected first page %v: %v", rr.Body, err)
+	}
+	rr = authRequest(router, http.MethodGet, "/orders?limit=2&cursor="+url.QueryEscape(*page.Next), "", staffToken)
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil || len(page.Data) != 1 || page.Data[0].ID != 1 || page.Next != nil {
+		t.Errorf("Unexpected second page %v: %v", rr.Body, err)
+	}
+}
+
+func TestCheckoutConcurrency_MemoryStore(t *testing.T) {
+	testCheckoutConcurrency(t, NewMemoryStore(queryAlbums...))
+}
+
+func TestCheckoutConcurrency_SQLite(t *testing.T) {
+	testCheckoutConcurrency(t, querySQLiteStore(t))
+}
+
+// testCheckoutConcurrency checks out one cart many times at once, and checks
+// that it was ordered, and its copy taken off the stock, exactly once.
+func testCheckoutConcurrency(t *testing.T, store Backend) {
+	t.Helper()
+
+	const attempts = 10
+
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	cart, err := store.CreateCart(ctx, Cart{ID: strings.Repeat("ab", 16), CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		t.Fatalf("Failed to create cart: %v", err)
+	}
+	if err := store.SetCartItem(ctx, cart.ID, 2, 1, now); err != nil {
+		t.Fatalf("Failed to fill cart: %v", err)
+	}
+	if _, err := store.AdjustStock(ctx, 2, "cd", 1, now); err != nil {
+		t.Fatalf("Failed to stock album: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan error, attempts)
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.Checkout(ctx, cart.ID, 1, now)
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	var succeeded int
+	for err := range results {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrCartNotFound):
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("Expected the cart to be checked out once, got %v", succeeded)
+	}
+
+	orders, err := store.ListOrders(ctx, OrderQuery{Limit: attempts})
+	if err != nil || len(orders) != 1 {
+		t.Errorf("Expected one order, got %v: %v", orders, err)
+	}
+
+	stock, err := store.Stock(ctx, []int64{2}, now)
+	if err != nil || len(stock[2]) != 1 || stock[2][0].OnHand != 0 {
+		t.Errorf("Expected the copy to be taken off the stock once, got %v: %v", stock, err)
+	}
+}
+
+func shopRequest(router http.Handler, method, url, body string) *httptest.ResponseRecorder {
+	return authRequest(router, method, url, body, "")
+}
+
+// authRequest sends a request with a JSON body, authenticated with token
+// unless it is empty.
+func authRequest(router http.Handler, method, url, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	return rr
+}
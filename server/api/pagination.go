@@ -0,0 +1,246 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go-web-service/money"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Page selects a window of albums in query order. After and Before are
+// exclusive bounds taken from a cursor, holding an album's value for each key
+// of the order; at most one of them is set. With Before the window is the
+// Limit albums closest to it, still returned in query order.
+type Page struct {
+	Limit  int
+	After  []any
+	Before []any
+}
+
+// AlbumPage is the envelope album listings are served in. Next and Prev are
+// opaque cursors for the neighbouring pages and are null at either end. Total
+// is only counted when the request asks for it with total=true.
+type AlbumPage struct {
+	Data  []Album `json:"data"`
+	Next  *string `json:"next"`
+	Prev  *string `json:"prev"`
+	Total *int64  `json:"total,omitempty"`
+	// Facets holds the counts asked for with facets=, over the same filters
+	// as the page but across every page.
+	Facets map[string][]FacetBucket `json:"facets,omitempty"`
+}
+
+// listRequest is the query and page a listing request asked for.
+type listRequest struct {
+	AlbumQuery
+	// sort is the raw sort parameter. Cursors carry it so they are not
+	// reused with a different order.
+	sort    string
+	Total   bool
+	Facets  []string
+	Include includes
+}
+
+// listInput reads the filters, sort, limit, cursor, total, facets and include
+// query parameters. It writes a 400 response and returns false when they are invalid.
+func listInput(w http.ResponseWriter, r *http.Request) (listRequest, bool) {
+	parameters := r.URL.Query()
+	request := listRequest{sort: parameters.Get("sort")}
+	request.Page.Limit = defaultPageLimit
+
+	var err error
+	if request.Filters, err = parseFilters(parameters, "limit", "cursor", "total", "sort", "facets", "include"); err != nil {
+		ServeJSONError(w, err.Error(), http.StatusBadRequest)
+		return request, false
+	}
+
+	if request.Sort, err = parseSort(request.sort); err != nil {
+		ServeJSONError(w, err.Error(), http.StatusBadRequest)
+		return request, false
+	}
+
+	if limit := parameters.Get("limit"); limit != "" {
+		if request.Page.Limit, err = parseLimit(limit); err != nil {
+			ServeJSONError(w, err.Error(), http.StatusBadRequest)
+			return request, false
+		}
+	}
+
+	if cursor := parameters.Get("cursor"); cursor != "" {
+		if err := request.decodeCursor(cursor); err != nil {
+			ServeJSONError(w, err.Error(), http.StatusBadRequest)
+			return request, false
+		}
+	}
+
+	if total := parameters.Get("total"); total != "" {
+		if request.Total, err = strconv.ParseBool(total); err != nil {
+			ServeJSONError(w, "total must be true or false", http.StatusBadRequest)
+			return request, false
+		}
+	}
+
+	if request.Facets, err = parseFacets(parameters.Get("facets")); err != nil {
+		ServeJSONError(w, err.Error(), http.StatusBadRequest)
+		return request, false
+	}
+
+	if request.Include, err = parseInclude(parameters.Get("include")); err != nil {
+		ServeJSONError(w, err.Error(), http.StatusBadRequest)
+		return request, false
+	}
+
+	return request, true
+}
+
+// parseLimit reads a limit query parameter.
+func parseLimit(limit string) (int, error) {
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 || n > maxPageLimit {
+		return 0, fmt.Errorf("limit must be a number between 1 and %d", maxPageLimit)
+	}
+
+	return n, nil
+}
+
+// query returns the query to run against the store. It fetches one album more
+// than requested so newPage can tell whether there is another page beyond it.
+func (l listRequest) query() AlbumQuery {
+	query := l.AlbumQuery
+	query.Page.Limit++
+
+	return query
+}
+
+// paged reports whether the request came with a cursor.
+func (l listRequest) paged() bool {
+	return l.Page.After != nil || l.Page.Before != nil
+}
+
+// newPage builds the envelope from albums fetched with l.query().
+func (l listRequest) newPage(albums []Album) AlbumPage {
+	backwards := l.Page.Before != nil
+
+	more := len(albums) > l.Page.Limit
+	if more {
+		if backwards {
+			albums = albums[1:]
+		} else {
+			albums = albums[:l.Page.Limit]
+		}
+	}
+
+	page := AlbumPage{Data: albums}
+	if len(albums) == 0 {
+		page.Data = []Album{}
+		return page
+	}
+
+	order := l.order()
+
+	if more || backwards {
+		next := l.encodeCursor(cursor{After: formatKey(albumKey(albums[len(albums)-1], order))})
+		page.Next = &next
+	}
+	if (more && backwards) || l.Page.After != nil {
+		prev := l.encodeCursor(cursor{Before: formatKey(albumKey(albums[0], order))})
+		page.Prev = &prev
+	}
+
+	return page
+}
+
+// cursor is the decoded form of the opaque cursors in an AlbumPage.
+type cursor struct {
+	Sort   string   `json:"s,omitempty"`
+	After  []string `json:"a,omitempty"`
+	Before []string `json:"b,omitempty"`
+}
+
+func (l listRequest) encodeCursor(c cursor) string {
+	c.Sort = l.sort
+	data, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor sets the page bounds from an encoded cursor.
+func (l *listRequest) decodeCursor(encoded string) error {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return errInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return errInvalidCursor
+	}
+
+	if c.Sort != l.sort {
+		return errors.New("cursor was issued for a different sort")
+	}
+
+	if (c.After == nil) == (c.Before == nil) {
+		return errInvalidCursor
+	}
+
+	order := l.order()
+	if l.Page.After, err = parseKey(c.After, order); err != nil {
+		return err
+	}
+	if l.Page.Before, err = parseKey(c.Before, order); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func formatKey(key []any) []string {
+	formatted := make([]string, len(key))
+	for i, value := range key {
+		switch value := value.(type) {
+		case int64:
+			formatted[i] = strconv.FormatInt(value, 10)
+		case string:
+			formatted[i] = value
+		case money.Money:
+			formatted[i] = value.String()
+		case Rating:
+			formatted[i] = value.String()
+		}
+	}
+
+	return formatted
+}
+
+func parseKey(values []string, order []SortKey) ([]any, error) {
+	if values == nil {
+		return nil, nil
+	}
+	if len(values) != len(order) {
+		return nil, errInvalidCursor
+	}
+
+	key := make([]any, len(values))
+	for i, value := range values {
+		parsed, err := albumFields[order[i].Field].parse(value)
+		if err != nil {
+			return nil, errInvalidCursor
+		}
+
+		key[i] = parsed
+	}
+
+	return key, nil
+}
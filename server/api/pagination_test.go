@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-web-service/migrations"
+	"go-web-service/money"
+	"go-web-service/utils"
+)
+
+func TestPagination_MemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	for i := 1; i <= 5; i++ {
+		_, _ = store.Create(context.Background(), Album{Title: fmt.Sprint("Album", i), Artist: "Artist", Price: money.New(999, "USD")})
+	}
+
+	testPagination(t, NewAlbums(store))
+}
+
+func TestPagination_SQLite(t *testing.T) {
+	t.Setenv("DATABASE_DRIVER", "sqlite")
+	t.Setenv("DATABASE_PATH", filepath.Join(t.TempDir(), "recordings.db"))
+
+	db, err := utils.DatabaseInit()
+	if err != nil {
+		t.Fatalf("Failed to open sqlite database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := (&migrations.Migrator{Db: db, Driver: "sqlite"}).Up(context.Background()); err != nil {
+		t.Fatalf("Failed to migrate sqlite database: %v", err)
+	}
+
+	// The seed data has the five albums the walk expects
+	testPagination(t, NewAlbums(&SQLStore{Db: db, Driver: "sqlite"}))
+}
+
+// testPagination walks five albums in pages of two, forwards and then back.
+func testPagination(t *testing.T, albums *Albums) {
+	t.Helper()
+
+	first := listAlbums(t, albums, "/albums?limit=2&total=true")
+	if albumIDs(first) != "1,2" || first.Prev != nil || first.Next == nil {
+		t.Fatalf("Unexpected first page: %v", albumIDs(first))
+	}
+	if first.Total == nil || *first.Total != 5 {
+		t.Errorf("Expected a total of 5, got %v", first.Total)
+	}
+
+	second := listAlbums(t, albums, "/albums?limit=2&cursor="+*first.Next)
+	if albumIDs(second) != "3,4" || second.Prev == nil || second.Next == nil {
+		t.Fatalf("Unexpected second page: %v", albumIDs(second))
+	}
+	if second.Total != nil {
+		t.Errorf("Expected no total unless asked for, got %v", *second.Total)
+	}
+
+	last := listAlbums(t, albums, "/albums?limit=2&cursor="+*second.Next)
+	if albumIDs(last) != "5" || last.Prev == nil || last.Next != nil {
+		t.Fatalf("Unexpected last page: %v", albumIDs(last))
+	}
+
+	back := listAlbums(t, albums, "/albums?limit=2&cursor="+*last.Prev)
+	if albumIDs(back) != "3,4" || back.Prev == nil || back.Next == nil {
+		t.Fatalf("Unexpected page walking back: %v", albumIDs(back))
+	}
+
+	back = listAlbums(t, albums, "/albums?limit=2&cursor="+*back.Prev)
+	if albumIDs(back) != "1,2" || back.Prev != nil || back.Next == nil {
+		t.Fatalf("Unexpected page walking back to the start: %v", albumIDs(back))
+	}
+}
+
+func TestPagination_InvalidInput(t *testing.T) {
+	albums := NewAlbums(NewMemoryStore())
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"/albums?limit=0", `{"errors":"limit must be a number between 1 and 100"}`},
+		{"/albums?limit=101", `{"errors":"limit must be a number between 1 and 100"}`},
+		{"/albums?limit=ten", `{"errors":"limit must be a number between 1 and 100"}`},
+		{"/albums?cursor=not-a-cursor", `{"errors":"invalid cursor"}`},
+		{"/albums?cursor=" + listRequest{}.encodeCursor(cursor{After: []string{"three"}}), `{"errors":"invalid cursor"}`},
+		{"/albums?sort=title&cursor=" + listRequest{}.encodeCursor(cursor{After: []string{"3"}}), `{"errors":"cursor was issued for a different sort"}`},
+		{"/albums?total=maybe", `{"errors":"total must be true or false"}`},
+		{"/albums/artist/Coltrane?limit=0", `{"errors":"limit must be a number between 1 and 100"}`},
+	}
+
+	for _, tt := range tests {
+		handler := albums.GetAlbums
+		if strings.HasPrefix(tt.url, "/albums/artist/") {
+			handler = albums.GetAlbumsByArtist
+		}
+
+		rr := sendMockHTTPRequest(t, handler, http.MethodGet, tt.url)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("%v returned wrong status code: got %v want %v", tt.url, status, http.StatusBadRequest)
+		}
+
+		actual := strings.TrimSpace(rr.Body.String())
+		if actual != tt.expected {
+			t.Errorf("%v returned unexpected body: got %v want %v", tt.url, actual, tt.expected)
+		}
+	}
+}
+
+func TestGetAlbumsByArtist_Pages(t *testing.T) {
+	albums := NewAlbums(NewMemoryStore(
+		Album{Title: "Blue Train", Artist: "John Coltrane", Price: money.New(5699, "USD")},
+		Album{Title: "Jeru", Artist: "Gerry Mulligan", Price: money.New(1799, "USD")},
+		Album{Title: "Giant Steps", Artist: "John Coltrane", Price: money.New(6399, "USD")},
+	))
+
+	rr := sendMockHTTPRequest(t, albums.GetAlbumsByArtist, http.MethodGet, "/albums/artist/coltrane?limit=1&total=true")
+
+	next := listRequest{}.encodeCursor(cursor{After: []string{"1"}})
+	expected := `{"data":[{"id":1,"title":"Blue Train","artist":"John Coltrane","artist_id":1,"price":"56.99","review_count":0,"average_rating":null,"currency":"USD"}],"next":"` + next + `","prev":null,"total":2}`
+	if actual := strings.TrimSpace(rr.Body.String()); actual != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
+	}
+
+	rr = sendMockHTTPRequest(t, albums.GetAlbumsByArtist, http.MethodGet, "/albums/artist/coltrane?limit=1&cursor="+next)
+
+	prev := listRequest{}.encodeCursor(cursor{Before: []string{"3"}})
+	expected = `{"data":[{"id":3,"title":"Giant Steps","artist":"John Coltrane","artist_id":1,"price":"63.99","review_count":0,"average_rating":null,"currency":"USD"}],"next":null,"prev":"` + prev + `"}`
+	if actual := strings.TrimSpace(rr.Body.String()); actual != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
+	}
+
+	// Paging past the last match is an empty page rather than a 404
+	rr = sendMockHTTPRequest(t, albums.GetAlbumsByArtist, http.MethodGet, "/albums/artist/coltrane?cursor="+listRequest{}.encodeCursor(cursor{After: []string{"3"}}))
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+}
@@ -0,0 +1,344 @@
+package api
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go-web-service/money"
+)
+
+// Operator compares an album field with one or more filter values.
+type Operator string
+
+const (
+	OpEq       Operator = "eq"
+	OpNeq      Operator = "neq"
+	OpLt       Operator = "lt"
+	OpLte      Operator = "lte"
+	OpGt       Operator = "gt"
+	OpGte      Operator = "gte"
+	OpContains Operator = "contains"
+	OpIn       Operator = "in"
+)
+
+// maxInValues bounds the values of an in filter, and so the size of its IN list.
+const maxInValues = 50
+
+// Filter keeps the albums whose Field compares to Values with Operator. Only
+// OpIn takes more than one value. Values have the type the field parses to.
+type Filter struct {
+	Field    string
+	Operator Operator
+	Values   []any
+}
+
+// SortKey orders albums by Field, descending when Desc is set.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// AlbumQuery selects, orders and pages albums. Albums are always ordered by
+// id after the Sort keys, so every album has a unique position.
+type AlbumQuery struct {
+	Filters []Filter
+	Sort    []SortKey
+	Page    Page
+}
+
+// albumField describes an album field that can be filtered and sorted on.
+type albumField struct {
+	column string
+	// text fields support contains and compare as strings.
+	text bool
+	// parse reads a filter or cursor value into the type value returns.
+	parse func(string) (any, error)
+	value func(Album) any
+	// label fields match albums by the names of their genres or tags. They
+	// have no value and only filter, with eq, neq and in.
+	label LabelKind
+}
+
+// albumFields whitelists the fields of the query language. Only these column
+// names ever reach SQL; every value is passed as a parameter.
+var albumFields = map[string]albumField{
+	"id":             {column: "id", parse: parseID, value: func(a Album) any { return a.ID }},
+	"title":          {column: "title", text: true, parse: parseText, value: func(a Album) any { return a.Title }},
+	"artist":         {column: "artist", text: true, parse: parseText, value: func(a Album) any { return a.Artist }},
+	"artist_id":      {column: "artist_id", parse: parseID, value: func(a Album) any { return a.ArtistID }},
+	"currency":       {column: "currency", text: true, parse: parseText, value: func(a Album) any { return a.Price.Currency }},
+	"label":          {column: "label", text: true, parse: parseText, value: func(a Album) any { return a.RecordLabel }},
+	"format":         {column: "format", text: true, parse: parseText, value: func(a Album) any { return a.Format }},
+	"catalog_number": {column: "catalog_number", text: true, parse: parseText, value: func(a Album) any { return a.CatalogNumber }},
+	"genre":          {label: LabelGenre, parse: parseLabel},
+	"tag":            {label: LabelTag, parse: parseLabel},
+	// Prices compare as plain numbers with two decimals, the way the
+	// DECIMAL(5, 2) column stores them, whatever their currency.
+	"price": {
+		column: "price",
+		parse: func(s string) (any, error) {
+			return money.Parse(s, DefaultCurrency)
+		},
+		value: func(a Album) any {
+			amount, _ := a.Price.Rescale(2)
+			return money.New(amount, DefaultCurrency)
+		},
+	},
+	// Albums without reviews rate 0, below any reviewed album.
+	"rating": {
+		column: "average_rating",
+		parse:  parseRating,
+		value: func(a Album) any {
+			if a.AverageRating == nil {
+				return Rating(0)
+			}
+			return *a.AverageRating
+		},
+	},
+}
+
+func parseText(s string) (any, error) {
+	return s, nil
+}
+
+// parseLabel reads a genre or tag name into the key names compare by.
+func parseLabel(s string) (any, error) {
+	return nameKey(s), nil
+}
+
+func parseID(s string) (any, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// order returns the sort keys with the id tie-breaker appended.
+func (q AlbumQuery) order() []SortKey {
+	for _, key := range q.Sort {
+		if key.Field == "id" {
+			return q.Sort
+		}
+	}
+
+	return append(slices.Clip(q.Sort), SortKey{Field: "id"})
+}
+
+// apply runs the query over albums in memory, for stores without SQL.
+func (q AlbumQuery) apply(albums []Album) []Album {
+	order := q.order()
+
+	var kept []Album
+	for _, album := range albums {
+		if !q.match(album) {
+			continue
+		}
+		if q.Page.After != nil && compareKey(album, order, q.Page.After) <= 0 {
+			continue
+		}
+		if q.Page.Before != nil && compareKey(album, order, q.Page.Before) >= 0 {
+			continue
+		}
+
+		kept = append(kept, album)
+	}
+
+	slices.SortFunc(kept, func(a, b Album) int {
+		return compareKey(a, order, albumKey(b, order))
+	})
+
+	if q.Page.Limit > 0 && len(kept) > q.Page.Limit {
+		if q.Page.Before != nil {
+			return kept[len(kept)-q.Page.Limit:]
+		}
+		return kept[:q.Page.Limit]
+	}
+
+	return kept
+}
+
+// match reports whether album passes every filter.
+func (q AlbumQuery) match(album Album) bool {
+	for _, filter := range q.Filters {
+		if !filter.match(album) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f Filter) match(album Album) bool {
+	value := albumFields[f.Field].value(album)
+
+	switch f.Operator {
+	case OpContains:
+		// LIKE is case-insensitive on the default MySQL collation, so match that here.
+		return strings.Contains(strings.ToLower(value.(string)), strings.ToLower(f.Values[0].(string)))
+	case OpIn:
+		return slices.ContainsFunc(f.Values, func(v any) bool { return compareValues(value, v) == 0 })
+	}
+
+	c := compareValues(value, f.Values[0])
+	switch f.Operator {
+	case OpEq:
+		return c == 0
+	case OpNeq:
+		return c != 0
+	case OpLt:
+		return c < 0
+	case OpLte:
+		return c <= 0
+	case OpGt:
+		return c > 0
+	case OpGte:
+		return c >= 0
+	}
+
+	return false
+}
+
+// albumKey returns the album's values for each key of order.
+func albumKey(album Album, order []SortKey) []any {
+	key := make([]any, len(order))
+	for i, sortKey := range order {
+		key[i] = albumFields[sortKey.Field].value(album)
+	}
+
+	return key
+}
+
+// compareKey compares the album's position in order with key.
+func compareKey(album Album, order []SortKey, key []any) int {
+	for i, sortKey := range order {
+		c := compareValues(albumFields[sortKey.Field].value(album), key[i])
+		if sortKey.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+func compareValues(a, b any) int {
+	switch a := a.(type) {
+	case int64:
+		return cmp.Compare(a, b.(int64))
+	case string:
+		return strings.Compare(a, b.(string))
+	case money.Money:
+		return cmp.Compare(a.Amount, b.(money.Money).Amount)
+	case Rating:
+		return cmp.Compare(a, b.(Rating))
+	}
+
+	panic(fmt.Sprintf("compareValues: unsupported type %T", a))
+}
+
+// filterParameter matches filter query parameters such as price[gte].
+var filterParameter = regexp.MustCompile(`^(\w+)(?:\[(\w+)\])?$`)
+
+// parseFilters reads every filter in parameters, skipping the names in
+// reserved. A parameter without an operator, such as title=Jeru, means eq.
+func parseFilters(parameters url.Values, reserved ...string) ([]Filter, error) {
+	var names []string
+	for name := range parameters {
+		if !slices.Contains(reserved, name) {
+			names = append(names, name)
+		}
+	}
+	// Map order is random; keep filters, and so the generated SQL, stable
+	slices.Sort(names)
+
+	var filters []Filter
+	for _, name := range names {
+		match := filterParameter.FindStringSubmatch(name)
+		if match == nil {
+			return nil, fmt.Errorf("unknown query parameter '%v'", name)
+		}
+
+		field, ok := albumFields[match[1]]
+		if !ok {
+			return nil, fmt.Errorf("unknown query parameter '%v'", name)
+		}
+
+		operator := OpEq
+		if match[2] != "" {
+			operator = Operator(match[2])
+		}
+
+		switch operator {
+		case OpEq, OpNeq, OpIn:
+		case OpLt, OpLte, OpGt, OpGte:
+			if field.label != "" {
+				return nil, fmt.Errorf("'%v' does not support %v", match[1], operator)
+			}
+		case OpContains:
+			if !field.text {
+				return nil, fmt.Errorf("'%v' does not support contains", match[1])
+			}
+		default:
+			return nil, fmt.Errorf("unknown operator '%v' for '%v'", match[2], match[1])
+		}
+
+		for _, value := range parameters[name] {
+			values := []string{value}
+			if operator == OpIn {
+				values = strings.Split(value, ",")
+				if len(values) > maxInValues {
+					return nil, fmt.Errorf("'%v' takes at most %d values", name, maxInValues)
+				}
+			}
+
+			filter := Filter{Field: match[1], Operator: operator}
+			for _, v := range values {
+				parsed, err := field.parse(v)
+				if err != nil {
+					return nil, fmt.Errorf("'%v' has an invalid value '%v'", name, v)
+				}
+
+				filter.Values = append(filter.Values, parsed)
+			}
+
+			filters = append(filters, filter)
+		}
+	}
+
+	return filters, nil
+}
+
+var errSortField = errors.New("sort must be a comma separated list of fields, each optionally prefixed with '-'")
+
+// parseSort reads a sort parameter such as "-price,title".
+func parseSort(sort string) ([]SortKey, error) {
+	if sort == "" {
+		return nil, nil
+	}
+
+	var keys []SortKey
+	seen := map[string]bool{}
+	for _, name := range strings.Split(sort, ",") {
+		key := SortKey{Field: strings.TrimPrefix(name, "-"), Desc: strings.HasPrefix(name, "-")}
+
+		if field, ok := albumFields[key.Field]; !ok || field.label != "" {
+			if key.Field == "" {
+				return nil, errSortField
+			}
+			return nil, fmt.Errorf("cannot sort by '%v'", key.Field)
+		}
+		if seen[key.Field] {
+			return nil, fmt.Errorf("cannot sort by '%v' more than once", key.Field)
+		}
+		seen[key.Field] = true
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go-web-service/migrations"
+	"go-web-service/money"
+	"go-web-service/utils"
+)
+
+// queryAlbums are the albums of the sqlite seed data followed by two more
+// with repeated prices and LIKE wildcards in the title.
+var queryAlbums = []Album{
+	{Title: "Blue Train", Artist: "John Coltrane", Price: money.MustParse("56.99", "USD")},
+	{Title: "Giant Steps", Artist: "John Coltrane", Price: money.MustParse("63.99", "USD")},
+	{Title: "Jeru", Artist: "Gerry Mulligan", Price: money.MustParse("17.99", "USD")},
+	{Title: "Sarah Vaughan", Artist: "Sarah Vaughan", Price: money.MustParse("34.98", "USD")},
+	{Title: "F-1 Trillion", Artist: "Post Malone", Price: money.MustParse("24.99", "USD")},
+	{Title: "Ballads", Artist: "John Coltrane", Price: money.MustParse("17.99", "USD")},
+	{Title: "100%_Pure", Artist: "Various", Price: money.MustParse("24.99", "USD")},
+}
+
+func TestAlbumQuery_MemoryStore(t *testing.T) {
+	testAlbumQuery(t, NewAlbums(NewMemoryStore(queryAlbums...)))
+}
+
+func TestAlbumQuery_SQLite(t *testing.T) {
+	testAlbumQuery(t, NewAlbums(querySQLiteStore(t)))
+}
+
+// querySQLiteStore returns a migrated SQLite store holding queryAlbums.
+func querySQLiteStore(t *testing.T) *SQLStore {
+	t.Helper()
+
+	t.Setenv("DATABASE_DRIVER", "sqlite")
+	t.Setenv("DATABASE_PATH", filepath.Join(t.TempDir(), "recordings.db"))
+
+	db, err := utils.DatabaseInit()
+	if err != nil {
+		t.Fatalf("Failed to open sqlite database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := (&migrations.Migrator{Db: db, Driver: "sqlite"}).Up(context.Background()); err != nil {
+		t.Fatalf("Failed to migrate sqlite database: %v", err)
+	}
+
+	store := &SQLStore{Db: db, Driver: "sqlite"}
+	for _, album := range queryAlbums[5:] {
+		if _, err := store.Create(context.Background(), album); err != nil {
+			t.Fatalf("Failed to create album: %v", err)
+		}
+	}
+
+	return store
+}
+
+func testAlbumQuery(t *testing.T, albums *Albums) {
+	t.Helper()
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"/albums?artist=John+Coltrane", "1,2,6"},
+		{"/albums?artist[eq]=John+Coltrane&title[neq]=Ballads", "1,2"},
+		{"/albums?price[gte]=20&price[lt]=60", "1,4,5,7"},
+		{"/albums?price[gt]=24.99&price[lte]=56.99", "1,4"},
+		{"/albums?title[contains]=blue", "1"},
+		{"/albums?title[contains]=%25_", "7"},
+		{"/albums?artist[in]=Gerry+Mulligan,Post+Malone", "3,5"},
+		{"/albums?currency=EUR", ""},
+		{"/albums?artist[neq]=John+Coltrane&sort=-price,title", "4,7,5,3"},
+		{"/albums?sort=price,-id", "6,3,7,5,4,1,2"},
+		{"/albums?sort=-title&limit=3", "4,3,2"},
+	}
+
+	for _, tt := range tests {
+		if actual := listAlbumIDs(t, albums, tt.url); actual != tt.expected {
+			t.Errorf("%v returned unexpected albums: got %v want %v", tt.url, actual, tt.expected)
+		}
+	}
+
+	// Walking a multi-key sort a page at a time visits every album once, in order
+	var forwards []string
+	url := "/albums?sort=-price,title&limit=2"
+	page := listAlbums(t, albums, url)
+	for {
+		forwards = append(forwards, albumIDs(page))
+		if page.Next == nil {
+			break
+		}
+		page = listAlbums(t, albums, url+"&cursor="+*page.Next)
+	}
+
+	if actual := strings.Join(forwards, ","); actual != "2,1,4,7,5,6,3" {
+		t.Errorf("Unexpected albums paging forwards: got %v", actual)
+	}
+
+	var backwards []string
+	for page.Prev != nil {
+		page = listAlbums(t, albums, url+"&cursor="+*page.Prev)
+		backwards = append([]string{albumIDs(page)}, backwards...)
+	}
+
+	if actual := strings.Join(backwards, ","); actual != "2,1,4,7,5,6" {
+		t.Errorf("Unexpected albums paging backwards: got %v", actual)
+	}
+}
+
+type albumListing struct {
+	Data []struct {
+		ID int64 `json:"id"`
+	} `json:"data"`
+	Next  *string `json:"next"`
+	Prev  *string `json:"prev"`
+	Total *int64  `json:"total"`
+}
+
+func listAlbums(t *testing.T, albums *Albums, url string) albumListing {
+	t.Helper()
+
+	rr := sendMockHTTPRequest(t, albums.GetAlbums, http.MethodGet, url)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("%v returned wrong status code: got %v want %v: %v", url, status, http.StatusOK, rr.Body.String())
+	}
+
+	var listing albumListing
+	if err := json.Unmarshal(rr.Body.Bytes(), &listing); err != nil {
+		t.Fatalf("Failed to decode page: %v", err)
+	}
+
+	return listing
+}
+
+func listAlbumIDs(t *testing.T, albums *Albums, url string) string {
+	t.Helper()
+
+	return albumIDs(listAlbums(t, albums, url))
+}
+
+func albumIDs(listing albumListing) string {
+	var ids []string
+	for _, album := range listing.Data {
+		ids = append(ids, fmt.Sprint(album.ID))
+	}
+
+	return strings.Join(ids, ",")
+}
+
+func TestAlbumQuery_SQL(t *testing.T) {
+	db, mock := getMockDB(t)
+	defer db.Close()
+
+	price := money.MustParse("20", DefaultCurrency)
+	mock.ExpectPrepare(`SELECT id, title, artist, artist_id, currency, price, release_date, label, format, catalog_number, barcode, review_count, average_rating, version FROM album `+
+		`WHERE deleted_at IS NULL AND artist IN \(\?, \?\) AND price >= \? AND title LIKE \? ESCAPE '!' `+
+		`AND \(\(price < \?\) OR \(price = \? AND title > \?\) OR \(price = \? AND title = \? AND id > \?\)\) `+
+		`ORDER BY price DESC, title, id LIMIT \?`).
+		ExpectQuery().
+		WithArgs("A", "B", "20.00", "%50!%!_off%", "30.00", "30.00", "Jeru", "30.00", "Jeru", 3, 11).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "artist", "artist_id", "currency", "price", "release_date", "label", "format", "catalog_number", "barcode", "review_count", "average_rating", "version"}))
+
+	albums := &Albums{Store: &SQLStore{Db: db}}
+	request := listRequest{sort: "-price,title"}
+	cursor := request.encodeCursor(cursor{After: []string{"30.00", "Jeru", "3"}})
+
+	rr := sendMockHTTPRequest(t, albums.GetAlbums, http.MethodGet,
+		"/albums?artist[in]=A,B&price[gte]="+price.String()+"&title[contains]=50%25_off&sort=-price,title&limit=10&cursor="+cursor)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %v", err)
+	}
+}
+
+func TestAlbumQuery_InvalidInput(t *testing.T) {
+	albums := NewAlbums(NewMemoryStore())
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"/albums?publisher=Blue+Note", `{"errors":"unknown query parameter 'publisher'"}`},
+		{"/albums?title[like]=Blue", `{"errors":"unknown operator 'like' for 'title'"}`},
+		{"/albums?price[contains]=9", `{"errors":"'price' does not support contains"}`},
+		{"/albums?price[gte]=cheap", `{"errors":"'price[gte]' has an invalid value 'cheap'"}`},
+		{"/albums?id[in]=1,two", `{"errors":"'id[in]' has an invalid value 'two'"}`},
+		{"/albums?id[in]=" + strings.Repeat("1,", maxInValues) + "1", `{"errors":"'id[in]' takes at most 50 values"}`},
+		{"/albums?sort=publisher", `{"errors":"cannot sort by 'publisher'"}`},
+		{"/albums?sort=title,-title", `{"errors":"cannot sort by 'title' more than once"}`},
+		{"/albums?sort=title,", `{"errors":"sort must be a comma separated list of fields, each optionally prefixed with '-'"}`},
+	}
+
+	for _, tt := range tests {
+		rr := sendMockHTTPRequest(t, albums.GetAlbums, http.MethodGet, tt.url)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("%v returned wrong status code: got %v want %v", tt.url, status, http.StatusBadRequest)
+		}
+
+		actual := strings.TrimSpace(rr.Body.String())
+		if actual != tt.expected {
+			t.Errorf("%v returned unexpected body: got %v want %v", tt.url, actual, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// maxBodyBytes caps the size of JSON request bodies.
+const maxBodyBytes = 1 << 20
+
+// isJSON reports whether the request declares a JSON body.
+func isJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	return err == nil && mediaType == "application/json"
+}
+
+// decodeJSON decodes the request body into dst. The body must hold exactly
+// one JSON object whose fields all exist on dst. Errors are written for
+// clients to read.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(dst)
+	if err == nil {
+		if decoder.Decode(&struct{}{}) != io.EOF {
+			return errors.New("request body must contain a single JSON object")
+		}
+
+		return nil
+	}
+
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	var maxBytesError *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return errors.New("request body must not be empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("request body contains malformed JSON")
+	case errors.As(err, &syntaxError):
+		return fmt.Errorf("request body contains malformed JSON at position %d", syntaxError.Offset)
+	case errors.As(err, &typeError):
+		if typeError.Field == "" {
+			return errors.New("request body must be a JSON object")
+		}
+		return fmt.Errorf("'%v' must be a %v", typeError.Field, jsonTypeName(typeError.Type.String()))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return fmt.Errorf("unknown field %v", strings.TrimPrefix(err.Error(), "json: unknown field "))
+	case errors.As(err, &maxBytesError):
+		return fmt.Errorf("request body must not be larger than %d bytes", maxBytesError.Limit)
+	default:
+		return err
+	}
+}
+
+// jsonTypeName describes a Go type the way a JSON client would think of it.
+func jsonTypeName(goType string) string {
+	goType = strings.TrimPrefix(goType, "*")
+
+	switch {
+	case goType == "string":
+		return "string"
+	case goType == "bool":
+		return "boolean"
+	case strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "uint"), strings.HasPrefix(goType, "float"):
+		return "number"
+	case strings.HasPrefix(goType, "[]"):
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func sendMockJSONRequest(t *testing.T, handler http.HandlerFunc, method, url, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{``, "request body must not be empty"},
+		{`{"title": "Jeru"`, "request body contains malformed JSON"},
+		{`{"title": Jeru}`, "request body contains malformed JSON at position 11"},
+		{`{"title": 12}`, "'title' must be a string"},
+		{`["Jeru"]`, "request body must be a JSON object"},
+		{`{"publisher": "Blue Note"}`, `unknown field "publisher"`},
+		{`{"title": "Jeru"} {"title": "Jeru"}`, "request body must contain a single JSON object"},
+		{`{"title": "` + strings.Repeat("a", maxBodyBytes) + `"}`, "request body must not be larger than 1048576 bytes"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPut, "/albums", strings.NewReader(tt.body))
+
+		var input albumRequest
+		err := decodeJSON(httptest.NewRecorder(), req, &input)
+		if err == nil {
+			t.Errorf("Expected an error for %.40q", tt.body)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("Unexpected error for %.40q: got %v want %v", tt.body, err, tt.expected)
+		}
+	}
+}
+
+func TestIsJSON(t *testing.T) {
+	tests := map[string]bool{
+		"application/json":                true,
+		"application/json; charset=utf-8": true,
+		"text/plain":                      false,
+		"":                                false,
+	}
+
+	for contentType, expected := range tests {
+		req := httptest.NewRequest(http.MethodPut, "/albums", nil)
+		req.Header.Set("Content-Type", contentType)
+
+		if actual := isJSON(req); actual != expected {
+			t.Errorf("isJSON(%q) = %v, want %v", contentType, actual, expected)
+		}
+	}
+}
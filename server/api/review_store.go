@@ -0,0 +1,345 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+)
+
+func (s *MemoryStore) ListReviews(ctx context.Context, query ReviewQuery) ([]Review, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var reviews []Review
+	for _, review := range s.reviews {
+		if review.AlbumID != query.AlbumID || query.Before != 0 && review.ID >= query.Before {
+			continue
+		}
+		reviews = append(reviews, s.reviewer(review))
+	}
+
+	slices.SortFunc(reviews, func(a, b Review) int { return cmp.Compare(b.ID, a.ID) })
+	if len(reviews) > query.Limit {
+		reviews = reviews[:query.Limit]
+	}
+
+	return reviews, nil
+}
+
+func (s *MemoryStore) GetReview(ctx context.Context, albumID, id int64) (Review, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	review, ok := s.reviews[id]
+	if !ok || review.AlbumID != albumID {
+		return Review{}, ErrReviewNotFound
+	}
+
+	return s.reviewer(review), nil
+}
+
+func (s *MemoryStore) CreateReview(ctx context.Context, review Review) (Review, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.albums[review.AlbumID]; !ok {
+		return Review{}, ErrAlbumNotFound
+	}
+	if review.CustomerID != nil {
+		if _, ok := s.customers[*review.CustomerID]; !ok {
+			return Review{}, ErrCustomerNotFound
+		}
+	}
+	for _, existing := range s.reviews {
+		if existing.AlbumID == review.AlbumID && existing.CustomerID != nil && review.CustomerID != nil && *existing.CustomerID == *review.CustomerID {
+			return Review{}, ErrReviewExists
+		}
+	}
+
+	s.nextReviewID++
+	review.ID, review.Reviewer = s.nextReviewID, ""
+	s.reviews[review.ID] = review
+	s.rateAlbum(review.AlbumID)
+
+	return review, nil
+}
+
+func (s *MemoryStore) UpdateReview(ctx context.Context, review Review) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.reviews[review.ID]
+	if !ok || existing.AlbumID != review.AlbumID {
+		return ErrReviewNotFound
+	}
+
+	existing.Rating, existing.Body, existing.UpdatedAt = review.Rating, review.Body, review.UpdatedAt
+	s.reviews[review.ID] = existing
+	s.rateAlbum(review.AlbumID)
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteReview(ctx context.Context, albumID, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	review, ok := s.reviews[id]
+	if !ok || review.AlbumID != albumID {
+		return ErrReviewNotFound
+	}
+
+	delete(s.reviews, id)
+	s.rateAlbum(albumID)
+
+	return nil
+}
+
+// reviewer sets the Reviewer of review to its customer's current name.
+// Callers must hold s.mu.
+func (s *MemoryStore) reviewer(review Review) Review {
+	if review.CustomerID != nil {
+		review.Reviewer = s.customers[*review.CustomerID].Name
+	}
+
+	return review
+}
+
+// rateAlbum recounts the review count and average rating of the album, and
+// moves it to its next version. Callers must hold s.mu.
+func (s *MemoryStore) rateAlbum(albumID int64) {
+	album, ok := s.albums[albumID]
+	if !ok {
+		return
+	}
+
+	var count, total int
+	for _, review := range s.reviews {
+		if review.AlbumID == albumID {
+			count++
+			total += review.Rating
+		}
+	}
+
+	album.ReviewCount, album.AverageRating = count, nil
+	album.Version++
+	if count > 0 {
+		average := averageRating(total, count)
+		album.AverageRating = &average
+	}
+	s.albums[albumID] = album
+}
+
+// reviewColumns are the review columns scanReview reads, with the name of
+// the reviewing customer. They select from review r LEFT JOIN customer c.
+const reviewColumns = "r.id, r.album_id, r.customer_id, COALESCE(c.name, ''), r.rating, r.body, r.created_at, r.updated_at"
+
+// scanReview reads the reviewColumns of a row.
+func scanReview(row interface{ Scan(...any) error }) (Review, error) {
+	var review Review
+	var customerID sql.NullInt64
+	err := row.Scan(&review.ID, &review.AlbumID, &customerID, &review.Reviewer, &review.Rating, &review.Body,
+		timeScanner{&review.CreatedAt}, timeScanner{&review.UpdatedAt})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Review{}, ErrReviewNotFound
+	}
+	if err != nil {
+		return Review{}, err
+	}
+
+	if customerID.Valid {
+		review.CustomerID = &customerID.Int64
+	}
+
+	return review, nil
+}
+
+func (s *SQLStore) ListReviews(ctx context.Context, query ReviewQuery) ([]Review, error) {
+	statement := `SELECT ` + reviewColumns + ` FROM review r LEFT JOIN customer c ON c.id = r.customer_id WHERE r.album_id = ?`
+	args := []any{query.AlbumID}
+	if query.Before != 0 {
+		statement += ` AND r.id < ?`
+		args = append(args, query.Before)
+	}
+	statement += ` ORDER BY r.id DESC LIMIT ?`
+	args = append(args, query.Limit)
+
+	rows, err := s.Db.QueryContext(ctx, s.rebind(statement), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reviews []Review
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+
+	return reviews, rows.Err()
+}
+
+func (s *SQLStore) GetReview(ctx context.Context, albumID, id int64) (Review, error) {
+	return scanReview(s.Db.QueryRowContext(ctx, s.rebind(`SELECT `+reviewColumns+
+		` FROM review r LEFT JOIN customer c ON c.id = r.customer_id WHERE r.album_id = ? AND r.id = ?`), albumID, id))
+}
+
+// CreateReview locks the album row before checking for an earlier review by
+// the customer, so that reviewing twice at once cannot run into the unique
+// index.
+func (s *SQLStore) CreateReview(ctx context.Context, review Review) (Review, error) {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return Review{}, err
+	}
+	defer tx.Rollback()
+
+	count, total, err := s.albumRating(ctx, tx, review.AlbumID)
+	if err != nil {
+		return Review{}, err
+	}
+
+	if review.CustomerID != nil {
+		var customers, existing int
+		err := tx.QueryRowContext(ctx, s.rebind(`SELECT (SELECT COUNT(*) FROM customer WHERE id = ?), (SELECT COUNT(*) FROM review WHERE album_id = ? AND customer_id = ?)`),
+			*review.CustomerID, review.AlbumID, *review.CustomerID).Scan(&customers, &existing)
+		if err != nil {
+			return Review{}, err
+		}
+		if customers == 0 {
+			return Review{}, ErrCustomerNotFound
+		}
+		if existing > 0 {
+			return Review{}, ErrReviewExists
+		}
+	}
+
+	query := `INSERT INTO review (album_id, customer_id, rating, body, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`
+	args := []any{review.AlbumID, review.CustomerID, review.Rating, review.Body, review.CreatedAt.UTC(), review.UpdatedAt.UTC()}
+	if s.postgres() {
+		err = tx.QueryRowContext(ctx, s.rebind(query+` RETURNING id`), args...).Scan(&review.ID)
+	} else {
+		var result sql.Result
+		if result, err = tx.ExecContext(ctx, query, args...); err == nil {
+			review.ID, err = result.LastInsertId()
+		}
+	}
+	if err != nil {
+		return Review{}, err
+	}
+
+	if err := s.setAlbumRating(ctx, tx, review.AlbumID, count+1, total+review.Rating); err != nil {
+		return Review{}, err
+	}
+
+	review.Reviewer = ""
+
+	return review, tx.Commit()
+}
+
+func (s *SQLStore) UpdateReview(ctx context.Context, review Review) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	count, total, err := s.albumRating(ctx, tx, review.AlbumID)
+	if errors.Is(err, ErrAlbumNotFound) {
+		return ErrReviewNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	previous, err := s.reviewRating(ctx, tx, review.AlbumID, review.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`UPDATE review SET rating = ?, body = ?, updated_at = ? WHERE id = ?`),
+		review.Rating, review.Body, review.UpdatedAt.UTC(), review.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.setAlbumRating(ctx, tx, review.AlbumID, count, total-previous+review.Rating); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) DeleteReview(ctx context.Context, albumID, id int64) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	count, total, err := s.albumRating(ctx, tx, albumID)
+	if errors.Is(err, ErrAlbumNotFound) {
+		return ErrReviewNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	previous, err := s.reviewRating(ctx, tx, albumID, id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM review WHERE id = ?`), id); err != nil {
+		return err
+	}
+
+	if err := s.setAlbumRating(ctx, tx, albumID, count-1, total-previous); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// albumRating locks the album row and returns its review count and the sum
+// of its ratings. Review writes take the lock first, so they apply their
+// change to the rating one at a time.
+func (s *SQLStore) albumRating(ctx context.Context, tx *sql.Tx, albumID int64) (int, int, error) {
+	query := `SELECT review_count, rating_total FROM album WHERE id = ? AND deleted_at IS NULL`
+	if s.Driver != "sqlite" {
+		query += ` FOR UPDATE`
+	}
+
+	var count, total int
+	err := tx.QueryRowContext(ctx, s.rebind(query), albumID).Scan(&count, &total)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, ErrAlbumNotFound
+	}
+
+	return count, total, err
+}
+
+// reviewRating returns the current rating of the album's review with id.
+func (s *SQLStore) reviewRating(ctx context.Context, tx *sql.Tx, albumID, id int64) (int, error) {
+	var rating int
+	err := tx.QueryRowContext(ctx, s.rebind(`SELECT rating FROM review WHERE album_id = ? AND id = ?`), albumID, id).Scan(&rating)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrReviewNotFound
+	}
+
+	return rating, err
+}
+
+// setAlbumRating stores the album's review count, rating sum and the average
+// of the two, and moves the album to its next version.
+func (s *SQLStore) setAlbumRating(ctx context.Context, tx *sql.Tx, albumID int64, count, total int) error {
+	_, err := tx.ExecContext(ctx, s.rebind(`UPDATE album SET review_count = ?, rating_total = ?, average_rating = ?, version = version + 1 WHERE id = ?`),
+		count, total, averageRating(total, count), albumID)
+
+	return err
+}
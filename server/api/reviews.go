@@ -0,0 +1,409 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrReviewNotFound is returned by a ReviewStore when the album has no
+	// review with the given id.
+	ErrReviewNotFound = errors.New("review not found")
+	// ErrReviewExists is returned when a customer reviews an album twice.
+	ErrReviewExists = errors.New("you have already reviewed this album")
+)
+
+const (
+	minRating = 1
+	maxRating = 5
+	// maxReviewLength caps the body of a review, in characters.
+	maxReviewLength = 5000
+)
+
+// Review is a customer's rating of an album from 1 to 5 stars, with an
+// optional text. Reviews outlive their customer's account, after which
+// CustomerID is null and Reviewer empty.
+type Review struct {
+	ID         int64  `json:"id"`
+	AlbumID    int64  `json:"album_id"`
+	CustomerID *int64 `json:"customer_id"`
+	// Reviewer is the current name of the customer.
+	Reviewer  string    `json:"reviewer"`
+	Rating    int       `json:"rating"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ReviewQuery selects a page of an album's reviews, newest first.
+type ReviewQuery struct {
+	AlbumID int64
+	Limit   int
+	// Before is the id of the last review of the previous page.
+	Before int64
+}
+
+// ReviewPage is the envelope review listings are served in. Next is an
+// opaque cursor for the following page and is null on the last one.
+type ReviewPage struct {
+	Data []Review `json:"data"`
+	Next *string  `json:"next"`
+}
+
+// ReviewStore is the persistence layer the review handlers depend on. Every
+// write updates the review count and average rating of the review's album in
+// the same transaction, so album reads never aggregate reviews.
+type ReviewStore interface {
+	ListReviews(ctx context.Context, query ReviewQuery) ([]Review, error)
+	GetReview(ctx context.Context, albumID, id int64) (Review, error)
+	// CreateReview returns ErrAlbumNotFound when there is no such album, and
+	// ErrReviewExists when the customer has reviewed it already.
+	CreateReview(ctx context.Context, review Review) (Review, error)
+	// UpdateReview sets the rating, body and UpdatedAt of the review.
+	UpdateReview(ctx context.Context, review Review) error
+	DeleteReview(ctx context.Context, albumID, id int64) error
+}
+
+// Rating is an average star rating in hundredths of a star, the precision
+// of the DECIMAL(3, 2) average_rating column.
+type Rating int64
+
+// averageRating returns total over count, rounded half up to hundredths.
+func averageRating(total, count int) Rating {
+	if count == 0 {
+		return 0
+	}
+
+	return Rating((200*int64(total) + int64(count)) / (2 * int64(count)))
+}
+
+// String formats the rating as a decimal with two digits, e.g. "4.67".
+func (r Rating) String() string {
+	return fmt.Sprintf("%d.%02d", r/100, r%100)
+}
+
+// MarshalJSON writes the rating as a JSON number.
+func (r Rating) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// Value stores the rating as a decimal string, which DECIMAL columns accept
+// exactly.
+func (r Rating) Value() (driver.Value, error) {
+	return r.String(), nil
+}
+
+func (r *Rating) Scan(src any) error {
+	var text string
+	switch v := src.(type) {
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	case int64:
+		text = strconv.FormatInt(v, 10)
+	case float64:
+		// SQLite keeps DECIMAL columns as REAL
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Errorf("scan rating: unsupported type %T", src)
+	}
+
+	parsed, err := parseRating(text)
+	if err != nil {
+		return fmt.Errorf("scan rating %q: %w", text, err)
+	}
+	*r = parsed.(Rating)
+
+	return nil
+}
+
+var errRating = fmt.Errorf("rating must be a number from 0 to %d with at most two decimals", maxRating)
+
+// parseRating reads a decimal rating such as "4.5" without going through
+// floating point.
+func parseRating(s string) (any, error) {
+	whole, fraction, _ := strings.Cut(strings.TrimSpace(s), ".")
+	fraction = strings.TrimRight(fraction, "0")
+	if whole == "" && fraction == "" || len(fraction) > 2 {
+		return nil, errRating
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+
+	hundredths, err := strconv.ParseUint(whole+fraction, 10, 64)
+	if err != nil || hundredths > 100*maxRating {
+		return nil, errRating
+	}
+
+	return Rating(hundredths), nil
+}
+
+// averageScanner scans the average_rating column into a *Rating that is nil
+// for albums without reviews, whose average is stored as 0.
+type averageScanner struct {
+	rating **Rating
+}
+
+func (s averageScanner) Scan(src any) error {
+	var rating Rating
+	if err := rating.Scan(src); err != nil {
+		return err
+	}
+
+	*s.rating = nil
+	if rating != 0 {
+		*s.rating = &rating
+	}
+
+	return nil
+}
+
+// GetReviews lists an album's reviews newest first, a page at a time.
+func (a *Albums) GetReviews(w http.ResponseWriter, r *http.Request) {
+	albumID, _, ok := reviewPath(w, r)
+	if !ok {
+		return
+	}
+
+	parameters := r.URL.Query()
+	query := ReviewQuery{AlbumID: albumID, Limit: defaultPageLimit}
+
+	var err error
+	if limit := parameters.Get("limit"); limit != "" {
+		if query.Limit, err = parseLimit(limit); err != nil {
+			ServeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if cursor := parameters.Get("cursor"); cursor != "" {
+		if query.Before, err = decodeIDCursor(cursor); err != nil {
+			ServeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if _, err := a.Store.Get(r.Context(), albumID); errors.Is(err, ErrAlbumNotFound) {
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		ServeJSONError(w, fmt.Sprintf("GetReviews %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Fetch one more review to tell whether there is a next page
+	query.Limit++
+	reviews, err := a.Reviews.ListReviews(r.Context(), query)
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("GetReviews %v", err), http.StatusInternalServerError)
+		return
+	}
+	query.Limit--
+
+	page := ReviewPage{Data: reviews}
+	if len(reviews) > query.Limit {
+		page.Data = reviews[:query.Limit]
+		next := encodeIDCursor(page.Data[query.Limit-1].ID)
+		page.Next = &next
+	}
+	if page.Data == nil {
+		page.Data = []Review{}
+	}
+
+	ServeJSON(w, page, http.StatusOK)
+}
+
+// AddReview reviews an album as the logged in customer, as in
+// {"rating":4,"body":"..."}. Each customer reviews an album at most once,
+// and changes their review with UpdateReview.
+func (a *Albums) AddReview(w http.ResponseWriter, r *http.Request) {
+	albumID, _, ok := reviewPath(w, r)
+	if !ok {
+		return
+	}
+
+	p, ok := requireCustomer(w, r)
+	if !ok {
+		return
+	}
+
+	var input reviewInput
+	if !readJSON(w, r, &input) {
+		return
+	}
+
+	if errs := input.validate(true); len(errs) > 0 {
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	review := Review{AlbumID: albumID, CustomerID: &p.customer.ID, Rating: *input.Rating, CreatedAt: now, UpdatedAt: now}
+	if input.Body != nil {
+		review.Body = strings.TrimSpace(*input.Body)
+	}
+
+	review, err := a.Reviews.CreateReview(r.Context(), review)
+	switch {
+	case errors.Is(err, ErrAlbumNotFound):
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrReviewExists):
+		ServeJSONError(w, ErrReviewExists.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		ServeJSONError(w, fmt.Sprintf("AddReview %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	a.serveReview(w, r, albumID, review.ID, "AddReview")
+}
+
+// UpdateReview changes the rating or body of the logged in customer's own
+// review.
+func (a *Albums) UpdateReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := a.ownReview(w, r, "UpdateReview")
+	if !ok {
+		return
+	}
+
+	var input reviewInput
+	if !readJSON(w, r, &input) {
+		return
+	}
+
+	if errs := input.validate(false); len(errs) > 0 {
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	if input.Rating != nil {
+		review.Rating = *input.Rating
+	}
+	if input.Body != nil {
+		review.Body = strings.TrimSpace(*input.Body)
+	}
+	review.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+
+	err := a.Reviews.UpdateReview(r.Context(), review)
+	switch {
+	case errors.Is(err, ErrReviewNotFound):
+		ServeJSONError(w, "review not found", http.StatusNotFound)
+		return
+	case err != nil:
+		ServeJSONError(w, fmt.Sprintf("UpdateReview %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	a.serveReview(w, r, review.AlbumID, review.ID, "UpdateReview")
+}
+
+// DeleteReview removes the logged in customer's own review.
+func (a *Albums) DeleteReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := a.ownReview(w, r, "DeleteReview")
+	if !ok {
+		return
+	}
+
+	err := a.Reviews.DeleteReview(r.Context(), review.AlbumID, review.ID)
+	switch {
+	case errors.Is(err, ErrReviewNotFound):
+		ServeJSONError(w, "review not found", http.StatusNotFound)
+	case err != nil:
+		ServeJSONError(w, "could not delete review", http.StatusInternalServerError)
+	default:
+		ServeJSON(w, map[string]any{"message": "review successfully removed"}, http.StatusOK)
+	}
+}
+
+// reviewInput is the body of AddReview and UpdateReview.
+type reviewInput struct {
+	Rating *int    `json:"rating"`
+	Body   *string `json:"body"`
+}
+
+// validate checks the rating, which AddReview requires, and the body.
+func (input reviewInput) validate(create bool) ValidationErrors {
+	var errs ValidationErrors
+	switch {
+	case input.Rating == nil:
+		if create {
+			errs.Add("rating", "is required")
+		}
+	case *input.Rating < minRating || *input.Rating > maxRating:
+		errs.Add("rating", fmt.Sprintf("must be a whole number of stars from %d to %d", minRating, maxRating))
+	}
+	validateText(&errs, "body", input.Body, maxReviewLength, false)
+
+	return errs
+}
+
+// ownReview reads the review a /albums/{id}/reviews/{review} request is
+// about. It writes a 401 response for anonymous callers, and a 403 one when
+// the review is not the logged in customer's.
+func (a *Albums) ownReview(w http.ResponseWriter, r *http.Request, handler string) (Review, bool) {
+	albumID, reviewID, ok := reviewPath(w, r)
+	if !ok {
+		return Review{}, false
+	}
+
+	p, ok := requireCustomer(w, r)
+	if !ok {
+		return Review{}, false
+	}
+
+	review, err := a.Reviews.GetReview(r.Context(), albumID, reviewID)
+	switch {
+	case errors.Is(err, ErrReviewNotFound):
+		ServeJSONError(w, "review not found", http.StatusNotFound)
+		return Review{}, false
+	case err != nil:
+		ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+		return Review{}, false
+	case review.CustomerID == nil || *review.CustomerID != p.customer.ID:
+		ServeJSONError(w, "you can only change your own review", http.StatusForbidden)
+		return Review{}, false
+	}
+
+	return review, true
+}
+
+// serveReview serves the album's review with id.
+func (a *Albums) serveReview(w http.ResponseWriter, r *http.Request, albumID, id int64, handler string) {
+	review, err := a.Reviews.GetReview(r.Context(), albumID, id)
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+		return
+	}
+
+	ServeJSON(w, review, http.StatusOK)
+}
+
+// reviewPath parses the album id, and the review id if there is one, of a
+// /albums/{id}/reviews or /albums/{id}/reviews/{review} path. It writes a
+// 400 response and returns false when either is not a number.
+func reviewPath(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/albums/"), "/")
+
+	albumID, err := strconv.ParseInt(segments[0], 10, 64)
+	if err != nil {
+		ServeJSONError(w, "invalid album id", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	var reviewID int64
+	if len(segments) > 2 {
+		if reviewID, err = strconv.ParseInt(segments[2], 10, 64); err != nil || len(segments) > 3 {
+			ServeJSONError(w, "invalid review id", http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+
+	return albumID, reviewID, true
+}
@@ -0,0 +1,270 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReviews_MemoryStore(t *testing.T) {
+	testReviews(t, NewMemoryStore(queryAlbums...))
+}
+
+func TestReviews_SQLite(t *testing.T) {
+	testReviews(t, querySQLiteStore(t))
+}
+
+// testReviews runs through reviewing albums as two customers, against a
+// store holding queryAlbums, and checks the ratings albums are served and
+// sorted with.
+func testReviews(t *testing.T, store Backend) {
+	t.Helper()
+
+	router := SetupRouter(NewAlbums(store))
+	tokens := map[string]string{
+		"{ella}":  registerCustomer(t, router, "ella@example.com"),
+		"{miles}": registerCustomer(t, router, "miles@example.com"),
+	}
+
+	tests := []struct {
+		method       string
+		url          string
+		token        string
+		body         string
+		expectedCode int
+		expected     string
+	}{
+		{http.MethodGet, "/albums/1/reviews", "", "", http.StatusOK, `{"data":[],"next":null}`},
+		{http.MethodGet, "/albums/99/reviews", "", "", http.StatusNotFound, `{"errors":"album not found"}`},
+		{http.MethodGet, "/albums/1", "", "", http.StatusOK, `"review_count":0,"average_rating":null,`},
+		{http.MethodPut, "/albums/1/reviews", "", `{"rating":4}`, http.StatusUnauthorized, `{"errors":"authentication required"}`},
+		{http.MethodPut, "/albums/1/reviews", "{ella}", `{"rating":4,"body":" Lovely tone "}`, http.StatusOK, `{"id":1,"album_id":1,"customer_id":1,"reviewer":"Ella","rating":4,"body":"Lovely tone","created_at":`},
+		{http.MethodPut, "/albums/1/reviews", "{ella}", `{"rating":5}`, http.StatusConflict, `{"errors":"you have already reviewed this album"}`},
+		{http.MethodPut, "/albums/99/reviews", "{ella}", `{"rating":5}`, http.StatusNotFound, `{"errors":"album not found"}`},
+		{http.MethodPut, "/albums/x/reviews", "{ella}", `{"rating":5}`, http.StatusBadRequest, `{"errors":"invalid album id"}`},
+		{http.MethodPut, "/albums/2/reviews", "{ella}", `{"rating":6,"body":""}`, http.StatusUnprocessableEntity, `"fields":{"body":["must not be blank"],"rating":["must be a whole number of stars from 1 to 5"]}`},
+		{http.MethodPut, "/albums/2/reviews", "{ella}", `{}`, http.StatusUnprocessableEntity, `"fields":{"rating":["is required"]}`},
+		{http.MethodPut, "/albums/1/reviews", "{miles}", `{"rating":5}`, http.StatusOK, `{"id":2,"album_id":1,"customer_id":2,"reviewer":"Ella","rating":5,"body":"",`},
+		{http.MethodGet, "/albums/1", "", "", http.StatusOK, `"review_count":2,"average_rating":4.50,`},
+		{http.MethodPatch, "/albums/1/reviews/1", "{miles}", `{"rating":1}`, http.StatusForbidden, `{"errors":"you can only change your own review"}`},
+		{http.MethodPatch, "/albums/1/reviews/1", "", `{"rating":1}`, http.StatusUnauthorized, `{"errors":"authentication required"}`},
+		{http.MethodPatch, "/albums/3/reviews/1", "{ella}", `{"rating":1}`, http.StatusNotFound, `{"errors":"review not found"}`},
+		{http.MethodPatch, "/albums/1/reviews/x", "{ella}", `{"rating":1}`, http.StatusBadRequest, `{"errors":"invalid review id"}`},
+		{http.MethodPatch, "/albums/1/reviews/1", "{ella}", `{"rating":0}`, http.StatusUnprocessableEntity, `"fields":{"rating":["must be a whole number of stars from 1 to 5"]}`},
+		{http.MethodPatch, "/albums/1/reviews/1", "{ella}", `{"rating":2}`, http.StatusOK, `{"id":1,"album_id":1,"customer_id":1,"reviewer":"Ella","rating":2,"body":"Lovely tone",`},
+		{http.MethodGet, "/albums/1", "", "", http.StatusOK, `"review_count":2,"average_rating":3.50,`},
+		{http.MethodPut, "/albums/3/reviews", "{ella}", `{"rating":5}`, http.StatusOK, `{"id":3,"album_id":3,`},
+		{http.MethodPut, "/albums/3/reviews", "{miles}", `{"rating":4}`, http.StatusOK, `{"id":4,"album_id":3,`},
+		{http.MethodPut, "/albums/5/reviews", "{miles}", `{"rating":3}`, http.StatusOK, `{"id":5,"album_id":5,`},
+		{http.MethodPut, "/albums/6/reviews", "{ella}", `{"rating":1}`, http.StatusOK, `{"id":6,"album_id":6,`},
+		{http.MethodPut, "/albums/6/reviews", "{miles}", `{"rating":2}`, http.StatusOK, `{"id":7,"album_id":6,`},
+		{http.MethodGet, "/albums/6", "", "", http.StatusOK, `"review_count":2,"average_rating":1.50,`},
+		{http.MethodGet, "/albums/1/reviews?limit=1", "", "", http.StatusOK, `{"data":[{"id":2,"album_id":1,`},
+		{http.MethodGet, "/albums/1/reviews?cursor=x", "", "", http.StatusBadRequest, `{"errors":"invalid cursor"}`},
+		{http.MethodGet, "/albums?rating[gt]=5", "", "", http.StatusOK, `{"data":[],`},
+		{http.MethodGet, "/albums?rating[gt]=5.5", "", "", http.StatusBadRequest, `{"errors":"'rating[gt]' has an invalid value '5.5'"}`},
+		{http.MethodDelete, "/albums/1/reviews/2", "{ella}", "", http.StatusForbidden, `{"errors":"you can only change your own review"}`},
+		{http.MethodDelete, "/albums/1/reviews/2", "{miles}", "", http.StatusOK, `{"message":"review successfully removed"}`},
+		{http.MethodDelete, "/albums/1/reviews/2", "{miles}", "", http.StatusNotFound, `{"errors":"review not found"}`},
+		{http.MethodGet, "/albums/1", "", "", http.StatusOK, `"review_count":1,"average_rating":2.00,`},
+	}
+
+	for _, tt := range tests {
+		token := tt.token
+		if id, ok := tokens[token]; ok {
+			token = id
+		}
+
+		rr := authRequest(router, tt.method, tt.url, tt.body, token)
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("%v %v returned wrong status code: got %v want %v", tt.method, tt.url, status, tt.expectedCode)
+		}
+
+		if actual := strings.TrimSpace(rr.Body.String()); !strings.Contains(actual, tt.expected) {
+			t.Errorf("%v %v returned unexpected body: got %v want %v", tt.method, tt.url, actual, tt.expected)
+		}
+	}
+
+	// Pages of reviews and of albums by rating follow on from their cursors
+	pages := func(url string) []int64 {
+		t.Helper()
+
+		var ids []int64
+		for url != "" {
+			rr := shopRequest(router, http.MethodGet, url, "")
+			var page struct {
+				Data []struct{ ID int64 }
+				Next *string
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+				t.Fatalf("GET %v returned an unexpected page %v: %v", url, rr.Body, err)
+			}
+
+			for _, item := range page.Data {
+				ids = append(ids, item.ID)
+			}
+			url, _, _ = strings.Cut(url, "cursor=")
+			if page.Next != nil {
+				url += "&cursor=" + *page.Next
+			} else {
+				url = ""
+			}
+		}
+
+		return ids
+	}
+
+	if ids := pages("/albums/3/reviews?limit=1"); !slices.Equal(ids, []int64{4, 3}) {
+		t.Errorf("Unexpected reviews of album 3: got %v want %v", ids, []int64{4, 3})
+	}
+	if ids := pages("/albums?sort=-rating&limit=2"); !slices.Equal(ids, []int64{3, 5, 1, 6, 2, 4, 7}) {
+		t.Errorf("Unexpected albums by rating: got %v want %v", ids, []int64{3, 5, 1, 6, 2, 4, 7})
+	}
+	if ids := pages("/albums?sort=rating&rating[gte]=1.5&limit=2"); !slices.Equal(ids, []int64{6, 1, 5, 3}) {
+		t.Errorf("Unexpected rated albums: got %v want %v", ids, []int64{6, 1, 5, 3})
+	}
+
+	// Reviews outlive their customer, and leave with their album
+	authRequest(router, http.MethodDelete, "/me", `{"password":"a-love-supreme"}`, tokens["{miles}"])
+	rr := shopRequest(router, http.MethodGet, "/albums/3/reviews", "")
+	if expected := `{"data":[{"id":4,"album_id":3,"customer_id":null,"reviewer":"","rating":4,`; !strings.HasPrefix(rr.Body.String(), expected) {
+		t.Errorf("Unexpected reviews after deleting an account: got %v want %v", rr.Body, expected)
+	}
+	if rr := shopRequest(router, http.MethodGet, "/albums/3", ""); !strings.Contains(rr.Body.String(), `"review_count":2,"average_rating":4.50,`) {
+		t.Errorf("Expected the rating to outlive the account, got %v", rr.Body)
+	}
+
+	if err := store.Delete(context.Background(), 3); err != nil {
+		t.Fatalf("Failed to delete album: %v", err)
+	}
+	if _, err := store.GetReview(context.Background(), 3, 4); !errors.Is(err, ErrReviewNotFound) {
+		t.Errorf("Expected the album's reviews to be deleted with it, got %v", err)
+	}
+}
+
+// TestReviewStore_SQLite writes reviews straight to the SQLite store and
+// checks the rating columns each write keeps up to date on the album, and the
+// order albums sort in by rating.
+func TestReviewStore_SQLite(t *testing.T) {
+	ctx := context.Background()
+	store := querySQLiteStore(t)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	var customers []int64
+	for _, email := range []string{"ella@example.com", "miles@example.com", "sarah@example.com"} {
+		customer, err := store.CreateCustomer(ctx, Customer{Email: email, PasswordHash: []byte("x"), CreatedAt: now})
+		if err != nil {
+			t.Fatalf("Failed to create customer: %v", err)
+		}
+		customers = append(customers, customer.ID)
+	}
+	ella, miles, sarah := customers[0], customers[1], customers[2]
+
+	review := func(albumID, customerID int64, rating int) Review {
+		t.Helper()
+
+		created, err := store.CreateReview(ctx, Review{AlbumID: albumID, CustomerID: &customerID, Rating: rating, CreatedAt: now, UpdatedAt: now})
+		if err != nil {
+			t.Fatalf("Failed to review album %v: %v", albumID, err)
+		}
+
+		return created
+	}
+	rating := func(albumID int64, count, total int, average string) {
+		t.Helper()
+
+		var actualCount, actualTotal int
+		var actualAverage Rating
+		err := store.Db.QueryRowContext(ctx, `SELECT review_count, rating_total, average_rating FROM album WHERE id = ?`, albumID).
+			Scan(&actualCount, &actualTotal, &actualAverage)
+		if err != nil || actualCount != count || actualTotal != total || actualAverage.String() != average {
+			t.Errorf("Album %v has review_count %v, rating_total %v and average_rating %v, %v; want %v, %v and %v",
+				albumID, actualCount, actualTotal, actualAverage, err, count, total, average)
+		}
+	}
+
+	ellaOnBlueTrain := review(1, ella, 4)
+	milesOnBlueTrain := review(1, miles, 5)
+	rating(1, 2, 9, "4.50")
+	review(2, ella, 3)
+	rating(2, 1, 3, "3.00")
+	review(3, sarah, 5)
+	rating(3, 1, 5, "5.00")
+
+	if _, err := store.CreateReview(ctx, Review{AlbumID: 1, CustomerID: &ella, Rating: 1, CreatedAt: now, UpdatedAt: now}); !errors.Is(err, ErrReviewExists) {
+		t.Errorf("Expected %v reviewing an album twice, got %v", ErrReviewExists, err)
+	}
+	if _, err := store.CreateReview(ctx, Review{AlbumID: 99, CustomerID: &ella, Rating: 1, CreatedAt: now, UpdatedAt: now}); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("Expected %v reviewing a missing album, got %v", ErrAlbumNotFound, err)
+	}
+	rating(1, 2, 9, "4.50")
+
+	ellaOnBlueTrain.Rating, ellaOnBlueTrain.Body = 2, "Grew tired of it"
+	if err := store.UpdateReview(ctx, ellaOnBlueTrain); err != nil {
+		t.Fatalf("Failed to edit review: %v", err)
+	}
+	rating(1, 2, 7, "3.50")
+	if found, err := store.GetReview(ctx, 1, ellaOnBlueTrain.ID); err != nil || found.Rating != 2 || found.Body != "Grew tired of it" {
+		t.Errorf("Unexpected edited review %+v, %v", found, err)
+	}
+
+	if err := store.DeleteReview(ctx, 1, milesOnBlueTrain.ID); err != nil {
+		t.Fatalf("Failed to delete review: %v", err)
+	}
+	if err := store.DeleteReview(ctx, 1, milesOnBlueTrain.ID); !errors.Is(err, ErrReviewNotFound) {
+		t.Errorf("Expected %v deleting a review twice, got %v", ErrReviewNotFound, err)
+	}
+	rating(1, 1, 2, "2.00")
+
+	// Unreviewed albums rate below every reviewed one
+	albums, err := store.List(ctx, AlbumQuery{Sort: []SortKey{{Field: "rating", Desc: true}}, Page: Page{Limit: 4}})
+	if err != nil {
+		t.Fatalf("Failed to list albums: %v", err)
+	}
+	var ids []int64
+	for _, album := range albums {
+		ids = append(ids, album.ID)
+	}
+	if !slices.Equal(ids, []int64{3, 2, 1, 4}) {
+		t.Errorf("Expected albums sorted by rating, got %v", ids)
+	}
+}
+
+func TestRating(t *testing.T) {
+	tests := []struct {
+		total, count int
+		expected     string
+	}{
+		{0, 0, "0.00"},
+		{5, 1, "5.00"},
+		{9, 2, "4.50"},
+		{14, 3, "4.67"},
+		{13, 3, "4.33"},
+		{1, 8, "0.13"},
+	}
+
+	for _, tt := range tests {
+		if actual := averageRating(tt.total, tt.count).String(); actual != tt.expected {
+			t.Errorf("averageRating(%v, %v) = %v, want %v", tt.total, tt.count, actual, tt.expected)
+		}
+	}
+
+	for _, src := range []any{"4.67", []byte("4.670"), 4.67, int64(4)} {
+		var rating Rating
+		if err := rating.Scan(src); err != nil || (rating != 467 && rating != 400) {
+			t.Errorf("Scan(%v) = %v, %v", src, rating, err)
+		}
+	}
+
+	for _, invalid := range []string{"", ".", "-1", "5.01", "4.567", "four"} {
+		if _, err := parseRating(invalid); err == nil {
+			t.Errorf("Expected parseRating(%q) to fail", invalid)
+		}
+	}
+}
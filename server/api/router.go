@@ -1,9 +1,9 @@
 package api
 
 import (
-	"database/sql"
 	"encoding/json"
 	"net/http"
+	"strings"
 )
 
 type AlbumsInterface interface {
@@ -12,9 +12,67 @@ type AlbumsInterface interface {
 	GetAlbumByID(w http.ResponseWriter, r *http.Request)
 	UpdateAlbum(w http.ResponseWriter, r *http.Request)
 	DeleteAlbum(w http.ResponseWriter, r *http.Request)
+	GetTrash(w http.ResponseWriter, r *http.Request)
+	RestoreAlbum(w http.ResponseWriter, r *http.Request)
+	GetAlbumHistory(w http.ResponseWriter, r *http.Request)
+	GetAudit(w http.ResponseWriter, r *http.Request)
 	AddRandom(w http.ResponseWriter, r *http.Request)
 	GetAlbumsByArtist(w http.ResponseWriter, r *http.Request)
-	GetHandleAlbumRows(rows *sql.Rows) ([]Album, error)
+	Search(w http.ResponseWriter, r *http.Request)
+	Suggest(w http.ResponseWriter, r *http.Request)
+	GetArtists(w http.ResponseWriter, r *http.Request)
+	AddArtist(w http.ResponseWriter, r *http.Request)
+	GetArtistByID(w http.ResponseWriter, r *http.Request)
+	UpdateArtist(w http.ResponseWriter, r *http.Request)
+	DeleteArtist(w http.ResponseWriter, r *http.Request)
+	GetArtistAlbums(w http.ResponseWriter, r *http.Request)
+	GetTracks(w http.ResponseWriter, r *http.Request)
+	AddTrack(w http.ResponseWriter, r *http.Request)
+	ReorderTracks(w http.ResponseWriter, r *http.Request)
+	DeleteTrack(w http.ResponseWriter, r *http.Request)
+	GetLabels(w http.ResponseWriter, r *http.Request)
+	AddLabel(w http.ResponseWriter, r *http.Request)
+	DeleteLabel(w http.ResponseWriter, r *http.Request)
+	GetAlbumLabels(w http.ResponseWriter, r *http.Request)
+	AssignLabel(w http.ResponseWriter, r *http.Request)
+	UnassignLabel(w http.ResponseWriter, r *http.Request)
+	UploadCover(w http.ResponseWriter, r *http.Request)
+	GetCover(w http.ResponseWriter, r *http.Request)
+	DeleteCover(w http.ResponseWriter, r *http.Request)
+	GetStock(w http.ResponseWriter, r *http.Request)
+	AdjustStock(w http.ResponseWriter, r *http.Request)
+	AddReservation(w http.ResponseWriter, r *http.Request)
+	DeleteReservation(w http.ResponseWriter, r *http.Request)
+	AddCart(w http.ResponseWriter, r *http.Request)
+	GetCart(w http.ResponseWriter, r *http.Request)
+	DeleteCart(w http.ResponseWriter, r *http.Request)
+	SetCartItem(w http.ResponseWriter, r *http.Request)
+	DeleteCartItem(w http.ResponseWriter, r *http.Request)
+	GetOrders(w http.ResponseWriter, r *http.Request)
+	AddOrder(w http.ResponseWriter, r *http.Request)
+	GetOrderByID(w http.ResponseWriter, r *http.Request)
+	UpdateOrder(w http.ResponseWriter, r *http.Request)
+	Register(w http.ResponseWriter, r *http.Request)
+	Login(w http.ResponseWriter, r *http.Request)
+	Logout(w http.ResponseWriter, r *http.Request)
+	GetMe(w http.ResponseWriter, r *http.Request)
+	ChangePassword(w http.ResponseWriter, r *http.Request)
+	DeleteMe(w http.ResponseWriter, r *http.Request)
+	AddWishlist(w http.ResponseWriter, r *http.Request)
+	GetWishlist(w http.ResponseWriter, r *http.Request)
+	DeleteWishlist(w http.ResponseWriter, r *http.Request)
+	AddWishlistItem(w http.ResponseWriter, r *http.Request)
+	DeleteWishlistItem(w http.ResponseWriter, r *http.Request)
+	ShareWishlist(w http.ResponseWriter, r *http.Request)
+	UnshareWishlist(w http.ResponseWriter, r *http.Request)
+	GetSharedWishlist(w http.ResponseWriter, r *http.Request)
+	GetReviews(w http.ResponseWriter, r *http.Request)
+	AddReview(w http.ResponseWriter, r *http.Request)
+	UpdateReview(w http.ResponseWriter, r *http.Request)
+	DeleteReview(w http.ResponseWriter, r *http.Request)
+	// Authenticate is middleware that resolves a request's credentials
+	// before it reaches the handlers.
+	Authenticate(next http.Handler) http.Handler
 }
 
 func ServeJSON(w http.ResponseWriter, data any, statusCode int) {
@@ -32,8 +90,8 @@ func corsMiddleware(h http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, PUT, PATCH")
-		w.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization")
-		w.Header().Set("Access-Control-Expose-Headers", "Content-Length")
+		w.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, If-Match, If-None-Match, "+wishlistTokenHeader+", "+requestIDHeader)
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Length, ETag, "+requestIDHeader)
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
@@ -58,6 +116,120 @@ func SetupRouter(albums AlbumsInterface) http.Handler {
 	})
 
 	mux.HandleFunc("/albums/", func(w http.ResponseWriter, r *http.Request) {
+		// /albums/{id}/cover
+		if strings.HasSuffix(r.URL.Path, "/cover") {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead:
+				albums.GetCover(w, r)
+			case http.MethodPut:
+				albums.UploadCover(w, r)
+			case http.MethodDelete:
+				albums.DeleteCover(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		// /albums/{id}/restore
+		if strings.HasSuffix(r.URL.Path, "/restore") {
+			switch r.Method {
+			case http.MethodPost:
+				albums.RestoreAlbum(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		// /albums/{id}/history
+		if strings.HasSuffix(r.URL.Path, "/history") {
+			switch r.Method {
+			case http.MethodGet:
+				albums.GetAlbumHistory(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		// /albums/{id}/stock
+		if strings.HasSuffix(r.URL.Path, "/stock") {
+			switch r.Method {
+			case http.MethodGet:
+				albums.GetStock(w, r)
+			case http.MethodPatch:
+				albums.AdjustStock(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		// /albums/{id}/reservations and /albums/{id}/reservations/{reservation}
+		if _, reservation, ok := strings.Cut(r.URL.Path, "/reservations"); ok {
+			switch {
+			case reservation == "" && r.Method == http.MethodPut:
+				albums.AddReservation(w, r)
+			case reservation != "" && r.Method == http.MethodDelete:
+				albums.DeleteReservation(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		// /albums/{id}/reviews and /albums/{id}/reviews/{review}
+		if _, review, ok := strings.Cut(r.URL.Path, "/reviews"); ok {
+			switch {
+			case review == "" && r.Method == http.MethodGet:
+				albums.GetReviews(w, r)
+			case review == "" && r.Method == http.MethodPut:
+				albums.AddReview(w, r)
+			case review != "" && r.Method == http.MethodPatch:
+				albums.UpdateReview(w, r)
+			case review != "" && r.Method == http.MethodDelete:
+				albums.DeleteReview(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		// /albums/{id}/tracks and /albums/{id}/tracks/{track}
+		if _, track, ok := strings.Cut(r.URL.Path, "/tracks"); ok {
+			switch {
+			case track == "" && r.Method == http.MethodGet:
+				albums.GetTracks(w, r)
+			case track == "" && r.Method == http.MethodPut:
+				albums.AddTrack(w, r)
+			case track == "" && r.Method == http.MethodPatch:
+				albums.ReorderTracks(w, r)
+			case track != "" && r.Method == http.MethodDelete:
+				albums.DeleteTrack(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		// /albums/{id}/genres and /albums/{id}/tags, with a label id to unassign
+		for _, labels := range []string{"/genres", "/tags"} {
+			if _, label, ok := strings.Cut(r.URL.Path, labels); ok {
+				switch {
+				case label == "" && r.Method == http.MethodGet:
+					albums.GetAlbumLabels(w, r)
+				case label == "" && r.Method == http.MethodPut:
+					albums.AssignLabel(w, r)
+				case label != "" && r.Method == http.MethodDelete:
+					albums.UnassignLabel(w, r)
+				default:
+					http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				}
+				return
+			}
+		}
+
 		switch r.Method {
 		case http.MethodGet:
 			albums.GetAlbumByID(w, r)
@@ -79,6 +251,24 @@ func SetupRouter(albums AlbumsInterface) http.Handler {
 		}
 	})
 
+	mux.HandleFunc("/albums/trash", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			albums.GetTrash(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/albums/suggest", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			albums.Suggest(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
 	mux.HandleFunc("/albums/artist/", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
@@ -88,7 +278,245 @@ func SetupRouter(albums AlbumsInterface) http.Handler {
 		}
 	})
 
-	handler := corsMiddleware(mux)
+	mux.HandleFunc("/artists", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			albums.GetArtists(w, r)
+		case http.MethodPut:
+			albums.AddArtist(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/artists/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/albums") {
+			switch r.Method {
+			case http.MethodGet:
+				albums.GetArtistAlbums(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			albums.GetArtistByID(w, r)
+		case http.MethodPatch:
+			albums.UpdateArtist(w, r)
+		case http.MethodDelete:
+			albums.DeleteArtist(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	for _, labels := range []string{"/genres", "/tags"} {
+		mux.HandleFunc(labels, func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				albums.GetLabels(w, r)
+			case http.MethodPut:
+				albums.AddLabel(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})
+
+		mux.HandleFunc(labels+"/", func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodDelete:
+				albums.DeleteLabel(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})
+	}
+
+	mux.HandleFunc("/carts", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			albums.AddCart(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/carts/", func(w http.ResponseWriter, r *http.Request) {
+		// /carts/{id}/items and /carts/{id}/items/{album}
+		if _, item, ok := strings.Cut(r.URL.Path, "/items"); ok {
+			switch {
+			case item == "" && r.Method == http.MethodPut:
+				albums.SetCartItem(w, r)
+			case item != "" && r.Method == http.MethodDelete:
+				albums.DeleteCartItem(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			albums.GetCart(w, r)
+		case http.MethodDelete:
+			albums.DeleteCart(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			albums.GetOrders(w, r)
+		case http.MethodPut:
+			albums.AddOrder(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/orders/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			albums.GetOrderByID(w, r)
+		case http.MethodPatch:
+			albums.UpdateOrder(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/auth/register", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			albums.Register(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/auth/login", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			albums.Login(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/auth/logout", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete:
+			albums.Logout(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/me", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			albums.GetMe(w, r)
+		case http.MethodDelete:
+			albums.DeleteMe(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/me/password", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPatch:
+			albums.ChangePassword(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/wishlist", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			albums.GetWishlist(w, r)
+		case http.MethodPut:
+			albums.AddWishlist(w, r)
+		case http.MethodDelete:
+			albums.DeleteWishlist(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/wishlist/items", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			albums.AddWishlistItem(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/wishlist/items/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete:
+			albums.DeleteWishlistItem(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/wishlist/share", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			albums.ShareWishlist(w, r)
+		case http.MethodDelete:
+			albums.UnshareWishlist(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/wishlists/shared/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			albums.GetSharedWishlist(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/audit", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			albums.GetAudit(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			albums.Search(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// CORS comes first so that preflight requests are answered without
+	// credentials.
+	handler := chain(mux, corsMiddleware, RequestID, albums.Authenticate)
 
 	return handler
 }
+
+// chain wraps h in each of middlewares, the first outermost.
+func chain(h http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+
+	return h
+}
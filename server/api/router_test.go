@@ -1,7 +1,6 @@
 package api
 
 import (
-	"database/sql"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -10,10 +9,6 @@ import (
 
 type MockRouterAlbums struct{}
 
-func (m *MockRouterAlbums) GetHandleAlbumRows(rows *sql.Rows) ([]Album, error) {
-	return []Album{}, nil
-}
-
 func (m *MockRouterAlbums) GetAlbums(w http.ResponseWriter, r *http.Request) {
 	ServeJSON(w, []string{"Album1", "Album2"}, http.StatusOK)
 }
@@ -34,6 +29,22 @@ func (m *MockRouterAlbums) DeleteAlbum(w http.ResponseWriter, r *http.Request) {
 	ServeJSON(w, "Album deleted", http.StatusOK)
 }
 
+func (m *MockRouterAlbums) GetTrash(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, []string{"Album1"}, http.StatusAccepted)
+}
+
+func (m *MockRouterAlbums) RestoreAlbum(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Album restored", http.StatusAccepted)
+}
+
+func (m *MockRouterAlbums) GetAlbumHistory(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, []string{"Entry1"}, http.StatusOK)
+}
+
+func (m *MockRouterAlbums) GetAudit(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, []string{"Entry1", "Entry2"}, http.StatusOK)
+}
+
 func (m *MockRouterAlbums) AddRandom(w http.ResponseWriter, r *http.Request) {
 	ServeJSON(w, "Random album added", http.StatusCreated)
 }
@@ -42,6 +53,233 @@ func (m *MockRouterAlbums) GetAlbumsByArtist(w http.ResponseWriter, r *http.Requ
 	ServeJSON(w, []string{"Album1", "Album2"}, http.StatusOK)
 }
 
+func (m *MockRouterAlbums) Search(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, []string{"Album1"}, http.StatusOK)
+}
+
+func (m *MockRouterAlbums) Suggest(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, []string{"Album1"}, http.StatusOK)
+}
+
+func (m *MockRouterAlbums) GetArtists(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, []string{"Artist1", "Artist2"}, http.StatusOK)
+}
+
+func (m *MockRouterAlbums) AddArtist(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Artist added", http.StatusCreated)
+}
+
+func (m *MockRouterAlbums) GetArtistByID(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Artist1", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) UpdateArtist(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Artist updated", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) DeleteArtist(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Artist deleted", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) GetArtistAlbums(w http.ResponseWriter, r *http.Request) {
+	// A distinct status shows the albums route was picked over GetArtistByID
+	ServeJSON(w, []string{"Album1"}, http.StatusAccepted)
+}
+
+// The track mocks answer with distinct statuses so the tests can tell them
+// from the album handlers sharing the /albums/ prefix.
+func (m *MockRouterAlbums) GetTracks(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, []string{"Track1", "Track2"}, http.StatusAccepted)
+}
+
+func (m *MockRouterAlbums) AddTrack(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Track added", http.StatusCreated)
+}
+
+func (m *MockRouterAlbums) ReorderTracks(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Tracks reordered", http.StatusAccepted)
+}
+
+func (m *MockRouterAlbums) DeleteTrack(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Track deleted", http.StatusAccepted)
+}
+
+func (m *MockRouterAlbums) GetLabels(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, []string{"Label1", "Label2"}, http.StatusOK)
+}
+
+func (m *MockRouterAlbums) AddLabel(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Label added", http.StatusCreated)
+}
+
+func (m *MockRouterAlbums) DeleteLabel(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Label deleted", http.StatusOK)
+}
+
+// The album label mocks, like the track mocks, answer with distinct statuses.
+func (m *MockRouterAlbums) GetAlbumLabels(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, []string{"Label1"}, http.StatusAccepted)
+}
+
+func (m *MockRouterAlbums) AssignLabel(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Label assigned", http.StatusCreated)
+}
+
+func (m *MockRouterAlbums) UnassignLabel(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Label unassigned", http.StatusAccepted)
+}
+
+// The cover mocks, like the track mocks, answer with distinct statuses.
+func (m *MockRouterAlbums) UploadCover(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Cover uploaded", http.StatusCreated)
+}
+
+func (m *MockRouterAlbums) GetCover(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Cover", http.StatusAccepted)
+}
+
+func (m *MockRouterAlbums) DeleteCover(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Cover deleted", http.StatusAccepted)
+}
+
+// The inventory mocks, like the track mocks, answer with distinct statuses.
+func (m *MockRouterAlbums) GetStock(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Stock", http.StatusAccepted)
+}
+
+func (m *MockRouterAlbums) AdjustStock(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Stock adjusted", http.StatusAccepted)
+}
+
+func (m *MockRouterAlbums) AddReservation(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Reservation added", http.StatusCreated)
+}
+
+func (m *MockRouterAlbums) DeleteReservation(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Reservation released", http.StatusAccepted)
+}
+
+func (m *MockRouterAlbums) AddCart(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Cart added", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) GetCart(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Cart", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) DeleteCart(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Cart deleted", http.StatusOK)
+}
+
+// The cart item mocks answer with distinct statuses, like the track mocks.
+func (m *MockRouterAlbums) SetCartItem(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Cart item set", http.StatusCreated)
+}
+
+func (m *MockRouterAlbums) DeleteCartItem(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Cart item deleted", http.StatusAccepted)
+}
+
+func (m *MockRouterAlbums) GetOrders(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Orders", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) AddOrder(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Order added", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) GetOrderByID(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Order", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) UpdateOrder(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Order updated", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) Register(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Registered", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) Login(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Logged in", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) Logout(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Logged out", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) GetMe(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Me", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Password changed", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Account deleted", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) AddWishlist(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Wishlist added", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) GetWishlist(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Wishlist", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) DeleteWishlist(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Wishlist deleted", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) AddWishlistItem(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Wishlist item added", http.StatusCreated)
+}
+
+func (m *MockRouterAlbums) DeleteWishlistItem(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Wishlist item deleted", http.StatusAccepted)
+}
+
+func (m *MockRouterAlbums) ShareWishlist(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Wishlist shared", http.StatusCreated)
+}
+
+func (m *MockRouterAlbums) UnshareWishlist(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Wishlist unshared", http.StatusAccepted)
+}
+
+func (m *MockRouterAlbums) GetSharedWishlist(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Shared wishlist", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) GetReviews(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Reviews", http.StatusOK)
+}
+
+func (m *MockRouterAlbums) AddReview(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Review added", http.StatusCreated)
+}
+
+func (m *MockRouterAlbums) UpdateReview(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Review updated", http.StatusAccepted)
+}
+
+func (m *MockRouterAlbums) DeleteReview(w http.ResponseWriter, r *http.Request) {
+	ServeJSON(w, "Review deleted", http.StatusAccepted)
+}
+
+// Authenticate lets every request through, except those with a token of
+// "denied" so that tests can tell the middleware ran.
+func (m *MockRouterAlbums) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer denied" {
+			ServeJSONError(w, "denied", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func TestServeJSONError(t *testing.T) {
 	rr := httptest.NewRecorder()
 	ServeJSONError(rr, "error message", http.StatusInternalServerError)
@@ -75,7 +313,66 @@ func TestSetupRouter(t *testing.T) {
 		{method: http.MethodPatch, url: "/albums/1", expectedCode: http.StatusOK},
 		{method: http.MethodDelete, url: "/albums/1", expectedCode: http.StatusOK},
 		{method: http.MethodPut, url: "/albums/random", expectedCode: http.StatusCreated},
+		{method: http.MethodGet, url: "/albums/trash", expectedCode: http.StatusAccepted},
+		{method: http.MethodPost, url: "/albums/1/restore", expectedCode: http.StatusAccepted},
+		{method: http.MethodGet, url: "/albums/1/history", expectedCode: http.StatusOK},
+		{method: http.MethodGet, url: "/audit?since=2026-01-01T00:00:00Z", expectedCode: http.StatusOK},
 		{method: http.MethodGet, url: "/albums/artist/1", expectedCode: http.StatusOK},
+		{method: http.MethodGet, url: "/search?q=blue", expectedCode: http.StatusOK},
+		{method: http.MethodGet, url: "/albums/suggest?prefix=col", expectedCode: http.StatusOK},
+		{method: http.MethodGet, url: "/artists", expectedCode: http.StatusOK},
+		{method: http.MethodPut, url: "/artists", expectedCode: http.StatusCreated},
+		{method: http.MethodGet, url: "/artists/1", expectedCode: http.StatusOK},
+		{method: http.MethodPatch, url: "/artists/1", expectedCode: http.StatusOK},
+		{method: http.MethodDelete, url: "/artists/1", expectedCode: http.StatusOK},
+		{method: http.MethodGet, url: "/artists/1/albums", expectedCode: http.StatusAccepted},
+		{method: http.MethodGet, url: "/albums/1/tracks", expectedCode: http.StatusAccepted},
+		{method: http.MethodPut, url: "/albums/1/tracks", expectedCode: http.StatusCreated},
+		{method: http.MethodPatch, url: "/albums/1/tracks", expectedCode: http.StatusAccepted},
+		{method: http.MethodDelete, url: "/albums/1/tracks/2", expectedCode: http.StatusAccepted},
+		{method: http.MethodGet, url: "/genres", expectedCode: http.StatusOK},
+		{method: http.MethodPut, url: "/genres", expectedCode: http.StatusCreated},
+		{method: http.MethodDelete, url: "/genres/1", expectedCode: http.StatusOK},
+		{method: http.MethodGet, url: "/tags?sort=albums", expectedCode: http.StatusOK},
+		{method: http.MethodDelete, url: "/tags/1", expectedCode: http.StatusOK},
+		{method: http.MethodGet, url: "/albums/1/genres", expectedCode: http.StatusAccepted},
+		{method: http.MethodPut, url: "/albums/1/tags", expectedCode: http.StatusCreated},
+		{method: http.MethodDelete, url: "/albums/1/tags/2", expectedCode: http.StatusAccepted},
+		{method: http.MethodPut, url: "/albums/1/cover", expectedCode: http.StatusCreated},
+		{method: http.MethodGet, url: "/albums/1/cover?size=256", expectedCode: http.StatusAccepted},
+		{method: http.MethodHead, url: "/albums/1/cover", expectedCode: http.StatusAccepted},
+		{method: http.MethodDelete, url: "/albums/1/cover", expectedCode: http.StatusAccepted},
+		{method: http.MethodGet, url: "/albums/1/stock", expectedCode: http.StatusAccepted},
+		{method: http.MethodPatch, url: "/albums/1/stock", expectedCode: http.StatusAccepted},
+		{method: http.MethodPut, url: "/albums/1/reservations", expectedCode: http.StatusCreated},
+		{method: http.MethodDelete, url: "/albums/1/reservations/2", expectedCode: http.StatusAccepted},
+		{method: http.MethodPut, url: "/carts", expectedCode: http.StatusOK},
+		{method: http.MethodGet, url: "/carts/abc", expectedCode: http.StatusOK},
+		{method: http.MethodDelete, url: "/carts/abc", expectedCode: http.StatusOK},
+		{method: http.MethodPut, url: "/carts/abc/items", expectedCode: http.StatusCreated},
+		{method: http.MethodDelete, url: "/carts/abc/items/1", expectedCode: http.StatusAccepted},
+		{method: http.MethodGet, url: "/orders", expectedCode: http.StatusOK},
+		{method: http.MethodPut, url: "/orders", expectedCode: http.StatusOK},
+		{method: http.MethodGet, url: "/orders/1", expectedCode: http.StatusOK},
+		{method: http.MethodPatch, url: "/orders/1", expectedCode: http.StatusOK},
+		{method: http.MethodPut, url: "/auth/register", expectedCode: http.StatusOK},
+		{method: http.MethodPut, url: "/auth/login", expectedCode: http.StatusOK},
+		{method: http.MethodDelete, url: "/auth/logout", expectedCode: http.StatusOK},
+		{method: http.MethodGet, url: "/me", expectedCode: http.StatusOK},
+		{method: http.MethodDelete, url: "/me", expectedCode: http.StatusOK},
+		{method: http.MethodPatch, url: "/me/password", expectedCode: http.StatusOK},
+		{method: http.MethodPut, url: "/wishlist", expectedCode: http.StatusOK},
+		{method: http.MethodGet, url: "/wishlist", expectedCode: http.StatusOK},
+		{method: http.MethodDelete, url: "/wishlist", expectedCode: http.StatusOK},
+		{method: http.MethodPut, url: "/wishlist/items", expectedCode: http.StatusCreated},
+		{method: http.MethodDelete, url: "/wishlist/items/1", expectedCode: http.StatusAccepted},
+		{method: http.MethodPut, url: "/wishlist/share", expectedCode: http.StatusCreated},
+		{method: http.MethodDelete, url: "/wishlist/share", expectedCode: http.StatusAccepted},
+		{method: http.MethodGet, url: "/wishlists/shared/abc", expectedCode: http.StatusOK},
+		{method: http.MethodGet, url: "/albums/1/reviews", expectedCode: http.StatusOK},
+		{method: http.MethodPut, url: "/albums/1/reviews", expectedCode: http.StatusCreated},
+		{method: http.MethodPatch, url: "/albums/1/reviews/2", expectedCode: http.StatusAccepted},
+		{method: http.MethodDelete, url: "/albums/1/reviews/2", expectedCode: http.StatusAccepted},
 		{method: http.MethodOptions, url: "/albums", expectedCode: http.StatusNoContent},
 	}
 
@@ -108,7 +405,43 @@ func TestSetupRouter__InvalidRoutes(t *testing.T) {
 		{method: http.MethodPost, url: "/albums", expectedCode: http.StatusMethodNotAllowed},
 		{method: http.MethodPut, url: "/albums/1", expectedCode: http.StatusMethodNotAllowed},
 		{method: http.MethodPost, url: "/albums/random", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodDelete, url: "/albums/trash", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, url: "/albums/1/restore", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodDelete, url: "/albums/1/history", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, url: "/audit", expectedCode: http.StatusMethodNotAllowed},
 		{method: http.MethodPut, url: "/albums/artist/1", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, url: "/search", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodPut, url: "/albums/suggest", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, url: "/artists", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodPut, url: "/artists/1", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodDelete, url: "/artists/1/albums", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodDelete, url: "/albums/1/tracks", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, url: "/albums/1/tracks/2", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodPatch, url: "/genres", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, url: "/tags/1", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodDelete, url: "/albums/1/genres", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodPatch, url: "/albums/1/tags/2", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodPatch, url: "/albums/1/cover", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodDelete, url: "/albums/1/stock", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, url: "/albums/1/reservations", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodPatch, url: "/albums/1/reservations/2", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, url: "/carts", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodPatch, url: "/carts/abc", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, url: "/carts/abc/items", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodDelete, url: "/orders", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodDelete, url: "/orders/1", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, url: "/auth/register", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, url: "/auth/login", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodPut, url: "/auth/logout", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodPatch, url: "/me", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, url: "/me/password", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodPatch, url: "/wishlist", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, url: "/wishlist/items", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodPut, url: "/wishlist/items/1", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, url: "/wishlist/share", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodDelete, url: "/wishlists/shared/abc", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodPatch, url: "/albums/1/reviews", expectedCode: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, url: "/albums/1/reviews/2", expectedCode: http.StatusMethodNotAllowed},
 	}
 
 	for _, tt := range tests {
@@ -125,3 +458,34 @@ func TestSetupRouter__InvalidRoutes(t *testing.T) {
 		}
 	}
 }
+
+func TestSetupRouter__Middleware(t *testing.T) {
+	router := SetupRouter(&MockRouterAlbums{})
+
+	tests := []struct {
+		method       string
+		expectedCode int
+	}{
+		{method: http.MethodGet, expectedCode: http.StatusUnauthorized},
+		// Preflight requests are answered before authentication
+		{method: http.MethodOptions, expectedCode: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, "/albums", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer denied")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("%v returned wrong status code: got %v want %v", tt.method, status, tt.expectedCode)
+		}
+		if origin := rr.Header().Get("Access-Control-Allow-Origin"); origin != "*" {
+			t.Errorf("%v is missing CORS headers", tt.method)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SearchResult is an album matched by a search, with its relevance score and
+// its fields with the matched words wrapped in <mark> tags. The rest of each
+// highlighted field is HTML escaped, so it can be rendered as HTML.
+type SearchResult struct {
+	Album      Album             `json:"album"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+	// matched lists the album's words that fuzzily matched the terms, which
+	// are highlighted instead of the terms themselves.
+	matched []string
+}
+
+// AlbumSearcher is implemented by stores that can search album titles and
+// artists by relevance. Terms are lower case words from tokenize; albums
+// matching any of them are returned, most relevant first.
+type AlbumSearcher interface {
+	Search(ctx context.Context, terms []string, limit int) ([]SearchResult, error)
+}
+
+// Search serves GET /search?q=, ranking albums by how well their title and
+// artist match the words of q. With fuzzy=true words also match despite
+// typos, ranked by how close they are.
+func (a *Albums) Search(w http.ResponseWriter, r *http.Request) {
+	parameters := r.URL.Query()
+
+	fuzzy := false
+	if value := parameters.Get("fuzzy"); value != "" {
+		var err error
+		if fuzzy, err = strconv.ParseBool(value); err != nil {
+			ServeJSONError(w, "fuzzy must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	search := a.searchFunc(fuzzy)
+	if search == nil {
+		ServeJSONError(w, "search is not supported by this store", http.StatusNotImplemented)
+		return
+	}
+
+	terms := tokenize(parameters.Get("q"))
+	if len(terms) == 0 {
+		ServeJSONError(w, "q must contain at least one word", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultPageLimit
+	if value := parameters.Get("limit"); value != "" {
+		var err error
+		if limit, err = parseLimit(value); err != nil {
+			ServeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	results, err := search(r.Context(), terms, limit)
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("Search %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if results == nil {
+		results = []SearchResult{}
+	}
+
+	for i, result := range results {
+		marked := terms
+		if result.matched != nil {
+			marked = result.matched
+		}
+
+		results[i].Highlights = map[string]string{
+			"title":  highlight(result.Album.Title, marked),
+			"artist": highlight(result.Album.Artist, marked),
+		}
+	}
+
+	ServeJSON(w, map[string]any{"data": results}, http.StatusOK)
+}
+
+// searchFunc returns the store's search, or nil when it cannot search.
+func (a *Albums) searchFunc(fuzzy bool) func(ctx context.Context, terms []string, limit int) ([]SearchResult, error) {
+	if fuzzy {
+		if searcher, ok := a.Store.(FuzzySearcher); ok {
+			return searcher.FuzzySearch
+		}
+		return nil
+	}
+
+	if searcher, ok := a.Store.(AlbumSearcher); ok {
+		return searcher.Search
+	}
+	return nil
+}
+
+// maxSearchTerms bounds the words of a search query that are looked up.
+const maxSearchTerms = 16
+
+// tokenize turns a search query into its terms: its words without repeats.
+func tokenize(text string) []string {
+	var terms []string
+	seen := map[string]bool{}
+
+	for _, word := range words(text) {
+		if seen[word] || len(terms) == maxSearchTerms {
+			continue
+		}
+
+		seen[word] = true
+		terms = append(terms, word)
+	}
+
+	return terms
+}
+
+// words splits text into lower case words of letters and digits.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), isSeparator)
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// highlight HTML escapes text and wraps the words matching terms in <mark> tags.
+func highlight(text string, terms []string) string {
+	var b strings.Builder
+
+	for len(text) > 0 {
+		start := strings.IndexFunc(text, func(r rune) bool { return !isSeparator(r) })
+		if start < 0 {
+			b.WriteString(html.EscapeString(text))
+			break
+		}
+
+		end := strings.IndexFunc(text[start:], isSeparator)
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start
+		}
+
+		b.WriteString(html.EscapeString(text[:start]))
+
+		word := text[start:end]
+		if containsTerm(terms, strings.ToLower(word)) {
+			b.WriteString("<mark>" + html.EscapeString(word) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(word))
+		}
+
+		text = text[end:]
+	}
+
+	return b.String()
+}
+
+func containsTerm(terms []string, word string) bool {
+	for _, term := range terms {
+		if term == word {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FullText reports whether the store's database can search albums itself.
+// SQLite cannot, so an IndexedStore searches its own index instead.
+func (s *SQLStore) FullText() bool {
+	return s.Driver == "" || s.Driver == "mysql" || s.postgres()
+}
+
+// Search uses the album_search index, a FULLTEXT index in MySQL and a GIN
+// index on a tsvector in PostgreSQL.
+func (s *SQLStore) Search(ctx context.Context, terms []string, limit int) ([]SearchResult, error) {
+	var score, where, query string
+	switch {
+	case s.postgres():
+		// Terms are letters and digits only, so they are safe to join into a tsquery
+		vector := `to_tsvector('simple', title || ' ' || artist)`
+		score = `ts_rank(` + vector + `, to_tsquery('simple', ?))`
+		where = vector + ` @@ to_tsquery('simple', ?)`
+		query = strings.Join(terms, " | ")
+	case s.FullText():
+		score = `MATCH (title, artist) AGAINST (? IN NATURAL LANGUAGE MODE)`
+		where = score
+		query = strings.Join(terms, " ")
+	default:
+		return nil, fmt.Errorf("full-text search is not supported by %v", s.Driver)
+	}
+
+	stmt, err := s.Db.PrepareContext(ctx, s.rebind(`SELECT `+albumColumns+`, `+score+` AS score
+FROM album
+WHERE deleted_at IS NULL AND `+where+`
+ORDER BY score DESC, id
+LIMIT ?`))
+	if err != nil {
+		return nil, fmt.Errorf("prepare %v", err)
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, query, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var result SearchResult
+		album := &result.Album
+		if err := rows.Scan(append(albumDest(album), &result.Score)...); err != nil {
+			return nil, fmt.Errorf("search %v", err)
+		}
+
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("search %v", err)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,286 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// indexLoadBatch is how many albums NewIndexedStore reads at a time.
+const indexLoadBatch = 500
+
+// IndexedStore adds search, fuzzy search and suggestions to a Backend. It
+// keeps an inverted index of album title and artist words in process memory,
+// updated as albums are written through it. Writes that bypass it, such as
+// another server sharing the database, are not seen until restart.
+type IndexedStore struct {
+	Backend
+
+	mu sync.RWMutex
+	// albums holds the indexed albums by id.
+	albums map[int64]Album
+	// postings maps each word to the albums containing it.
+	postings map[string]map[int64]posting
+	// trigrams maps each trigram to the words containing it, for fuzzy matching.
+	trigrams map[string]map[string]bool
+	// vocabulary holds every indexed word in order, for prefix lookups.
+	vocabulary []string
+}
+
+// posting counts the occurrences of a word in an album.
+type posting struct {
+	title  int
+	artist int
+}
+
+// NewIndexedStore indexes every album in store.
+func NewIndexedStore(ctx context.Context, store Backend) (*IndexedStore, error) {
+	s := &IndexedStore{
+		Backend:  store,
+		albums:   map[int64]Album{},
+		postings: map[string]map[int64]posting{},
+		trigrams: map[string]map[string]bool{},
+	}
+
+	var after []any
+	for {
+		albums, err := store.List(ctx, AlbumQuery{Page: Page{Limit: indexLoadBatch, After: after}})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, album := range albums {
+			s.add(album)
+		}
+
+		if len(albums) < indexLoadBatch {
+			return s, nil
+		}
+
+		after = []any{albums[len(albums)-1].ID}
+	}
+}
+
+func (s *IndexedStore) Create(ctx context.Context, album Album) (Album, error) {
+	album, err := s.Backend.Create(ctx, album)
+	if err != nil {
+		return album, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.add(album)
+
+	return album, nil
+}
+
+func (s *IndexedStore) Update(ctx context.Context, id int64, update AlbumUpdate) error {
+	if err := s.Backend.Update(ctx, id, update); err != nil {
+		return err
+	}
+
+	return s.reindex(ctx, id)
+}
+
+func (s *IndexedStore) Delete(ctx context.Context, id int64) error {
+	if err := s.Backend.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(id)
+
+	return nil
+}
+
+// Trash takes the album out of the index, and Restore puts it back.
+func (s *IndexedStore) Trash(ctx context.Context, id, version int64, now time.Time) error {
+	if err := s.Backend.Trash(ctx, id, version, now); err != nil {
+		return err
+	}
+
+	return s.reindex(ctx, id)
+}
+
+func (s *IndexedStore) Restore(ctx context.Context, id int64) error {
+	if err := s.Backend.Restore(ctx, id); err != nil {
+		return err
+	}
+
+	return s.reindex(ctx, id)
+}
+
+// UpdateArtist reindexes the artist's albums when it is renamed.
+func (s *IndexedStore) UpdateArtist(ctx context.Context, id int64, update ArtistUpdate) error {
+	if err := s.Backend.UpdateArtist(ctx, id, update); err != nil {
+		return err
+	}
+
+	if update.Name == nil {
+		return nil
+	}
+
+	albums, err := s.Backend.List(ctx, AlbumQuery{Filters: []Filter{{Field: "artist_id", Operator: OpEq, Values: []any{id}}}})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, album := range albums {
+		s.remove(album.ID)
+		s.add(album)
+	}
+
+	return nil
+}
+
+// CreateReview reindexes the album, whose rating the review changes.
+func (s *IndexedStore) CreateReview(ctx context.Context, review Review) (Review, error) {
+	review, err := s.Backend.CreateReview(ctx, review)
+	if err != nil {
+		return review, err
+	}
+
+	return review, s.reindex(ctx, review.AlbumID)
+}
+
+func (s *IndexedStore) UpdateReview(ctx context.Context, review Review) error {
+	if err := s.Backend.UpdateReview(ctx, review); err != nil {
+		return err
+	}
+
+	return s.reindex(ctx, review.AlbumID)
+}
+
+func (s *IndexedStore) DeleteReview(ctx context.Context, albumID, id int64) error {
+	if err := s.Backend.DeleteReview(ctx, albumID, id); err != nil {
+		return err
+	}
+
+	return s.reindex(ctx, albumID)
+}
+
+// reindex replaces the indexed copy of the album with id. It reads the album
+// back rather than applying a change, so the index holds exactly what the
+// store does.
+func (s *IndexedStore) reindex(ctx context.Context, id int64) error {
+	album, err := s.Backend.Get(ctx, id)
+	if err != nil && !errors.Is(err, ErrAlbumNotFound) {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(id)
+	if err == nil {
+		s.add(album)
+	}
+
+	return nil
+}
+
+// Search uses the wrapped store's full-text search when its database has one.
+// Otherwise it ranks albums by TF-IDF: each matched word scores its number of
+// occurrences, with title words counting double, weighted by how rare the
+// word is across all albums.
+func (s *IndexedStore) Search(ctx context.Context, terms []string, limit int) ([]SearchResult, error) {
+	if store, ok := s.Backend.(*SQLStore); ok && store.FullText() {
+		return store.Search(ctx, terms, limit)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scores := map[int64]float64{}
+	for _, term := range terms {
+		postings := s.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+
+		idf := math.Log(1 + float64(len(s.albums))/float64(len(postings)))
+		for id, p := range postings {
+			scores[id] += idf * float64(2*p.title+p.artist)
+		}
+	}
+
+	results := make([]SearchResult, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, SearchResult{Album: s.albums[id], Score: score})
+	}
+
+	sortResults(results)
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// sortResults orders results by descending score, then by album id.
+func sortResults(results []SearchResult) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Album.ID < results[j].Album.ID
+	})
+}
+
+// add indexes album. Callers must hold s.mu.
+func (s *IndexedStore) add(album Album) {
+	s.albums[album.ID] = album
+
+	counts := map[string]posting{}
+	for _, word := range words(album.Title) {
+		p := counts[word]
+		p.title++
+		counts[word] = p
+	}
+	for _, word := range words(album.Artist) {
+		p := counts[word]
+		p.artist++
+		counts[word] = p
+	}
+
+	for word, p := range counts {
+		if s.postings[word] == nil {
+			s.postings[word] = map[int64]posting{}
+			s.addWord(word)
+		}
+		s.postings[word][album.ID] = p
+	}
+}
+
+// remove drops the album with id from the index. Callers must hold s.mu.
+func (s *IndexedStore) remove(id int64) {
+	album, ok := s.albums[id]
+	if !ok {
+		return
+	}
+
+	delete(s.albums, id)
+
+	for _, word := range append(words(album.Title), words(album.Artist)...) {
+		if _, ok := s.postings[word]; !ok {
+			// A word repeated in the album was already removed
+			continue
+		}
+
+		delete(s.postings[word], id)
+		if len(s.postings[word]) == 0 {
+			delete(s.postings, word)
+			s.removeWord(word)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go-web-service/migrations"
+	"go-web-service/money"
+	"go-web-service/utils"
+)
+
+func TestTokenize(t *testing.T) {
+	actual := tokenize("  Blue-Train, blue TRAIN! 100%_Pure Café ")
+	expected := []string{"blue", "train", "100", "pure", "café"}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected terms: got %v want %v", actual, expected)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"Blue Train", "<mark>Blue</mark> <mark>Train</mark>"},
+		{"Bluest Train-spotting", "Bluest <mark>Train</mark>-spotting"},
+		{"<b>blue</b> & co", "&lt;b&gt;<mark>blue</mark>&lt;/b&gt; &amp; co"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if actual := highlight(tt.text, []string{"blue", "train"}); actual != tt.expected {
+			t.Errorf("highlight(%q) = %q want %q", tt.text, actual, tt.expected)
+		}
+	}
+}
+
+func TestIndexedStore(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := NewIndexedStore(ctx, NewMemoryStore(queryAlbums...))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	search := func(query string) string {
+		results, err := store.Search(ctx, tokenize(query), 10)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		var ids []string
+		for _, result := range results {
+			ids = append(ids, result.Album.Title)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	if actual := search("coltrane"); actual != "Blue Train,Giant Steps,Ballads" {
+		t.Errorf("Unexpected results: %v", actual)
+	}
+	if actual := search("sarah vaughan"); actual != "Sarah Vaughan" {
+		t.Errorf("Unexpected results: %v", actual)
+	}
+	// Matching more words ranks higher
+	if actual := search("blue coltrane"); actual != "Blue Train,Giant Steps,Ballads" {
+		t.Errorf("Unexpected results: %v", actual)
+	}
+	if actual := search("100% pure"); actual != "100%_Pure" {
+		t.Errorf("Unexpected results: %v", actual)
+	}
+
+	title := "Coltrane Plays the Blues"
+	if err := store.Update(ctx, 3, AlbumUpdate{Title: &title}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := store.Delete(ctx, 1); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := store.Create(ctx, Album{Title: "Lush Life", Artist: "John Coltrane", Price: money.New(1999, "USD")}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// A title match outranks an artist match
+	if actual := search("coltrane"); actual != "Coltrane Plays the Blues,Giant Steps,Ballads,Lush Life" {
+		t.Errorf("Unexpected results after writes: %v", actual)
+	}
+	if actual := search("jeru blue"); actual != "" {
+		t.Errorf("Expected old words to be removed from the index, got %v", actual)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	store, _ := NewIndexedStore(context.Background(), NewMemoryStore(queryAlbums...))
+	albums := NewAlbums(store)
+
+	rr := sendMockHTTPRequest(t, albums.Search, http.MethodGet, "/search?q=giant+STEPS&limit=1")
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expected := `{"data":[{"album":{"id":2,"title":"Giant Steps","artist":"John Coltrane","artist_id":1,"price":"63.99","review_count":0,"average_rating":null,"currency":"USD"},"score":8.317766166719343,"highlights":{"artist":"John Coltrane","title":"\u003cmark\u003eGiant\u003c/mark\u003e \u003cmark\u003eSteps\u003c/mark\u003e"}}]}`
+	if actual := strings.TrimSpace(rr.Body.String()); actual != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", actual, expected)
+	}
+
+	rr = sendMockHTTPRequest(t, albums.Search, http.MethodGet, "/search?q=nothing+matches")
+	if actual := strings.TrimSpace(rr.Body.String()); actual != `{"data":[]}` {
+		t.Errorf("Handler returned unexpected body: got %v want %v", actual, `{"data":[]}`)
+	}
+}
+
+func TestSearch_Errors(t *testing.T) {
+	store, _ := NewIndexedStore(context.Background(), NewMemoryStore())
+
+	tests := []struct {
+		albums       *Albums
+		url          string
+		expectedCode int
+		expected     string
+	}{
+		{NewAlbums(store), "/search", http.StatusBadRequest, `{"errors":"q must contain at least one word"}`},
+		{NewAlbums(store), "/search?q=%25%25", http.StatusBadRequest, `{"errors":"q must contain at least one word"}`},
+		{NewAlbums(store), "/search?q=blue&limit=0", http.StatusBadRequest, `{"errors":"limit must be a number between 1 and 100"}`},
+		{NewAlbums(NewMemoryStore()), "/search?q=blue", http.StatusNotImplemented, `{"errors":"search is not supported by this store"}`},
+	}
+
+	for _, tt := range tests {
+		rr := sendMockHTTPRequest(t, tt.albums.Search, http.MethodGet, tt.url)
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("%v returned wrong status code: got %v want %v", tt.url, status, tt.expectedCode)
+		}
+
+		if actual := strings.TrimSpace(rr.Body.String()); actual != tt.expected {
+			t.Errorf("%v returned unexpected body: got %v want %v", tt.url, actual, tt.expected)
+		}
+	}
+}
+
+func TestSQLStore_Search(t *testing.T) {
+	tests := []struct {
+		driver string
+		query  string
+		arg    string
+	}{
+		{"mysql", `SELECT id, title, artist, artist_id, currency, price, release_date, label, format, catalog_number, barcode, review_count, average_rating, version, MATCH \(title, artist\) AGAINST \(\? IN NATURAL LANGUAGE MODE\) AS score
+FROM album
+WHERE deleted_at IS NULL AND MATCH \(title, artist\) AGAINST \(\? IN NATURAL LANGUAGE MODE\)
+ORDER BY score DESC, id
+LIMIT \?`, "blue train"},
+		{"postgres", `SELECT id, title, artist, artist_id, currency, price, release_date, label, format, catalog_number, barcode, review_count, average_rating, version, ts_rank\(to_tsvector\('simple', title \|\| ' ' \|\| artist\), to_tsquery\('simple', \$1\)\) AS score
+FROM album
+WHERE deleted_at IS NULL AND to_tsvector\('simple', title \|\| ' ' \|\| artist\) @@ to_tsquery\('simple', \$2\)
+ORDER BY score DESC, id
+LIMIT \$3`, "blue | train"},
+	}
+
+	for _, tt := range tests {
+		db, mock := getMockDB(t)
+
+		mock.ExpectPrepare(tt.query).
+			ExpectQuery().
+			WithArgs(tt.arg, tt.arg, 5).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title", "artist", "artist_id", "currency", "price", "release_date", "label", "format", "catalog_number", "barcode", "review_count", "average_rating", "version", "score"}).
+				AddRow(1, "Blue Train", "John Coltrane", 1, "USD", "56.99", nil, "", "", "", nil, 0, 0, 1, 0.75))
+
+		store := &SQLStore{Db: db, Driver: tt.driver}
+		results, err := store.Search(context.Background(), []string{"blue", "train"}, 5)
+		if err != nil {
+			t.Fatalf("%v: expected no error, got %v", tt.driver, err)
+		}
+
+		if len(results) != 1 || results[0].Album.Title != "Blue Train" || results[0].Score != 0.75 {
+			t.Errorf("%v: unexpected results %v", tt.driver, results)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%v: there were unfulfilled expectations: %v", tt.driver, err)
+		}
+
+		db.Close()
+	}
+
+	if (&SQLStore{Driver: "sqlite"}).FullText() {
+		t.Errorf("Expected SQLite to need the in-process index")
+	}
+}
+
+func TestIndexedStore_SQLite(t *testing.T) {
+	t.Setenv("DATABASE_DRIVER", "sqlite")
+	t.Setenv("DATABASE_PATH", filepath.Join(t.TempDir(), "recordings.db"))
+
+	db, err := utils.DatabaseInit()
+	if err != nil {
+		t.Fatalf("Failed to open sqlite database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := (&migrations.Migrator{Db: db, Driver: "sqlite"}).Up(context.Background()); err != nil {
+		t.Fatalf("Failed to migrate sqlite database: %v", err)
+	}
+
+	store, err := NewIndexedStore(context.Background(), &SQLStore{Db: db, Driver: "sqlite"})
+	if err != nil {
+		t.Fatalf("Failed to index sqlite database: %v", err)
+	}
+
+	results, err := store.Search(context.Background(), []string{"malone"}, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(results) != 1 || results[0].Album.Title != "F-1 Trillion" {
+		t.Errorf("Unexpected results %v", results)
+	}
+}
+
+func TestIndexedStore_FullText(t *testing.T) {
+	db, mock := getMockDB(t)
+	defer db.Close()
+
+	mock.ExpectPrepare(`MATCH \(title, artist\) AGAINST`).
+		ExpectQuery().
+		WithArgs("jeru", "jeru", 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "artist", "artist_id", "currency", "price", "release_date", "label", "format", "catalog_number", "barcode", "review_count", "average_rating", "version", "score"}))
+
+	// Databases with full-text search answer searches themselves
+	store := &IndexedStore{Backend: &SQLStore{Db: db, Driver: "mysql"}}
+	if _, err := store.Search(context.Background(), []string{"jeru"}, 10); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"strings"
+)
+
+// likeEscaper escapes the LIKE wildcards in a contains value, so a user's
+// % and _ match themselves. ! is used as the escape character because a
+// backslash means different things in MySQL and PostgreSQL string literals.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// where compiles filters into SQL conditions and their arguments. Column
+// names come from the albumFields whitelist; values are always parameters.
+// The conditions always leave out albums in the trash.
+func (s *SQLStore) where(filters []Filter) ([]string, []any) {
+	conditions := []string{"deleted_at IS NULL"}
+	var args []any
+
+	for _, filter := range filters {
+		field := albumFields[filter.Field]
+		column := field.column
+
+		if field.label != "" {
+			condition, labelArgs := labelCondition(field.label, filter)
+			conditions = append(conditions, condition)
+			args = append(args, labelArgs...)
+			continue
+		}
+
+		switch filter.Operator {
+		case OpContains:
+			conditions = append(conditions, column+" "+s.like()+" ? ESCAPE '!'")
+			args = append(args, "%"+likeEscaper.Replace(filter.Values[0].(string))+"%")
+		case OpIn:
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(filter.Values)), ", ")
+			conditions = append(conditions, column+" IN ("+placeholders+")")
+			args = append(args, filter.Values...)
+		default:
+			conditions = append(conditions, column+" "+comparisons[filter.Operator]+" ?")
+			args = append(args, filter.Values[0])
+		}
+	}
+
+	return conditions, args
+}
+
+// labelCondition compiles a genre or tag filter into an EXISTS subquery over
+// the kind's join table, negated for neq.
+func labelCondition(kind LabelKind, filter Filter) (string, []any) {
+	described := labelKinds[kind]
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(filter.Values)), ", ")
+	condition := "EXISTS (SELECT 1 FROM " + described.join + " j JOIN " + described.table + " l ON l.id = j." + described.column +
+		" WHERE j.album_id = album.id AND l.name_key IN (" + placeholders + "))"
+	if filter.Operator == OpNeq {
+		condition = "NOT " + condition
+	}
+
+	return condition, filter.Values
+}
+
+var comparisons = map[Operator]string{
+	OpEq:  "=",
+	OpNeq: "<>",
+	OpLt:  "<",
+	OpLte: "<=",
+	OpGt:  ">",
+	OpGte: ">=",
+}
+
+// keyset compiles the condition for albums after key in order, or before it
+// when backwards is set. For an order of a, b it is
+// (a > ?) OR (a = ? AND b > ?), with < for descending keys.
+func (s *SQLStore) keyset(order []SortKey, key []any, backwards bool) (string, []any) {
+	var alternatives []string
+	var args []any
+
+	for i, sortKey := range order {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, albumFields[order[j].Field].column+" = ?")
+			args = append(args, key[j])
+		}
+
+		operator := ">"
+		if sortKey.Desc != backwards {
+			operator = "<"
+		}
+		terms = append(terms, albumFields[sortKey.Field].column+" "+operator+" ?")
+		args = append(args, key[i])
+
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// orderBy compiles the ORDER BY list of order, reversed when backwards is set.
+func orderBy(order []SortKey, backwards bool) string {
+	var columns []string
+	for _, sortKey := range order {
+		column := albumFields[sortKey.Field].column
+		if sortKey.Desc != backwards {
+			column += " DESC"
+		}
+
+		columns = append(columns, column)
+	}
+
+	return strings.Join(columns, ", ")
+}
+
+// like returns the case-insensitive LIKE operator of the store's dialect.
+func (s *SQLStore) like() string {
+	if s.postgres() {
+		return "ILIKE"
+	}
+
+	return "LIKE"
+}
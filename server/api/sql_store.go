@@ -0,0 +1,954 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go-web-service/utils"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// albumColumns lists the album columns in the order albumDest scans them.
+// The currency comes before the price because money.Money needs it to scan.
+const albumColumns = "id, title, artist, artist_id, currency, price, release_date, label, format, catalog_number, barcode, review_count, average_rating, version"
+
+// artistColumns lists the artist columns in the order handleArtistRows scans them.
+const artistColumns = "id, name, bio"
+
+// trackColumns lists the track columns in the order Tracks scans them.
+const trackColumns = "id, album_id, disc, position, title, duration, isrc"
+
+// querier is the part of *sql.DB and *sql.Tx that reads, for lookups made
+// both inside a write's transaction and outside any.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// SQLStore is a Backend kept in a MySQL, PostgreSQL or SQLite database.
+type SQLStore struct {
+	Db *sql.DB
+	// Driver selects the SQL dialect. MySQL and SQLite share one; "postgres"
+	// switches to $n placeholders, RETURNING and case-insensitive ILIKE.
+	Driver string
+}
+
+func (s *SQLStore) List(ctx context.Context, query AlbumQuery) ([]Album, error) {
+	order := query.order()
+	conditions, args := s.where(query.Filters)
+
+	bound, backwards := query.Page.After, false
+	if query.Page.Before != nil {
+		// Walk backwards from the cursor, then put the rows back in order below
+		bound, backwards = query.Page.Before, true
+	}
+	if bound != nil {
+		condition, keyArgs := s.keyset(order, bound, backwards)
+		conditions = append(conditions, condition)
+		args = append(args, keyArgs...)
+	}
+
+	statement := `SELECT ` + albumColumns + ` FROM album`
+	if len(conditions) > 0 {
+		statement += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	statement += ` ORDER BY ` + orderBy(order, backwards)
+	if query.Page.Limit > 0 {
+		statement += ` LIMIT ?`
+		args = append(args, query.Page.Limit)
+	}
+
+	stmt, err := s.Db.PrepareContext(ctx, s.rebind(statement))
+	if err != nil {
+		return nil, fmt.Errorf("prepare %v", err)
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	albums, err := handleAlbumRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if backwards {
+		slices.Reverse(albums)
+	}
+
+	return albums, nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, id int64) (Album, error) {
+	stmt, err := s.Db.PrepareContext(ctx, s.rebind(`SELECT `+albumColumns+` FROM album WHERE id = ? AND deleted_at IS NULL`))
+	if err != nil {
+		return Album{}, fmt.Errorf("prepare %v", err)
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, id)
+	if err != nil {
+		return Album{}, err
+	}
+
+	albums, err := handleAlbumRows(rows)
+	if err != nil {
+		return Album{}, err
+	}
+
+	if len(albums) == 0 {
+		return Album{}, ErrAlbumNotFound
+	}
+
+	return albums[0], nil
+}
+
+func (s *SQLStore) Create(ctx context.Context, album Album) (Album, error) {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return Album{}, err
+	}
+	defer tx.Rollback()
+
+	artist, err := s.albumArtist(ctx, tx, album.ArtistID, album.Artist)
+	if err != nil {
+		return Album{}, err
+	}
+	album.ArtistID, album.Artist = artist.ID, artist.Name
+	album.Version = 1
+
+	if err := s.checkBarcode(ctx, tx, album.Barcode, 0); err != nil {
+		return Album{}, err
+	}
+
+	query := `INSERT INTO album (title, artist, artist_id, price, currency, release_date, label, format, catalog_number, barcode)` +
+		` VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	args := []any{album.Title, album.Artist, album.ArtistID, album.Price, album.Price.Currency,
+		album.ReleaseDate, album.RecordLabel, album.Format, album.CatalogNumber, album.Barcode}
+	if s.postgres() {
+		// lib/pq and pgx do not support LastInsertId, so ask for the id instead.
+		query += ` RETURNING id`
+	}
+
+	stmt, err := tx.PrepareContext(ctx, s.rebind(query))
+	if err != nil {
+		return Album{}, fmt.Errorf("prepare %v", err)
+	}
+	defer stmt.Close()
+
+	if s.postgres() {
+		err = stmt.QueryRowContext(ctx, args...).Scan(&album.ID)
+		if uniqueViolation(err) {
+			return Album{}, ErrBarcodeExists
+		}
+		if err != nil {
+			return Album{}, err
+		}
+	} else {
+		result, err := stmt.ExecContext(ctx, args...)
+		if uniqueViolation(err) {
+			return Album{}, ErrBarcodeExists
+		}
+		if err != nil {
+			return Album{}, err
+		}
+
+		lastId, err := result.LastInsertId()
+		if err != nil {
+			return Album{}, err
+		}
+
+		album.ID = lastId
+	}
+
+	if err := s.audit(ctx, tx, album.ID, AuditCreate, nil, &album, time.Now()); err != nil {
+		return Album{}, err
+	}
+
+	return album, tx.Commit()
+}
+
+func (s *SQLStore) Update(ctx context.Context, id int64, update AlbumUpdate) error {
+	if update.Empty() {
+		return nil
+	}
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := s.lockAlbum(ctx, tx, id, true)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	var values []any
+	var artist *Artist
+
+	if update.Title != nil {
+		keys = append(keys, "title = ?")
+		values = append(values, *update.Title)
+	}
+	if update.Artist != nil || update.ArtistID != nil {
+		var id int64
+		var name string
+		if update.ArtistID != nil {
+			id = *update.ArtistID
+		} else {
+			name = *update.Artist
+		}
+
+		resolved, err := s.albumArtist(ctx, tx, id, name)
+		if err != nil {
+			return err
+		}
+		artist = &resolved
+
+		keys = append(keys, "artist = ?", "artist_id = ?")
+		values = append(values, artist.Name, artist.ID)
+	}
+	if update.Price != nil {
+		keys = append(keys, "price = ?", "currency = ?")
+		values = append(values, *update.Price, update.Price.Currency)
+	}
+	if update.ReleaseDate != nil {
+		keys = append(keys, "release_date = ?")
+		values = append(values, *update.ReleaseDate)
+	}
+	if update.RecordLabel != nil {
+		keys = append(keys, "label = ?")
+		values = append(values, *update.RecordLabel)
+	}
+	if update.Format != nil {
+		keys = append(keys, "format = ?")
+		values = append(values, *update.Format)
+	}
+	if update.CatalogNumber != nil {
+		keys = append(keys, "catalog_number = ?")
+		values = append(values, *update.CatalogNumber)
+	}
+	if update.Barcode != nil {
+		if err := s.checkBarcode(ctx, tx, *update.Barcode, id); err != nil {
+			return err
+		}
+
+		keys = append(keys, "barcode = ?")
+		values = append(values, *update.Barcode)
+	}
+
+	keys = append(keys, "version = version + 1")
+	dynamicSql := `UPDATE album SET ` + strings.Join(keys, ", ") + ` WHERE id = ? AND deleted_at IS NULL`
+	values = append(values, id)
+	if update.Version != 0 {
+		dynamicSql += ` AND version = ?`
+		values = append(values, update.Version)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, s.rebind(dynamicSql))
+	if err != nil {
+		return fmt.Errorf("prepare %v", err)
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, values...)
+	if uniqueViolation(err) {
+		return ErrBarcodeExists
+	}
+	if err != nil {
+		return err
+	}
+	if update.Version != 0 {
+		if err := s.checkVersion(ctx, tx, result, id); err != nil {
+			return err
+		}
+	}
+
+	after := before
+	if artist != nil {
+		after.ArtistID, after.Artist = artist.ID, artist.Name
+	}
+	update.apply(&after)
+	if err := s.audit(ctx, tx, id, AuditUpdate, &before, &after, time.Now()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) Delete(ctx context.Context, id int64) error {
+	return s.deleteAlbum(ctx, id, "DELETE FROM album WHERE id = ?", id)
+}
+
+func (s *SQLStore) Purge(ctx context.Context, id int64, cutoff time.Time) error {
+	return s.deleteAlbum(ctx, id, "DELETE FROM album WHERE id = ? AND deleted_at IS NOT NULL AND deleted_at <= ?", id, cutoff.UTC())
+}
+
+// deleteAlbum deletes the album with id by statement and logs the purge in
+// one transaction. It returns ErrAlbumNotFound when statement deletes no row.
+func (s *SQLStore) deleteAlbum(ctx context.Context, id int64, statement string, args ...any) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	album, err := s.lockAlbum(ctx, tx, id, false)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, s.rebind(statement), args...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAlbumNotFound
+	}
+
+	if err := s.audit(ctx, tx, id, AuditPurge, &album, nil, time.Now()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) Count(ctx context.Context, filters []Filter) (int64, error) {
+	statement := `SELECT COUNT(*) FROM album`
+	conditions, args := s.where(filters)
+	if len(conditions) > 0 {
+		statement += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	var count int64
+	if err := s.Db.QueryRowContext(ctx, s.rebind(statement), args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count %v", err)
+	}
+
+	return count, nil
+}
+
+// checkVersion tells why a write made against a version of the album with
+// id changed no rows: ErrAlbumNotFound when the album is gone or in the
+// trash, and ErrVersionMismatch when it has moved to another version.
+func (s *SQLStore) checkVersion(ctx context.Context, db querier, result sql.Result, id int64) error {
+	affected, err := result.RowsAffected()
+	if err != nil || affected > 0 {
+		return err
+	}
+
+	var albums int
+	if err := db.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM album WHERE id = ? AND deleted_at IS NULL`), id).Scan(&albums); err != nil {
+		return err
+	}
+	if albums == 0 {
+		return ErrAlbumNotFound
+	}
+
+	return ErrVersionMismatch
+}
+
+// checkBarcode returns ErrBarcodeExists when an album other than the one
+// with id has the barcode. The unique index still guards against races, and
+// the writes map its violations to ErrBarcodeExists too.
+func (s *SQLStore) checkBarcode(ctx context.Context, db querier, barcode Barcode, id int64) error {
+	if barcode == "" {
+		return nil
+	}
+
+	var taken int
+	err := db.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM album WHERE barcode = ? AND id <> ?`), barcode, id).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrBarcodeExists
+	}
+
+	return nil
+}
+
+// uniqueViolation reports whether err is the driver's error for a write that
+// breaks a unique index.
+func uniqueViolation(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	var pgErr *pgconn.PgError
+	var sqliteErr *sqlite.Error
+
+	switch {
+	case errors.As(err, &mysqlErr):
+		return mysqlErr.Number == 1062
+	case errors.As(err, &pgErr):
+		return pgErr.Code == "23505"
+	case errors.As(err, &sqliteErr):
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+	}
+
+	return false
+}
+
+func (s *SQLStore) postgres() bool {
+	return s.Driver == "postgres"
+}
+
+// rebind rewrites the ? placeholders in query into the form the store's driver expects.
+func (s *SQLStore) rebind(query string) string {
+	return utils.Rebind(s.Driver, query)
+}
+
+// albumDest returns pointers to the fields of album in albumColumns order, for Scan.
+func albumDest(album *Album) []any {
+	return []any{&album.ID, &album.Title, &album.Artist, &album.ArtistID, &album.Price.Currency, &album.Price,
+		&album.ReleaseDate, &album.RecordLabel, &album.Format, &album.CatalogNumber, &album.Barcode, &album.ReviewCount,
+		averageScanner{&album.AverageRating}, &album.Version}
+}
+
+var handleAlbumRows = func(rows *sql.Rows) ([]Album, error) {
+	// Albums slice to hold db rows
+	var albums []Album
+
+	defer rows.Close()
+
+	// Loop rows using Scan to assign to struct fields
+	for rows.Next() {
+		var album Album
+		if err := rows.Scan(albumDest(&album)...); err != nil {
+			return nil, fmt.Errorf("handleAlbumRows %v", err)
+		}
+
+		albums = append(albums, album)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("handleAlbumRows %v", err)
+	}
+
+	return albums, nil
+}
+
+func (s *SQLStore) ListArtists(ctx context.Context, query ArtistQuery) ([]Artist, error) {
+	statement := `SELECT ` + artistColumns + ` FROM artist`
+	var args []any
+	if query.After != nil {
+		key := nameKey(query.After.Name)
+		statement += ` WHERE name_key > ? OR (name_key = ? AND id > ?)`
+		args = append(args, key, key, query.After.ID)
+	}
+	statement += ` ORDER BY name_key, id`
+	if query.Limit > 0 {
+		statement += ` LIMIT ?`
+		args = append(args, query.Limit)
+	}
+
+	rows, err := s.Db.QueryContext(ctx, s.rebind(statement), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return handleArtistRows(rows)
+}
+
+func (s *SQLStore) GetArtist(ctx context.Context, id int64) (Artist, error) {
+	return s.getArtist(ctx, s.Db, id)
+}
+
+func (s *SQLStore) getArtist(ctx context.Context, db querier, id int64) (Artist, error) {
+	rows, err := db.QueryContext(ctx, s.rebind(`SELECT `+artistColumns+` FROM artist WHERE id = ?`), id)
+	if err != nil {
+		return Artist{}, err
+	}
+
+	artists, err := handleArtistRows(rows)
+	if err != nil {
+		return Artist{}, err
+	}
+
+	if len(artists) == 0 {
+		return Artist{}, ErrArtistNotFound
+	}
+
+	return artists[0], nil
+}
+
+func (s *SQLStore) CreateArtist(ctx context.Context, artist Artist) (Artist, error) {
+	artist.Name = normalizeName(artist.Name)
+
+	if _, err := s.artistByName(ctx, s.Db, artist.Name, false); err == nil {
+		return Artist{}, ErrArtistExists
+	} else if !errors.Is(err, ErrArtistNotFound) {
+		return Artist{}, err
+	}
+
+	query := `INSERT INTO artist (name, name_key, bio) VALUES (?, ?, ?)`
+	args := []any{artist.Name, nameKey(artist.Name), artist.Bio}
+
+	if s.postgres() {
+		err := s.Db.QueryRowContext(ctx, s.rebind(query+` RETURNING id`), args...).Scan(&artist.ID)
+		if err != nil {
+			return Artist{}, err
+		}
+
+		return artist, nil
+	}
+
+	result, err := s.Db.ExecContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return Artist{}, err
+	}
+
+	if artist.ID, err = result.LastInsertId(); err != nil {
+		return Artist{}, err
+	}
+
+	return artist, nil
+}
+
+func (s *SQLStore) UpdateArtist(ctx context.Context, id int64, update ArtistUpdate) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM artist WHERE id = ?`), id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return ErrArtistNotFound
+	}
+
+	var keys []string
+	var values []any
+
+	var name string
+	if update.Name != nil {
+		name = normalizeName(*update.Name)
+
+		var taken int
+		err := tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM artist WHERE name_key = ? AND id <> ?`), nameKey(name), id).Scan(&taken)
+		if err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrArtistExists
+		}
+
+		keys = append(keys, "name = ?", "name_key = ?")
+		values = append(values, name, nameKey(name))
+	}
+	if update.Bio != nil {
+		keys = append(keys, "bio = ?")
+		values = append(values, *update.Bio)
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`UPDATE artist SET `+strings.Join(keys, ", ")+` WHERE id = ?`), append(values, id)...)
+	if err != nil {
+		return err
+	}
+
+	if update.Name != nil {
+		if err := s.moveAlbums(ctx, tx, id, id, name, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// moveAlbums puts the albums of the artist with from under the artist with to
+// called name inside tx, and logs the update of each album it changes.
+func (s *SQLStore) moveAlbums(ctx context.Context, tx *sql.Tx, from, to int64, name string, now time.Time) error {
+	query := `SELECT ` + albumColumns + ` FROM album WHERE artist_id = ? ORDER BY id`
+	if s.Driver != "sqlite" {
+		query += ` FOR UPDATE`
+	}
+
+	rows, err := tx.QueryContext(ctx, s.rebind(query), from)
+	if err != nil {
+		return err
+	}
+	albums, err := handleAlbumRows(rows)
+	if err != nil {
+		return err
+	}
+
+	for _, before := range albums {
+		if before.ArtistID == to && before.Artist == name {
+			continue
+		}
+
+		_, err := tx.ExecContext(ctx, s.rebind(`UPDATE album SET artist_id = ?, artist = ?, version = version + 1 WHERE id = ?`), to, name, before.ID)
+		if err != nil {
+			return err
+		}
+
+		after := before
+		after.ArtistID, after.Artist = to, name
+		after.Version++
+		if err := s.audit(ctx, tx, before.ID, AuditUpdate, &before, &after, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLStore) DeleteArtist(ctx context.Context, id int64) error {
+	result, err := s.Db.ExecContext(ctx, s.rebind(`DELETE FROM artist WHERE id = ? AND NOT EXISTS (SELECT 1 FROM album WHERE artist_id = ?)`), id, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		// Either there is no such artist or it still has albums
+		if _, err := s.GetArtist(ctx, id); err != nil {
+			return err
+		}
+		return ErrArtistHasAlbums
+	}
+
+	return nil
+}
+
+// NormalizeArtists brings the artists in line with normalizeName and
+// nameKey, which the SQL that created the artist table could only
+// approximate: it trims spaces but does not collapse those inside names.
+// Artists whose names then match are merged into the first one created, which
+// takes over their albums. It changes nothing once the artists are in line,
+// and is run on start after the migrations. The album updates are logged as
+// made by the system.
+func (s *SQLStore) NormalizeArtists(ctx context.Context) error {
+	ctx = withActor(ctx, systemActor)
+	now := time.Now()
+
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, name, name_key FROM artist ORDER BY id`)
+	if err != nil {
+		return err
+	}
+
+	type storedArtist struct {
+		id        int64
+		name, key string
+	}
+	var artists []storedArtist
+	first := map[string]storedArtist{}
+	for rows.Next() {
+		var artist storedArtist
+		if err := rows.Scan(&artist.id, &artist.name, &artist.key); err != nil {
+			rows.Close()
+			return err
+		}
+
+		artists = append(artists, artist)
+		if _, ok := first[nameKey(artist.name)]; !ok {
+			first[nameKey(artist.name)] = artist
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Merge the duplicates first, so that their keys are free for the
+	// artists they are merged into
+	for _, artist := range artists {
+		into := first[nameKey(artist.name)]
+		if into.id == artist.id {
+			continue
+		}
+
+		if err := s.moveAlbums(ctx, tx, artist.id, into.id, normalizeName(into.name), now); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM artist WHERE id = ?`), artist.id); err != nil {
+			return err
+		}
+	}
+
+	for _, artist := range first {
+		name := normalizeName(artist.name)
+		if name == artist.name && nameKey(name) == artist.key {
+			continue
+		}
+
+		_, err := tx.ExecContext(ctx, s.rebind(`UPDATE artist SET name = ?, name_key = ? WHERE id = ?`), name, nameKey(name), artist.id)
+		if err != nil {
+			return err
+		}
+		if err := s.moveAlbums(ctx, tx, artist.id, artist.id, name, now); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// artistByName returns the artist whose name matches name ignoring case and
+// spacing. lock reads it with a shared lock where the driver has them.
+func (s *SQLStore) artistByName(ctx context.Context, db querier, name string, lock bool) (Artist, error) {
+	query := `SELECT ` + artistColumns + ` FROM artist WHERE name_key = ?`
+	if lock && s.Driver != "sqlite" {
+		query += ` FOR SHARE`
+	}
+
+	rows, err := db.QueryContext(ctx, s.rebind(query), nameKey(name))
+	if err != nil {
+		return Artist{}, err
+	}
+
+	artists, err := handleArtistRows(rows)
+	if err != nil {
+		return Artist{}, err
+	}
+
+	if len(artists) == 0 {
+		return Artist{}, ErrArtistNotFound
+	}
+
+	return artists[0], nil
+}
+
+// albumArtist returns the artist with id, or when id is zero the artist
+// called name, creating it if needed, inside the transaction of an album
+// write.
+func (s *SQLStore) albumArtist(ctx context.Context, tx *sql.Tx, id int64, name string) (Artist, error) {
+	if id != 0 {
+		return s.getArtist(ctx, tx, id)
+	}
+
+	artist, err := s.artistByName(ctx, tx, name, false)
+	if !errors.Is(err, ErrArtistNotFound) {
+		return artist, err
+	}
+
+	// Another request may be creating the artist too. The insert then waits
+	// for it and does nothing, and the locking read sees its artist even
+	// where plain reads keep to the snapshot tx began with.
+	query := `INSERT INTO artist (name, name_key, bio) VALUES (?, ?, '') ON CONFLICT DO NOTHING`
+	if s.Driver == "mysql" {
+		query = `INSERT IGNORE INTO artist (name, name_key, bio) VALUES (?, ?, '')`
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(query), normalizeName(name), nameKey(name)); err != nil {
+		return Artist{}, err
+	}
+
+	return s.artistByName(ctx, tx, name, true)
+}
+
+func handleArtistRows(rows *sql.Rows) ([]Artist, error) {
+	defer rows.Close()
+
+	var artists []Artist
+	for rows.Next() {
+		var artist Artist
+		if err := rows.Scan(&artist.ID, &artist.Name, &artist.Bio); err != nil {
+			return nil, fmt.Errorf("handleArtistRows %v", err)
+		}
+
+		artists = append(artists, artist)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("handleArtistRows %v", err)
+	}
+
+	return artists, nil
+}
+
+func (s *SQLStore) Tracks(ctx context.Context, albumIDs []int64) (map[int64][]Track, error) {
+	tracks := map[int64][]Track{}
+	if len(albumIDs) == 0 {
+		return tracks, nil
+	}
+
+	args := make([]any, len(albumIDs))
+	for i, id := range albumIDs {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(albumIDs)), ", ")
+
+	rows, err := s.Db.QueryContext(ctx, s.rebind(`SELECT `+trackColumns+` FROM track WHERE album_id IN (`+
+		placeholders+`) ORDER BY album_id, disc, position`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var track Track
+		if err := rows.Scan(&track.ID, &track.AlbumID, &track.Disc, &track.Position, &track.Title, &track.Duration, &track.ISRC); err != nil {
+			return nil, fmt.Errorf("tracks %v", err)
+		}
+
+		tracks[track.AlbumID] = append(tracks[track.AlbumID], track)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("tracks %v", err)
+	}
+
+	return tracks, nil
+}
+
+func (s *SQLStore) AddTrack(ctx context.Context, track Track) (Track, error) {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return Track{}, err
+	}
+	defer tx.Rollback()
+
+	// Lock the album so that writes to its tracks number them one at a time
+	if _, err := s.lockAlbum(ctx, tx, track.AlbumID, true); err != nil {
+		return Track{}, err
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM track WHERE album_id = ? AND disc = ?`), track.AlbumID, track.Disc).Scan(&count)
+	if err != nil {
+		return Track{}, err
+	}
+
+	if track.Position < 1 || track.Position > count {
+		track.Position = count + 1
+	} else {
+		_, err := tx.ExecContext(ctx, s.rebind(`UPDATE track SET position = position + 1 WHERE album_id = ? AND disc = ? AND position >= ?`),
+			track.AlbumID, track.Disc, track.Position)
+		if err != nil {
+			return Track{}, err
+		}
+	}
+
+	query := `INSERT INTO track (album_id, disc, position, title, duration, isrc) VALUES (?, ?, ?, ?, ?, ?)`
+	args := []any{track.AlbumID, track.Disc, track.Position, track.Title, track.Duration, track.ISRC}
+
+	if s.postgres() {
+		if err := tx.QueryRowContext(ctx, s.rebind(query+` RETURNING id`), args...).Scan(&track.ID); err != nil {
+			return Track{}, err
+		}
+	} else {
+		result, err := tx.ExecContext(ctx, s.rebind(query), args...)
+		if err != nil {
+			return Track{}, err
+		}
+
+		if track.ID, err = result.LastInsertId(); err != nil {
+			return Track{}, err
+		}
+	}
+
+	return track, tx.Commit()
+}
+
+func (s *SQLStore) ReorderTracks(ctx context.Context, albumID int64, trackIDs []int64) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := s.lockAlbum(ctx, tx, albumID, true); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, s.rebind(`SELECT id, disc FROM track WHERE album_id = ?`), albumID)
+	if err != nil {
+		return err
+	}
+
+	discs := map[int64]int{}
+	for rows.Next() {
+		var id int64
+		var disc int
+		if err := rows.Scan(&id, &disc); err != nil {
+			rows.Close()
+			return err
+		}
+		discs[id] = disc
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	positions, err := trackPositions(discs, trackIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range trackIDs {
+		if _, err := tx.ExecContext(ctx, s.rebind(`UPDATE track SET position = ? WHERE id = ?`), positions[id], id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) DeleteTrack(ctx context.Context, albumID, trackID int64) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := s.lockAlbum(ctx, tx, albumID, false); errors.Is(err, ErrAlbumNotFound) {
+		return ErrTrackNotFound
+	} else if err != nil {
+		return err
+	}
+
+	var disc, position int
+	err = tx.QueryRowContext(ctx, s.rebind(`SELECT disc, position FROM track WHERE id = ? AND album_id = ?`), trackID, albumID).Scan(&disc, &position)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTrackNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM track WHERE id = ?`), trackID); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`UPDATE track SET position = position - 1 WHERE album_id = ? AND disc = ? AND position > ?`),
+		albumID, disc, position)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
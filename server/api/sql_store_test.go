@@ -0,0 +1,270 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go-web-service/migrations"
+	"go-web-service/money"
+	"go-web-service/utils"
+)
+
+func TestSQLStore_SQLite(t *testing.T) {
+	t.Setenv("DATABASE_DRIVER", "sqlite")
+	t.Setenv("DATABASE_PATH", filepath.Join(t.TempDir(), "recordings.db"))
+
+	db, err := utils.DatabaseInit()
+	if err != nil {
+		t.Fatalf("Failed to open sqlite database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := (&migrations.Migrator{Db: db, Driver: "sqlite"}).Up(context.Background()); err != nil {
+		t.Fatalf("Failed to migrate sqlite database: %v", err)
+	}
+
+	router := SetupRouter(NewAlbums(&SQLStore{Db: db, Driver: "sqlite"}))
+
+	tests := []struct {
+		method       string
+		url          string
+		expectedCode int
+		expected     string
+	}{
+		{http.MethodGet, "/albums/3", http.StatusOK, `[{"id":3,"title":"Jeru","artist":"Gerry Mulligan","artist_id":2,"price":"17.99","review_count":0,"average_rating":null,"currency":"USD"}]`},
+		{http.MethodGet, "/albums/artist/coltrane", http.StatusOK, `{"data":[{"id":1,"title":"Blue Train","artist":"John Coltrane","artist_id":1,"price":"56.99","review_count":0,"average_rating":null,"currency":"USD"},{"id":2,"title":"Giant Steps","artist":"John Coltrane","artist_id":1,"price":"63.99","review_count":0,"average_rating":null,"currency":"USD"}],"next":null,"prev":null}`},
+		{http.MethodPut, "/albums?title=Kind+of+Blue&artist=Miles+Davis&price=29.99", http.StatusOK, `{"id":6,"title":"Kind of Blue","artist":"Miles Davis","artist_id":5,"price":"29.99","review_count":0,"average_rating":null,"currency":"USD"}`},
+		{http.MethodPatch, "/albums/6?price=19.99", http.StatusOK, `{"message":"album successfully updated"}`},
+		{http.MethodGet, "/albums/6", http.StatusOK, `[{"id":6,"title":"Kind of Blue","artist":"Miles Davis","artist_id":5,"price":"19.99","review_count":0,"average_rating":null,"currency":"USD"}]`},
+		{http.MethodDelete, "/albums/6", http.StatusOK, `{"message":"album successfully removed"}`},
+		{http.MethodDelete, "/albums/6", http.StatusNotFound, `{"errors":"album not found"}`},
+		{http.MethodGet, "/albums/6", http.StatusNotFound, `{"errors":"album not found"}`},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.url, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("%v %v returned wrong status code: got %v want %v", tt.method, tt.url, status, tt.expectedCode)
+		}
+
+		actual := strings.TrimSpace(rr.Body.String())
+		if actual != tt.expected {
+			t.Errorf("%v %v returned unexpected body: got %v want %v", tt.method, tt.url, actual, tt.expected)
+		}
+	}
+}
+
+// TestSQLStore_Checkout_SQLite checks out a cart against the SQLite store:
+// the cart's reservation is used up first, the rest comes from the copies
+// available in any format, and a cart that would oversell is left as it was.
+func TestSQLStore_Checkout_SQLite(t *testing.T) {
+	ctx := context.Background()
+	store := querySQLiteStore(t)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	customerID := reservingCustomer(t, store)
+	other, err := store.CreateCustomer(ctx, Customer{Email: "sarah@example.com", PasswordHash: []byte("x"), CreatedAt: now})
+	if err != nil {
+		t.Fatalf("Failed to create customer: %v", err)
+	}
+
+	for format, onHand := range map[string]int{"cd": 2, "vinyl": 1} {
+		if _, err := store.AdjustStock(ctx, 3, format, onHand, now); err != nil {
+			t.Fatalf("Failed to stock album: %v", err)
+		}
+	}
+
+	cart, err := store.CreateCart(ctx, Cart{ID: strings.Repeat("ab", 16), CustomerID: &customerID, CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		t.Fatalf("Failed to create cart: %v", err)
+	}
+	held, err := store.Reserve(ctx, Reservation{AlbumID: 3, Format: "cd", Quantity: 1, ExpiresAt: now.Add(time.Hour), CustomerID: customerID, CartID: &cart.ID}, now)
+	if err != nil {
+		t.Fatalf("Failed to reserve for the cart: %v", err)
+	}
+	if _, err := store.Reserve(ctx, Reservation{AlbumID: 3, Format: "cd", Quantity: 1, ExpiresAt: now.Add(time.Hour), CustomerID: other.ID}, now); err != nil {
+		t.Fatalf("Failed to reserve for another customer: %v", err)
+	}
+
+	// The held cd and the vinyl are all the cart can have
+	if err := store.SetCartItem(ctx, cart.ID, 3, 3, now); err != nil {
+		t.Fatalf("Failed to fill cart: %v", err)
+	}
+	if _, err := store.Checkout(ctx, cart.ID, customerID, now); !errors.Is(err, ErrOutOfStock) {
+		t.Errorf("Expected %v overselling, got %v", ErrOutOfStock, err)
+	}
+	stock, err := store.Stock(ctx, []int64{3}, now)
+	if err != nil || !slices.Equal(stock[3], []Stock{newStock("cd", 2, 2), newStock("vinyl", 1, 0)}) {
+		t.Errorf("Expected the stock to be left as it was, got %v: %v", stock, err)
+	}
+
+	if _, err := store.Checkout(ctx, cart.ID, other.ID, now); !errors.Is(err, ErrCartNotFound) {
+		t.Errorf("Expected %v checking out another customer's cart, got %v", ErrCartNotFound, err)
+	}
+
+	if err := store.SetCartItem(ctx, cart.ID, 3, 2, now); err != nil {
+		t.Fatalf("Failed to fill cart: %v", err)
+	}
+	order, err := store.Checkout(ctx, cart.ID, customerID, now)
+	if err != nil {
+		t.Fatalf("Failed to check out: %v", err)
+	}
+	if order.Status != OrderPending || *order.CustomerID != customerID || order.Total.String() != "35.98" ||
+		len(order.Items) != 1 || order.Items[0].Quantity != 2 {
+		t.Errorf("Unexpected order %+v", order)
+	}
+
+	// The cart's reservation is used up, the other customer's is kept
+	stock, err = store.Stock(ctx, []int64{3}, now)
+	if err != nil || !slices.Equal(stock[3], []Stock{newStock("cd", 1, 1), newStock("vinyl", 0, 0)}) {
+		t.Errorf("Expected the held cd and the vinyl to be taken, got %v: %v", stock, err)
+	}
+	if err := store.Release(ctx, 3, held.ID, customerID, now); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("Expected the cart's reservation to be used up, got %v", err)
+	}
+	if _, err := store.GetCart(ctx, cart.ID); !errors.Is(err, ErrCartNotFound) {
+		t.Errorf("Expected the cart to be deleted, got %v", err)
+	}
+}
+
+func TestSQLStore_Postgres(t *testing.T) {
+	db, mock := getMockDB(t)
+	defer db.Close()
+
+	store := &SQLStore{Db: db, Driver: "postgres"}
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	expectArtistLookup(mock, "artist1", 3, "Artist1")
+	mock.ExpectPrepare(`INSERT INTO album \(title, artist, artist_id, price, currency, release_date, label, format, catalog_number, barcode\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6, \$7, \$8, \$9, \$10\) RETURNING id`).
+		ExpectQuery().
+		WithArgs("Album1", "Artist1", 3, "10.99", "USD", nil, "", "", "", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	expectAudit(mock, 7, AuditCreate, sqlmock.AnyArg())
+	mock.ExpectCommit()
+
+	album, err := store.Create(ctx, Album{Title: "Album1", Artist: "Artist1", Price: money.MustParse("10.99", "USD")})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if album.ID != 7 {
+		t.Errorf("Expected id from RETURNING clause, got %v", album.ID)
+	}
+
+	price := money.MustParse("12.99", "EUR")
+	mock.ExpectBegin()
+	expectAlbumLock(mock, 7, "Album1", "Artist1", "10.99")
+	mock.ExpectPrepare(`UPDATE album SET price = \$1, currency = \$2, version = version \+ 1 WHERE id = \$3 AND deleted_at IS NULL`).
+		ExpectExec().
+		WithArgs("12.99", "EUR", 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAudit(mock, 7, AuditUpdate, `{"currency":{"before":"USD","after":"EUR"},"price":{"before":"10.99","after":"12.99"}}`)
+	mock.ExpectCommit()
+
+	if err := store.Update(ctx, 7, AlbumUpdate{Price: &price}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	mock.ExpectPrepare(`SELECT id, title, artist, artist_id, currency, price, release_date, label, format, catalog_number, barcode, review_count, average_rating, version FROM album WHERE deleted_at IS NULL AND artist ILIKE \$1 ESCAPE '!' AND \(\(id > \$2\)\) ORDER BY id LIMIT \$3`).
+		ExpectQuery().
+		WithArgs("%artist%", 5, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "artist", "artist_id", "currency", "price", "release_date", "label", "format", "catalog_number", "barcode", "review_count", "average_rating", "version"}).AddRow(7, "Album1", "Artist1", 1, "EUR", "12.99", nil, "", "", "", nil, 0, 0, 1))
+
+	albums, err := store.List(ctx, AlbumQuery{
+		Filters: []Filter{{Field: "artist", Operator: OpContains, Values: []any{"artist"}}},
+		Page:    Page{Limit: 10, After: []any{int64(5)}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(albums) != 1 || albums[0].Price != price {
+		t.Errorf("Expected NUMERIC price to scan into the album, got %v", albums)
+	}
+
+	mock.ExpectBegin()
+	expectAlbumLock(mock, 7, "Album1", "Artist1", "12.99")
+	mock.ExpectExec(`DELETE FROM album WHERE id = \$1`).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAudit(mock, 7, AuditPurge, sqlmock.AnyArg())
+	mock.ExpectCommit()
+
+	if err := store.Delete(ctx, 7); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %v", err)
+	}
+}
+
+func TestUniqueViolation(t *testing.T) {
+	store := querySQLiteStore(t)
+	_, sqliteErr := store.Db.ExecContext(context.Background(), `UPDATE album SET barcode = '036000291452' WHERE id IN (1, 2)`)
+
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{sqliteErr, true},
+		{fmt.Errorf("create: %w", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}), true},
+		{&mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row"}, false},
+		{&pgconn.PgError{Code: "23505"}, true},
+		{&pgconn.PgError{Code: "23503"}, false},
+		{fmt.Errorf("insert error"), false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if actual := uniqueViolation(tt.err); actual != tt.expected {
+			t.Errorf("uniqueViolation(%v) = %v, want %v", tt.err, actual, tt.expected)
+		}
+	}
+}
+
+// TestSQLStore_BarcodeRace checks that a write losing a race for a barcode
+// to the unique index fails with ErrBarcodeExists.
+func TestSQLStore_BarcodeRace(t *testing.T) {
+	db, mock := getMockDB(t)
+	defer db.Close()
+
+	store := &SQLStore{Db: db, Driver: "mysql"}
+	barcode := Barcode("036000291452")
+
+	mock.ExpectBegin()
+	expectAlbumLock(mock, 1, "Album1", "Artist1", "10.99")
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM album WHERE barcode = \? AND id <> \?`).
+		WithArgs(barcode, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectPrepare(`UPDATE album SET barcode = \?, version = version \+ 1 WHERE id = \? AND deleted_at IS NULL`).
+		ExpectExec().
+		WithArgs(barcode, 1).
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '036000291452' for key 'album_barcode'"})
+	mock.ExpectRollback()
+
+	if err := store.Update(context.Background(), 1, AlbumUpdate{Barcode: &barcode}); !errors.Is(err, ErrBarcodeExists) {
+		t.Errorf("Expected %v, got %v", ErrBarcodeExists, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-web-service/money"
+)
+
+// ErrAlbumNotFound is returned by an AlbumStore when no album matches the given id.
+var ErrAlbumNotFound = errors.New("album not found")
+
+// AlbumUpdate holds the fields of a partial album update. Nil fields are left untouched.
+// Artist names the album's artist, who is created when no artist has the
+// name yet; ArtistID picks an existing artist instead.
+// The release metadata fields are cleared by an empty value.
+type AlbumUpdate struct {
+	Title    *string
+	Artist   *string
+	ArtistID *int64
+	Price    *money.Money
+
+	ReleaseDate   *Date
+	RecordLabel   *string
+	Format        *string
+	CatalogNumber *string
+	Barcode       *Barcode
+
+	// Version, when set, is the version the album must still be at for the
+	// update to apply.
+	Version int64
+}
+
+// Empty reports whether the update would not change any field.
+func (u AlbumUpdate) Empty() bool {
+	return u.Title == nil && u.Artist == nil && u.ArtistID == nil && u.Price == nil &&
+		u.ReleaseDate == nil && u.RecordLabel == nil && u.Format == nil && u.CatalogNumber == nil && u.Barcode == nil
+}
+
+// apply copies the fields the update sets onto album, but for the artist,
+// which the store resolves first.
+func (u AlbumUpdate) apply(album *Album) {
+	if u.Title != nil {
+		album.Title = *u.Title
+	}
+	if u.Price != nil {
+		album.Price = *u.Price
+	}
+	u.metadata(album)
+}
+
+// metadata copies the release metadata fields the update sets onto album.
+func (u AlbumUpdate) metadata(album *Album) {
+	if u.ReleaseDate != nil {
+		album.ReleaseDate = *u.ReleaseDate
+	}
+	if u.RecordLabel != nil {
+		album.RecordLabel = *u.RecordLabel
+	}
+	if u.Format != nil {
+		album.Format = *u.Format
+	}
+	if u.CatalogNumber != nil {
+		album.CatalogNumber = *u.CatalogNumber
+	}
+	if u.Barcode != nil {
+		album.Barcode = *u.Barcode
+	}
+}
+
+// AlbumStore is the persistence layer the album handlers depend on. Create,
+// Update, Delete, Trash and Restore write their audit entry in the same
+// transaction as the write.
+type AlbumStore interface {
+	// List returns the albums matching the query, in its order.
+	List(ctx context.Context, query AlbumQuery) ([]Album, error)
+	Get(ctx context.Context, id int64) (Album, error)
+	// Create stores the album under the artist with its ArtistID, or else
+	// under the artist its Artist names, and returns it with both set. Create
+	// and Update return ErrBarcodeExists when another album has the barcode.
+	Create(ctx context.Context, album Album) (Album, error)
+	// Update moves the album to its next version, as do the review and
+	// artist writes that change it. It returns ErrAlbumNotFound when the
+	// album does not exist or is in the trash, and ErrVersionMismatch when the
+	// update's Version is set and the album has moved past it.
+	Update(ctx context.Context, id int64, update AlbumUpdate) error
+	// Delete deletes the album for good, whether or not it is in the trash,
+	// along with its tracks, label assignments, cover, stock, reservations and
+	// reviews, and takes it out of carts. Orders and wishlists keep their copy
+	// of the album's details.
+	Delete(ctx context.Context, id int64) error
+	// Trash moves the album to the trash as of now, hiding it from every read
+	// but ListTrash. It keeps everything Delete would delete for Restore,
+	// except that it takes the album out of carts. When version is not zero it
+	// returns ErrVersionMismatch if the album has moved past it.
+	Trash(ctx context.Context, id, version int64, now time.Time) error
+	// Restore takes the album out of the trash. It returns ErrAlbumNotFound
+	// when the album is not in the trash.
+	Restore(ctx context.Context, id int64) error
+	// Purge deletes the album for good like Delete, but only while it is in
+	// the trash and was deleted at or before cutoff, checked in the same
+	// write so that an album restored meanwhile is kept. It returns
+	// ErrAlbumNotFound otherwise.
+	Purge(ctx context.Context, id int64, cutoff time.Time) error
+	// ListTrash returns the albums in the trash with their DeletedAt, most
+	// recently deleted first.
+	ListTrash(ctx context.Context, query TrashQuery) ([]Album, error)
+	// Count returns the number of albums matching every filter.
+	Count(ctx context.Context, filters []Filter) (int64, error)
+	// Facets counts the albums matching every filter by each of the named facets.
+	Facets(ctx context.Context, filters []Filter, names []string) (map[string][]FacetBucket, error)
+}
+
+// Backend keeps every feature in one database, as MemoryStore and SQLStore
+// do. Handlers depend on the store of each feature they use instead, and
+// NewAlbums wires a Backend in as all of them.
+type Backend interface {
+	AlbumStore
+	ArtistStore
+	TrackStore
+	LabelStore
+	CoverStore
+	InventoryStore
+	CartStore
+	OrderStore
+	CustomerStore
+	WishlistStore
+	ReviewStore
+	AuditStore
+}
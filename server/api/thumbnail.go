@@ -0,0 +1,54 @@
+package api
+
+import (
+	"image"
+	"image/draw"
+)
+
+// thumbnail scales img down to fit within size by size pixels, keeping its
+// aspect ratio. Each thumbnail pixel averages the block of image pixels it
+// covers, which keeps detail that sampling single pixels would alias away.
+// Images that already fit are returned as they are.
+func thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+
+	thumbWidth, thumbHeight := size, size
+	if width > height {
+		thumbHeight = max(1, height*size/width)
+	} else {
+		thumbWidth = max(1, width*size/height)
+	}
+
+	// Work on premultiplied RGBA so transparent pixels do not bleed their
+	// color into the average.
+	src := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for y := range thumbHeight {
+		y0, y1 := y*height/thumbHeight, (y+1)*height/thumbHeight
+		for x := range thumbWidth {
+			x0, x1 := x*width/thumbWidth, (x+1)*width/thumbWidth
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i, value := range row {
+					sum[i%4] += int(value)
+				}
+			}
+
+			count := (x1 - x0) * (y1 - y0)
+			pixel := dst.Pix[y*dst.Stride+x*4:]
+			for i := range sum {
+				pixel[i] = uint8((sum[i] + count/2) / count)
+			}
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,328 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrTrackNotFound is returned by a TrackStore when the album has no track with the given id.
+	ErrTrackNotFound = errors.New("track not found")
+	// ErrTrackOrder is returned when a new track order does not list every
+	// track of the album exactly once.
+	ErrTrackOrder = errors.New("order must list every track of the album exactly once")
+)
+
+// Limits of the track table columns.
+const (
+	maxTrackTitleLength = 255
+	// maxTrackDuration is a day, in seconds.
+	maxTrackDuration = 24 * 60 * 60
+	maxDisc          = 99
+)
+
+// isrcPattern matches an International Standard Recording Code once its
+// hyphens are removed: country, registrant, year and designation.
+var isrcPattern = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{3}[0-9]{7}$`)
+
+// Track is a recording on an album, numbered by Position within its Disc.
+// Duration is in seconds.
+type Track struct {
+	ID       int64  `json:"id"`
+	AlbumID  int64  `json:"album_id"`
+	Disc     int    `json:"disc"`
+	Position int    `json:"position"`
+	Title    string `json:"title"`
+	Duration int    `json:"duration"`
+	ISRC     string `json:"isrc,omitempty"`
+}
+
+// TrackStore is the persistence layer the track handlers depend on.
+type TrackStore interface {
+	// Tracks returns the tracks of each album by album id, in disc and
+	// position order. Albums without tracks are left out.
+	Tracks(ctx context.Context, albumIDs []int64) (map[int64][]Track, error)
+	// AddTrack inserts the track at its Position on its disc, moving later
+	// tracks down. A Position of zero or past the end appends the track.
+	AddTrack(ctx context.Context, track Track) (Track, error)
+	// ReorderTracks renumbers the album's tracks in the order of trackIDs.
+	// Tracks stay on their disc.
+	ReorderTracks(ctx context.Context, albumID int64, trackIDs []int64) error
+	// DeleteTrack removes a track, moving later tracks on its disc up.
+	DeleteTrack(ctx context.Context, albumID, trackID int64) error
+}
+
+// totalDuration sums the durations of tracks.
+func totalDuration(tracks []Track) int {
+	var total int
+	for _, track := range tracks {
+		total += track.Duration
+	}
+
+	return total
+}
+
+// TrackList is the envelope an album's tracks are served in, with their
+// total Runtime in seconds.
+type TrackList struct {
+	Data    []Track `json:"data"`
+	Runtime int     `json:"runtime"`
+}
+
+func newTrackList(tracks []Track) TrackList {
+	if tracks == nil {
+		tracks = []Track{}
+	}
+
+	return TrackList{Data: tracks, Runtime: totalDuration(tracks)}
+}
+
+// trackPositions numbers the tracks of an album, given as the disc of each
+// track id, in the order of trackIDs. It returns ErrTrackOrder unless
+// trackIDs holds every track exactly once.
+func trackPositions(discs map[int64]int, trackIDs []int64) (map[int64]int, error) {
+	if len(trackIDs) != len(discs) {
+		return nil, ErrTrackOrder
+	}
+
+	positions := map[int64]int{}
+	next := map[int]int{}
+	for _, id := range trackIDs {
+		disc, ok := discs[id]
+		if _, seen := positions[id]; !ok || seen {
+			return nil, ErrTrackOrder
+		}
+
+		next[disc]++
+		positions[id] = next[disc]
+	}
+
+	return positions, nil
+}
+
+// GetTracks lists an album's tracks.
+func (a *Albums) GetTracks(w http.ResponseWriter, r *http.Request) {
+	albumID, _, ok := trackPath(w, r)
+	if !ok {
+		return
+	}
+
+	a.serveTracks(w, r, albumID, "GetTracks")
+}
+
+// AddTrack adds a track to an album, at the end of its disc unless a
+// position is given.
+func (a *Albums) AddTrack(w http.ResponseWriter, r *http.Request) {
+	albumID, _, ok := trackPath(w, r)
+	if !ok {
+		return
+	}
+
+	if !isJSON(r) {
+		ServeJSONError(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var input trackRequest
+	if err := decodeJSON(w, r, &input); err != nil {
+		ServeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	track, errs := input.track(albumID)
+	if len(errs) > 0 {
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	track, err := a.Tracks.AddTrack(r.Context(), track)
+	if errors.Is(err, ErrAlbumNotFound) {
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("AddTrack %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	ServeJSON(w, track, http.StatusOK)
+}
+
+// ReorderTracks renumbers an album's tracks in the order of the track ids in
+// the body, such as {"order":[3,1,2]}, and serves the reordered tracks.
+func (a *Albums) ReorderTracks(w http.ResponseWriter, r *http.Request) {
+	albumID, _, ok := trackPath(w, r)
+	if !ok {
+		return
+	}
+
+	if !isJSON(r) {
+		ServeJSONError(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var input struct {
+		Order []int64 `json:"order"`
+	}
+	if err := decodeJSON(w, r, &input); err != nil {
+		ServeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := a.Tracks.ReorderTracks(r.Context(), albumID, input.Order)
+	switch {
+	case errors.Is(err, ErrAlbumNotFound):
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrTrackOrder):
+		var errs ValidationErrors
+		errs.Add("order", "must list every track of the album exactly once")
+		ServeValidationErrors(w, errs)
+		return
+	case err != nil:
+		ServeJSONError(w, fmt.Sprintf("ReorderTracks %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	a.serveTracks(w, r, albumID, "ReorderTracks")
+}
+
+func (a *Albums) DeleteTrack(w http.ResponseWriter, r *http.Request) {
+	albumID, trackID, ok := trackPath(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.Tracks.DeleteTrack(r.Context(), albumID, trackID)
+	if errors.Is(err, ErrTrackNotFound) {
+		ServeJSONError(w, "track not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		ServeJSONError(w, "could not delete track", http.StatusInternalServerError)
+		return
+	}
+
+	ServeJSON(w, map[string]any{"message": "track successfully removed"}, http.StatusOK)
+}
+
+// serveTracks serves the tracks of the album with albumID, or a 404 when
+// there is no such album.
+func (a *Albums) serveTracks(w http.ResponseWriter, r *http.Request, albumID int64, handler string) {
+	if _, err := a.Store.Get(r.Context(), albumID); errors.Is(err, ErrAlbumNotFound) {
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+		return
+	}
+
+	tracks, err := a.Tracks.Tracks(r.Context(), []int64{albumID})
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+		return
+	}
+
+	ServeJSON(w, newTrackList(tracks[albumID]), http.StatusOK)
+}
+
+// embedTracks sets the tracks and runtime of each album.
+func (a *Albums) embedTracks(ctx context.Context, albums []Album) error {
+	ids := make([]int64, len(albums))
+	for i, album := range albums {
+		ids[i] = album.ID
+	}
+
+	tracks, err := a.Tracks.Tracks(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range albums {
+		albums[i].Tracks = tracks[albums[i].ID]
+		total := totalDuration(albums[i].Tracks)
+		albums[i].Runtime = &total
+	}
+
+	return nil
+}
+
+// trackRequest holds the track fields sent when adding a track.
+type trackRequest struct {
+	Title    *string `json:"title"`
+	Duration *int    `json:"duration"`
+	ISRC     *string `json:"isrc"`
+	Disc     *int    `json:"disc"`
+	Position *int    `json:"position"`
+}
+
+// track validates the request and turns it into a track of the album.
+func (in trackRequest) track(albumID int64) (Track, ValidationErrors) {
+	var errs ValidationErrors
+	track := Track{AlbumID: albumID, Disc: 1}
+
+	validateText(&errs, "title", in.Title, maxTrackTitleLength, true)
+	if in.Title != nil {
+		track.Title = *in.Title
+	}
+
+	switch {
+	case in.Duration == nil:
+		errs.Add("duration", "is required")
+	case *in.Duration < 1 || *in.Duration > maxTrackDuration:
+		errs.Add("duration", fmt.Sprintf("must be a number of seconds between 1 and %d", maxTrackDuration))
+	default:
+		track.Duration = *in.Duration
+	}
+
+	if in.ISRC != nil {
+		track.ISRC = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(*in.ISRC), "-", ""))
+		if track.ISRC != "" && !isrcPattern.MatchString(track.ISRC) {
+			errs.Add("isrc", "must be a 12 character ISRC such as US-S1Z-99-00001")
+		}
+	}
+
+	if in.Disc != nil {
+		if *in.Disc < 1 || *in.Disc > maxDisc {
+			errs.Add("disc", fmt.Sprintf("must be between 1 and %d", maxDisc))
+		}
+		track.Disc = *in.Disc
+	}
+
+	if in.Position != nil {
+		if *in.Position < 1 {
+			errs.Add("position", "must be at least 1")
+		}
+		track.Position = *in.Position
+	}
+
+	return track, errs
+}
+
+// trackPath parses the album id, and the track id if there is one, of a
+// /albums/{id}/tracks or /albums/{id}/tracks/{track} path. It writes a 400
+// response and returns false when either is not a number.
+func trackPath(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	album, track, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/albums/"), "/tracks")
+
+	albumID, err := strconv.ParseInt(album, 10, 64)
+	if err != nil {
+		ServeJSONError(w, "invalid album id", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	var trackID int64
+	if track = strings.TrimPrefix(track, "/"); track != "" {
+		if trackID, err = strconv.ParseInt(track, 10, 64); err != nil {
+			ServeJSONError(w, "invalid track id", http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+
+	return albumID, trackID, true
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestTracks_MemoryStore(t *testing.T) {
+	testTracks(t, NewAlbums(NewMemoryStore(queryAlbums...)))
+}
+
+func TestTracks_SQLite(t *testing.T) {
+	testTracks(t, NewAlbums(querySQLiteStore(t)))
+}
+
+// testTracks runs through the track endpoints against albums holding queryAlbums.
+func testTracks(t *testing.T, albums *Albums) {
+	t.Helper()
+
+	router := SetupRouter(albums)
+
+	tests := []struct {
+		method       string
+		url          string
+		body         string
+		expectedCode int
+		expected     string
+	}{
+		{http.MethodGet, "/albums/3/tracks", "", http.StatusOK, `{"data":[],"runtime":0}`},
+
+		// Tracks are appended to their disc unless a position is given
+		{http.MethodPut, "/albums/3/tracks", `{"title":"Godchild","duration":191,"isrc":"us-s1z-99-00001"}`, http.StatusOK, `{"id":1,"album_id":3,"disc":1,"position":1,"title":"Godchild","duration":191,"isrc":"USS1Z9900001"}`},
+		{http.MethodPut, "/albums/3/tracks", `{"title":"Boplicity","duration":180,"position":7}`, http.StatusOK, `{"id":2,"album_id":3,"disc":1,"position":2,"title":"Boplicity","duration":180}`},
+		{http.MethodPut, "/albums/3/tracks", `{"title":"Venus de Milo","duration":190,"position":1}`, http.StatusOK, `{"id":3,"album_id":3,"disc":1,"position":1,"title":"Venus de Milo","duration":190}`},
+		{http.MethodPut, "/albums/3/tracks", `{"title":"Darn That Dream","duration":200,"disc":2}`, http.StatusOK, `{"id":4,"album_id":3,"disc":2,"position":1,"title":"Darn That Dream","duration":200}`},
+		{http.MethodGet, "/albums/3/tracks", "", http.StatusOK, `{"data":[{"id":3,"album_id":3,"disc":1,"position":1,"title":"Venus de Milo","duration":190},{"id":1,"album_id":3,"disc":1,"position":2,"title":"Godchild","duration":191,"isrc":"USS1Z9900001"},{"id":2,"album_id":3,"disc":1,"position":3,"title":"Boplicity","duration":180},{"id":4,"album_id":3,"disc":2,"position":1,"title":"Darn That Dream","duration":200}],"runtime":761}`},
+
+		{http.MethodPut, "/albums/3/tracks", `{"duration":0,"isrc":"abc","disc":100}`, http.StatusUnprocessableEntity, `{"errors":["'title' is required","'duration' must be a number of seconds between 1 and 86400","'isrc' must be a 12 character ISRC such as US-S1Z-99-00001","'disc' must be between 1 and 99"]`},
+		{http.MethodPut, "/albums/99/tracks", `{"title":"Nowhere","duration":60}`, http.StatusNotFound, `{"errors":"album not found"}`},
+		{http.MethodGet, "/albums/99/tracks", "", http.StatusNotFound, `{"errors":"album not found"}`},
+		{http.MethodGet, "/albums/abc/tracks", "", http.StatusBadRequest, `{"errors":"invalid album id"}`},
+
+		// Reordering keeps tracks on their disc
+		{http.MethodPatch, "/albums/3/tracks", `{"order":[2,4,1,3]}`, http.StatusOK, `{"data":[{"id":2,"album_id":3,"disc":1,"position":1,"title":"Boplicity","duration":180},{"id":1,"album_id":3,"disc":1,"position":2,"title":"Godchild","duration":191,"isrc":"USS1Z9900001"},{"id":3,"album_id":3,"disc":1,"position":3,"title":"Venus de Milo","duration":190},{"id":4,"album_id":3,"disc":2,"position":1,"title":"Darn That Dream","duration":200}],"runtime":761}`},
+		{http.MethodPatch, "/albums/3/tracks", `{"order":[1,2]}`, http.StatusUnprocessableEntity, `{"errors":["'order' must list every track of the album exactly once"],"fields":{"order":["must list every track of the album exactly once"]}}`},
+		{http.MethodPatch, "/albums/3/tracks", `{"order":[1,2,3,3]}`, http.StatusUnprocessableEntity, `"fields":{"order":`},
+		{http.MethodPatch, "/albums/3/tracks", `{"order":[1,2,3,99]}`, http.StatusUnprocessableEntity, `"fields":{"order":`},
+		{http.MethodPatch, "/albums/99/tracks", `{"order":[]}`, http.StatusNotFound, `{"errors":"album not found"}`},
+
+		// Deleting a track closes the gap it leaves
+		{http.MethodDelete, "/albums/3/tracks/1", "", http.StatusOK, `{"message":"track successfully removed"}`},
+		{http.MethodDelete, "/albums/3/tracks/1", "", http.StatusNotFound, `{"errors":"track not found"}`},
+		{http.MethodDelete, "/albums/4/tracks/2", "", http.StatusNotFound, `{"errors":"track not found"}`},
+		{http.MethodDelete, "/albums/3/tracks/abc", "", http.StatusBadRequest, `{"errors":"invalid track id"}`},
+		{http.MethodGet, "/albums/3/tracks", "", http.StatusOK, `{"data":[{"id":2,"album_id":3,"disc":1,"position":1,"title":"Boplicity","duration":180},{"id":3,"album_id":3,"disc":1,"position":2,"title":"Venus de Milo","duration":190},{"id":4,"album_id":3,"disc":2,"position":1,"title":"Darn That Dream","duration":200}],"runtime":570}`},
+
+		// Albums embed their tracks when asked to
+		{http.MethodGet, "/albums/3", "", http.StatusOK, `[{"id":3,"title":"Jeru","artist":"Gerry Mulligan","artist_id":2,"price":"17.99","review_count":0,"average_rating":null,"currency":"USD"}]`},
+		{http.MethodGet, "/albums/3?include=tracks", "", http.StatusOK, `[{"id":3,"title":"Jeru","artist":"Gerry Mulligan","artist_id":2,"price":"17.99","review_count":0,"average_rating":null,"currency":"USD","tracks":[{"id":2,"album_id":3,"disc":1,"position":1,"title":"Boplicity","duration":180},{"id":3,"album_id":3,"disc":1,"position":2,"title":"Venus de Milo","duration":190},{"id":4,"album_id":3,"disc":2,"position":1,"title":"Darn That Dream","duration":200}],"runtime":570}]`},
+		{http.MethodGet, "/albums?price[lt]=20&sort=id&include=tracks", "", http.StatusOK, `"title":"Jeru","artist":"Gerry Mulligan","artist_id":2,"price":"17.99","review_count":0,"average_rating":null,"currency":"USD","tracks":[{"id":2,`},
+		{http.MethodGet, "/albums?price[lt]=20&sort=id&include=tracks", "", http.StatusOK, `"title":"Ballads","artist":"John Coltrane","artist_id":1,"price":"17.99","review_count":0,"average_rating":null,"currency":"USD","tracks":[],"runtime":0}`},
+		{http.MethodGet, "/albums?include=covers", "", http.StatusBadRequest, `{"errors":"unknown include 'covers'"}`},
+		{http.MethodGet, "/albums/3?include=covers", "", http.StatusBadRequest, `{"errors":"unknown include 'covers'"}`},
+
+		// An album's tracks are hidden in the trash, and go with it when purged
+		{http.MethodDelete, "/albums/3", "", http.StatusOK, `{"message":"album successfully removed"}`},
+		{http.MethodGet, "/albums/3/tracks", "", http.StatusNotFound, `{"errors":"album not found"}`},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if tt.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("%v %v returned wrong status code: got %v want %v", tt.method, tt.url, status, tt.expectedCode)
+		}
+
+		if actual := strings.TrimSpace(rr.Body.String()); !strings.Contains(actual, tt.expected) {
+			t.Errorf("%v %v returned unexpected body: got %v want %v", tt.method, tt.url, actual, tt.expected)
+		}
+	}
+
+	if _, err := albums.PurgeTrash(context.Background(), 0, time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("Failed to purge the trash: %v", err)
+	}
+	tracks, err := albums.Tracks.Tracks(context.Background(), []int64{3})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(tracks) != 0 {
+		t.Errorf("Expected the deleted album's tracks to be gone, got %v", tracks)
+	}
+}
+
+// TestTrackWrites_MySQLLocks checks that the writes that number an album's
+// tracks lock the album first, so that they renumber them one at a time.
+func TestTrackWrites_MySQLLocks(t *testing.T) {
+	db, mock := getMockDB(t)
+	defer db.Close()
+
+	store := &SQLStore{Db: db, Driver: "mysql"}
+	writes := []func() error{
+		func() error {
+			_, err := store.AddTrack(context.Background(), Track{AlbumID: 3, Disc: 1, Title: "Moon Dreams"})
+			return err
+		},
+		func() error { return store.ReorderTracks(context.Background(), 3, []int64{1, 2}) },
+	}
+
+	for _, write := range writes {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`^SELECT id, title, .+ FROM album WHERE id = \? AND deleted_at IS NULL FOR UPDATE$`).
+			WithArgs(3).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectRollback()
+
+		if err := write(); !errors.Is(err, ErrAlbumNotFound) {
+			t.Errorf("Expected %v, got %v", ErrAlbumNotFound, err)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %v", err)
+	}
+}
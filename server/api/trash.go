@@ -0,0 +1,215 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// purgeBatchSize is how many albums PurgeTrash reads from the trash at a time.
+const purgeBatchSize = 100
+
+// maxPurgeInterval is the longest RunTrashPurge waits between purges.
+const maxPurgeInterval = time.Hour
+
+// TrashQuery selects a page of the trash, most recently deleted first.
+type TrashQuery struct {
+	Limit int
+	// DeletedBefore and BeforeID are the deletion time and id of the last
+	// album of the previous page, which the page continues after. Album ids
+	// start at 1, so a zero BeforeID keeps the albums deleted strictly before
+	// DeletedBefore.
+	DeletedBefore time.Time
+	BeforeID      int64
+}
+
+// after reports whether an album deleted at deletedAt with id comes after
+// the query's bound, or whether there is no bound.
+func (q TrashQuery) after(deletedAt time.Time, id int64) bool {
+	return q.DeletedBefore.IsZero() || deletedAt.Before(q.DeletedBefore) || deletedAt.Equal(q.DeletedBefore) && id < q.BeforeID
+}
+
+// TrashPage is the envelope the trash is served in. Next is an opaque cursor
+// for the following page and is null on the last one.
+type TrashPage struct {
+	Data []Album `json:"data"`
+	Next *string `json:"next"`
+}
+
+// GetTrash lists the albums in the trash, most recently deleted first, a
+// page at a time. Only staff can see the trash.
+func (a *Albums) GetTrash(w http.ResponseWriter, r *http.Request) {
+	if !requireStaff(w, r) {
+		return
+	}
+
+	parameters := r.URL.Query()
+	query := TrashQuery{Limit: defaultPageLimit}
+
+	var err error
+	if limit := parameters.Get("limit"); limit != "" {
+		if query.Limit, err = parseLimit(limit); err != nil {
+			ServeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if cursor := parameters.Get("cursor"); cursor != "" {
+		if query.DeletedBefore, query.BeforeID, err = decodeTrashCursor(cursor); err != nil {
+			ServeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Fetch one more album to tell whether there is a next page
+	query.Limit++
+	albums, err := a.Store.ListTrash(r.Context(), query)
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("GetTrash %v", err), http.StatusInternalServerError)
+		return
+	}
+	query.Limit--
+
+	page := TrashPage{Data: albums}
+	if len(albums) > query.Limit {
+		page.Data = albums[:query.Limit]
+		last := page.Data[query.Limit-1]
+		next := encodeTrashCursor(*last.DeletedAt, last.ID)
+		page.Next = &next
+	}
+	if page.Data == nil {
+		page.Data = []Album{}
+	}
+
+	ServeJSON(w, page, http.StatusOK)
+}
+
+// RestoreAlbum takes an album out of the trash and serves it. Only staff can
+// restore albums.
+func (a *Albums) RestoreAlbum(w http.ResponseWriter, r *http.Request) {
+	if !requireStaff(w, r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/albums/"), "/restore"), 10, 64)
+	if err != nil {
+		ServeJSONError(w, "invalid album id", http.StatusBadRequest)
+		return
+	}
+
+	err = a.Store.Restore(r.Context(), id)
+	if errors.Is(err, ErrAlbumNotFound) {
+		ServeJSONError(w, "album not found in the trash", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("RestoreAlbum %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	album, err := a.Store.Get(r.Context(), id)
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("RestoreAlbum %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	ServeJSON(w, album, http.StatusOK)
+}
+
+// PurgeTrash deletes the albums that have been in the trash for longer than
+// retention as of now for good, along with their cover images. It returns
+// how many albums it deleted. The deletions are logged as made by the system.
+func (a *Albums) PurgeTrash(ctx context.Context, retention time.Duration, now time.Time) (int, error) {
+	ctx = withActor(ctx, systemActor)
+	cutoff := now.Add(-retention)
+	query := TrashQuery{Limit: purgeBatchSize, DeletedBefore: cutoff}
+
+	var purged int
+	for {
+		albums, err := a.Store.ListTrash(ctx, query)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, album := range albums {
+			cover, coverErr := a.Covers.Cover(ctx, album.ID)
+
+			// Albums restored since they were listed are skipped and keep
+			// their cover images, as are those another run purged first
+			err := a.Store.Purge(ctx, album.ID, cutoff)
+			if errors.Is(err, ErrAlbumNotFound) {
+				continue
+			}
+			if err != nil {
+				return purged, err
+			}
+			purged++
+
+			if coverErr == nil {
+				a.removeCoverBlobs(ctx, cover)
+			}
+		}
+
+		if len(albums) < query.Limit {
+			return purged, nil
+		}
+		last := albums[len(albums)-1]
+		query.DeletedBefore, query.BeforeID = *last.DeletedAt, last.ID
+	}
+}
+
+// RunTrashPurge purges the trash of albums older than retention, then again
+// every hour, or every retention period when that is shorter, until ctx is
+// done. Failed purges are logged and retried on the next run.
+func (a *Albums) RunTrashPurge(ctx context.Context, retention time.Duration) {
+	ticker := time.NewTicker(min(retention, maxPurgeInterval))
+	defer ticker.Stop()
+
+	for {
+		if _, err := a.PurgeTrash(ctx, retention, time.Now()); err != nil && ctx.Err() == nil {
+			log.Printf("purge trash: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func encodeTrashCursor(deletedAt time.Time, id int64) string {
+	data, _ := json.Marshal(cursor{Before: []string{deletedAt.UTC().Format(time.RFC3339Nano), strconv.FormatInt(id, 10)}})
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeTrashCursor(encoded string) (time.Time, int64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return time.Time{}, 0, errInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || len(c.Before) != 2 {
+		return time.Time{}, 0, errInvalidCursor
+	}
+
+	deletedAt, err := time.Parse(time.RFC3339Nano, c.Before[0])
+	if err != nil {
+		return time.Time{}, 0, errInvalidCursor
+	}
+	id, err := strconv.ParseInt(c.Before[1], 10, 64)
+	if err != nil || id < 1 {
+		return time.Time{}, 0, errInvalidCursor
+	}
+
+	return deletedAt, id, nil
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Trash moves the album out of albums, where every read looks, into the
+// trash. Like Delete it takes the album out of carts.
+func (s *MemoryStore) Trash(ctx context.Context, id, version int64, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	album, ok := s.albums[id]
+	if !ok {
+		return ErrAlbumNotFound
+	}
+	if version != 0 && album.Version != version {
+		return ErrVersionMismatch
+	}
+	if err := s.record(ctx, id, AuditDelete, &album, nil, time.Now()); err != nil {
+		return err
+	}
+
+	album.DeletedAt = &now
+	delete(s.albums, id)
+	s.trash[id] = album
+	for cartID, cart := range s.carts {
+		cart.Items = slices.DeleteFunc(slices.Clone(cart.Items), func(item CartItem) bool { return item.AlbumID == id })
+		s.carts[cartID] = cart
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Restore(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	album, ok := s.trash[id]
+	if !ok {
+		return ErrAlbumNotFound
+	}
+
+	album.DeletedAt = nil
+	if err := s.record(ctx, id, AuditRestore, nil, &album, time.Now()); err != nil {
+		return err
+	}
+	delete(s.trash, id)
+	s.albums[id] = album
+
+	return nil
+}
+
+func (s *MemoryStore) ListTrash(ctx context.Context, query TrashQuery) ([]Album, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var albums []Album
+	for _, album := range s.trash {
+		if query.after(*album.DeletedAt, album.ID) {
+			albums = append(albums, album)
+		}
+	}
+
+	slices.SortFunc(albums, func(a, b Album) int {
+		if c := b.DeletedAt.Compare(*a.DeletedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+	if len(albums) > query.Limit {
+		albums = albums[:query.Limit]
+	}
+
+	return albums, nil
+}
+
+// Trash marks the album deleted, takes it out of carts and logs the deletion
+// in one transaction.
+func (s *SQLStore) Trash(ctx context.Context, id, version int64, now time.Time) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE album SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`
+	args := []any{now.UTC(), id}
+	if version != 0 {
+		query += ` AND version = ?`
+		args = append(args, version)
+	}
+
+	result, err := tx.ExecContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkVersion(ctx, tx, result, id); err != nil {
+		return err
+	}
+
+	album, err := s.lockAlbum(ctx, tx, id, false)
+	if err != nil {
+		return err
+	}
+	if err := s.audit(ctx, tx, id, AuditDelete, &album, nil, time.Now()); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM cart_item WHERE album_id = ?`), id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) Restore(ctx context.Context, id int64) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, s.rebind(`UPDATE album SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL`), id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAlbumNotFound
+	}
+
+	album, err := s.lockAlbum(ctx, tx, id, true)
+	if err != nil {
+		return err
+	}
+	if err := s.audit(ctx, tx, id, AuditRestore, nil, &album, time.Now()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) ListTrash(ctx context.Context, query TrashQuery) ([]Album, error) {
+	statement := `SELECT ` + albumColumns + `, deleted_at FROM album WHERE deleted_at IS NOT NULL`
+	var args []any
+	if !query.DeletedBefore.IsZero() {
+		statement += ` AND (deleted_at < ? OR deleted_at = ? AND id < ?)`
+		args = append(args, query.DeletedBefore.UTC(), query.DeletedBefore.UTC(), query.BeforeID)
+	}
+	statement += ` ORDER BY deleted_at DESC, id DESC LIMIT ?`
+	args = append(args, query.Limit)
+
+	rows, err := s.Db.QueryContext(ctx, s.rebind(statement), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var albums []Album
+	for rows.Next() {
+		var album Album
+		var deletedAt time.Time
+		if err := rows.Scan(append(albumDest(&album), timeScanner{&deletedAt})...); err != nil {
+			return nil, fmt.Errorf("list trash %v", err)
+		}
+
+		album.DeletedAt = &deletedAt
+		albums = append(albums, album)
+	}
+
+	return albums, rows.Err()
+}
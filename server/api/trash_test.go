@@ -0,0 +1,215 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrash_MemoryStore(t *testing.T) {
+	testTrash(t, NewAlbums(NewMemoryStore(queryAlbums...)))
+}
+
+func TestTrash_SQLite(t *testing.T) {
+	testTrash(t, NewAlbums(querySQLiteStore(t)))
+}
+
+// testTrash runs through deleting, restoring and purging albums, against
+// albums holding queryAlbums.
+func testTrash(t *testing.T, albums *Albums) {
+	t.Helper()
+
+	albums.StaffToken = staffToken
+	router := SetupRouter(albums)
+	ctx := context.Background()
+	token := registerCustomer(t, router, "ella@example.com")
+
+	rr := authRequest(router, http.MethodPut, "/carts", "", token)
+	var cart struct{ ID string }
+	if err := json.Unmarshal(rr.Body.Bytes(), &cart); err != nil {
+		t.Fatalf("Failed to decode cart: %v", err)
+	}
+	authRequest(router, http.MethodPut, "/carts/"+cart.ID+"/items", `{"album_id":3,"quantity":1}`, token)
+	authRequest(router, http.MethodPut, "/albums/6/reviews", `{"rating":4}`, token)
+
+	// Albums deleted a while ago, in a known order
+	deletedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for id, at := range map[int64]time.Time{1: deletedAt, 5: deletedAt.Add(time.Hour), 6: deletedAt.Add(time.Hour), 7: deletedAt.Add(time.Hour)} {
+		if err := albums.Store.Trash(ctx, id, 0, at); err != nil {
+			t.Fatalf("Failed to trash album %v: %v", id, err)
+		}
+	}
+
+	tests := []struct {
+		method       string
+		url          string
+		token        string
+		expectedCode int
+		expected     string
+	}{
+		{http.MethodDelete, "/albums/3", token, http.StatusOK, `{"message":"album successfully removed"}`},
+		{http.MethodDelete, "/albums/3", token, http.StatusNotFound, `{"errors":"album not found"}`},
+		{http.MethodGet, "/albums/3", token, http.StatusNotFound, `{"errors":"album not found"}`},
+		{http.MethodGet, "/albums/3/tracks", token, http.StatusNotFound, `{"errors":"album not found"}`},
+		{http.MethodGet, "/albums/3/reviews", token, http.StatusNotFound, `{"errors":"album not found"}`},
+		{http.MethodPatch, "/albums/3", token, http.StatusNotFound, `{"errors":"album not found"}`},
+		{http.MethodGet, "/albums?artist=Gerry%20Mulligan", token, http.StatusOK, `{"data":[],`},
+		{http.MethodGet, "/albums?sort=id", token, http.StatusOK, `{"data":[{"id":2,`},
+		{http.MethodGet, "/carts/" + cart.ID, token, http.StatusOK, `"items":[],`},
+		// Only staff see and restore the trash
+		{http.MethodGet, "/albums/trash", "", http.StatusUnauthorized, `{"errors":"authentication required"}`},
+		{http.MethodGet, "/albums/trash", token, http.StatusForbidden, `{"errors":"only staff can do this"}`},
+		{http.MethodPost, "/albums/6/restore", "", http.StatusUnauthorized, `{"errors":"authentication required"}`},
+		{http.MethodPost, "/albums/6/restore", token, http.StatusForbidden, `{"errors":"only staff can do this"}`},
+		{http.MethodGet, "/albums/trash?limit=1", staffToken, http.StatusOK, `{"data":[{"id":3,"title":"Jeru","artist":"Gerry Mulligan",`},
+		{http.MethodGet, "/albums/trash?cursor=x", staffToken, http.StatusBadRequest, `{"errors":"invalid cursor"}`},
+		{http.MethodGet, "/albums/trash?limit=0", staffToken, http.StatusBadRequest, `{"errors":"limit must be a number between 1 and 100"}`},
+
+		{http.MethodPost, "/albums/6/restore", staffToken, http.StatusOK, `{"id":6,"title":"Ballads","artist":"John Coltrane","artist_id":1,"price":"17.99","review_count":1,"average_rating":4.00,`},
+		{http.MethodPost, "/albums/6/restore", staffToken, http.StatusNotFound, `{"errors":"album not found in the trash"}`},
+		{http.MethodPost, "/albums/2/restore", staffToken, http.StatusNotFound, `{"errors":"album not found in the trash"}`},
+		{http.MethodPost, "/albums/x/restore", staffToken, http.StatusBadRequest, `{"errors":"invalid album id"}`},
+		{http.MethodGet, "/albums/6", token, http.StatusOK, `[{"id":6,"title":"Ballads",`},
+	}
+
+	for _, tt := range tests {
+		rr := authRequest(router, tt.method, tt.url, `{"title":"Jeru"}`, tt.token)
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("%v %v returned wrong status code: got %v want %v", tt.method, tt.url, status, tt.expectedCode)
+		}
+
+		if actual := strings.TrimSpace(rr.Body.String()); !strings.Contains(actual, tt.expected) {
+			t.Errorf("%v %v returned unexpected body: got %v want %v", tt.method, tt.url, actual, tt.expected)
+		}
+	}
+
+	// Pages of the trash follow on from their cursors, most recently deleted first
+	trash := func() []int64 {
+		t.Helper()
+
+		var ids []int64
+		for url := "/albums/trash?limit=1"; url != ""; {
+			rr := authRequest(router, http.MethodGet, url, "", staffToken)
+			var page struct {
+				Data []struct {
+					ID        int64
+					DeletedAt *time.Time `json:"deleted_at"`
+				}
+				Next *string
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+				t.Fatalf("GET %v returned an unexpected page %v: %v", url, rr.Body, err)
+			}
+
+			for _, album := range page.Data {
+				if album.DeletedAt == nil {
+					t.Errorf("Expected album %v in the trash to have deleted_at, got %v", album.ID, rr.Body)
+				}
+				ids = append(ids, album.ID)
+			}
+			url = ""
+			if page.Next != nil {
+				url = "/albums/trash?limit=1&cursor=" + *page.Next
+			}
+		}
+
+		return ids
+	}
+
+	if ids := trash(); !slices.Equal(ids, []int64{3, 7, 5, 1}) {
+		t.Errorf("Unexpected trash: got %v want %v", ids, []int64{3, 7, 5, 1})
+	}
+
+	// Purging deletes the albums that have been in the trash for longer than
+	// the retention period for good
+	purged, err := albums.PurgeTrash(ctx, 24*time.Hour, deletedAt.Add(24*time.Hour+30*time.Minute))
+	if err != nil || purged != 1 {
+		t.Fatalf("PurgeTrash returned %v, %v, want 1", purged, err)
+	}
+	if ids := trash(); !slices.Equal(ids, []int64{3, 7, 5}) {
+		t.Errorf("Unexpected trash after purging: got %v want %v", ids, []int64{3, 7, 5})
+	}
+	if rr := authRequest(router, http.MethodPost, "/albums/1/restore", "", staffToken); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected a purged album not to be restored, got %v", rr.Code)
+	}
+
+	if purged, err := albums.PurgeTrash(ctx, 0, time.Now().Add(time.Second)); err != nil || purged != 3 {
+		t.Fatalf("PurgeTrash returned %v, %v, want 3", purged, err)
+	}
+	if ids := trash(); len(ids) != 0 {
+		t.Errorf("Expected the trash to be empty, got %v", ids)
+	}
+	if err := albums.Store.Delete(ctx, 3); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("Expected the purged album to be gone, got %v", err)
+	}
+}
+
+func TestPurge_MemoryStore(t *testing.T) {
+	testPurge(t, NewMemoryStore(queryAlbums...))
+}
+
+func TestPurge_SQLite(t *testing.T) {
+	testPurge(t, querySQLiteStore(t))
+}
+
+// testPurge checks that Purge only deletes albums still in the trash since
+// the cutoff, against a store holding queryAlbums.
+func testPurge(t *testing.T, store Backend) {
+	t.Helper()
+
+	ctx := context.Background()
+	deletedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if err := store.Purge(ctx, 2, deletedAt); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("Expected an album outside the trash not to be purged, got %v", err)
+	}
+
+	if err := store.Trash(ctx, 2, 0, deletedAt); err != nil {
+		t.Fatalf("Failed to trash album: %v", err)
+	}
+	if err := store.Purge(ctx, 2, deletedAt.Add(-time.Second)); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("Expected an album deleted after the cutoff not to be purged, got %v", err)
+	}
+
+	// An album restored after it was listed for purging is kept
+	if err := store.Restore(ctx, 2); err != nil {
+		t.Fatalf("Failed to restore album: %v", err)
+	}
+	if err := store.Purge(ctx, 2, deletedAt.Add(time.Hour)); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("Expected a restored album not to be purged, got %v", err)
+	}
+	if _, err := store.Get(ctx, 2); err != nil {
+		t.Errorf("Expected the restored album to be kept, got %v", err)
+	}
+
+	if err := store.Trash(ctx, 2, 0, deletedAt); err != nil {
+		t.Fatalf("Failed to trash album: %v", err)
+	}
+	if err := store.Purge(ctx, 2, deletedAt); err != nil {
+		t.Errorf("Expected the album to be purged, got %v", err)
+	}
+	if err := store.Restore(ctx, 2); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("Expected the purged album to be gone, got %v", err)
+	}
+}
+
+func TestTrashCursor(t *testing.T) {
+	deletedAt := time.Date(2026, 1, 1, 12, 30, 0, 0, time.UTC)
+
+	cursor := encodeTrashCursor(deletedAt, 42)
+	if at, id, err := decodeTrashCursor(cursor); err != nil || !at.Equal(deletedAt) || id != 42 {
+		t.Errorf("Expected cursor to decode to %v and 42, got %v, %v, %v", deletedAt, at, id, err)
+	}
+
+	for _, invalid := range []string{"x", encodeIDCursor(42), encodeTrashCursor(deletedAt, 0)} {
+		if _, _, err := decodeTrashCursor(invalid); !errors.Is(err, errInvalidCursor) {
+			t.Errorf("Expected decodeTrashCursor(%q) to fail, got %v", invalid, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"go-web-service/money"
+)
+
+// Limits of the album table columns.
+const (
+	maxTitleLength  = 128
+	maxArtistLength = 255
+	// maxPrice is the largest value a DECIMAL(5, 2) column holds.
+	maxPrice      = "999.99"
+	maxPriceCents = 99999
+)
+
+// FieldError describes a single invalid field of a request.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("'%v' %v", e.Field, e.Message)
+}
+
+// ValidationErrors collects every FieldError found in a request so they can
+// be reported together.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldError := range e {
+		messages[i] = fieldError.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (e *ValidationErrors) Add(field, message string) {
+	*e = append(*e, FieldError{Field: field, Message: message})
+}
+
+// Has reports whether field already has an error.
+func (e ValidationErrors) Has(field string) bool {
+	for _, fieldError := range e {
+		if fieldError.Field == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ServeValidationErrors writes a 422 response listing every field error, both
+// as readable messages under "errors" and grouped by field under "fields".
+func ServeValidationErrors(w http.ResponseWriter, errs ValidationErrors) {
+	messages := make([]string, len(errs))
+	fields := map[string][]string{}
+	for i, fieldError := range errs {
+		messages[i] = fieldError.Error()
+		fields[fieldError.Field] = append(fields[fieldError.Field], fieldError.Message)
+	}
+
+	ServeJSON(w, map[string]any{"errors": messages, "fields": fields}, http.StatusUnprocessableEntity)
+}
+
+// Validate checks the fields of an update against the album table limits.
+// When requireAll is set, as it is for new albums, missing fields are errors
+// too. Fields that already have an error in errs are skipped.
+func (u AlbumUpdate) Validate(requireAll bool, errs ValidationErrors) ValidationErrors {
+	if !errs.Has("title") {
+		validateText(&errs, "title", u.Title, maxTitleLength, requireAll)
+	}
+	if !errs.Has("artist") {
+		// An artist_id stands in for the artist name
+		validateText(&errs, "artist", u.Artist, maxArtistLength, requireAll && u.ArtistID == nil)
+	}
+	if u.ArtistID != nil {
+		switch {
+		case u.Artist != nil:
+			errs.Add("artist_id", "must not be passed with 'artist'")
+		case *u.ArtistID < 1:
+			errs.Add("artist_id", "must be a positive number")
+		}
+	}
+
+	if !errs.Has("price") && !errs.Has("currency") {
+		validatePrice(&errs, u.Price, requireAll)
+	}
+
+	// The empty string clears these, so only other values are checked
+	if u.RecordLabel != nil && *u.RecordLabel != "" {
+		validateText(&errs, "label", u.RecordLabel, maxRecordLabelLength, false)
+	}
+	if u.CatalogNumber != nil && *u.CatalogNumber != "" {
+		validateText(&errs, "catalog_number", u.CatalogNumber, maxCatalogNumberLength, false)
+	}
+	if u.Format != nil && *u.Format != "" && !slices.Contains(albumFormats, *u.Format) {
+		errs.Add("format", "must be one of "+strings.Join(albumFormats, ", "))
+	}
+
+	return errs
+}
+
+func validatePrice(errs *ValidationErrors, price *money.Money, required bool) {
+	if price == nil {
+		if required {
+			errs.Add("price", "is required")
+		}
+		return
+	}
+
+	exponent, ok := money.Exponent(price.Currency)
+	if !ok {
+		errs.Add("currency", "must be a supported ISO 4217 currency code")
+		return
+	}
+
+	// The price column stores hundredths whatever the currency. Rescaling
+	// fails when it would lose decimals, or overflow for currencies with
+	// fewer than two.
+	cents, ok := price.Rescale(2)
+	switch {
+	case price.Amount < 0:
+		errs.Add("price", "must not be negative")
+	case !ok && exponent > 2:
+		errs.Add("price", "must not have more than 2 decimal places")
+	case !ok, cents > maxPriceCents:
+		errs.Add("price", "must not be more than "+maxPrice)
+	}
+}
+
+func validateText(errs *ValidationErrors, field string, value *string, maxLength int, required bool) {
+	switch {
+	case value == nil:
+		if required {
+			errs.Add(field, "is required")
+		}
+	case strings.TrimSpace(*value) == "":
+		errs.Add(field, "must not be blank")
+	case utf8.RuneCountInString(*value) > maxLength:
+		errs.Add(field, fmt.Sprintf("must be at most %d characters", maxLength))
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-web-service/money"
+)
+
+func TestAlbumUpdate_Validate(t *testing.T) {
+	valid := Album{Title: "Blue Train", Artist: "John Coltrane", Price: money.MustParse("56.99", "USD")}
+	if errs := valid.Update().Validate(true, nil); len(errs) != 0 {
+		t.Errorf("Expected a valid album, got %v", errs)
+	}
+
+	for _, price := range []money.Money{money.New(0, "USD"), money.New(1, "USD"), money.New(99999, "USD"), money.New(999, "JPY")} {
+		if errs := (AlbumUpdate{Price: &price}).Validate(false, nil); len(errs) != 0 {
+			t.Errorf("Expected price %v %v to be valid, got %v", price, price.Currency, errs)
+		}
+	}
+
+	invalid := map[money.Money]string{
+		money.New(-1, "USD"):     "'price' must not be negative",
+		money.New(100000, "USD"): "'price' must not be more than 999.99",
+		money.New(1000, "JPY"):   "'price' must not be more than 999.99",
+		// 100 times this wraps around to 84 in an int64
+		money.New(184467440737095517, "JPY"): "'price' must not be more than 999.99",
+		money.New(math.MaxInt64, "KRW"):      "'price' must not be more than 999.99",
+		money.New(1234, "BHD"):               "'price' must not have more than 2 decimal places",
+		money.New(100, "XYZ"):                "'currency' must be a supported ISO 4217 currency code",
+	}
+	for price, expected := range invalid {
+		if errs := (AlbumUpdate{Price: &price}).Validate(false, nil); errs.Error() != expected {
+			t.Errorf("Unexpected errors for price %v %v: got %v want %v", price, price.Currency, errs, expected)
+		}
+	}
+
+	if errs := (AlbumUpdate{}).Validate(false, nil); len(errs) != 0 {
+		t.Errorf("Expected an empty partial update to be valid, got %v", errs)
+	}
+
+	errs := (AlbumUpdate{}).Validate(true, nil)
+	if errs.Error() != "'title' is required; 'artist' is required; 'price' is required" {
+		t.Errorf("Unexpected errors for an empty album: %v", errs)
+	}
+
+	// Existing errors for a field are not reported twice
+	var existing ValidationErrors
+	existing.Add("price", "must be a number")
+	errs = (AlbumUpdate{Title: &valid.Title, Artist: &valid.Artist}).Validate(true, existing)
+	if len(errs) != 1 || !errs.Has("price") {
+		t.Errorf("Expected only the existing price error, got %v", errs)
+	}
+}
+
+func TestServeValidationErrors(t *testing.T) {
+	var errs ValidationErrors
+	errs.Add("price", "must not be negative")
+	errs.Add("price", "must not have more than 2 decimal places")
+
+	rr := httptest.NewRecorder()
+	ServeValidationErrors(rr, errs)
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code %v, got %v", http.StatusUnprocessableEntity, rr.Code)
+	}
+
+	expected := `{"errors":["'price' must not be negative","'price' must not have more than 2 decimal places"],"fields":{"price":["must not be negative","must not have more than 2 decimal places"]}}`
+	actual := strings.TrimSpace(rr.Body.String())
+	if actual != expected {
+		t.Errorf("Expected body %v, got %v", expected, actual)
+	}
+}
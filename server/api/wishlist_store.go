@@ -0,0 +1,411 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"go-web-service/money"
+)
+
+func (s *MemoryStore) CreateWishlist(ctx context.Context, wishlist Wishlist) (Wishlist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if wishlist.CustomerID != nil {
+		if _, ok := s.customers[*wishlist.CustomerID]; !ok {
+			return Wishlist{}, ErrCustomerNotFound
+		}
+		if _, err := s.findWishlist(WishlistOwner{CustomerID: wishlist.CustomerID}); err == nil {
+			return Wishlist{}, ErrWishlistExists
+		}
+	}
+
+	s.nextWishlistID++
+	wishlist.ID, wishlist.Items = s.nextWishlistID, nil
+	s.wishlists[wishlist.ID] = wishlist
+
+	return wishlist, nil
+}
+
+func (s *MemoryStore) FindWishlist(ctx context.Context, owner WishlistOwner) (Wishlist, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wishlist, err := s.findWishlist(owner)
+	wishlist.Items = nil
+
+	return wishlist, err
+}
+
+func (s *MemoryStore) GetWishlist(ctx context.Context, id int64) (Wishlist, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wishlist, ok := s.wishlists[id]
+	if !ok {
+		return Wishlist{}, ErrWishlistNotFound
+	}
+
+	items := make([]WishlistItem, len(wishlist.Items))
+	for i, item := range wishlist.Items {
+		items[i] = item
+		if item.AlbumID == nil {
+			continue
+		}
+		album, ok := s.albums[*item.AlbumID]
+		if !ok {
+			// The album is in the trash
+			items[i].AlbumID = nil
+			continue
+		}
+		price := album.Price
+		items[i].AlbumID, items[i].Title, items[i].Artist, items[i].Price = &album.ID, album.Title, album.Artist, &price
+	}
+	wishlist.Items = items
+
+	return wishlist, nil
+}
+
+func (s *MemoryStore) DeleteWishlist(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.wishlists[id]; !ok {
+		return ErrWishlistNotFound
+	}
+
+	delete(s.wishlists, id)
+
+	return nil
+}
+
+func (s *MemoryStore) AddWishlistItem(ctx context.Context, wishlistID, albumID int64, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wishlist, ok := s.wishlists[wishlistID]
+	if !ok {
+		return ErrWishlistNotFound
+	}
+	album, ok := s.albums[albumID]
+	if !ok {
+		return ErrAlbumNotFound
+	}
+
+	for _, item := range wishlist.Items {
+		if item.AlbumID != nil && *item.AlbumID == albumID {
+			return nil
+		}
+	}
+
+	s.nextWishlistItemID++
+	item := WishlistItem{ID: s.nextWishlistItemID, AlbumID: &album.ID, Title: album.Title, Artist: album.Artist, AddedAt: now}
+	wishlist.Items = append(slices.Clone(wishlist.Items), item)
+	s.wishlists[wishlistID] = wishlist
+
+	return nil
+}
+
+func (s *MemoryStore) RemoveWishlistItem(ctx context.Context, wishlistID, itemID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wishlist, ok := s.wishlists[wishlistID]
+	if !ok {
+		return ErrWishlistNotFound
+	}
+
+	items := slices.DeleteFunc(slices.Clone(wishlist.Items), func(item WishlistItem) bool { return item.ID == itemID })
+	if len(items) == len(wishlist.Items) {
+		return ErrWishlistItemNotFound
+	}
+
+	wishlist.Items = items
+	s.wishlists[wishlistID] = wishlist
+
+	return nil
+}
+
+func (s *MemoryStore) SetWishlistShare(ctx context.Context, id int64, nonce string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wishlist, ok := s.wishlists[id]
+	if !ok {
+		return ErrWishlistNotFound
+	}
+
+	wishlist.ShareNonce = nonce
+	s.wishlists[id] = wishlist
+
+	return nil
+}
+
+// findWishlist returns the wishlist of owner. Callers must hold s.mu.
+func (s *MemoryStore) findWishlist(owner WishlistOwner) (Wishlist, error) {
+	for _, wishlist := range s.wishlists {
+		switch {
+		case owner.CustomerID != nil:
+			if wishlist.CustomerID != nil && *wishlist.CustomerID == *owner.CustomerID {
+				return wishlist, nil
+			}
+		case owner.TokenHash != "" && wishlist.OwnerTokenHash == owner.TokenHash:
+			return wishlist, nil
+		}
+	}
+
+	return Wishlist{}, ErrWishlistNotFound
+}
+
+// wishlistColumns are the wishlist columns scanWishlist reads.
+const wishlistColumns = "id, customer_id, owner_token_hash, share_nonce, created_at"
+
+// scanWishlist reads the wishlistColumns of a *sql.Row.
+func scanWishlist(row *sql.Row) (Wishlist, error) {
+	var wishlist Wishlist
+	var customerID sql.NullInt64
+	var tokenHash, nonce sql.NullString
+	err := row.Scan(&wishlist.ID, &customerID, &tokenHash, &nonce, timeScanner{&wishlist.CreatedAt})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Wishlist{}, ErrWishlistNotFound
+	}
+	if err != nil {
+		return Wishlist{}, err
+	}
+
+	if customerID.Valid {
+		wishlist.CustomerID = &customerID.Int64
+	}
+	wishlist.OwnerTokenHash, wishlist.ShareNonce = tokenHash.String, nonce.String
+
+	return wishlist, nil
+}
+
+func (s *SQLStore) CreateWishlist(ctx context.Context, wishlist Wishlist) (Wishlist, error) {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return Wishlist{}, err
+	}
+	defer tx.Rollback()
+
+	if wishlist.CustomerID != nil {
+		var customers, existing int
+		err := tx.QueryRowContext(ctx, s.rebind(`SELECT (SELECT COUNT(*) FROM customer WHERE id = ?), (SELECT COUNT(*) FROM wishlist WHERE customer_id = ?)`),
+			*wishlist.CustomerID, *wishlist.CustomerID).Scan(&customers, &existing)
+		if err != nil {
+			return Wishlist{}, err
+		}
+		if customers == 0 {
+			return Wishlist{}, ErrCustomerNotFound
+		}
+		if existing > 0 {
+			return Wishlist{}, ErrWishlistExists
+		}
+	}
+
+	var tokenHash, nonce *string
+	if wishlist.OwnerTokenHash != "" {
+		tokenHash = &wishlist.OwnerTokenHash
+	}
+	if wishlist.ShareNonce != "" {
+		nonce = &wishlist.ShareNonce
+	}
+
+	query := `INSERT INTO wishlist (customer_id, owner_token_hash, share_nonce, created_at) VALUES (?, ?, ?, ?)`
+	args := []any{wishlist.CustomerID, tokenHash, nonce, wishlist.CreatedAt.UTC()}
+	if s.postgres() {
+		err = tx.QueryRowContext(ctx, s.rebind(query+` RETURNING id`), args...).Scan(&wishlist.ID)
+	} else {
+		var result sql.Result
+		if result, err = tx.ExecContext(ctx, query, args...); err == nil {
+			wishlist.ID, err = result.LastInsertId()
+		}
+	}
+	if err != nil {
+		return Wishlist{}, err
+	}
+
+	wishlist.Items = nil
+
+	return wishlist, tx.Commit()
+}
+
+func (s *SQLStore) FindWishlist(ctx context.Context, owner WishlistOwner) (Wishlist, error) {
+	switch {
+	case owner.CustomerID != nil:
+		return scanWishlist(s.Db.QueryRowContext(ctx, s.rebind(`SELECT `+wishlistColumns+` FROM wishlist WHERE customer_id = ?`), *owner.CustomerID))
+	case owner.TokenHash != "":
+		return scanWishlist(s.Db.QueryRowContext(ctx, s.rebind(`SELECT `+wishlistColumns+` FROM wishlist WHERE owner_token_hash = ?`), owner.TokenHash))
+	default:
+		return Wishlist{}, ErrWishlistNotFound
+	}
+}
+
+// GetWishlist reads items whose album was deleted or is in the trash from
+// their own copy of the album's title and artist.
+func (s *SQLStore) GetWishlist(ctx context.Context, id int64) (Wishlist, error) {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return Wishlist{}, err
+	}
+	defer tx.Rollback()
+
+	wishlist, err := scanWishlist(tx.QueryRowContext(ctx, s.rebind(`SELECT `+wishlistColumns+` FROM wishlist WHERE id = ?`), id))
+	if err != nil {
+		return Wishlist{}, err
+	}
+
+	rows, err := tx.QueryContext(ctx, s.rebind(`SELECT i.id, a.id, COALESCE(a.title, i.title), COALESCE(a.artist, i.artist), a.currency, a.price, i.added_at`+
+		` FROM wishlist_item i LEFT JOIN album a ON a.id = i.album_id AND a.deleted_at IS NULL WHERE i.wishlist_id = ? ORDER BY i.id`), id)
+	if err != nil {
+		return Wishlist{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item WishlistItem
+		var albumID sql.NullInt64
+		var currency sql.NullString
+		var price any
+		if err := rows.Scan(&item.ID, &albumID, &item.Title, &item.Artist, &currency, &price, timeScanner{&item.AddedAt}); err != nil {
+			return Wishlist{}, err
+		}
+		if albumID.Valid {
+			item.AlbumID, item.Price = &albumID.Int64, &money.Money{Currency: currency.String}
+			if err := item.Price.Scan(price); err != nil {
+				return Wishlist{}, err
+			}
+		}
+		wishlist.Items = append(wishlist.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return Wishlist{}, err
+	}
+
+	return wishlist, tx.Commit()
+}
+
+func (s *SQLStore) DeleteWishlist(ctx context.Context, id int64) error {
+	result, err := s.Db.ExecContext(ctx, s.rebind(`DELETE FROM wishlist WHERE id = ?`), id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrWishlistNotFound
+	}
+
+	return nil
+}
+
+// AddWishlistItem locks the wishlist row, so that adding the same album twice
+// at once cannot run into the unique index.
+func (s *SQLStore) AddWishlistItem(ctx context.Context, wishlistID, albumID int64, now time.Time) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT id FROM wishlist WHERE id = ?`
+	if s.Driver != "sqlite" {
+		query += ` FOR UPDATE`
+	}
+	err = tx.QueryRowContext(ctx, s.rebind(query), wishlistID).Scan(&wishlistID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrWishlistNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var title, artist string
+	err = tx.QueryRowContext(ctx, s.rebind(`SELECT title, artist FROM album WHERE id = ? AND deleted_at IS NULL`), albumID).Scan(&title, &artist)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAlbumNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var existing int
+	err = tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM wishlist_item WHERE wishlist_id = ? AND album_id = ?`), wishlistID, albumID).Scan(&existing)
+	if err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO wishlist_item (wishlist_id, album_id, title, artist, added_at) VALUES (?, ?, ?, ?, ?)`),
+		wishlistID, albumID, title, artist, now.UTC())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) RemoveWishlistItem(ctx context.Context, wishlistID, itemID int64) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var wishlists int
+	if err := tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM wishlist WHERE id = ?`), wishlistID).Scan(&wishlists); err != nil {
+		return err
+	}
+	if wishlists == 0 {
+		return ErrWishlistNotFound
+	}
+
+	result, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM wishlist_item WHERE wishlist_id = ? AND id = ?`), wishlistID, itemID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrWishlistItemNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) SetWishlistShare(ctx context.Context, id int64, nonce string) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var wishlists int
+	if err := tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM wishlist WHERE id = ?`), id).Scan(&wishlists); err != nil {
+		return err
+	}
+	if wishlists == 0 {
+		return ErrWishlistNotFound
+	}
+
+	var value *string
+	if nonce != "" {
+		value = &nonce
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(`UPDATE wishlist SET share_nonce = ? WHERE id = ?`), value, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,428 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-web-service/money"
+)
+
+var (
+	// ErrWishlistNotFound is returned by a WishlistStore when no wishlist
+	// matches the given id or owner.
+	ErrWishlistNotFound = errors.New("wishlist not found")
+	// ErrWishlistItemNotFound is returned when the wishlist has no item with
+	// the given id.
+	ErrWishlistItemNotFound = errors.New("wishlist item not found")
+	// ErrWishlistExists is returned when creating a second wishlist for a
+	// customer.
+	ErrWishlistExists = errors.New("customer already has a wishlist")
+)
+
+// wishlistTokenHeader carries the owner token of an anonymous wishlist.
+const wishlistTokenHeader = "Wishlist-Token"
+
+// WishlistOwner is whose wishlist a request is about: a customer, or the
+// holder of an anonymous wishlist's owner token, known by its SHA-256.
+type WishlistOwner struct {
+	CustomerID *int64
+	TokenHash  string
+}
+
+// Wishlist is a list of albums someone is interested in. It belongs to a
+// customer, or to an anonymous owner when CustomerID is null. Shared reports
+// whether a share link currently gives read access to it.
+type Wishlist struct {
+	ID             int64          `json:"id"`
+	CustomerID     *int64         `json:"customer_id"`
+	Items          []WishlistItem `json:"items"`
+	Shared         bool           `json:"shared"`
+	CreatedAt      time.Time      `json:"created_at"`
+	OwnerTokenHash string         `json:"-"`
+	// ShareNonce is part of the signed share link. Replacing or clearing it
+	// revokes the link.
+	ShareNonce string `json:"-"`
+}
+
+// WishlistItem is an album on a wishlist at its current price and
+// availability. Once the album is deleted AlbumID, Price and Availability
+// are null, and Title and Artist are those the album had when added.
+type WishlistItem struct {
+	ID           int64         `json:"id"`
+	AlbumID      *int64        `json:"album_id"`
+	Title        string        `json:"title"`
+	Artist       string        `json:"artist"`
+	Price        *money.Money  `json:"price"`
+	Availability *Availability `json:"availability"`
+	AddedAt      time.Time     `json:"added_at"`
+}
+
+// SharedWishlist is what a share link shows of a wishlist, leaving out who
+// it belongs to.
+type SharedWishlist struct {
+	Items     []WishlistItem `json:"items"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// WishlistStore is the persistence layer the wishlist handlers depend on.
+type WishlistStore interface {
+	// CreateWishlist returns ErrWishlistExists when the wishlist's customer
+	// already has one.
+	CreateWishlist(ctx context.Context, wishlist Wishlist) (Wishlist, error)
+	// FindWishlist returns the wishlist of owner, without its items.
+	FindWishlist(ctx context.Context, owner WishlistOwner) (Wishlist, error)
+	// GetWishlist returns the wishlist with its items in the order they were
+	// added, each at its album's current price.
+	GetWishlist(ctx context.Context, id int64) (Wishlist, error)
+	DeleteWishlist(ctx context.Context, id int64) error
+	// AddWishlistItem leaves the wishlist as it is when the album is on it
+	// already.
+	AddWishlistItem(ctx context.Context, wishlistID, albumID int64, now time.Time) error
+	RemoveWishlistItem(ctx context.Context, wishlistID, itemID int64) error
+	// SetWishlistShare replaces the wishlist's share nonce. An empty nonce
+	// stops the wishlist being shared.
+	SetWishlistShare(ctx context.Context, id int64, nonce string) error
+}
+
+// WishlistResponse is what AddWishlist serves. OwnerToken is only set for a
+// new anonymous wishlist, and goes in the Wishlist-Token header of later
+// requests about it. It cannot be recovered once lost.
+type WishlistResponse struct {
+	Wishlist
+	OwnerToken string `json:"owner_token,omitempty"`
+}
+
+// ShareResponse is what ShareWishlist serves.
+type ShareResponse struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// AddWishlist serves the authenticated customer's wishlist, creating it if
+// need be. Anonymous callers get a new wishlist and its owner token.
+func (a *Albums) AddWishlist(w http.ResponseWriter, r *http.Request) {
+	wishlist := Wishlist{CreatedAt: time.Now().UTC().Truncate(time.Second)}
+
+	var token string
+	if customer, ok := CurrentCustomer(r.Context()); ok {
+		wishlist.CustomerID = &customer.ID
+	} else {
+		var err error
+		if token, err = newSessionToken(); err != nil {
+			ServeJSONError(w, fmt.Sprintf("AddWishlist %v", err), http.StatusInternalServerError)
+			return
+		}
+		wishlist.OwnerTokenHash = hashToken(token)
+	}
+
+	owner := WishlistOwner{CustomerID: wishlist.CustomerID}
+	wishlist, err := a.Wishlists.CreateWishlist(r.Context(), wishlist)
+	if errors.Is(err, ErrWishlistExists) {
+		wishlist, err = a.Wishlists.FindWishlist(r.Context(), owner)
+	}
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("AddWishlist %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	wishlist, ok := a.wishlist(w, r, wishlist.ID, "AddWishlist")
+	if !ok {
+		return
+	}
+
+	ServeJSON(w, WishlistResponse{Wishlist: wishlist, OwnerToken: token}, http.StatusOK)
+}
+
+// GetWishlist serves the caller's wishlist with each album's current price
+// and availability.
+func (a *Albums) GetWishlist(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.ownWishlist(w, r, "GetWishlist")
+	if !ok {
+		return
+	}
+
+	a.serveWishlist(w, r, id, "GetWishlist")
+}
+
+func (a *Albums) DeleteWishlist(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.ownWishlist(w, r, "DeleteWishlist")
+	if !ok {
+		return
+	}
+
+	err := a.Wishlists.DeleteWishlist(r.Context(), id)
+	switch {
+	case errors.Is(err, ErrWishlistNotFound):
+		ServeJSONError(w, "wishlist not found", http.StatusNotFound)
+	case err != nil:
+		ServeJSONError(w, "could not delete wishlist", http.StatusInternalServerError)
+	default:
+		ServeJSON(w, map[string]any{"message": "wishlist successfully removed"}, http.StatusOK)
+	}
+}
+
+// AddWishlistItem puts an album on the caller's wishlist, as in
+// {"album_id":3}, and serves the wishlist.
+func (a *Albums) AddWishlistItem(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.ownWishlist(w, r, "AddWishlistItem")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		AlbumID *int64 `json:"album_id"`
+	}
+	if !readJSON(w, r, &input) {
+		return
+	}
+
+	if input.AlbumID == nil {
+		var errs ValidationErrors
+		errs.Add("album_id", "is required")
+		ServeValidationErrors(w, errs)
+		return
+	}
+
+	err := a.Wishlists.AddWishlistItem(r.Context(), id, *input.AlbumID, time.Now().UTC().Truncate(time.Second))
+	switch {
+	case errors.Is(err, ErrWishlistNotFound):
+		ServeJSONError(w, "wishlist not found", http.StatusNotFound)
+	case errors.Is(err, ErrAlbumNotFound):
+		ServeJSONError(w, "album not found", http.StatusNotFound)
+	case err != nil:
+		ServeJSONError(w, fmt.Sprintf("AddWishlistItem %v", err), http.StatusInternalServerError)
+	default:
+		a.serveWishlist(w, r, id, "AddWishlistItem")
+	}
+}
+
+// DeleteWishlistItem takes an item off the caller's wishlist by its id, which
+// works for items whose album was deleted too, and serves the wishlist.
+func (a *Albums) DeleteWishlistItem(w http.ResponseWriter, r *http.Request) {
+	itemID, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/wishlist/items/"), 10, 64)
+	if err != nil {
+		ServeJSONError(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+
+	id, ok := a.ownWishlist(w, r, "DeleteWishlistItem")
+	if !ok {
+		return
+	}
+
+	err = a.Wishlists.RemoveWishlistItem(r.Context(), id, itemID)
+	switch {
+	case errors.Is(err, ErrWishlistNotFound):
+		ServeJSONError(w, "wishlist not found", http.StatusNotFound)
+	case errors.Is(err, ErrWishlistItemNotFound):
+		ServeJSONError(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		ServeJSONError(w, fmt.Sprintf("DeleteWishlistItem %v", err), http.StatusInternalServerError)
+	default:
+		a.serveWishlist(w, r, id, "DeleteWishlistItem")
+	}
+}
+
+// ShareWishlist serves a new read-only link to the caller's wishlist. Any
+// link shared before stops working.
+func (a *Albums) ShareWishlist(w http.ResponseWriter, r *http.Request) {
+	if len(a.ShareKey) == 0 {
+		ServeJSONError(w, "wishlist sharing is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	id, ok := a.ownWishlist(w, r, "ShareWishlist")
+	if !ok {
+		return
+	}
+
+	nonce, err := newShareNonce()
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("ShareWishlist %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	err = a.Wishlists.SetWishlistShare(r.Context(), id, nonce)
+	switch {
+	case errors.Is(err, ErrWishlistNotFound):
+		ServeJSONError(w, "wishlist not found", http.StatusNotFound)
+	case err != nil:
+		ServeJSONError(w, fmt.Sprintf("ShareWishlist %v", err), http.StatusInternalServerError)
+	default:
+		token := shareToken(a.ShareKey, id, nonce)
+		ServeJSON(w, ShareResponse{Token: token, URL: "/wishlists/shared/" + token}, http.StatusOK)
+	}
+}
+
+// UnshareWishlist revokes the caller's wishlist's share link.
+func (a *Albums) UnshareWishlist(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.ownWishlist(w, r, "UnshareWishlist")
+	if !ok {
+		return
+	}
+
+	err := a.Wishlists.SetWishlistShare(r.Context(), id, "")
+	switch {
+	case errors.Is(err, ErrWishlistNotFound):
+		ServeJSONError(w, "wishlist not found", http.StatusNotFound)
+	case err != nil:
+		ServeJSONError(w, fmt.Sprintf("UnshareWishlist %v", err), http.StatusInternalServerError)
+	default:
+		ServeJSON(w, map[string]any{"message": "wishlist is no longer shared"}, http.StatusOK)
+	}
+}
+
+// GetSharedWishlist serves the wishlist a share link points at, to anyone
+// holding the link. Forged, revoked and replaced links are all not found.
+func (a *Albums) GetSharedWishlist(w http.ResponseWriter, r *http.Request) {
+	if len(a.ShareKey) == 0 {
+		ServeJSONError(w, "wishlist sharing is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	id, nonce, ok := parseShareToken(a.ShareKey, strings.TrimPrefix(r.URL.Path, "/wishlists/shared/"))
+	if !ok {
+		ServeJSONError(w, "wishlist not found", http.StatusNotFound)
+		return
+	}
+
+	wishlist, ok := a.wishlist(w, r, id, "GetSharedWishlist")
+	if !ok {
+		return
+	}
+	if wishlist.ShareNonce == "" || subtle.ConstantTimeCompare([]byte(wishlist.ShareNonce), []byte(nonce)) != 1 {
+		ServeJSONError(w, "wishlist not found", http.StatusNotFound)
+		return
+	}
+
+	ServeJSON(w, SharedWishlist{Items: wishlist.Items, CreatedAt: wishlist.CreatedAt}, http.StatusOK)
+}
+
+// ownWishlist returns the id of the caller's wishlist: the authenticated
+// customer's, or else the one whose owner token the request carries. It
+// writes an error response and returns false when there is none.
+func (a *Albums) ownWishlist(w http.ResponseWriter, r *http.Request, handler string) (int64, bool) {
+	var owner WishlistOwner
+	if customer, ok := CurrentCustomer(r.Context()); ok {
+		owner.CustomerID = &customer.ID
+	} else if token := strings.TrimSpace(r.Header.Get(wishlistTokenHeader)); token != "" {
+		owner.TokenHash = hashToken(token)
+	} else {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		ServeJSONError(w, "authentication or a "+wishlistTokenHeader+" header is required", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	wishlist, err := a.Wishlists.FindWishlist(r.Context(), owner)
+	if errors.Is(err, ErrWishlistNotFound) {
+		ServeJSONError(w, "wishlist not found", http.StatusNotFound)
+		return 0, false
+	}
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+		return 0, false
+	}
+
+	return wishlist.ID, true
+}
+
+func (a *Albums) serveWishlist(w http.ResponseWriter, r *http.Request, id int64, handler string) {
+	wishlist, ok := a.wishlist(w, r, id, handler)
+	if !ok {
+		return
+	}
+
+	ServeJSON(w, wishlist, http.StatusOK)
+}
+
+// wishlist reads a wishlist and fills in the availability of its albums. It
+// writes an error response and returns false when that fails.
+func (a *Albums) wishlist(w http.ResponseWriter, r *http.Request, id int64, handler string) (Wishlist, bool) {
+	wishlist, err := a.Wishlists.GetWishlist(r.Context(), id)
+	if errors.Is(err, ErrWishlistNotFound) {
+		ServeJSONError(w, "wishlist not found", http.StatusNotFound)
+		return Wishlist{}, false
+	}
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+		return Wishlist{}, false
+	}
+
+	var albumIDs []int64
+	for _, item := range wishlist.Items {
+		if item.AlbumID != nil {
+			albumIDs = append(albumIDs, *item.AlbumID)
+		}
+	}
+
+	stock, err := a.Inventory.Stock(r.Context(), albumIDs, time.Now())
+	if err != nil {
+		ServeJSONError(w, fmt.Sprintf("%v %v", handler, err), http.StatusInternalServerError)
+		return Wishlist{}, false
+	}
+
+	for i, item := range wishlist.Items {
+		if item.AlbumID != nil {
+			status := newStockLevel(stock[*item.AlbumID]).Status
+			wishlist.Items[i].Availability = &status
+		}
+	}
+	if wishlist.Items == nil {
+		wishlist.Items = []WishlistItem{}
+	}
+	wishlist.Shared = wishlist.ShareNonce != ""
+
+	return wishlist, true
+}
+
+// newShareNonce returns a random share nonce of 32 hex digits.
+func newShareNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(nonce), nil
+}
+
+// shareToken signs a wishlist id and share nonce with key. The token is the
+// id, the nonce and an HMAC-SHA256 of both, encoded for use in a URL.
+func shareToken(key []byte, id int64, nonce string) string {
+	payload := binary.BigEndian.AppendUint64(nil, uint64(id))
+	payload = append(payload, nonce...)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(payload))
+}
+
+// parseShareToken returns the wishlist id and share nonce of a token signed
+// with key, and false for tokens that are malformed or signed otherwise.
+func parseShareToken(key []byte, token string) (int64, string, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != 8+32+sha256.Size {
+		return 0, "", false
+	}
+
+	payload, sum := raw[:8+32], raw[8+32:]
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	if !hmac.Equal(mac.Sum(nil), sum) {
+		return 0, "", false
+	}
+
+	return int64(binary.BigEndian.Uint64(payload[:8])), string(payload[8:]), true
+}
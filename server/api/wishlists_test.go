@@ -0,0 +1,291 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWishlists_MemoryStore(t *testing.T) {
+	testWishlists(t, NewMemoryStore(queryAlbums...))
+}
+
+func TestWishlists_SQLite(t *testing.T) {
+	testWishlists(t, querySQLiteStore(t))
+}
+
+// testWishlists runs through filling, sharing and emptying an anonymous
+// wishlist and a customer's one, against a store holding queryAlbums.
+func testWishlists(t *testing.T, store Backend) {
+	t.Helper()
+
+	albums := NewAlbums(store)
+	albums.ShareKey = []byte(strings.Repeat("k", 32))
+	router := SetupRouter(albums)
+	if _, err := store.AdjustStock(context.Background(), 1, "vinyl", 10, time.Now()); err != nil {
+		t.Fatalf("Failed to stock album: %v", err)
+	}
+
+	rr := shopRequest(router, http.MethodPut, "/wishlist", "")
+	var created struct {
+		ID         int64
+		CustomerID *int64 `json:"customer_id"`
+		OwnerToken string `json:"owner_token"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil || created.OwnerToken == "" || created.CustomerID != nil {
+		t.Fatalf("Unexpected new wishlist %v: %v", rr.Body, err)
+	}
+
+	customer := registerCustomer(t, router, "ella@example.com")
+	owner := http.Header{wishlistTokenHeader: {created.OwnerToken}}
+	callers := map[string]http.Header{
+		"owner":    owner,
+		"customer": {"Authorization": {"Bearer " + customer}},
+		"stranger": {wishlistTokenHeader: {"stranger"}},
+	}
+
+	tests := []struct {
+		method       string
+		url          string
+		caller       string
+		body         string
+		expectedCode int
+		expected     string
+	}{
+		{http.MethodGet, "/wishlist", "owner", "", http.StatusOK, `{"id":1,"customer_id":null,"items":[],"shared":false,`},
+		{http.MethodGet, "/wishlist", "", "", http.StatusUnauthorized, `{"errors":"authentication or a Wishlist-Token header is required"}`},
+		{http.MethodGet, "/wishlist", "stranger", "", http.StatusNotFound, `{"errors":"wishlist not found"}`},
+		{http.MethodPut, "/wishlist/items", "owner", `{"album_id":3}`, http.StatusOK, `"items":[{"id":1,"album_id":3,"title":"Jeru","artist":"Gerry Mulligan","price":"17.99","availability":"out_of_stock","added_at":`},
+		{http.MethodPut, "/wishlist/items", "owner", `{"album_id":1}`, http.StatusOK, `{"id":2,"album_id":1,"title":"Blue Train","artist":"John Coltrane","price":"56.99","availability":"in_stock",`},
+		{http.MethodPut, "/wishlist/items", "owner", `{"album_id":3}`, http.StatusOK, `"items":[{"id":1,"album_id":3,`},
+		{http.MethodPut, "/wishlist/items", "owner", `{"album_id":99}`, http.StatusNotFound, `{"errors":"album not found"}`},
+		{http.MethodPut, "/wishlist/items", "owner", `{}`, http.StatusUnprocessableEntity, `"fields":{"album_id":["is required"]}`},
+		{http.MethodDelete, "/wishlist/items/9", "owner", "", http.StatusNotFound, `{"errors":"wishlist item not found"}`},
+		{http.MethodDelete, "/wishlist/items/x", "owner", "", http.StatusBadRequest, `{"errors":"invalid item id"}`},
+		{http.MethodPut, "/wishlist", "customer", "", http.StatusOK, `{"id":2,"customer_id":1,"items":[],`},
+		{http.MethodPut, "/wishlist/items", "customer", `{"album_id":5}`, http.StatusOK, `"items":[{"id":3,"album_id":5,"title":"F-1 Trillion",`},
+		{http.MethodPut, "/wishlist", "customer", "", http.StatusOK, `{"id":2,"customer_id":1,"items":[{"id":3,`},
+		{http.MethodDelete, "/wishlist/items/1", "customer", "", http.StatusNotFound, `{"errors":"wishlist item not found"}`},
+		{http.MethodDelete, "/wishlist/share", "owner", "", http.StatusOK, `{"message":"wishlist is no longer shared"}`},
+	}
+
+	for _, tt := range tests {
+		rr := wishlistRequest(router, tt.method, tt.url, tt.body, callers[tt.caller])
+
+		if status := rr.Code; status != tt.expectedCode {
+			t.Errorf("%v %v returned wrong status code: got %v want %v", tt.method, tt.url, status, tt.expectedCode)
+		}
+
+		if actual := strings.TrimSpace(rr.Body.String()); !strings.Contains(actual, tt.expected) {
+			t.Errorf("%v %v returned unexpected body: got %v want %v", tt.method, tt.url, actual, tt.expected)
+		}
+	}
+
+	// Share links show the items, and stop working once replaced or revoked
+	share := func() string {
+		t.Helper()
+
+		rr := wishlistRequest(router, http.MethodPut, "/wishlist/share", "", owner)
+		var link ShareResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &link); err != nil || link.URL != "/wishlists/shared/"+link.Token {
+			t.Fatalf("Unexpected share link %v: %v", rr.Body, err)
+		}
+
+		return link.URL
+	}
+	shared := func(url string, expectedCode int) string {
+		t.Helper()
+
+		rr := shopRequest(router, http.MethodGet, url, "")
+		if rr.Code != expectedCode {
+			t.Errorf("GET %v returned wrong status code: got %v want %v", url, rr.Code, expectedCode)
+		}
+
+		return rr.Body.String()
+	}
+
+	first := share()
+	if body := shared(first, http.StatusOK); !strings.HasPrefix(body, `{"items":[{"id":1,"album_id":3,"title":"Jeru",`) || strings.Contains(body, "customer_id") {
+		t.Errorf("Unexpected shared wishlist %v", body)
+	}
+	if rr := wishlistRequest(router, http.MethodGet, "/wishlist", "", owner); !strings.Contains(rr.Body.String(), `"shared":true`) {
+		t.Errorf("Expected the wishlist to be shared, got %v", rr.Body)
+	}
+
+	second := share()
+	shared(first, http.StatusNotFound)
+	shared(second, http.StatusOK)
+	shared(second[:len(second)-2]+"AA", http.StatusNotFound)
+	shared("/wishlists/shared/x", http.StatusNotFound)
+
+	wishlistRequest(router, http.MethodDelete, "/wishlist/share", "", owner)
+	shared(second, http.StatusNotFound)
+
+	// Items outlive their album, and can still be taken off the wishlist
+	if err := store.Delete(context.Background(), 3); err != nil {
+		t.Fatalf("Failed to delete album: %v", err)
+	}
+	rr = wishlistRequest(router, http.MethodGet, "/wishlist", "", owner)
+	if expected := `"items":[{"id":1,"album_id":null,"title":"Jeru","artist":"Gerry Mulligan","price":null,"availability":null,`; !strings.Contains(rr.Body.String(), expected) {
+		t.Errorf("Unexpected wishlist after deleting an album: got %v want %v", rr.Body, expected)
+	}
+	rr = wishlistRequest(router, http.MethodDelete, "/wishlist/items/1", "", owner)
+	if expected := `"items":[{"id":2,"album_id":1,`; !strings.Contains(rr.Body.String(), expected) {
+		t.Errorf("Unexpected wishlist after removing an item: got %v want %v", rr.Body, expected)
+	}
+
+	// Wishlists go with the account or when deleted
+	wishlistRequest(router, http.MethodDelete, "/me", `{"password":"a-love-supreme"}`, callers["customer"])
+	if _, err := store.GetWishlist(context.Background(), 2); !errors.Is(err, ErrWishlistNotFound) {
+		t.Errorf("Expected the customer's wishlist to be deleted with them, got %v", err)
+	}
+	if rr := wishlistRequest(router, http.MethodDelete, "/wishlist", "", owner); rr.Code != http.StatusOK {
+		t.Errorf("DeleteWishlist returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := wishlistRequest(router, http.MethodGet, "/wishlist", "", owner); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected the deleted wishlist to be gone, got %v", rr.Code)
+	}
+}
+
+func TestWishlistStore_MemoryStore(t *testing.T) {
+	testWishlistStore(t, NewMemoryStore(queryAlbums...))
+}
+
+func TestWishlistStore_SQLite(t *testing.T) {
+	testWishlistStore(t, querySQLiteStore(t))
+}
+
+// testWishlistStore fills, shares and empties a wishlist whose albums are
+// trashed and deleted along the way, against store holding queryAlbums.
+func testWishlistStore(t *testing.T, store Backend) {
+	t.Helper()
+
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	wishlist, err := store.CreateWishlist(ctx, Wishlist{OwnerTokenHash: hashToken("owner"), CreatedAt: now})
+	if err != nil {
+		t.Fatalf("Failed to create wishlist: %v", err)
+	}
+	if found, err := store.FindWishlist(ctx, WishlistOwner{TokenHash: hashToken("owner")}); err != nil || found.ID != wishlist.ID {
+		t.Errorf("Expected to find the wishlist by its owner, got %+v, %v", found, err)
+	}
+	if _, err := store.FindWishlist(ctx, WishlistOwner{TokenHash: hashToken("stranger")}); !errors.Is(err, ErrWishlistNotFound) {
+		t.Errorf("Expected %v, got %v", ErrWishlistNotFound, err)
+	}
+
+	for _, id := range []int64{3, 1, 4, 3} {
+		if err := store.AddWishlistItem(ctx, wishlist.ID, id, now); err != nil {
+			t.Fatalf("Failed to add album %v: %v", id, err)
+		}
+	}
+	if err := store.AddWishlistItem(ctx, wishlist.ID, 99, now); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("Expected %v adding a missing album, got %v", ErrAlbumNotFound, err)
+	}
+	if err := store.AddWishlistItem(ctx, 99, 3, now); !errors.Is(err, ErrWishlistNotFound) {
+		t.Errorf("Expected %v adding to a missing wishlist, got %v", ErrWishlistNotFound, err)
+	}
+
+	// Trashed albums cannot be added, and those on the list show their copy
+	// of the album's details until restored
+	if err := store.Trash(ctx, 1, 0, now); err != nil {
+		t.Fatalf("Failed to trash album: %v", err)
+	}
+	if err := store.AddWishlistItem(ctx, wishlist.ID, 1, now); !errors.Is(err, ErrAlbumNotFound) {
+		t.Errorf("Expected %v adding a trashed album, got %v", ErrAlbumNotFound, err)
+	}
+	if err := store.Delete(ctx, 4); err != nil {
+		t.Fatalf("Failed to delete album: %v", err)
+	}
+
+	found, err := store.GetWishlist(ctx, wishlist.ID)
+	if err != nil || len(found.Items) != 3 {
+		t.Fatalf("Expected three items, got %+v, %v", found, err)
+	}
+	jeru, blueTrain, sarahVaughan := found.Items[0], found.Items[1], found.Items[2]
+	if jeru.AlbumID == nil || *jeru.AlbumID != 3 || jeru.Price == nil || jeru.Price.String() != "17.99" {
+		t.Errorf("Unexpected item %+v", jeru)
+	}
+	if blueTrain.AlbumID != nil || blueTrain.Price != nil || blueTrain.Title != "Blue Train" || blueTrain.Artist != "John Coltrane" {
+		t.Errorf("Expected the trashed album to show its copy, got %+v", blueTrain)
+	}
+	if sarahVaughan.AlbumID != nil || sarahVaughan.Price != nil || sarahVaughan.Title != "Sarah Vaughan" {
+		t.Errorf("Expected the deleted album to show its copy, got %+v", sarahVaughan)
+	}
+
+	if err := store.Restore(ctx, 1); err != nil {
+		t.Fatalf("Failed to restore album: %v", err)
+	}
+	if found, err := store.GetWishlist(ctx, wishlist.ID); err != nil || found.Items[1].AlbumID == nil || *found.Items[1].AlbumID != 1 {
+		t.Errorf("Expected the restored album to be back on the wishlist, got %+v, %v", found, err)
+	}
+
+	if err := store.RemoveWishlistItem(ctx, wishlist.ID, sarahVaughan.ID); err != nil {
+		t.Fatalf("Failed to remove item: %v", err)
+	}
+	if err := store.RemoveWishlistItem(ctx, wishlist.ID, sarahVaughan.ID); !errors.Is(err, ErrWishlistItemNotFound) {
+		t.Errorf("Expected %v removing the item twice, got %v", ErrWishlistItemNotFound, err)
+	}
+
+	// Replacing or clearing the nonce revokes the share link
+	for _, nonce := range []string{"first", "second", ""} {
+		if err := store.SetWishlistShare(ctx, wishlist.ID, nonce); err != nil {
+			t.Fatalf("Failed to share wishlist: %v", err)
+		}
+		found, err := store.GetWishlist(ctx, wishlist.ID)
+		if err != nil || found.ShareNonce != nonce {
+			t.Errorf("Expected the share nonce %q, got %+v, %v", nonce, found, err)
+		}
+	}
+	if err := store.SetWishlistShare(ctx, 99, "x"); !errors.Is(err, ErrWishlistNotFound) {
+		t.Errorf("Expected %v, got %v", ErrWishlistNotFound, err)
+	}
+
+	if err := store.DeleteWishlist(ctx, wishlist.ID); err != nil {
+		t.Fatalf("Failed to delete wishlist: %v", err)
+	}
+	if _, err := store.GetWishlist(ctx, wishlist.ID); !errors.Is(err, ErrWishlistNotFound) {
+		t.Errorf("Expected the wishlist to be gone, got %v", err)
+	}
+}
+
+func TestShareToken(t *testing.T) {
+	key := []byte(strings.Repeat("k", 32))
+	nonce := strings.Repeat("ab", 16)
+
+	token := shareToken(key, 42, nonce)
+	if id, parsed, ok := parseShareToken(key, token); !ok || id != 42 || parsed != nonce {
+		t.Errorf("Expected token to parse as 42 and %v, got %v, %v, %v", nonce, id, parsed, ok)
+	}
+	if _, _, ok := parseShareToken([]byte(strings.Repeat("x", 32)), token); ok {
+		t.Errorf("Expected a token signed with another key to be refused")
+	}
+
+	raw, _ := base64.RawURLEncoding.DecodeString(token)
+	raw[7]++
+	if _, _, ok := parseShareToken(key, base64.RawURLEncoding.EncodeToString(raw)); ok {
+		t.Errorf("Expected a token with a changed id to be refused")
+	}
+}
+
+// wishlistRequest sends a request with a JSON body and header.
+func wishlistRequest(router http.Handler, method, url, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	return rr
+}
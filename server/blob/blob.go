@@ -0,0 +1,34 @@
+// Package blob stores opaque files, such as album cover images, by key.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// ErrNotFound is returned by a Store when no blob has the key.
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps blobs under slash separated keys such as covers/1/original.
+type Store interface {
+	// Put writes the blob, replacing any blob with the key.
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	// Get returns ErrNotFound when no blob has the key. The caller closes the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// validKey rejects keys that are empty, absolute or would escape the store
+// through "..", so that every store lays out the same keys the same way.
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Dir stores blobs as files below a directory on the local filesystem. The
+// content type is not kept; readers sniff it or know it from elsewhere.
+type Dir struct {
+	Path string
+}
+
+func (d Dir) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	name, err := d.name(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it into place, so that readers
+	// never see a partly written blob.
+	file, err := os.CreateTemp(filepath.Dir(name), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), name)
+}
+
+func (d Dir) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := d.name(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return file, err
+}
+
+func (d Dir) Delete(ctx context.Context, key string) error {
+	name, err := d.name(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// name returns the file the blob with key is kept in.
+func (d Dir) name(key string) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(d.Path, filepath.FromSlash(key)), nil
+}
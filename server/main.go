@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"github.com/joho/godotenv"
 	"go-web-service/api"
+	"go-web-service/migrations"
 	"go-web-service/utils"
 	"net/http"
 	"os"
@@ -22,7 +25,62 @@ func main() {
 		panic("failed to connect to database")
 	}
 
-	endpoints := &api.Albums{Db: db}
+	migrator := &migrations.Migrator{Db: db, Driver: utils.DatabaseDriver()}
+
+	// `migrate up`, `migrate down N` and `migrate status` manage the schema and exit
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrations.Run(context.Background(), migrator, os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if os.Getenv("DATABASE_MIGRATE_ON_START") != "false" {
+		if _, err := migrator.Up(context.Background()); err != nil {
+			panic(err)
+		}
+	}
+
+	sqlStore := &api.SQLStore{Db: db, Driver: utils.DatabaseDriver()}
+	if err := sqlStore.NormalizeArtists(context.Background()); err != nil {
+		panic(err)
+	}
+
+	// The in-process index serves fuzzy search and suggestions, and full-text
+	// search on databases without it
+	store, err := api.NewIndexedStore(context.Background(), sqlStore)
+	if err != nil {
+		panic(err)
+	}
+
+	blobs, err := utils.BlobStoreInit()
+	if err != nil {
+		panic(err)
+	}
+
+	shareKey, err := utils.ShareKeyInit()
+	if err != nil {
+		panic(err)
+	}
+
+	staffToken, err := utils.StaffTokenInit()
+	if err != nil {
+		panic(err)
+	}
+
+	retention, err := utils.TrashRetentionInit()
+	if err != nil {
+		panic(err)
+	}
+
+	endpoints := api.NewAlbums(store)
+	endpoints.Blobs = blobs
+	endpoints.ShareKey = shareKey
+	endpoints.StaffToken = staffToken
+
+	// Albums deleted longer ago than the retention period are purged in the background
+	go endpoints.RunTrashPurge(context.Background(), retention)
 
 	router := api.SetupRouter(endpoints)
 	err = http.ListenAndServe(":"+os.Getenv("APPLICATION_PORT"), router)
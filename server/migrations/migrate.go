@@ -0,0 +1,423 @@
+// Package migrations keeps the database schema in numbered up/down SQL files,
+// one directory per database driver, and applies them with a Migrator.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-web-service/utils"
+)
+
+//go:embed mysql postgres sqlite
+var files embed.FS
+
+// ErrLocked is returned when another instance holds the migration lock.
+var ErrLocked = errors.New("another instance is running migrations")
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// lockName and lockKey name the migration lock for MySQL's GET_LOCK and
+// PostgreSQL's advisory locks respectively.
+const (
+	lockName = "go-web-service.schema_migrations"
+	lockKey  = 7_424_312_019
+)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+type Status struct {
+	Migration
+	// AppliedAt is empty while the migration is pending.
+	AppliedAt string
+}
+
+// Migrator applies the migrations for Driver to Db, tracking them in the
+// schema_migrations table.
+type Migrator struct {
+	Db     *sql.DB
+	Driver string
+	// LockTimeout bounds how long to wait for another instance to finish
+	// migrating. It defaults to ten seconds.
+	LockTimeout time.Duration
+}
+
+// Load returns the migrations shipped for driver in version order.
+func Load(driver string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, driver)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for driver %q", driver)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %v", entry.Name())
+		}
+
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %v has more than one name", version)
+		}
+
+		contents, err := fs.ReadFile(files, path.Join(driver, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	var migrations []Migration
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %v has no up file", migration)
+		}
+
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Up applies every pending migration and returns the ones it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	migrations, err := Load(m.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+
+			err := m.run(ctx, conn, migration.Up,
+				`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("migrate up %v: %v", migration, err)
+			}
+
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down rolls back the most recently applied steps migrations and returns them.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, err := Load(m.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[int64]Migration{}
+	for _, migration := range migrations {
+		known[migration.Version] = migration
+	}
+
+	var rolledBack []Migration
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		var applied []int64
+		for version := range versions {
+			applied = append(applied, version)
+		}
+		sort.Slice(applied, func(i, j int) bool { return applied[i] > applied[j] })
+
+		for i := 0; i < steps && i < len(applied); i++ {
+			migration, ok := known[applied[i]]
+			if !ok {
+				return fmt.Errorf("migrate down: applied migration %v has no file", applied[i])
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migrate down %v: no down file", migration)
+			}
+
+			err := m.run(ctx, conn, migration.Down,
+				`DELETE FROM schema_migrations WHERE version = ?`, migration.Version)
+			if err != nil {
+				return fmt.Errorf("migrate down %v: %v", migration, err)
+			}
+
+			rolledBack = append(rolledBack, migration)
+		}
+
+		return nil
+	})
+
+	return rolledBack, err
+}
+
+// Status reports every known migration and when it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	migrations, err := Load(m.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := m.Db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	versions, err := m.appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, migration := range migrations {
+		statuses = append(statuses, Status{Migration: migration, AppliedAt: versions[migration.Version]})
+	}
+
+	return statuses, nil
+}
+
+// run executes the statements of a migration followed by its bookkeeping
+// query. Outside SQLite each migration gets its own transaction; SQLite runs
+// the whole batch inside the transaction that doubles as its lock.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, statements string, bookkeeping string, args ...any) error {
+	if m.Driver == "sqlite" {
+		return execAll(ctx, conn, statements, m.rebind(bookkeeping), args)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := execAll(ctx, tx, statements, m.rebind(bookkeeping), args); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func execAll(ctx context.Context, db execer, statements string, bookkeeping string, args []any) error {
+	for _, statement := range split(statements) {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	_, err := db.ExecContext(ctx, bookkeeping, args...)
+
+	return err
+}
+
+// split breaks a migration file into statements. Statements end with a
+// semicolon at the end of a line and full-line -- comments are dropped.
+func split(contents string) []string {
+	var statements []string
+	var statement strings.Builder
+
+	for _, line := range strings.Split(contents, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		statement.WriteString(line)
+		statement.WriteString("\n")
+
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(statement.String()))
+			statement.Reset()
+		}
+	}
+
+	if rest := strings.TrimSpace(statement.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+
+	return statements
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.Db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	unlock, err := m.lock(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	err = m.ensureTable(ctx, conn)
+	if err == nil {
+		err = fn(conn)
+	}
+
+	if unlockErr := unlock(err); err == nil {
+		err = unlockErr
+	}
+
+	return err
+}
+
+// lock takes the driver's migration lock on conn. The returned function
+// releases it and is told whether the locked work failed.
+func (m *Migrator) lock(ctx context.Context, conn *sql.Conn) (func(error) error, error) {
+	timeout := m.LockTimeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	switch m.Driver {
+	case "mysql":
+		var acquired sql.NullInt64
+		err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, lockName, int(timeout.Seconds())).Scan(&acquired)
+		if err != nil {
+			return nil, fmt.Errorf("acquire migration lock: %v", err)
+		}
+		if acquired.Int64 != 1 {
+			return nil, ErrLocked
+		}
+
+		return func(error) error {
+			_, err := conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, lockName)
+			return err
+		}, nil
+	case "postgres":
+		deadline := time.Now().Add(timeout)
+		for {
+			var acquired bool
+			err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, lockKey).Scan(&acquired)
+			if err != nil {
+				return nil, fmt.Errorf("acquire migration lock: %v", err)
+			}
+			if acquired {
+				break
+			}
+			if time.Now().After(deadline) {
+				return nil, ErrLocked
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(250 * time.Millisecond):
+			}
+		}
+
+		return func(error) error {
+			_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+			return err
+		}, nil
+	case "sqlite":
+		// SQLite has no named locks, but an immediate transaction holds the
+		// database's single write lock until it ends. busy_timeout bounds the wait.
+		if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrLocked, err)
+		}
+
+		return func(failed error) error {
+			if failed != nil {
+				_, err := conn.ExecContext(context.Background(), `ROLLBACK`)
+				return err
+			}
+
+			_, err := conn.ExecContext(context.Background(), `COMMIT`)
+			return err
+		}, nil
+	default:
+		return nil, fmt.Errorf("no migration lock for driver %q", m.Driver)
+	}
+}
+
+func (m *Migrator) ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations
+(
+    version    BIGINT       NOT NULL PRIMARY KEY,
+    name       VARCHAR(255) NOT NULL,
+    applied_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %v", err)
+	}
+
+	return nil
+}
+
+// appliedVersions maps each applied version to the time it was applied.
+func (m *Migrator) appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]string, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	versions := map[int64]string{}
+	for rows.Next() {
+		var version int64
+		var appliedAt string
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("read schema_migrations: %v", err)
+		}
+
+		versions[version] = appliedAt
+	}
+
+	return versions, rows.Err()
+}
+
+func (m *Migrator) rebind(query string) string {
+	return utils.Rebind(m.Driver, query)
+}
@@ -0,0 +1,236 @@
+package migrations
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	_ "modernc.org/sqlite"
+)
+
+func getSQLiteDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "recordings.db")+"?_pragma=busy_timeout(100)")
+	if err != nil {
+		t.Fatalf("Failed to open sqlite database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestLoad(t *testing.T) {
+	for _, driver := range []string{"mysql", "postgres", "sqlite"} {
+		migrations, err := Load(driver)
+		if err != nil {
+			t.Fatalf("Expected %v migrations to load, got %v", driver, err)
+		}
+
+		if len(migrations) == 0 || migrations[0].String() != "0001_create_album" {
+			t.Errorf("Expected %v migrations to start with 0001_create_album, got %v", driver, migrations)
+		}
+
+		for i, migration := range migrations {
+			if migration.Down == "" {
+				t.Errorf("Expected %v migration %v to have a down file", driver, migration)
+			}
+			if i > 0 && migrations[i-1].Version >= migration.Version {
+				t.Errorf("Expected %v migrations in version order, got %v", driver, migrations)
+			}
+		}
+	}
+
+	if _, err := Load("oracle"); err == nil {
+		t.Error("Expected an error for a driver without migrations")
+	}
+}
+
+func TestSplit(t *testing.T) {
+	statements := split(`-- leading comment
+CREATE TABLE a
+(
+    id INT
+);
+
+INSERT INTO a VALUES (1);
+SELECT 1`)
+
+	if len(statements) != 3 {
+		t.Fatalf("Expected 3 statements, got %q", statements)
+	}
+	if !strings.HasPrefix(statements[0], "CREATE TABLE a") || !strings.HasSuffix(statements[0], ");") {
+		t.Errorf("Unexpected first statement %q", statements[0])
+	}
+}
+
+func TestMigrator_SQLite(t *testing.T) {
+	ctx := context.Background()
+	db := getSQLiteDB(t)
+	migrator := &Migrator{Db: db, Driver: "sqlite"}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	all, _ := Load("sqlite")
+	if len(applied) != len(all) {
+		t.Errorf("Expected every migration to be applied, got %v", applied)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM album").Scan(&count); err != nil || count != 5 {
+		t.Fatalf("Expected 5 seeded albums, got %v (%v)", count, err)
+	}
+
+	applied, err = migrator.Up(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("Expected a second run to be a no-op, got %v (%v)", applied, err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == "" {
+			t.Errorf("Expected %v to be applied", status.Migration)
+		}
+	}
+
+	rolledBack, err := migrator.Down(ctx, len(all))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(rolledBack) != len(all) || rolledBack[len(rolledBack)-1].Version != 1 {
+		t.Errorf("Expected migrations to be rolled back newest first, got %v", rolledBack)
+	}
+
+	if _, err := db.Exec("SELECT 1 FROM album"); err == nil {
+		t.Error("Expected album table to be dropped")
+	}
+
+	var out bytes.Buffer
+	if err := Run(ctx, migrator, []string{"status"}, &out); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(out.String(), "0001_create_album") || !strings.Contains(out.String(), "pending") {
+		t.Errorf("Expected status to list pending migrations, got %q", out.String())
+	}
+}
+
+func TestMigrator_SQLiteLocked(t *testing.T) {
+	db := getSQLiteDB(t)
+
+	// Another connection holding the write lock stands in for a second instance
+	other, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to open connection: %v", err)
+	}
+	defer other.Close()
+
+	if _, err := other.ExecContext(context.Background(), "BEGIN IMMEDIATE"); err != nil {
+		t.Fatalf("Failed to take write lock: %v", err)
+	}
+	defer other.ExecContext(context.Background(), "ROLLBACK")
+
+	_, err = (&Migrator{Db: db, Driver: "sqlite"}).Up(context.Background())
+	if !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected ErrLocked, got %v", err)
+	}
+}
+
+func TestMigrator_MySQLLocked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock database: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT GET_LOCK\(\?, \?\)`).
+		WithArgs(lockName, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"GET_LOCK"}).AddRow(0))
+
+	_, err = (&Migrator{Db: db, Driver: "mysql"}).Up(context.Background())
+	if !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected ErrLocked, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRun_Usage(t *testing.T) {
+	migrator := &Migrator{Driver: "sqlite"}
+
+	for _, args := range [][]string{{}, {"sideways"}, {"down", "zero"}} {
+		if err := Run(context.Background(), migrator, args, &bytes.Buffer{}); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
+
+func TestMigrator_SQLiteArtists(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "recordings.db")+"?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatalf("Failed to open sqlite database: %v", err)
+	}
+	defer db.Close()
+
+	migrator := &Migrator{Db: db, Driver: "sqlite"}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Roll back to before the artist table and add artists spelled differently
+	all, _ := Load("sqlite")
+	var since int
+	for _, migration := range all {
+		if migration.Version >= 4 {
+			since++
+		}
+	}
+	if _, err := migrator.Down(ctx, since); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO album (title, artist, price) VALUES ('Ballads', 'john coltrane ', 17.99), ('Lush Life', ' JOHN COLTRANE', 19.99)`); err != nil {
+		t.Fatalf("Failed to insert albums: %v", err)
+	}
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	rows, err := db.Query(`SELECT artist.name, COUNT(*) FROM album JOIN artist ON artist.id = album.artist_id GROUP BY artist.id ORDER BY artist.id`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer rows.Close()
+
+	var artists []string
+	for rows.Next() {
+		var name string
+		var albums int
+		if err := rows.Scan(&name, &albums); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		artists = append(artists, fmt.Sprintf("%v:%d", name, albums))
+	}
+
+	expected := "John Coltrane:4,Gerry Mulligan:1,Sarah Vaughan:1,Post Malone:1"
+	if actual := strings.Join(artists, ","); actual != expected {
+		t.Errorf("Unexpected artists: got %v want %v", actual, expected)
+	}
+
+	var spellings int
+	if err := db.QueryRow(`SELECT COUNT(DISTINCT artist) FROM album`).Scan(&spellings); err != nil || spellings != 4 {
+		t.Errorf("Expected album artists to take the artist's name, got %v spellings (%v)", spellings, err)
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE album DROP INDEX album_search;
@@ -0,0 +1 @@
+ALTER TABLE album ADD FULLTEXT INDEX album_search (title, artist);
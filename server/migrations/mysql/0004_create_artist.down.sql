@@ -0,0 +1,2 @@
+ALTER TABLE album DROP FOREIGN KEY album_artist, DROP COLUMN artist_id;
+DROP TABLE artist;
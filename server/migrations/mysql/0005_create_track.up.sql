@@ -0,0 +1,15 @@
+-- Tracks are numbered from 1 on each disc. The server keeps the numbers
+-- contiguous as tracks are added, moved and removed.
+CREATE TABLE track
+(
+    id       INT AUTO_INCREMENT NOT NULL,
+    album_id INT                NOT NULL,
+    disc     SMALLINT           NOT NULL DEFAULT 1,
+    position SMALLINT           NOT NULL,
+    title    VARCHAR(255)       NOT NULL,
+    duration INT                NOT NULL,
+    isrc     VARCHAR(12)        NOT NULL DEFAULT '',
+    PRIMARY KEY (`id`),
+    KEY track_album (album_id, disc, position),
+    CONSTRAINT track_album FOREIGN KEY (album_id) REFERENCES album (id) ON DELETE CASCADE
+);
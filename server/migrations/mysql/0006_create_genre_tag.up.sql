@@ -0,0 +1,39 @@
+-- Genres are a curated list; tags are free-form and created as albums are
+-- tagged. Both compare names by name_key, like artists.
+CREATE TABLE genre
+(
+    id       INT AUTO_INCREMENT NOT NULL,
+    name     VARCHAR(100)       NOT NULL,
+    name_key VARCHAR(100)       NOT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY genre_name_key (name_key)
+);
+
+CREATE TABLE tag
+(
+    id       INT AUTO_INCREMENT NOT NULL,
+    name     VARCHAR(50)        NOT NULL,
+    name_key VARCHAR(50)        NOT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY tag_name_key (name_key)
+);
+
+CREATE TABLE album_genre
+(
+    album_id INT NOT NULL,
+    genre_id INT NOT NULL,
+    PRIMARY KEY (album_id, genre_id),
+    KEY album_genre_genre (genre_id),
+    CONSTRAINT album_genre_album FOREIGN KEY (album_id) REFERENCES album (id) ON DELETE CASCADE,
+    CONSTRAINT album_genre_genre FOREIGN KEY (genre_id) REFERENCES genre (id) ON DELETE CASCADE
+);
+
+CREATE TABLE album_tag
+(
+    album_id INT NOT NULL,
+    tag_id   INT NOT NULL,
+    PRIMARY KEY (album_id, tag_id),
+    KEY album_tag_tag (tag_id),
+    CONSTRAINT album_tag_album FOREIGN KEY (album_id) REFERENCES album (id) ON DELETE CASCADE,
+    CONSTRAINT album_tag_tag FOREIGN KEY (tag_id) REFERENCES tag (id) ON DELETE CASCADE
+);
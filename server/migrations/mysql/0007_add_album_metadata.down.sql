@@ -0,0 +1,7 @@
+ALTER TABLE album
+    DROP INDEX album_barcode,
+    DROP COLUMN release_date,
+    DROP COLUMN label,
+    DROP COLUMN format,
+    DROP COLUMN catalog_number,
+    DROP COLUMN barcode;
@@ -0,0 +1,13 @@
+-- The cover image itself lives in the blob store, keyed by its checksum.
+CREATE TABLE album_cover
+(
+    album_id     INT         NOT NULL,
+    content_type VARCHAR(32) NOT NULL,
+    size         INT         NOT NULL,
+    width        INT         NOT NULL,
+    height       INT         NOT NULL,
+    checksum     CHAR(64)    NOT NULL,
+    updated_at   TIMESTAMP   NOT NULL,
+    PRIMARY KEY (`album_id`),
+    CONSTRAINT album_cover_album FOREIGN KEY (album_id) REFERENCES album (id) ON DELETE CASCADE
+);
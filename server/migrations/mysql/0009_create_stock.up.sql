@@ -0,0 +1,23 @@
+-- Physical copies are counted per album and format. Reservations hold copies
+-- back from sale until they expire, so what is available is on_hand less the
+-- quantity of unexpired reservations.
+CREATE TABLE stock
+(
+    album_id INT         NOT NULL,
+    format   VARCHAR(16) NOT NULL,
+    on_hand  INT         NOT NULL DEFAULT 0,
+    PRIMARY KEY (album_id, format),
+    CONSTRAINT stock_album FOREIGN KEY (album_id) REFERENCES album (id) ON DELETE CASCADE
+);
+
+CREATE TABLE reservation
+(
+    id         INT AUTO_INCREMENT NOT NULL,
+    album_id   INT                NOT NULL,
+    format     VARCHAR(16)        NOT NULL,
+    quantity   INT                NOT NULL,
+    expires_at TIMESTAMP          NOT NULL,
+    PRIMARY KEY (`id`),
+    KEY reservation_stock (album_id, format, expires_at),
+    CONSTRAINT reservation_album FOREIGN KEY (album_id) REFERENCES album (id) ON DELETE CASCADE
+);
@@ -0,0 +1,49 @@
+-- Carts are identified by an unguessable token so that anonymous shoppers can
+-- keep one. Their items are priced from the album table when read.
+CREATE TABLE cart
+(
+    id          CHAR(32)  NOT NULL,
+    customer_id INT,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL,
+    PRIMARY KEY (`id`)
+);
+
+CREATE TABLE cart_item
+(
+    cart_id  CHAR(32) NOT NULL,
+    album_id INT      NOT NULL,
+    quantity INT      NOT NULL,
+    PRIMARY KEY (cart_id, album_id),
+    CONSTRAINT cart_item_cart FOREIGN KEY (cart_id) REFERENCES cart (id) ON DELETE CASCADE,
+    CONSTRAINT cart_item_album FOREIGN KEY (album_id) REFERENCES album (id) ON DELETE CASCADE
+);
+
+-- ORDER is a reserved word, hence the plural. Order items keep a copy of the
+-- album's title, artist and price at checkout, and outlive the album.
+CREATE TABLE orders
+(
+    id          INT AUTO_INCREMENT NOT NULL,
+    customer_id INT,
+    status      VARCHAR(16)        NOT NULL,
+    currency    CHAR(3)            NOT NULL,
+    total       DECIMAL(12, 3)     NOT NULL,
+    created_at  TIMESTAMP          NOT NULL,
+    updated_at  TIMESTAMP          NOT NULL,
+    PRIMARY KEY (`id`),
+    KEY orders_customer (customer_id, id)
+);
+
+CREATE TABLE order_item
+(
+    id       INT AUTO_INCREMENT NOT NULL,
+    order_id INT                NOT NULL,
+    album_id INT,
+    title    VARCHAR(128)       NOT NULL,
+    artist   VARCHAR(255)       NOT NULL,
+    quantity INT                NOT NULL,
+    price    DECIMAL(12, 3)     NOT NULL,
+    PRIMARY KEY (`id`),
+    CONSTRAINT order_item_order FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE,
+    CONSTRAINT order_item_album FOREIGN KEY (album_id) REFERENCES album (id) ON DELETE SET NULL
+);
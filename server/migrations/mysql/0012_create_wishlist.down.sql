@@ -0,0 +1,2 @@
+DROP TABLE wishlist_item;
+DROP TABLE wishlist;
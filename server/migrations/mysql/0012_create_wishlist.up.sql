@@ -0,0 +1,31 @@
+-- A wishlist belongs to a customer or, for anonymous callers, to whoever
+-- holds its owner token, of which only the SHA-256 is stored. share_nonce is
+-- part of the signed share link, and clearing or replacing it revokes the link.
+CREATE TABLE wishlist
+(
+    id               INT AUTO_INCREMENT NOT NULL,
+    customer_id      INT,
+    owner_token_hash CHAR(64),
+    share_nonce      CHAR(32),
+    created_at       TIMESTAMP          NOT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY wishlist_customer_unique (customer_id),
+    UNIQUE KEY wishlist_owner_token (owner_token_hash),
+    CONSTRAINT wishlist_customer FOREIGN KEY (customer_id) REFERENCES customer (id) ON DELETE CASCADE
+);
+
+-- Items keep the album's title and artist so that they can still be shown
+-- once the album is deleted.
+CREATE TABLE wishlist_item
+(
+    id          INT AUTO_INCREMENT NOT NULL,
+    wishlist_id INT                NOT NULL,
+    album_id    INT,
+    title       VARCHAR(128)       NOT NULL,
+    artist      VARCHAR(255)       NOT NULL,
+    added_at    TIMESTAMP          NOT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY wishlist_item_unique (wishlist_id, album_id),
+    CONSTRAINT wishlist_item_wishlist FOREIGN KEY (wishlist_id) REFERENCES wishlist (id) ON DELETE CASCADE,
+    CONSTRAINT wishlist_item_album FOREIGN KEY (album_id) REFERENCES album (id) ON DELETE SET NULL
+);
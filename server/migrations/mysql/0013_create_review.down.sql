@@ -0,0 +1,7 @@
+ALTER TABLE album
+    DROP INDEX album_rating,
+    DROP COLUMN review_count,
+    DROP COLUMN rating_total,
+    DROP COLUMN average_rating;
+
+DROP TABLE review;
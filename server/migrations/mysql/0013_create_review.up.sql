@@ -0,0 +1,26 @@
+-- Reviews are one per customer and album. They outlive the customer's
+-- account, so the album's rating does not change when an account is deleted.
+CREATE TABLE review
+(
+    id          INT AUTO_INCREMENT NOT NULL,
+    album_id    INT                NOT NULL,
+    customer_id INT,
+    rating      INT                NOT NULL,
+    body        TEXT               NOT NULL,
+    created_at  TIMESTAMP          NOT NULL,
+    updated_at  TIMESTAMP          NOT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY review_customer_unique (album_id, customer_id),
+    KEY review_album_id (album_id, id),
+    CONSTRAINT review_album FOREIGN KEY (album_id) REFERENCES album (id) ON DELETE CASCADE,
+    CONSTRAINT review_customer FOREIGN KEY (customer_id) REFERENCES customer (id) ON DELETE SET NULL
+);
+
+-- The rating columns are kept up to date as reviews are written, so that
+-- listings neither aggregate reviews nor need them to sort by rating. An
+-- average of 0 means the album has no reviews.
+ALTER TABLE album
+    ADD COLUMN review_count   INT           NOT NULL DEFAULT 0,
+    ADD COLUMN rating_total   INT           NOT NULL DEFAULT 0,
+    ADD COLUMN average_rating DECIMAL(3, 2) NOT NULL DEFAULT 0,
+    ADD KEY album_rating (average_rating, id);
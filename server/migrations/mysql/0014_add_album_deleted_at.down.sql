@@ -0,0 +1,6 @@
+-- Albums in the trash would reappear, so they are purged first.
+DELETE FROM album WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE album
+    DROP INDEX album_deleted_at,
+    DROP COLUMN deleted_at;
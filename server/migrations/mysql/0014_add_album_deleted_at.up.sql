@@ -0,0 +1,5 @@
+-- Deleted albums stay in the trash, hidden from every read, until they are
+-- restored or purged once the retention period is over.
+ALTER TABLE album
+    ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL,
+    ADD KEY album_deleted_at (deleted_at, id);
@@ -0,0 +1,15 @@
+-- Every write to an album is logged here, in the same transaction, with the
+-- fields it changed. Entries are only ever added, and outlive their album.
+CREATE TABLE album_audit
+(
+    id         INT AUTO_INCREMENT NOT NULL,
+    album_id   INT                NOT NULL,
+    action     VARCHAR(16)        NOT NULL,
+    actor      VARCHAR(255)       NOT NULL,
+    request_id VARCHAR(128)       NOT NULL,
+    changes    TEXT               NOT NULL,
+    created_at TIMESTAMP          NOT NULL,
+    PRIMARY KEY (`id`),
+    KEY album_audit_album_id (album_id, id),
+    KEY album_audit_created_at (created_at, id)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE reservation
+    DROP INDEX reservation_cart,
+    DROP COLUMN cart_id;
@@ -0,0 +1,12 @@
+-- The copies each order took off the stock, per album and format, so that
+-- cancelling the order can put them back.
+CREATE TABLE order_stock
+(
+    order_id INT         NOT NULL,
+    album_id INT         NOT NULL,
+    format   VARCHAR(16) NOT NULL,
+    quantity INT         NOT NULL,
+    PRIMARY KEY (order_id, album_id, format),
+    CONSTRAINT order_stock_order FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE,
+    CONSTRAINT order_stock_album FOREIGN KEY (album_id) REFERENCES album (id) ON DELETE CASCADE
+);
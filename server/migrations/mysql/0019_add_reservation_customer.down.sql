@@ -0,0 +1,3 @@
+ALTER TABLE reservation
+    DROP INDEX reservation_customer,
+    DROP COLUMN customer_id;
@@ -0,0 +1,6 @@
+-- Reservations are made by customers, who can only hold so many copies at a
+-- time. Like carts, customers are not referenced by a foreign key: the
+-- reservations of a deleted customer simply expire.
+ALTER TABLE reservation
+    ADD COLUMN customer_id INT NULL DEFAULT NULL,
+    ADD KEY reservation_customer (customer_id, expires_at);
@@ -0,0 +1,2 @@
+-- Existing prices were all entered in US dollars.
+ALTER TABLE album ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
@@ -0,0 +1,2 @@
+-- The 'simple' configuration does not stem, so artist names are matched as written.
+CREATE INDEX album_search ON album USING GIN (to_tsvector('simple', title || ' ' || artist));
@@ -0,0 +1,33 @@
+-- name_key is the lowercased name, so artists differing only in case or
+-- surrounding spaces are one artist. album.artist keeps a copy of the name
+-- for filtering and the album_search index.
+CREATE TABLE artist
+(
+    id       SERIAL       NOT NULL,
+    name     VARCHAR(255) NOT NULL,
+    name_key VARCHAR(255) NOT NULL,
+    bio      TEXT         NOT NULL DEFAULT '',
+    PRIMARY KEY (id),
+    CONSTRAINT artist_name_key UNIQUE (name_key)
+);
+
+-- One artist per distinct album artist, spelled as on its first album.
+INSERT
+INTO artist
+    (name, name_key)
+SELECT TRIM(a.artist), LOWER(TRIM(a.artist))
+FROM album a
+WHERE a.id = (SELECT MIN(b.id) FROM album b WHERE LOWER(TRIM(b.artist)) = LOWER(TRIM(a.artist)))
+ORDER BY a.id;
+
+ALTER TABLE album ADD COLUMN artist_id INTEGER REFERENCES artist (id);
+
+UPDATE album
+SET artist_id = (SELECT id FROM artist WHERE name_key = LOWER(TRIM(album.artist)));
+
+UPDATE album
+SET artist = (SELECT name FROM artist WHERE artist.id = album.artist_id);
+
+ALTER TABLE album ALTER COLUMN artist_id SET NOT NULL;
+
+CREATE INDEX album_artist_id ON album (artist_id);
@@ -0,0 +1,15 @@
+-- Tracks are numbered from 1 on each disc. The server keeps the numbers
+-- contiguous as tracks are added, moved and removed.
+CREATE TABLE track
+(
+    id       SERIAL       NOT NULL,
+    album_id INTEGER      NOT NULL REFERENCES album (id) ON DELETE CASCADE,
+    disc     SMALLINT     NOT NULL DEFAULT 1,
+    position SMALLINT     NOT NULL,
+    title    VARCHAR(255) NOT NULL,
+    duration INTEGER      NOT NULL,
+    isrc     VARCHAR(12)  NOT NULL DEFAULT '',
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX track_album ON track (album_id, disc, position);
@@ -0,0 +1,7 @@
+DROP INDEX album_barcode;
+ALTER TABLE album
+    DROP COLUMN release_date,
+    DROP COLUMN label,
+    DROP COLUMN format,
+    DROP COLUMN catalog_number,
+    DROP COLUMN barcode;
@@ -0,0 +1,10 @@
+-- Barcodes are stored in their 13 digit EAN form and are NULL when unknown,
+-- so the unique index only covers albums that have one.
+ALTER TABLE album
+    ADD COLUMN release_date   DATE         NULL,
+    ADD COLUMN label          VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN format         VARCHAR(16)  NOT NULL DEFAULT '',
+    ADD COLUMN catalog_number VARCHAR(64)  NOT NULL DEFAULT '',
+    ADD COLUMN barcode        CHAR(13)     NULL;
+
+CREATE UNIQUE INDEX album_barcode ON album (barcode);
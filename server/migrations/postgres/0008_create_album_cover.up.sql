@@ -0,0 +1,12 @@
+-- The cover image itself lives in the blob store, keyed by its checksum.
+CREATE TABLE album_cover
+(
+    album_id     INTEGER     NOT NULL REFERENCES album (id) ON DELETE CASCADE,
+    content_type VARCHAR(32) NOT NULL,
+    size         INTEGER     NOT NULL,
+    width        INTEGER     NOT NULL,
+    height       INTEGER     NOT NULL,
+    checksum     CHAR(64)    NOT NULL,
+    updated_at   TIMESTAMP   NOT NULL,
+    PRIMARY KEY (album_id)
+);
@@ -0,0 +1,4 @@
+DROP TABLE order_item;
+DROP TABLE orders;
+DROP TABLE cart_item;
+DROP TABLE cart;
@@ -0,0 +1,2 @@
+DROP TABLE customer_session;
+DROP TABLE customer;
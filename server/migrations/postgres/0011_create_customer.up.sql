@@ -0,0 +1,26 @@
+-- Emails are stored lowercased, so the unique index makes them unique
+-- regardless of case. Passwords are only kept as bcrypt hashes.
+CREATE TABLE customer
+(
+    id            SERIAL       NOT NULL,
+    email         VARCHAR(254) NOT NULL,
+    name          VARCHAR(128) NOT NULL DEFAULT '',
+    password_hash VARCHAR(255) NOT NULL,
+    created_at    TIMESTAMP    NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX customer_email ON customer (email);
+
+-- Sessions are looked up by the SHA-256 of their token, so a leaked table
+-- cannot be used to sign in.
+CREATE TABLE customer_session
+(
+    token_hash  CHAR(64)  NOT NULL,
+    customer_id INTEGER   NOT NULL REFERENCES customer (id) ON DELETE CASCADE,
+    created_at  TIMESTAMP NOT NULL,
+    expires_at  TIMESTAMP NOT NULL,
+    PRIMARY KEY (token_hash)
+);
+
+CREATE INDEX customer_session_customer ON customer_session (customer_id);
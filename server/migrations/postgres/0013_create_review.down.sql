@@ -0,0 +1,7 @@
+DROP INDEX album_rating;
+ALTER TABLE album
+    DROP COLUMN review_count,
+    DROP COLUMN rating_total,
+    DROP COLUMN average_rating;
+
+DROP TABLE review;
@@ -0,0 +1,5 @@
+-- Albums in the trash would reappear, so they are purged first.
+DELETE FROM album WHERE deleted_at IS NOT NULL;
+
+DROP INDEX album_deleted_at;
+ALTER TABLE album DROP COLUMN deleted_at;
@@ -0,0 +1,5 @@
+-- Deleted albums stay in the trash, hidden from every read, until they are
+-- restored or purged once the retention period is over.
+ALTER TABLE album ADD COLUMN deleted_at TIMESTAMP NULL;
+
+CREATE INDEX album_deleted_at ON album (deleted_at, id);
@@ -0,0 +1,16 @@
+-- Every write to an album is logged here, in the same transaction, with the
+-- fields it changed. Entries are only ever added, and outlive their album.
+CREATE TABLE album_audit
+(
+    id         SERIAL       NOT NULL,
+    album_id   INTEGER      NOT NULL,
+    action     VARCHAR(16)  NOT NULL,
+    actor      VARCHAR(255) NOT NULL,
+    request_id VARCHAR(128) NOT NULL,
+    changes    TEXT         NOT NULL,
+    created_at TIMESTAMP    NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX album_audit_album_id ON album_audit (album_id, id);
+CREATE INDEX album_audit_created_at ON album_audit (created_at, id);
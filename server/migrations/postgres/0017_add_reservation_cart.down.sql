@@ -0,0 +1,2 @@
+DROP INDEX reservation_cart;
+ALTER TABLE reservation DROP COLUMN cart_id;
@@ -0,0 +1,10 @@
+-- The copies each order took off the stock, per album and format, so that
+-- cancelling the order can put them back.
+CREATE TABLE order_stock
+(
+    order_id INTEGER     NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    album_id INTEGER     NOT NULL REFERENCES album (id) ON DELETE CASCADE,
+    format   VARCHAR(16) NOT NULL,
+    quantity INTEGER     NOT NULL,
+    PRIMARY KEY (order_id, album_id, format)
+);
@@ -0,0 +1,6 @@
+-- Reservations are made by customers, who can only hold so many copies at a
+-- time. Like carts, customers are not referenced by a foreign key: the
+-- reservations of a deleted customer simply expire.
+ALTER TABLE reservation ADD COLUMN customer_id INTEGER NULL;
+
+CREATE INDEX reservation_customer ON reservation (customer_id, expires_at);
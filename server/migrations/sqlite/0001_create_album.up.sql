@@ -0,0 +1,24 @@
+-- Databases created by the old Docker init script already have this table, so
+-- it is only created and seeded when missing.
+CREATE TABLE IF NOT EXISTS album
+(
+    id     INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    title  VARCHAR(128)                      NOT NULL,
+    artist VARCHAR(255)                      NOT NULL,
+    price  DECIMAL(5, 2)                     NOT NULL
+);
+
+INSERT
+INTO album
+    (title, artist, price)
+SELECT seed.title, seed.artist, seed.price
+FROM (SELECT 'Blue Train' AS title, 'John Coltrane' AS artist, 56.99 AS price
+      UNION ALL
+      SELECT 'Giant Steps', 'John Coltrane', 63.99
+      UNION ALL
+      SELECT 'Jeru', 'Gerry Mulligan', 17.99
+      UNION ALL
+      SELECT 'Sarah Vaughan', 'Sarah Vaughan', 34.98
+      UNION ALL
+      SELECT 'F-1 Trillion', 'Post Malone', 24.99) AS seed
+WHERE NOT EXISTS (SELECT 1 FROM album);
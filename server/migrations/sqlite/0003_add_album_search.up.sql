@@ -0,0 +1 @@
+-- SQLite has no full-text index here; the server searches an in-process index instead.
@@ -0,0 +1,3 @@
+DROP INDEX album_artist_id;
+ALTER TABLE album DROP COLUMN artist_id;
+DROP TABLE artist;
@@ -0,0 +1,4 @@
+DROP TABLE album_tag;
+DROP TABLE album_genre;
+DROP TABLE tag;
+DROP TABLE genre;
@@ -0,0 +1,33 @@
+-- Genres are a curated list; tags are free-form and created as albums are
+-- tagged. Both compare names by name_key, like artists.
+CREATE TABLE genre
+(
+    id       INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    name     VARCHAR(100)                      NOT NULL,
+    name_key VARCHAR(100)                      NOT NULL UNIQUE
+);
+
+CREATE TABLE tag
+(
+    id       INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    name     VARCHAR(50)                       NOT NULL,
+    name_key VARCHAR(50)                       NOT NULL UNIQUE
+);
+
+CREATE TABLE album_genre
+(
+    album_id INTEGER NOT NULL REFERENCES album (id) ON DELETE CASCADE,
+    genre_id INTEGER NOT NULL REFERENCES genre (id) ON DELETE CASCADE,
+    PRIMARY KEY (album_id, genre_id)
+);
+
+CREATE INDEX album_genre_genre ON album_genre (genre_id);
+
+CREATE TABLE album_tag
+(
+    album_id INTEGER NOT NULL REFERENCES album (id) ON DELETE CASCADE,
+    tag_id   INTEGER NOT NULL REFERENCES tag (id) ON DELETE CASCADE,
+    PRIMARY KEY (album_id, tag_id)
+);
+
+CREATE INDEX album_tag_tag ON album_tag (tag_id);
@@ -0,0 +1,6 @@
+DROP INDEX album_barcode;
+ALTER TABLE album DROP COLUMN release_date;
+ALTER TABLE album DROP COLUMN label;
+ALTER TABLE album DROP COLUMN format;
+ALTER TABLE album DROP COLUMN catalog_number;
+ALTER TABLE album DROP COLUMN barcode;
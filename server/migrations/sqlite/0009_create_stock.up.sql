@@ -0,0 +1,21 @@
+-- Physical copies are counted per album and format. Reservations hold copies
+-- back from sale until they expire, so what is available is on_hand less the
+-- quantity of unexpired reservations.
+CREATE TABLE stock
+(
+    album_id INTEGER     NOT NULL REFERENCES album (id) ON DELETE CASCADE,
+    format   VARCHAR(16) NOT NULL,
+    on_hand  INTEGER     NOT NULL DEFAULT 0,
+    PRIMARY KEY (album_id, format)
+);
+
+CREATE TABLE reservation
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    album_id   INTEGER                           NOT NULL REFERENCES album (id) ON DELETE CASCADE,
+    format     VARCHAR(16)                       NOT NULL,
+    quantity   INTEGER                           NOT NULL,
+    expires_at TIMESTAMP                         NOT NULL
+);
+
+CREATE INDEX reservation_stock ON reservation (album_id, format, expires_at);
@@ -0,0 +1,46 @@
+-- Carts are identified by an unguessable token so that anonymous shoppers can
+-- keep one. Their items are priced from the album table when read.
+CREATE TABLE cart
+(
+    id          CHAR(32)  NOT NULL,
+    customer_id INTEGER,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE cart_item
+(
+    cart_id  CHAR(32) NOT NULL REFERENCES cart (id) ON DELETE CASCADE,
+    album_id INTEGER  NOT NULL REFERENCES album (id) ON DELETE CASCADE,
+    quantity INTEGER  NOT NULL,
+    PRIMARY KEY (cart_id, album_id)
+);
+
+-- ORDER is a reserved word, hence the plural. Order items keep a copy of the
+-- album's title, artist and price at checkout, and outlive the album.
+CREATE TABLE orders
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    customer_id INTEGER,
+    status      VARCHAR(16)                       NOT NULL,
+    currency    CHAR(3)                           NOT NULL,
+    total       DECIMAL(12, 3)                    NOT NULL,
+    created_at  TIMESTAMP                         NOT NULL,
+    updated_at  TIMESTAMP                         NOT NULL
+);
+
+CREATE INDEX orders_customer ON orders (customer_id, id);
+
+CREATE TABLE order_item
+(
+    id       INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    order_id INTEGER                           NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    album_id INTEGER                           REFERENCES album (id) ON DELETE SET NULL,
+    title    VARCHAR(128)                      NOT NULL,
+    artist   VARCHAR(255)                      NOT NULL,
+    quantity INTEGER                           NOT NULL,
+    price    DECIMAL(12, 3)                    NOT NULL
+);
+
+CREATE INDEX order_item_order ON order_item (order_id);
@@ -0,0 +1,28 @@
+-- A wishlist belongs to a customer or, for anonymous callers, to whoever
+-- holds its owner token, of which only the SHA-256 is stored. share_nonce is
+-- part of the signed share link, and clearing or replacing it revokes the link.
+CREATE TABLE wishlist
+(
+    id               INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    customer_id      INTEGER REFERENCES customer (id) ON DELETE CASCADE,
+    owner_token_hash CHAR(64),
+    share_nonce      CHAR(32),
+    created_at       TIMESTAMP                         NOT NULL
+);
+
+CREATE UNIQUE INDEX wishlist_customer_unique ON wishlist (customer_id);
+CREATE UNIQUE INDEX wishlist_owner_token ON wishlist (owner_token_hash);
+
+-- Items keep the album's title and artist so that they can still be shown
+-- once the album is deleted.
+CREATE TABLE wishlist_item
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    wishlist_id INTEGER                           NOT NULL REFERENCES wishlist (id) ON DELETE CASCADE,
+    album_id    INTEGER                           REFERENCES album (id) ON DELETE SET NULL,
+    title       VARCHAR(128)                      NOT NULL,
+    artist      VARCHAR(255)                      NOT NULL,
+    added_at    TIMESTAMP                         NOT NULL
+);
+
+CREATE UNIQUE INDEX wishlist_item_unique ON wishlist_item (wishlist_id, album_id);
@@ -0,0 +1,6 @@
+DROP INDEX album_rating;
+ALTER TABLE album DROP COLUMN review_count;
+ALTER TABLE album DROP COLUMN rating_total;
+ALTER TABLE album DROP COLUMN average_rating;
+
+DROP TABLE review;
@@ -0,0 +1,24 @@
+-- Reviews are one per customer and album. They outlive the customer's
+-- account, so the album's rating does not change when an account is deleted.
+CREATE TABLE review
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    album_id    INTEGER                           NOT NULL REFERENCES album (id) ON DELETE CASCADE,
+    customer_id INTEGER                           REFERENCES customer (id) ON DELETE SET NULL,
+    rating      INTEGER                           NOT NULL,
+    body        TEXT                              NOT NULL,
+    created_at  TIMESTAMP                         NOT NULL,
+    updated_at  TIMESTAMP                         NOT NULL
+);
+
+CREATE UNIQUE INDEX review_customer_unique ON review (album_id, customer_id);
+CREATE INDEX review_album_id ON review (album_id, id);
+
+-- The rating columns are kept up to date as reviews are written, so that
+-- listings neither aggregate reviews nor need them to sort by rating. An
+-- average of 0 means the album has no reviews.
+ALTER TABLE album ADD COLUMN review_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE album ADD COLUMN rating_total INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE album ADD COLUMN average_rating DECIMAL(3, 2) NOT NULL DEFAULT 0;
+
+CREATE INDEX album_rating ON album (average_rating, id);
@@ -0,0 +1,3 @@
+-- Counts the changes to an album, for the ETag its If-Match requests are
+-- checked against.
+ALTER TABLE album ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
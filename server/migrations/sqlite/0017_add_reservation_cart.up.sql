@@ -0,0 +1,6 @@
+-- Reservations made for a cart are taken off the stock when it is checked
+-- out. They are left to expire when the cart is deleted instead, so the cart
+-- is not referenced by a foreign key.
+ALTER TABLE reservation ADD COLUMN cart_id CHAR(32) NULL;
+
+CREATE INDEX reservation_cart ON reservation (cart_id);
@@ -0,0 +1,2 @@
+DROP INDEX reservation_customer;
+ALTER TABLE reservation DROP COLUMN customer_id;
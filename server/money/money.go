@@ -0,0 +1,227 @@
+// Package money represents monetary amounts exactly, as a whole number of
+// minor units (cents for USD) in an ISO 4217 currency.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrSyntax    = errors.New("money: amount is not a decimal number")
+	ErrPrecision = errors.New("money: amount has more decimal places than the currency allows")
+	ErrRange     = errors.New("money: amount is out of range")
+	ErrCurrency  = errors.New("money: unsupported currency")
+)
+
+// exponents maps supported ISO 4217 codes to their number of minor unit digits.
+var exponents = map[string]int{
+	"AUD": 2,
+	"BHD": 3,
+	"CAD": 2,
+	"CHF": 2,
+	"CNY": 2,
+	"DKK": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"HKD": 2,
+	"INR": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"MXN": 2,
+	"NOK": 2,
+	"NZD": 2,
+	"SEK": 2,
+	"SGD": 2,
+	"USD": 2,
+	"ZAR": 2,
+}
+
+// Exponent returns the number of minor unit digits of currency, and whether
+// the currency is supported.
+func Exponent(currency string) (int, bool) {
+	exponent, ok := exponents[currency]
+
+	return exponent, ok
+}
+
+type Money struct {
+	// Amount is the number of minor units, e.g. 5699 for 56.99 USD.
+	Amount   int64
+	Currency string
+}
+
+// New returns amount minor units of currency.
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Parse reads a decimal amount such as "56.99" in currency. It never goes
+// through floating point, so the result is exact or an error.
+func Parse(s string, currency string) (Money, error) {
+	exponent, ok := Exponent(currency)
+	if !ok {
+		return Money{}, ErrCurrency
+	}
+
+	amount, err := parseDecimal(s, exponent)
+	if err != nil {
+		return Money{}, err
+	}
+
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// MustParse is like Parse but panics on error. It is meant for constants and tests.
+func MustParse(s string, currency string) Money {
+	m, err := Parse(s, currency)
+	if err != nil {
+		panic(err)
+	}
+
+	return m
+}
+
+func parseDecimal(s string, exponent int) (int64, error) {
+	s = strings.TrimSpace(s)
+
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" && fraction == "" || !digits(whole) || !digits(fraction) {
+		return 0, ErrSyntax
+	}
+
+	// Trailing zeros past the currency's precision are harmless, e.g. "17.990".
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > exponent {
+		return 0, ErrPrecision
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	if whole == "" {
+		whole = "0"
+	}
+
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, ErrRange
+	}
+
+	if negative {
+		amount = -amount
+	}
+
+	return amount, nil
+}
+
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String formats the amount as a plain decimal with the currency's number
+// of minor digits, e.g. "56.99". The currency code is not included.
+func (m Money) String() string {
+	exponent, ok := Exponent(m.Currency)
+	if !ok {
+		exponent = 2
+	}
+
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	if exponent == 0 {
+		return sign + strconv.FormatInt(amount, 10)
+	}
+
+	unit := int64(math.Pow10(exponent))
+
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/unit, exponent, amount%unit)
+}
+
+// Rescale returns the amount expressed with exponent minor digits, and false
+// if that would lose precision or overflow an int64.
+func (m Money) Rescale(exponent int) (int64, bool) {
+	current, ok := Exponent(m.Currency)
+	if !ok {
+		return 0, false
+	}
+
+	if exponent >= current {
+		unit := int64(math.Pow10(exponent - current))
+		if m.Amount > math.MaxInt64/unit || m.Amount < math.MinInt64/unit {
+			return 0, false
+		}
+
+		return m.Amount * unit, true
+	}
+
+	unit := int64(math.Pow10(current - exponent))
+	if m.Amount%unit != 0 {
+		return 0, false
+	}
+
+	return m.Amount / unit, true
+}
+
+// MarshalJSON writes the amount as a decimal string so clients never see a
+// binary floating point approximation.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(m.String())), nil
+}
+
+// Value stores the amount as a decimal string, which DECIMAL columns accept
+// exactly. The currency is stored in its own column.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan reads a DECIMAL column into the amount. The currency must already be
+// set, so select the currency column before the amount.
+func (m *Money) Scan(src any) error {
+	exponent, ok := Exponent(m.Currency)
+	if !ok {
+		return fmt.Errorf("scan %q amount: %w", m.Currency, ErrCurrency)
+	}
+
+	var text string
+	switch v := src.(type) {
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	case int64:
+		text = strconv.FormatInt(v, 10)
+	case float64:
+		// SQLite keeps DECIMAL columns as REAL. Amounts were written as exact
+		// decimal strings, so the shortest representation recovers them.
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Errorf("scan amount: unsupported type %T", src)
+	}
+
+	amount, err := parseDecimal(text, exponent)
+	if err != nil {
+		return fmt.Errorf("scan amount %q: %w", text, err)
+	}
+
+	m.Amount = amount
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		currency string
+		expected int64
+		err      error
+	}{
+		{"56.99", "USD", 5699, nil},
+		{"56.9", "USD", 5690, nil},
+		{"17.990", "USD", 1799, nil},
+		{".5", "EUR", 50, nil},
+		{"10", "USD", 1000, nil},
+		{"-3.25", "USD", -325, nil},
+		{"1000", "JPY", 1000, nil},
+		{"1.234", "BHD", 1234, nil},
+		{"9.999", "USD", 0, ErrPrecision},
+		{"10.5", "JPY", 0, ErrPrecision},
+		{"abc", "USD", 0, ErrSyntax},
+		{"1e3", "USD", 0, ErrSyntax},
+		{"", "USD", 0, ErrSyntax},
+		{".", "USD", 0, ErrSyntax},
+		{"99999999999999999999", "USD", 0, ErrRange},
+		{"1.00", "XYZ", 0, ErrCurrency},
+	}
+
+	for _, tt := range tests {
+		m, err := Parse(tt.input, tt.currency)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q, %q) error = %v, want %v", tt.input, tt.currency, err, tt.err)
+			continue
+		}
+
+		if err == nil && (m.Amount != tt.expected || m.Currency != tt.currency) {
+			t.Errorf("Parse(%q, %q) = %+v, want %v %v", tt.input, tt.currency, m, tt.expected, tt.currency)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := map[Money]string{
+		New(5699, "USD"): "56.99",
+		New(5, "USD"):    "0.05",
+		New(-325, "EUR"): "-3.25",
+		New(1000, "JPY"): "1000",
+		New(1234, "BHD"): "1.234",
+	}
+
+	for m, expected := range tests {
+		if actual := m.String(); actual != expected {
+			t.Errorf("%+v.String() = %v, want %v", m, actual, expected)
+		}
+	}
+}
+
+func TestRescale(t *testing.T) {
+	if cents, ok := New(1000, "JPY").Rescale(2); !ok || cents != 100000 {
+		t.Errorf("Expected 1000 JPY to be 100000 hundredths, got %v %v", cents, ok)
+	}
+
+	if cents, ok := New(1230, "BHD").Rescale(2); !ok || cents != 123 {
+		t.Errorf("Expected 1.230 BHD to be 123 hundredths, got %v %v", cents, ok)
+	}
+
+	if _, ok := New(1234, "BHD").Rescale(2); ok {
+		t.Error("Expected 1.234 BHD not to fit in hundredths")
+	}
+
+	for _, amount := range []int64{math.MaxInt64, 184467440737095517, -184467440737095517} {
+		if cents, ok := New(amount, "JPY").Rescale(2); ok {
+			t.Errorf("Expected %v JPY to overflow hundredths, got %v", amount, cents)
+		}
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	data, err := json.Marshal(map[string]Money{"price": New(5699, "USD")})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if string(data) != `{"price":"56.99"}` {
+		t.Errorf("Unexpected JSON %s", data)
+	}
+}
+
+func TestScan(t *testing.T) {
+	for _, src := range []any{[]byte("56.99"), "56.99", 56.99, float64(56.99)} {
+		m := Money{Currency: "USD"}
+		if err := m.Scan(src); err != nil || m.Amount != 5699 {
+			t.Errorf("Scan(%#v) = %+v, %v", src, m, err)
+		}
+	}
+
+	m := Money{Currency: "JPY"}
+	if err := m.Scan(int64(1000)); err != nil || m.Amount != 1000 {
+		t.Errorf("Scan(1000) = %+v, %v", m, err)
+	}
+
+	if err := (&Money{}).Scan("56.99"); !errors.Is(err, ErrCurrency) {
+		t.Errorf("Expected ErrCurrency without a currency, got %v", err)
+	}
+
+	if err := (&Money{Currency: "USD"}).Scan(true); err == nil {
+		t.Error("Expected an error for an unsupported type")
+	}
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+
+	"go-web-service/blob"
+)
+
+// BlobStoreInit returns the blob store selected by BLOB_STORE. Blobs are
+// kept below the directory at BLOB_PATH (defaulting to "blobs") when the
+// variable is unset or "fs", and "s3" keeps them in the S3_BUCKET bucket of
+// the S3-compatible service at S3_ENDPOINT.
+func BlobStoreInit() (blob.Store, error) {
+	switch store := os.Getenv("BLOB_STORE"); store {
+	case "", "fs":
+		path := os.Getenv("BLOB_PATH")
+		if path == "" {
+			path = "blobs"
+		}
+
+		return blob.Dir{Path: path}, nil
+	case "s3":
+		region := os.Getenv("S3_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+
+		s3 := blob.S3{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			Region:          region,
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		}
+		if s3.Endpoint == "" || s3.Bucket == "" {
+			return nil, fmt.Errorf("BLOB_STORE s3 needs S3_ENDPOINT and S3_BUCKET")
+		}
+
+		return s3, nil
+	default:
+		return nil, fmt.Errorf("unsupported BLOB_STORE %q", store)
+	}
+}
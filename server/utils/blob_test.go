@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"testing"
+
+	"go-web-service/blob"
+)
+
+func TestBlobStoreInit(t *testing.T) {
+	tests := []struct {
+		env      map[string]string
+		expected blob.Store
+		err      string
+	}{
+		{map[string]string{}, blob.Dir{Path: "blobs"}, ""},
+		{map[string]string{"BLOB_STORE": "fs", "BLOB_PATH": "/var/covers"}, blob.Dir{Path: "/var/covers"}, ""},
+		{
+			map[string]string{"BLOB_STORE": "s3", "S3_ENDPOINT": "http://minio:9000", "S3_BUCKET": "covers", "S3_ACCESS_KEY_ID": "key", "S3_SECRET_ACCESS_KEY": "secret"},
+			blob.S3{Endpoint: "http://minio:9000", Bucket: "covers", Region: "us-east-1", AccessKeyID: "key", SecretAccessKey: "secret"},
+			"",
+		},
+		{map[string]string{"BLOB_STORE": "s3", "S3_BUCKET": "covers"}, nil, "BLOB_STORE s3 needs S3_ENDPOINT and S3_BUCKET"},
+		{map[string]string{"BLOB_STORE": "ftp"}, nil, `unsupported BLOB_STORE "ftp"`},
+	}
+
+	for _, tt := range tests {
+		for _, name := range []string{"BLOB_STORE", "BLOB_PATH", "S3_ENDPOINT", "S3_BUCKET", "S3_REGION", "S3_ACCESS_KEY_ID", "S3_SECRET_ACCESS_KEY"} {
+			t.Setenv(name, tt.env[name])
+		}
+
+		store, err := BlobStoreInit()
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Expected error %q for %v, got %v", tt.err, tt.env, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Expected no error for %v, got %v", tt.env, err)
+		}
+		if store != tt.expected {
+			t.Errorf("Unexpected store for %v: got %#v want %#v", tt.env, store, tt.expected)
+		}
+	}
+}
@@ -2,14 +2,44 @@ package utils
 
 import (
 	"database/sql"
+	"fmt"
+	"net/url"
 	"os"
 
 	"github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
 )
 
 var sqlOpen = sql.Open
 
+// DatabaseDriver returns the driver selected by DATABASE_DRIVER, defaulting to "mysql".
+func DatabaseDriver() string {
+	if driver := os.Getenv("DATABASE_DRIVER"); driver != "" {
+		return driver
+	}
+
+	return "mysql"
+}
+
+// DatabaseInit connects to the database selected by DATABASE_DRIVER. MySQL is
+// used when the variable is unset, "postgres" connects using the same
+// DATABASE_* settings, and "sqlite" opens the file at DATABASE_PATH. The
+// schema itself is managed by the migrations package.
 func DatabaseInit() (*sql.DB, error) {
+	switch driver := DatabaseDriver(); driver {
+	case "mysql":
+		return mysqlInit()
+	case "postgres":
+		return postgresInit()
+	case "sqlite":
+		return sqliteInit()
+	default:
+		return nil, fmt.Errorf("unsupported DATABASE_DRIVER %q", driver)
+	}
+}
+
+func mysqlInit() (*sql.DB, error) {
 	config := mysql.Config{
 		User:                 os.Getenv("DATABASE_USER"),
 		Passwd:               os.Getenv("DATABASE_PASSWORD"),
@@ -19,7 +49,46 @@ func DatabaseInit() (*sql.DB, error) {
 		AllowNativePasswords: true,
 	}
 
-	db, err := sqlOpen("mysql", config.FormatDSN())
+	return open("mysql", config.FormatDSN())
+}
+
+func postgresInit() (*sql.DB, error) {
+	sslMode := os.Getenv("DATABASE_SSLMODE")
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(os.Getenv("DATABASE_USER"), os.Getenv("DATABASE_PASSWORD")),
+		Host:     os.Getenv("DATABASE_ADDRESS") + ":" + os.Getenv("DATABASE_PORT"),
+		Path:     os.Getenv("DATABASE_NAME"),
+		RawQuery: url.Values{"sslmode": {sslMode}}.Encode(),
+	}
+
+	return open("pgx", dsn.String())
+}
+
+func sqliteInit() (*sql.DB, error) {
+	path := os.Getenv("DATABASE_PATH")
+	if path == "" {
+		path = "recordings.db"
+	}
+
+	db, err := open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows one writer at a time, so serialise access through a
+	// single connection rather than surfacing SQLITE_BUSY to handlers.
+	db.SetMaxOpenConns(1)
+
+	return db, nil
+}
+
+func open(driver, dsn string) (*sql.DB, error) {
+	db, err := sqlOpen(driver, dsn)
 	if err != nil {
 		return nil, err
 	}
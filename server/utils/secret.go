@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+)
+
+// minShareKeyLength is the shortest SHARE_LINK_SECRET accepted.
+const minShareKeyLength = 32
+
+// ShareKeyInit returns the key wishlist share links are signed with, from
+// SHARE_LINK_SECRET. A random key is used when the variable is unset, so that
+// links then only work until the server restarts.
+func ShareKeyInit() ([]byte, error) {
+	secret := os.Getenv("SHARE_LINK_SECRET")
+	if secret == "" {
+		key := make([]byte, minShareKeyLength)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+
+		return key, nil
+	}
+
+	if len(secret) < minShareKeyLength {
+		return nil, fmt.Errorf("SHARE_LINK_SECRET must be at least %d characters", minShareKeyLength)
+	}
+
+	return []byte(secret), nil
+}
+
+// minStaffTokenLength is the shortest STAFF_TOKEN accepted.
+const minStaffTokenLength = 32
+
+// StaffTokenInit returns the bearer token staff authenticate with, from
+// STAFF_TOKEN. It is empty when the variable is unset, and nobody can then
+// act as staff.
+func StaffTokenInit() (string, error) {
+	token := os.Getenv("STAFF_TOKEN")
+	if token != "" && len(token) < minStaffTokenLength {
+		return "", fmt.Errorf("STAFF_TOKEN must be at least %d characters", minStaffTokenLength)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestShareKeyInit(t *testing.T) {
+	secret := strings.Repeat("s", 32)
+	t.Setenv("SHARE_LINK_SECRET", secret)
+	if key, err := ShareKeyInit(); err != nil || string(key) != secret {
+		t.Errorf("Expected the configured key, got %q, %v", key, err)
+	}
+
+	t.Setenv("SHARE_LINK_SECRET", "short")
+	if _, err := ShareKeyInit(); err == nil || err.Error() != "SHARE_LINK_SECRET must be at least 32 characters" {
+		t.Errorf("Expected a short secret to be refused, got %v", err)
+	}
+
+	t.Setenv("SHARE_LINK_SECRET", "")
+	first, err := ShareKeyInit()
+	if err != nil || len(first) != 32 {
+		t.Fatalf("Expected a random key, got %q, %v", first, err)
+	}
+	if second, _ := ShareKeyInit(); bytes.Equal(first, second) {
+		t.Errorf("Expected random keys to differ")
+	}
+}
+
+func TestStaffTokenInit(t *testing.T) {
+	token := strings.Repeat("t", 32)
+	t.Setenv("STAFF_TOKEN", token)
+	if actual, err := StaffTokenInit(); err != nil || actual != token {
+		t.Errorf("Expected the configured token, got %q, %v", actual, err)
+	}
+
+	t.Setenv("STAFF_TOKEN", "short")
+	if _, err := StaffTokenInit(); err == nil || err.Error() != "STAFF_TOKEN must be at least 32 characters" {
+		t.Errorf("Expected a short token to be refused, got %v", err)
+	}
+
+	t.Setenv("STAFF_TOKEN", "")
+	if actual, err := StaffTokenInit(); err != nil || actual != "" {
+		t.Errorf("Expected no token, got %q, %v", actual, err)
+	}
+}
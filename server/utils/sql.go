@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Rebind rewrites the ? placeholders in query into the form driver expects.
+// MySQL and SQLite accept ? as is; PostgreSQL needs numbered $n placeholders.
+func Rebind(driver, query string) string {
+	if driver != "postgres" {
+		return query
+	}
+
+	var rebound strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			rebound.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+
+		rebound.WriteRune(r)
+	}
+
+	return rebound.String()
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// defaultTrashRetention is how long deleted albums stay in the trash when
+// TRASH_RETENTION is unset.
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+// TrashRetentionInit returns how long deleted albums can be restored from
+// the trash before they are purged, from TRASH_RETENTION, a duration such as
+// 720h.
+func TrashRetentionInit() (time.Duration, error) {
+	value := os.Getenv("TRASH_RETENTION")
+	if value == "" {
+		return defaultTrashRetention, nil
+	}
+
+	retention, err := time.ParseDuration(value)
+	if err != nil || retention <= 0 {
+		return 0, fmt.Errorf("TRASH_RETENTION must be a positive duration such as 720h, got %q", value)
+	}
+
+	return retention, nil
+}
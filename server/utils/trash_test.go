@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrashRetentionInit(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+		valid    bool
+	}{
+		{"", 720 * time.Hour, true},
+		{"48h", 48 * time.Hour, true},
+		{"90m", 90 * time.Minute, true},
+		{"0s", 0, false},
+		{"-1h", 0, false},
+		{"30d", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("TRASH_RETENTION", tt.value)
+
+		retention, err := TrashRetentionInit()
+		if (err == nil) != tt.valid || retention != tt.expected {
+			t.Errorf("TrashRetentionInit() with %q = %v, %v, want %v", tt.value, retention, err, tt.expected)
+		}
+	}
+}